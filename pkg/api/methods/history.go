@@ -28,6 +28,7 @@ func HandleHistory(env requests.RequestEnv) (any, error) {
 			Text:    e.Text,
 			Data:    e.Data,
 			Success: e.Success,
+			Figure:  e.Figure,
 		}
 	}
 
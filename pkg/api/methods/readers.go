@@ -1,13 +1,198 @@
 package methods
 
 import (
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"sort"
+	"strings"
+	"time"
+
 	"github.com/ZaparooProject/zaparoo-core/pkg/api/models"
 	"github.com/ZaparooProject/zaparoo-core/pkg/api/models/requests"
+	"github.com/ZaparooProject/zaparoo-core/pkg/config"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/ntag"
+	"github.com/ZaparooProject/zaparoo-core/pkg/utils"
 	"github.com/rs/zerolog/log"
 )
 
+// Return the driver ID of a reader for a device string, falling back to the
+// reader's primary ID if the device prefix isn't recognised.
+func readerDriver(device string, r readers.Reader) string {
+	ids := r.Ids()
+	ps := strings.SplitN(device, ":", 2)
+	if utils.Contains(ids, ps[0]) {
+		return ps[0]
+	}
+	if len(ids) > 0 {
+		return ids[0]
+	}
+	return ""
+}
+
+func HandleReaders(env requests.RequestEnv) (any, error) {
+	log.Info().Msg("received readers request")
+
+	rs := env.State.ListReaders()
+	sort.Strings(rs)
+
+	resp := models.ReadersResponse{
+		Readers:   make([]models.ReaderDetailsResponse, 0),
+		Conflicts: make([]models.ReaderConflictResponse, 0),
+	}
+
+	for _, device := range rs {
+		r, ok := env.State.GetReader(device)
+		if !ok || r == nil {
+			continue
+		}
+
+		caps := r.Capabilities()
+		tagTypes := caps.TagTypes
+		if tagTypes == nil {
+			tagTypes = make([]string, 0)
+		}
+
+		rd := models.ReaderDetailsResponse{
+			Driver:    readerDriver(device, r),
+			Ids:       r.Ids(),
+			Connected: r.Connected(),
+			Device:    device,
+			Info:      r.Info(),
+			Capabilities: models.ReaderCapabilitiesResponse{
+				Write:    caps.Write,
+				Removal:  caps.Removal,
+				TagTypes: tagTypes,
+			},
+		}
+
+		stats, ok := env.State.GetReaderStats(device)
+		if ok {
+			rd.Uptime = int(time.Since(stats.ConnectedAt).Seconds())
+			rd.Scans = stats.Scans
+			rd.Errors = stats.Errors
+			rd.LastError = stats.LastError
+			if !stats.LastErrorTime.IsZero() {
+				errTime := stats.LastErrorTime
+				rd.LastErrorTime = &errTime
+			}
+		}
+
+		resp.Readers = append(resp.Readers, rd)
+	}
+
+	for _, c := range env.State.ListReaderConflicts() {
+		resp.Conflicts = append(resp.Conflicts, models.ReaderConflictResponse{
+			Device: c.Device,
+			Path:   c.Path,
+			HeldBy: c.HeldBy,
+		})
+	}
+
+	return resp, nil
+}
+
+func HandleReadersConnect(env requests.RequestEnv) (any, error) {
+	log.Info().Msg("received readers connect request")
+
+	if len(env.Params) == 0 {
+		return nil, ErrMissingParams
+	}
+
+	var params models.ReaderDeviceParams
+	err := json.Unmarshal(env.Params, &params)
+	if err != nil {
+		return nil, ErrInvalidParams
+	}
+
+	ps := strings.SplitN(params.Device, ":", 2)
+	if len(ps) != 2 {
+		return nil, errors.New("invalid device string: " + params.Device)
+	}
+
+	supported := false
+	for _, r := range env.Platform.SupportedReaders(env.Config) {
+		if utils.Contains(r.Ids(), ps[0]) {
+			supported = true
+			break
+		}
+	}
+	if !supported {
+		return nil, errors.New("unsupported reader driver: " + ps[0])
+	}
+
+	if _, ok := env.State.GetReader(params.Device); ok {
+		return nil, errors.New("reader already connected: " + params.Device)
+	}
+
+	env.State.ConnectReader(params.Device)
+
+	return nil, nil
+}
+
+func HandleReadersDisconnect(env requests.RequestEnv) (any, error) {
+	log.Info().Msg("received readers disconnect request")
+
+	if len(env.Params) == 0 {
+		return nil, ErrMissingParams
+	}
+
+	var params models.ReaderDeviceParams
+	err := json.Unmarshal(env.Params, &params)
+	if err != nil {
+		return nil, ErrInvalidParams
+	}
+
+	if _, ok := env.State.GetReader(params.Device); !ok {
+		return nil, errors.New("reader not connected: " + params.Device)
+	}
+
+	env.State.DisconnectReader(params.Device)
+
+	return nil, nil
+}
+
+// Validate and decode the token protection options of a write request.
+func writeOptions(params models.ReaderWriteParams) (readers.WriteOptions, error) {
+	opts := readers.WriteOptions{
+		Lock: params.Lock,
+	}
+
+	if params.Password != nil && *params.Password != "" {
+		pwd, err := hex.DecodeString(*params.Password)
+		if err != nil || len(pwd) != 4 {
+			return opts, errors.New("password must be 4 hex encoded bytes")
+		}
+		opts.Password = pwd
+	}
+
+	if params.Pack != nil && *params.Pack != "" {
+		if len(opts.Password) == 0 {
+			return opts, errors.New("pack requires a password")
+		}
+
+		pack, err := hex.DecodeString(*params.Pack)
+		if err != nil || len(pack) != 2 {
+			return opts, errors.New("pack must be 2 hex encoded bytes")
+		}
+		opts.Pack = pack
+	}
+
+	if params.ProtectFrom != nil {
+		if len(opts.Password) == 0 {
+			return opts, errors.New("protect from page requires a password")
+		}
+
+		if *params.ProtectFrom < ntag.FirstUserPage || *params.ProtectFrom > 0xFE {
+			return opts, errors.New("invalid protect from page")
+		}
+		opts.ProtectFrom = byte(*params.ProtectFrom)
+	}
+
+	return opts, nil
+}
+
 func HandleReaderWrite(env requests.RequestEnv) (any, error) {
 	log.Info().Msg("received reader write request")
 
@@ -21,27 +206,92 @@ func HandleReaderWrite(env requests.RequestEnv) (any, error) {
 		return nil, ErrInvalidParams
 	}
 
+	opts, err := writeOptions(params)
+	if err != nil {
+		return nil, err
+	}
+
 	rs := env.State.ListReaders()
 	if len(rs) == 0 {
 		return nil, errors.New("no readers connected")
 	}
 
-	rid := rs[0]
-	lt := env.State.GetLastScanned()
+	// only readers which can write are picked automatically
+	writable := make([]string, 0, len(rs))
+	for _, device := range rs {
+		r, ok := env.State.GetReader(device)
+		if ok && r != nil && r.Capabilities().Write {
+			writable = append(writable, device)
+		}
+	}
+
+	var rid string
+	if params.Device != nil && *params.Device != "" {
+		// an explicit target always takes precedence
+		rid = *params.Device
+	} else {
+		if len(writable) == 0 {
+			return nil, errors.New("no connected readers support writing")
+		}
+		rid = writable[0]
 
-	if !lt.ScanTime.IsZero() && !lt.Remote {
-		rid = lt.Source
+		lt := env.State.GetLastScanned()
+		if !lt.ScanTime.IsZero() && !lt.Remote && utils.Contains(writable, lt.Source) {
+			rid = lt.Source
+		}
+
+		// dedicated write station readers take precedence
+		for _, device := range writable {
+			if env.Config.GetReaderRole(device) == config.ReaderRoleWrite {
+				rid = device
+				break
+			}
+		}
 	}
 
 	reader, ok := env.State.GetReader(rid)
 	if !ok || reader == nil {
-		return nil, errors.New("reader not connected: " + rs[0])
+		return nil, errors.New("reader not connected: " + rid)
+	} else if !reader.Capabilities().Write {
+		return nil, errors.New("reader does not support writing: " + rid)
+	}
+
+	failed := false
+	status := func(ws readers.WriteStatus) {
+		log.Debug().Msgf("write status for %s: %s", ws.Device, ws.Status)
+
+		resp := models.ReaderWritingResponse{
+			Device: ws.Device,
+			Status: ws.Status,
+		}
+
+		if ws.Status == readers.WriteStatusFailed {
+			failed = true
+			if ws.Error != nil {
+				resp.Error = ws.Error.Error()
+			}
+		}
+
+		env.State.Notifications <- models.Notification{
+			Method: models.ReadersWriting,
+			Params: resp,
+		}
 	}
 
-	t, err := reader.Write(params.Text)
+	t, err := reader.Write(params.Text, opts, status)
 	if err != nil {
 		log.Error().Err(err).Msg("error writing to reader")
-		return nil, errors.New("error writing to reader")
+
+		// not all readers report their own failures
+		if !failed {
+			status(readers.WriteStatus{
+				Device: rid,
+				Status: readers.WriteStatusFailed,
+				Error:  err,
+			})
+		}
+
+		return nil, errors.New("error writing to reader: " + err.Error())
 	}
 
 	if t != nil {
@@ -50,3 +300,31 @@ func HandleReaderWrite(env requests.RequestEnv) (any, error) {
 
 	return nil, nil
 }
+
+func HandleReaderWriteCancel(env requests.RequestEnv) (any, error) {
+	log.Info().Msg("received reader write cancel request")
+
+	var params models.ReaderWriteCancelParams
+	if len(env.Params) > 0 {
+		err := json.Unmarshal(env.Params, &params)
+		if err != nil {
+			return nil, ErrInvalidParams
+		}
+	}
+
+	rs := env.State.ListReaders()
+	if params.Device != nil && *params.Device != "" {
+		rs = []string{*params.Device}
+	}
+
+	for _, device := range rs {
+		reader, ok := env.State.GetReader(device)
+		if !ok || reader == nil {
+			return nil, errors.New("reader not connected: " + device)
+		}
+
+		reader.CancelWrite()
+	}
+
+	return nil, nil
+}
@@ -56,6 +56,7 @@ func newStatus(
 			Text:     active.Text,
 			Data:     active.Data,
 			ScanTime: active.ScanTime,
+			Figure:   active.Figure,
 		},
 		LastToken: models.TokenResponse{
 			Type:     last.Type,
@@ -63,6 +64,7 @@ func newStatus(
 			Text:     last.Text,
 			Data:     last.Data,
 			ScanTime: last.ScanTime,
+			Figure:   last.Figure,
 		},
 		GamesIndex: models.IndexResponse{
 			Exists:      IndexInstance.Exists(pl),
@@ -0,0 +1,168 @@
+package methods
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/ZaparooProject/zaparoo-core/pkg/api/models"
+	"github.com/ZaparooProject/zaparoo-core/pkg/api/models/requests"
+	"github.com/ZaparooProject/zaparoo-core/pkg/database"
+	"github.com/rs/zerolog/log"
+)
+
+func HandleWebhooks(env requests.RequestEnv) (any, error) {
+	log.Info().Msg("received webhooks request")
+
+	webhooks, err := env.Database.GetAllWebhooks()
+	if err != nil {
+		log.Error().Err(err).Msg("error getting webhooks")
+		return nil, errors.New("error getting webhooks")
+	}
+
+	wrs := make([]models.WebhookResponse, 0)
+
+	for _, w := range webhooks {
+		events := w.Events
+		if events == nil {
+			events = make([]string, 0)
+		}
+
+		wrs = append(wrs, models.WebhookResponse{
+			Id:        w.Id,
+			Added:     time.Unix(w.Added, 0).Format(time.RFC3339),
+			Label:     w.Label,
+			Enabled:   w.Enabled,
+			Url:       w.Url,
+			Events:    events,
+			HasSecret: w.Secret != "",
+		})
+	}
+
+	return models.AllWebhooksResponse{
+		Webhooks: wrs,
+	}, nil
+}
+
+func HandleAddWebhook(env requests.RequestEnv) (any, error) {
+	log.Info().Msg("received add webhook request")
+
+	if len(env.Params) == 0 {
+		return nil, ErrMissingParams
+	}
+
+	var params models.AddWebhookParams
+	err := json.Unmarshal(env.Params, &params)
+	if err != nil {
+		return nil, ErrInvalidParams
+	}
+
+	err = database.ValidateWebhookUrl(params.Url)
+	if err != nil {
+		log.Error().Err(err).Msg("invalid params")
+		return nil, ErrInvalidParams
+	}
+
+	w := database.Webhook{
+		Label:   params.Label,
+		Enabled: params.Enabled,
+		Url:     params.Url,
+		Events:  params.Events,
+		Secret:  params.Secret,
+	}
+
+	err = env.Database.AddWebhook(w)
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func HandleDeleteWebhook(env requests.RequestEnv) (any, error) {
+	log.Info().Msg("received delete webhook request")
+
+	if len(env.Params) == 0 {
+		return nil, ErrMissingParams
+	}
+
+	var params models.DeleteWebhookParams
+	err := json.Unmarshal(env.Params, &params)
+	if err != nil {
+		return nil, ErrInvalidParams
+	}
+
+	err = env.Database.DeleteWebhook(strconv.Itoa(params.Id))
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func validateUpdateWebhookParams(uwr *models.UpdateWebhookParams) error {
+	if uwr.Label == nil && uwr.Enabled == nil && uwr.Url == nil && uwr.Events == nil && uwr.Secret == nil {
+		return errors.New("missing fields")
+	}
+
+	if uwr.Url != nil {
+		return database.ValidateWebhookUrl(*uwr.Url)
+	}
+
+	return nil
+}
+
+func HandleUpdateWebhook(env requests.RequestEnv) (any, error) {
+	log.Info().Msg("received update webhook request")
+
+	if len(env.Params) == 0 {
+		return nil, ErrMissingParams
+	}
+
+	var params models.UpdateWebhookParams
+	err := json.Unmarshal(env.Params, &params)
+	if err != nil {
+		return nil, ErrInvalidParams
+	}
+
+	err = validateUpdateWebhookParams(&params)
+	if err != nil {
+		log.Error().Err(err).Msg("invalid params")
+		return nil, ErrInvalidParams
+	}
+
+	oldWebhook, err := env.Database.GetWebhook(strconv.Itoa(params.Id))
+	if err != nil {
+		return nil, err
+	}
+
+	newWebhook := oldWebhook
+
+	if params.Label != nil {
+		newWebhook.Label = *params.Label
+	}
+
+	if params.Enabled != nil {
+		newWebhook.Enabled = *params.Enabled
+	}
+
+	if params.Url != nil {
+		newWebhook.Url = *params.Url
+	}
+
+	if params.Events != nil {
+		newWebhook.Events = *params.Events
+	}
+
+	if params.Secret != nil {
+		newWebhook.Secret = *params.Secret
+	}
+
+	err = env.Database.UpdateWebhook(strconv.Itoa(params.Id), newWebhook)
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
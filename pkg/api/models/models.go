@@ -3,31 +3,43 @@ package models
 import "github.com/google/uuid"
 
 const (
-	ReadersConnected     = "readers.connected"
-	ReadersDisconnected  = "readers.disconnected"
-	TokensLaunching      = "tokens.launching"
-	TokensActive         = "tokens.active"
-	MediaStopped         = "media.stopped"
-	MediaStarted         = "media.started"
-	MediaIndexing        = "media.indexing"
-	MethodLaunch         = "launch"
-	MethodStop           = "stop"
-	MethodMediaIndex     = "media.index"
-	MethodMediaSearch    = "media.search"
-	MethodSettings       = "settings"
-	MethodSettingsUpdate = "settings.update"
-	MethodClients        = "clients"
-	MethodClientsNew     = "clients.new"
-	MethodClientsDelete  = "clients.delete"
-	MethodSystems        = "systems"
-	MethodHistory        = "tokens.history"
-	MethodMappings       = "mappings"
-	MethodMappingsNew    = "mappings.new"
-	MethodMappingsDelete = "mappings.delete"
-	MethodMappingsUpdate = "mappings.update"
-	MethodReadersWrite   = "readers.write"
-	MethodStatus         = "status"
-	MethodVersion        = "version"
+	ReadersConnected         = "readers.connected"
+	ReadersDisconnected      = "readers.disconnected"
+	ReadersWriting           = "readers.writing"
+	ReadersError             = "readers.error"
+	TokensLaunching          = "tokens.launching"
+	TokensActive             = "tokens.active"
+	TokensConfirm            = "tokens.confirm"
+	MediaStopped             = "media.stopped"
+	MediaStarted             = "media.started"
+	MediaIndexing            = "media.indexing"
+	SessionWarning           = "session.warning"
+	MethodLaunch             = "launch"
+	MethodStop               = "stop"
+	MethodMediaIndex         = "media.index"
+	MethodMediaSearch        = "media.search"
+	MethodSettings           = "settings"
+	MethodSettingsUpdate     = "settings.update"
+	MethodClients            = "clients"
+	MethodClientsNew         = "clients.new"
+	MethodClientsDelete      = "clients.delete"
+	MethodSystems            = "systems"
+	MethodHistory            = "tokens.history"
+	MethodMappings           = "mappings"
+	MethodMappingsNew        = "mappings.new"
+	MethodMappingsDelete     = "mappings.delete"
+	MethodMappingsUpdate     = "mappings.update"
+	MethodWebhooks           = "webhooks"
+	MethodWebhooksNew        = "webhooks.new"
+	MethodWebhooksDelete     = "webhooks.delete"
+	MethodWebhooksUpdate     = "webhooks.update"
+	MethodReaders            = "readers"
+	MethodReadersConnect     = "readers.connect"
+	MethodReadersDisconnect  = "readers.disconnect"
+	MethodReadersWrite       = "readers.write"
+	MethodReadersWriteCancel = "readers.write.cancel"
+	MethodStatus             = "status"
+	MethodVersion            = "version"
 )
 
 type Notification struct {
@@ -67,3 +79,16 @@ type MediaStartedParams struct {
 	MediaPath  string `json:"mediaPath"`
 	MediaName  string `json:"mediaName"`
 }
+
+type SessionWarningParams struct {
+	Remaining int `json:"remaining"`
+}
+
+// ReaderErrorParams reports a reader which failed to open or stopped
+// working. Retry is the number of seconds until it will be tried again.
+type ReaderErrorParams struct {
+	Device   string `json:"device"`
+	Error    string `json:"error"`
+	Failures int    `json:"failures"`
+	Retry    int    `json:"retry"`
+}
@@ -40,8 +40,43 @@ type UpdateMappingParams struct {
 	Override *string `json:"override"`
 }
 
+type AddWebhookParams struct {
+	Label   string   `json:"label"`
+	Enabled bool     `json:"enabled"`
+	Url     string   `json:"url"`
+	Events  []string `json:"events"`
+	Secret  string   `json:"secret"`
+}
+
+type DeleteWebhookParams struct {
+	Id int `json:"id"`
+}
+
+type UpdateWebhookParams struct {
+	Id      int       `json:"id"`
+	Label   *string   `json:"label"`
+	Enabled *bool     `json:"enabled"`
+	Url     *string   `json:"url"`
+	Events  *[]string `json:"events"`
+	Secret  *string   `json:"secret"`
+}
+
+type ReaderDeviceParams struct {
+	Device string `json:"device"`
+}
+
 type ReaderWriteParams struct {
-	Text string `json:"text"`
+	Text   string  `json:"text"`
+	Device *string `json:"device"`
+	// NTAG21x protection options, password and pack are hex encoded
+	Password    *string `json:"password"`
+	Pack        *string `json:"pack"`
+	ProtectFrom *int    `json:"protectFrom"`
+	Lock        bool    `json:"lock"`
+}
+
+type ReaderWriteCancelParams struct {
+	Device *string `json:"device"`
 }
 
 type UpdateSettingsParams struct {
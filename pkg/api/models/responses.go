@@ -2,6 +2,8 @@ package models
 
 import (
 	"time"
+
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/figures"
 )
 
 type SearchResultMedia struct {
@@ -53,6 +55,8 @@ type HistoryReponseEntry struct {
 	Text    string    `json:"text"`
 	Data    string    `json:"data"`
 	Success bool      `json:"success"`
+	// Figure is set if the token was a decoded toy figure.
+	Figure *figures.Figure `json:"figure,omitempty"`
 }
 
 type HistoryResponse struct {
@@ -74,12 +78,30 @@ type MappingResponse struct {
 	Override string `json:"override"`
 }
 
+type AllWebhooksResponse struct {
+	Webhooks []WebhookResponse `json:"webhooks"`
+}
+
+// WebhookResponse is a webhook without its secret, which can't be read back
+// once set.
+type WebhookResponse struct {
+	Id        string   `json:"id"`
+	Added     string   `json:"added"`
+	Label     string   `json:"label"`
+	Enabled   bool     `json:"enabled"`
+	Url       string   `json:"url"`
+	Events    []string `json:"events"`
+	HasSecret bool     `json:"hasSecret"`
+}
+
 type TokenResponse struct {
 	Type     string    `json:"type"`
 	UID      string    `json:"uid"`
 	Text     string    `json:"text"`
 	Data     string    `json:"data"`
 	ScanTime time.Time `json:"scanTime"`
+	// Figure is set if the token is a decoded toy figure.
+	Figure *figures.Figure `json:"figure,omitempty"`
 }
 
 type IndexResponse struct {
@@ -104,6 +126,43 @@ type ReaderResponse struct {
 	Info      string `json:"info"`
 }
 
+type ReaderCapabilitiesResponse struct {
+	Write    bool     `json:"write"`
+	Removal  bool     `json:"removal"`
+	TagTypes []string `json:"tagTypes"`
+}
+
+type ReaderDetailsResponse struct {
+	Driver        string                     `json:"driver"`
+	Ids           []string                   `json:"ids"`
+	Connected     bool                       `json:"connected"`
+	Device        string                     `json:"device"`
+	Info          string                     `json:"info"`
+	Capabilities  ReaderCapabilitiesResponse `json:"capabilities"`
+	Uptime        int                        `json:"uptime"`
+	Scans         int                        `json:"scans"`
+	Errors        int                        `json:"errors"`
+	LastError     string                     `json:"lastError,omitempty"`
+	LastErrorTime *time.Time                 `json:"lastErrorTime,omitempty"`
+}
+
+type ReaderConflictResponse struct {
+	Device string `json:"device"`
+	Path   string `json:"path"`
+	HeldBy string `json:"heldBy"`
+}
+
+type ReadersResponse struct {
+	Readers   []ReaderDetailsResponse  `json:"readers"`
+	Conflicts []ReaderConflictResponse `json:"conflicts"`
+}
+
+type ReaderWritingResponse struct {
+	Device string `json:"device"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
 type PlayingResponse struct {
 	System     string `json:"system"`
 	SystemName string `json:"systemName"`
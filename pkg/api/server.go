@@ -51,8 +51,17 @@ var methodMap = map[string]func(requests.RequestEnv) (any, error){
 	models.MethodMappingsNew:    methods.HandleAddMapping,
 	models.MethodMappingsDelete: methods.HandleDeleteMapping,
 	models.MethodMappingsUpdate: methods.HandleUpdateMapping,
+	// webhooks
+	models.MethodWebhooks:       methods.HandleWebhooks,
+	models.MethodWebhooksNew:    methods.HandleAddWebhook,
+	models.MethodWebhooksDelete: methods.HandleDeleteWebhook,
+	models.MethodWebhooksUpdate: methods.HandleUpdateWebhook,
 	// readers
-	models.MethodReadersWrite: methods.HandleReaderWrite,
+	models.MethodReaders:            methods.HandleReaders,
+	models.MethodReadersConnect:     methods.HandleReadersConnect,
+	models.MethodReadersDisconnect:  methods.HandleReadersDisconnect,
+	models.MethodReadersWrite:       methods.HandleReaderWrite,
+	models.MethodReadersWriteCancel: methods.HandleReaderWriteCancel,
 	// utils
 	models.MethodStatus:  methods.HandleStatus, // TODO: remove, convert to individual methods
 	models.MethodVersion: methods.HandleVersion,
@@ -128,64 +137,20 @@ func handleResponse(resp models.ResponseObject) error {
 	return nil
 }
 
-func Start(
+// newWebsocket returns the websocket server which handles API requests.
+// Messages from a session are handled concurrently, so a request which
+// blocks, like a write waiting for a tag, doesn't hold up the requests
+// after it, like cancelling that write.
+func newWebsocket(
 	pl platforms.Platform,
 	cfg *config.UserConfig,
 	st *state.State,
 	itq chan<- tokens.Token,
 	db *database.Database,
-	ns <-chan models.Notification,
-) {
-	r := chi.NewRouter()
-
-	r.Use(middleware.Recoverer)
-	r.Use(middleware.NoCache)
-	r.Use(middleware.Timeout(RequestTimeout))
-	r.Use(cors.Handler(cors.Options{
-		AllowedOrigins: []string{"https://*", "http://*", "capacitor://*"},
-		AllowedMethods: []string{"GET"},
-		AllowedHeaders: []string{"Accept"},
-		ExposedHeaders: []string{},
-	}))
-
+) *melody.Melody {
 	m := melody.New()
 	m.Upgrader.CheckOrigin = func(r *http.Request) bool { return true }
-
-	// consume and broadcast notifications
-	go func(ns <-chan models.Notification) {
-		for !st.ShouldStopService() {
-			select {
-			case n := <-ns:
-				ro := models.RequestObject{
-					JsonRpc: "2.0",
-					Method:  n.Method,
-					Params:  n.Params,
-				}
-
-				data, err := json.Marshal(ro)
-				if err != nil {
-					log.Error().Err(err).Msg("marshalling notification request")
-					continue
-				}
-
-				// TODO: this will not work with encryption
-				err = m.Broadcast(data)
-				if err != nil {
-					log.Error().Err(err).Msg("broadcasting notification")
-				}
-			case <-time.After(500 * time.Millisecond):
-				// TODO: better to wait on a stop channel?
-				continue
-			}
-		}
-	}(ns)
-
-	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
-		err := m.HandleRequest(w, r)
-		if err != nil {
-			log.Error().Err(err).Msg("handling websocket request")
-		}
-	})
+	m.Config.ConcurrentMessageHandling = true
 
 	m.HandleMessage(func(s *melody.Session, msg []byte) {
 		// ping command for heartbeat operation
@@ -261,6 +226,67 @@ func Start(
 		log.Error().Err(err).Msg("message does not match known types")
 	})
 
+	return m
+}
+
+func Start(
+	pl platforms.Platform,
+	cfg *config.UserConfig,
+	st *state.State,
+	itq chan<- tokens.Token,
+	db *database.Database,
+	ns <-chan models.Notification,
+) {
+	r := chi.NewRouter()
+
+	r.Use(middleware.Recoverer)
+	r.Use(middleware.NoCache)
+	r.Use(middleware.Timeout(RequestTimeout))
+	r.Use(cors.Handler(cors.Options{
+		AllowedOrigins: []string{"https://*", "http://*", "capacitor://*"},
+		AllowedMethods: []string{"GET"},
+		AllowedHeaders: []string{"Accept"},
+		ExposedHeaders: []string{},
+	}))
+
+	m := newWebsocket(pl, cfg, st, itq, db)
+
+	// consume and broadcast notifications
+	go func(ns <-chan models.Notification) {
+		for !st.ShouldStopService() {
+			select {
+			case n := <-ns:
+				ro := models.RequestObject{
+					JsonRpc: "2.0",
+					Method:  n.Method,
+					Params:  n.Params,
+				}
+
+				data, err := json.Marshal(ro)
+				if err != nil {
+					log.Error().Err(err).Msg("marshalling notification request")
+					continue
+				}
+
+				// TODO: this will not work with encryption
+				err = m.Broadcast(data)
+				if err != nil {
+					log.Error().Err(err).Msg("broadcasting notification")
+				}
+			case <-time.After(500 * time.Millisecond):
+				// TODO: better to wait on a stop channel?
+				continue
+			}
+		}
+	}(ns)
+
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		err := m.HandleRequest(w, r)
+		if err != nil {
+			log.Error().Err(err).Msg("handling websocket request")
+		}
+	})
+
 	// TODO: use allow list
 	r.Get("/l/*", methods.HandleLaunchBasic(st, itq))
 
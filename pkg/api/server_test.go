@@ -0,0 +1,151 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ZaparooProject/zaparoo-core/pkg/api/models"
+	"github.com/ZaparooProject/zaparoo-core/pkg/config"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers"
+	"github.com/ZaparooProject/zaparoo-core/pkg/service/state"
+	"github.com/ZaparooProject/zaparoo-core/pkg/service/tokens"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// blockingReader waits in Write until the write is cancelled, like a reader
+// waiting for a tag to be placed on it.
+type blockingReader struct {
+	cancel   chan struct{}
+	readOnly bool
+}
+
+func (r *blockingReader) Ids() []string                          { return []string{"test"} }
+func (r *blockingReader) Open(string, chan<- readers.Scan) error { return nil }
+func (r *blockingReader) Close() error                           { return nil }
+func (r *blockingReader) Detect([]string) string                 { return "" }
+func (r *blockingReader) Device() string                         { return "test:1" }
+func (r *blockingReader) Connected() bool                        { return true }
+func (r *blockingReader) Info() string                           { return "test" }
+func (r *blockingReader) Health() error                          { return nil }
+
+func (r *blockingReader) Capabilities() readers.Capabilities {
+	return readers.Capabilities{Write: !r.readOnly}
+}
+
+func (r *blockingReader) Write(
+	string,
+	readers.WriteOptions,
+	func(readers.WriteStatus),
+) (*tokens.Token, error) {
+	select {
+	case <-r.cancel:
+		return nil, errors.New("write cancelled")
+	case <-time.After(5 * time.Second):
+		return nil, nil
+	}
+}
+
+func (r *blockingReader) CancelWrite() {
+	select {
+	case r.cancel <- struct{}{}:
+	default:
+	}
+}
+
+func sendRequest(t *testing.T, ws *websocket.Conn, method string, params any) uuid.UUID {
+	t.Helper()
+
+	id := uuid.New()
+	err := ws.WriteJSON(models.RequestObject{
+		JsonRpc: "2.0",
+		Id:      &id,
+		Method:  method,
+		Params:  params,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return id
+}
+
+func readResponse(t *testing.T, ws *websocket.Conn) models.ResponseObject {
+	t.Helper()
+
+	err := ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var resp models.ResponseObject
+	err = ws.ReadJSON(&resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return resp
+}
+
+// dialTestServer starts an API websocket server with a single reader and
+// connects to it.
+func dialTestServer(t *testing.T, r readers.Reader) *websocket.Conn {
+	t.Helper()
+
+	st, ns := state.NewState(nil)
+	t.Cleanup(st.StopService)
+	go func() {
+		for range ns {
+		}
+	}()
+
+	st.SetReader(r.Device(), r)
+
+	m := newWebsocket(nil, &config.UserConfig{}, st, make(chan tokens.Token), nil)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = m.HandleRequest(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ws.Close() })
+
+	return ws
+}
+
+func TestCancelWriteOnSameSession(t *testing.T) {
+	ws := dialTestServer(t, &blockingReader{cancel: make(chan struct{})})
+
+	writeId := sendRequest(t, ws, models.MethodReadersWrite, models.ReaderWriteParams{Text: "**launch.random:snes"})
+	// give the write time to start waiting for a tag
+	time.Sleep(100 * time.Millisecond)
+	cancelId := sendRequest(t, ws, models.MethodReadersWriteCancel, nil)
+
+	resp := readResponse(t, ws)
+	if resp.Id != cancelId || resp.Error != nil {
+		t.Fatalf("expected cancel response first, got: %+v", resp)
+	}
+
+	resp = readResponse(t, ws)
+	if resp.Id != writeId || resp.Error == nil {
+		t.Fatalf("expected cancelled write error, got: %+v", resp)
+	}
+}
+
+func TestWriteSkipsReadOnlyReaders(t *testing.T) {
+	ws := dialTestServer(t, &blockingReader{cancel: make(chan struct{}), readOnly: true})
+
+	writeId := sendRequest(t, ws, models.MethodReadersWrite, models.ReaderWriteParams{Text: "**launch.random:snes"})
+
+	resp := readResponse(t, ws)
+	if resp.Id != writeId || resp.Error == nil {
+		t.Fatalf("expected write error, got: %+v", resp)
+	}
+}
@@ -0,0 +1,275 @@
+// Package webhooks delivers service notifications to webhook URLs as HTTP
+// POST requests. The body is the same JSON-RPC notification sent to API
+// websocket clients.
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ZaparooProject/zaparoo-core/pkg/api/models"
+	"github.com/ZaparooProject/zaparoo-core/pkg/config"
+	"github.com/ZaparooProject/zaparoo-core/pkg/database"
+	"github.com/ZaparooProject/zaparoo-core/pkg/service/state"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// HeaderEvent is the notification method, e.g. media.started.
+	HeaderEvent = "X-Zaparoo-Event"
+	// HeaderDelivery is a unique ID for the notification, which is the same
+	// for every attempt to deliver it.
+	HeaderDelivery = "X-Zaparoo-Delivery"
+	// HeaderSignature is the HMAC-SHA256 of the body keyed with the
+	// webhook's secret, in the format sha256=<hex>. Only sent if the
+	// webhook has a secret.
+	HeaderSignature = "X-Zaparoo-Signature"
+)
+
+const (
+	defaultMaxAttempts = 5
+	defaultBackoff     = 1 * time.Second
+	defaultMaxBackoff  = 1 * time.Minute
+	requestTimeout     = 10 * time.Second
+	// only this much of a response body is read before it's discarded
+	maxResponseSize = 64 * 1024
+	// notifications waiting to be delivered to a single webhook
+	queueSize = 100
+)
+
+type Store interface {
+	GetEnabledWebhooks() ([]database.Webhook, error)
+}
+
+type Dispatcher struct {
+	store  Store
+	client *http.Client
+	// MaxAttempts is how many times a notification is sent before giving up.
+	MaxAttempts int
+	// Backoff is the delay before the first retry, it doubles after every
+	// failed attempt up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	mu sync.Mutex
+	// delivery queue of each webhook, by ID
+	queues map[string]chan delivery
+}
+
+type delivery struct {
+	webhook database.Webhook
+	method  string
+	payload []byte
+}
+
+func NewDispatcher(store Store) *Dispatcher {
+	return &Dispatcher{
+		store:       store,
+		client:      &http.Client{Timeout: requestTimeout},
+		MaxAttempts: defaultMaxAttempts,
+		Backoff:     defaultBackoff,
+		MaxBackoff:  defaultMaxBackoff,
+		queues:      make(map[string]chan delivery),
+	}
+}
+
+// WantsEvent returns true if a webhook with the given event filter should
+// receive a notification. An empty filter matches everything, and filters
+// ending in .* match every method with that prefix, e.g. media.*.
+func WantsEvent(events []string, method string) bool {
+	if len(events) == 0 {
+		return true
+	}
+
+	for _, e := range events {
+		if e == "*" || e == method {
+			return true
+		}
+
+		if strings.HasSuffix(e, ".*") && strings.HasPrefix(method, strings.TrimSuffix(e, "*")) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Sign returns the signature header value of a body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Send queues a notification for every enabled webhook which wants it.
+// Each webhook has its own queue which is delivered in order in the
+// background, so a retrying webhook delays its own notifications but not
+// those of other webhooks.
+func (d *Dispatcher) Send(method string, payload []byte) {
+	hooks, err := d.store.GetEnabledWebhooks()
+	if err != nil {
+		log.Error().Err(err).Msg("error getting webhooks")
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	enabled := make(map[string]bool)
+	for _, w := range hooks {
+		enabled[w.Id] = true
+
+		if !WantsEvent(w.Events, method) {
+			continue
+		}
+
+		q, ok := d.queues[w.Id]
+		if !ok {
+			q = make(chan delivery, queueSize)
+			d.queues[w.Id] = q
+			go d.run(q)
+		}
+
+		select {
+		case q <- delivery{webhook: w, method: method, payload: payload}:
+		default:
+			log.Warn().Msgf("webhook %s queue is full, dropped %s", w.Id, method)
+		}
+	}
+
+	// queues of deleted or disabled webhooks finish what's left and stop
+	for id, q := range d.queues {
+		if !enabled[id] {
+			close(q)
+			delete(d.queues, id)
+		}
+	}
+}
+
+// Stop closes every queue. Notifications which were already queued are
+// still delivered.
+func (d *Dispatcher) Stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for id, q := range d.queues {
+		close(q)
+		delete(d.queues, id)
+	}
+}
+
+func (d *Dispatcher) run(q <-chan delivery) {
+	for dl := range q {
+		d.deliver(dl.webhook, dl.method, dl.payload)
+	}
+}
+
+func (d *Dispatcher) deliver(w database.Webhook, method string, payload []byte) {
+	delivery := uuid.New().String()
+	backoff := d.Backoff
+
+	for attempt := 1; ; attempt++ {
+		retry, err := d.post(w, method, delivery, payload)
+		if err == nil {
+			log.Debug().Msgf("delivered %s to webhook %s", method, w.Id)
+			return
+		}
+
+		if !retry || attempt >= d.MaxAttempts {
+			log.Error().Err(err).Msgf(
+				"error delivering %s to webhook %s, giving up after %d attempts",
+				method, w.Id, attempt,
+			)
+			return
+		}
+
+		log.Warn().Err(err).Msgf(
+			"error delivering %s to webhook %s, retrying in %s",
+			method, w.Id, backoff,
+		)
+
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > d.MaxBackoff {
+			backoff = d.MaxBackoff
+		}
+	}
+}
+
+// post sends a single request to a webhook. It returns whether a failed
+// request is worth retrying, which is true for connection errors and
+// server errors but not for rejected requests.
+func (d *Dispatcher) post(
+	w database.Webhook,
+	method string,
+	delivery string,
+	payload []byte,
+) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, w.Url, bytes.NewReader(payload))
+	if err != nil {
+		return false, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Zaparoo/"+config.Version)
+	req.Header.Set(HeaderEvent, method)
+	req.Header.Set(HeaderDelivery, delivery)
+	if w.Secret != "" {
+		req.Header.Set(HeaderSignature, Sign(w.Secret, payload))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer func(Body io.ReadCloser) {
+		_, _ = io.Copy(io.Discard, io.LimitReader(Body, maxResponseSize))
+		_ = Body.Close()
+	}(resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+
+	retry := resp.StatusCode >= 500 ||
+		resp.StatusCode == http.StatusTooManyRequests ||
+		resp.StatusCode == http.StatusRequestTimeout
+
+	return retry, fmt.Errorf("unexpected webhook response: %s", resp.Status)
+}
+
+// Start delivers notifications to webhooks until the service stops. The body
+// is the notification as a JSON-RPC request, the same as API clients get.
+func Start(st *state.State, store Store, ns <-chan models.Notification) {
+	d := NewDispatcher(store)
+	defer d.Stop()
+
+	for !st.ShouldStopService() {
+		select {
+		case n := <-ns:
+			data, err := json.Marshal(models.RequestObject{
+				JsonRpc: "2.0",
+				Method:  n.Method,
+				Params:  n.Params,
+			})
+			if err != nil {
+				log.Error().Err(err).Msg("marshalling webhook notification")
+				continue
+			}
+
+			d.Send(n.Method, data)
+		case <-time.After(500 * time.Millisecond):
+			continue
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ZaparooProject/zaparoo-core/pkg/database"
+)
+
+type testStore []database.Webhook
+
+func (s testStore) GetEnabledWebhooks() ([]database.Webhook, error) {
+	return s, nil
+}
+
+type received struct {
+	path   string
+	body   []byte
+	header http.Header
+}
+
+// testServer records requests and replies with the given status codes in
+// order, then 200 OK.
+type testServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	requests chan received
+}
+
+func newTestServer(t *testing.T, statuses ...int) *testServer {
+	s := &testServer{
+		statuses: statuses,
+		requests: make(chan received, 10),
+	}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		s.requests <- received{
+			path:   r.URL.Path,
+			body:   body,
+			header: r.Header,
+		}
+
+		s.mu.Lock()
+		status := http.StatusOK
+		if len(s.statuses) > 0 {
+			status = s.statuses[0]
+			s.statuses = s.statuses[1:]
+		}
+		s.mu.Unlock()
+
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func (s *testServer) next(t *testing.T) received {
+	t.Helper()
+	select {
+	case r := <-s.requests:
+		return r
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for webhook request")
+		return received{}
+	}
+}
+
+func (s *testServer) none(t *testing.T) {
+	t.Helper()
+	select {
+	case r := <-s.requests:
+		t.Fatalf("unexpected webhook request: %s %s", r.path, r.body)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func newTestDispatcher(hooks ...database.Webhook) *Dispatcher {
+	d := NewDispatcher(testStore(hooks))
+	d.Backoff = time.Millisecond
+	d.MaxBackoff = 5 * time.Millisecond
+	return d
+}
+
+func TestWantsEvent(t *testing.T) {
+	tests := []struct {
+		events []string
+		method string
+		want   bool
+	}{
+		{nil, "media.started", true},
+		{[]string{"*"}, "media.started", true},
+		{[]string{"media.started"}, "media.started", true},
+		{[]string{"media.started"}, "media.stopped", false},
+		{[]string{"tokens.active", "media.*"}, "media.stopped", true},
+		{[]string{"media.*"}, "mediax.started", false},
+		{[]string{"media.*"}, "tokens.active", false},
+	}
+
+	for _, tt := range tests {
+		got := WantsEvent(tt.events, tt.method)
+		if got != tt.want {
+			t.Errorf("WantsEvent(%v, %q) = %t, want %t", tt.events, tt.method, got, tt.want)
+		}
+	}
+}
+
+func TestSendFiltersAndSigns(t *testing.T) {
+	s := newTestServer(t)
+
+	d := newTestDispatcher(
+		database.Webhook{
+			Id:     "1",
+			Url:    s.URL + "/media",
+			Events: []string{"media.*"},
+		},
+		database.Webhook{
+			Id:     "2",
+			Url:    s.URL + "/all",
+			Secret: "Sup3rSecret",
+		},
+	)
+
+	payload := []byte(`{"jsonrpc":"2.0","method":"tokens.active","params":{}}`)
+	d.Send("tokens.active", payload)
+
+	r := s.next(t)
+	if r.path != "/all" {
+		t.Fatalf("request sent to %s, want /all", r.path)
+	}
+	s.none(t)
+
+	if string(r.body) != string(payload) {
+		t.Errorf("body = %s, want %s", r.body, payload)
+	}
+
+	if r.header.Get(HeaderEvent) != "tokens.active" {
+		t.Errorf("event header = %q, want tokens.active", r.header.Get(HeaderEvent))
+	}
+
+	mac := hmac.New(sha256.New, []byte("Sup3rSecret"))
+	mac.Write(payload)
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if r.header.Get(HeaderSignature) != want {
+		t.Errorf("signature = %q, want %q", r.header.Get(HeaderSignature), want)
+	}
+
+	d.Send("media.stopped", payload)
+
+	paths := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		r := s.next(t)
+		paths[r.path] = true
+		if r.path == "/media" && r.header.Get(HeaderSignature) != "" {
+			t.Error("signature sent for webhook without secret")
+		}
+	}
+	if !paths["/media"] || !paths["/all"] {
+		t.Errorf("requests sent to %v, want /media and /all", paths)
+	}
+}
+
+func TestRetryWithBackoff(t *testing.T) {
+	s := newTestServer(t,
+		http.StatusInternalServerError,
+		http.StatusTooManyRequests,
+	)
+
+	d := newTestDispatcher(database.Webhook{Id: "1", Url: s.URL})
+	d.Send("media.started", []byte(`{}`))
+
+	first := s.next(t)
+	delivery := first.header.Get(HeaderDelivery)
+	if delivery == "" {
+		t.Fatal("missing delivery header")
+	}
+
+	for i := 0; i < 2; i++ {
+		r := s.next(t)
+		if r.header.Get(HeaderDelivery) != delivery {
+			t.Errorf("retry delivery = %q, want %q", r.header.Get(HeaderDelivery), delivery)
+		}
+	}
+
+	s.none(t)
+}
+
+func TestGiveUp(t *testing.T) {
+	s := newTestServer(t,
+		http.StatusBadGateway,
+		http.StatusBadGateway,
+		http.StatusBadGateway,
+	)
+
+	d := newTestDispatcher(database.Webhook{Id: "1", Url: s.URL})
+	d.MaxAttempts = 2
+	d.Send("media.started", []byte(`{}`))
+
+	s.next(t)
+	s.next(t)
+	s.none(t)
+}
+
+func TestNoRetryOnClientError(t *testing.T) {
+	s := newTestServer(t, http.StatusNotFound)
+
+	d := newTestDispatcher(database.Webhook{Id: "1", Url: s.URL})
+	d.Send("media.started", []byte(`{}`))
+
+	s.next(t)
+	s.none(t)
+}
+
+func TestDeliverInOrder(t *testing.T) {
+	s := newTestServer(t, http.StatusInternalServerError)
+
+	d := newTestDispatcher(database.Webhook{Id: "1", Url: s.URL})
+	d.Backoff = 50 * time.Millisecond
+	d.Send("media.started", []byte(`1`))
+	d.Send("media.stopped", []byte(`2`))
+
+	// the second notification waits for the first to be retried
+	for _, want := range []string{"1", "1", "2"} {
+		r := s.next(t)
+		if string(r.body) != want {
+			t.Fatalf("body = %s, want %s", r.body, want)
+		}
+	}
+	s.none(t)
+}
+
+func TestStopDisabledQueue(t *testing.T) {
+	s := newTestServer(t)
+
+	store := testStore{database.Webhook{Id: "1", Url: s.URL}}
+	d := NewDispatcher(&store)
+	d.Send("media.started", []byte(`{}`))
+	s.next(t)
+
+	store = nil
+	d.Send("media.started", []byte(`{}`))
+	s.none(t)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.queues) != 0 {
+		t.Fatalf("expected no queues, got: %d", len(d.queues))
+	}
+}
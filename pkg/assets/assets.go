@@ -20,6 +20,12 @@ var FailSound []byte
 //go:embed systems/*
 var Systems embed.FS
 
+// Figures contains the lookup tables for toy figure IDs, like Amiibo and
+// Lego Dimensions characters.
+//
+//go:embed figures/*
+var Figures embed.FS
+
 type SystemMetadata struct {
 	Id           string `json:"id"`
 	Name         string `json:"name"`
@@ -17,14 +17,16 @@ import (
 )
 
 type Flags struct {
-	Write        *string
-	Launch       *string
-	Api          *string
-	Clients      *bool
-	NewClient    *string
-	DeleteClient *string
-	Qr           *bool
-	Version      *bool
+	Write         *string
+	WritePassword *string
+	WriteLock     *bool
+	Launch        *string
+	Api           *string
+	Clients       *bool
+	NewClient     *string
+	DeleteClient  *string
+	Qr            *bool
+	Version       *bool
 }
 
 // SetupFlags defines all common CLI flags between platforms.
@@ -35,6 +37,16 @@ func SetupFlags() *Flags {
 			"",
 			"write text to tag using connected reader",
 		),
+		WritePassword: flag.String(
+			"write-password",
+			"",
+			"protect written NTAG tag with a 4 byte hex password",
+		),
+		WriteLock: flag.Bool(
+			"write-lock",
+			false,
+			"permanently lock written tag so it's read-only",
+		),
 		Launch: flag.String(
 			"launch",
 			"",
@@ -94,9 +106,15 @@ type ConnQr struct {
 // set up. Logging is allowed.
 func (f *Flags) Post(cfg *config.UserConfig) {
 	if *f.Write != "" {
-		data, err := json.Marshal(&models.ReaderWriteParams{
+		params := models.ReaderWriteParams{
 			Text: *f.Write,
-		})
+			Lock: *f.WriteLock,
+		}
+		if *f.WritePassword != "" {
+			params.Password = f.WritePassword
+		}
+
+		data, err := json.Marshal(&params)
 		if err != nil {
 			_, _ = fmt.Fprintf(os.Stderr, "Error encoding params: %v\n", err)
 			os.Exit(1)
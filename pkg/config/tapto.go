@@ -4,6 +4,7 @@ import (
 	"github.com/rs/zerolog/log"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 const (
@@ -11,12 +12,18 @@ const (
 	GamesDbFilename    = "games.db"
 	TapToDbFilename    = "tapto.db"
 	DefaultApiPort     = "7497"
+	DefaultMqttPrefix  = "zaparoo"
+	DefaultHaPrefix    = "homeassistant"
 	LogFilename        = "tapto.log"
 	AppName            = "tapto"
 	UserConfigFilename = "tapto.ini"
 	PidFilename        = "tapto.pid"
 )
 
+// DefaultConfirmTimeout is how long a token which needs confirming can be
+// tapped again to run it, if confirm_timeout isn't set.
+const DefaultConfirmTimeout = 5 * time.Second
+
 func TempDir() string {
 	path := filepath.Join(os.TempDir(), AppName)
 	err := os.MkdirAll(path, 0755)
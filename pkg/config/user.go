@@ -26,9 +26,12 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers"
 	"github.com/rs/zerolog"
 	"gopkg.in/ini.v1"
 )
@@ -37,16 +40,54 @@ const UserConfigEnv = "TAPTO_CONFIG"
 const UserAppPathEnv = "TAPTO_APP_PATH"
 
 type TapToConfig struct {
-	Reader            []string `ini:"reader,omitempty,allowshadow"`
-	AllowCommands     bool     `ini:"allow_commands"`      // TODO: DEPRECATED, remove and use allow_shell below
-	DisableSounds     bool     `ini:"disable_sounds"`      // TODO: rename something like audio_feedback?
-	ProbeDevice       bool     `ini:"probe_device"`        // TODO: rename to reader_detection?
-	ExitGame          bool     `ini:"exit_game"`           // TODO: rename to insert_mode
-	ExitGameBlocklist []string `ini:"exit_game_blocklist"` // TODO: rename to insert_mode_blocklist
-	ExitGameDelay     int      `ini:"exit_game_delay"`     // TODO: rename to insert_mode_delay
-	ConsoleLogging    bool     `ini:"console_logging"`
-	Debug             bool     `ini:"debug"`
-	ConnectionString  string   `ini:"connection_string,omitempty"` // DEPRECATED
+	Reader                []string `ini:"reader,omitempty,allowshadow"`
+	AllowCommands         bool     `ini:"allow_commands"`      // TODO: DEPRECATED, remove and use allow_shell below
+	DisableSounds         bool     `ini:"disable_sounds"`      // TODO: rename something like audio_feedback?
+	ProbeDevice           bool     `ini:"probe_device"`        // TODO: rename to reader_detection?
+	ExitGame              bool     `ini:"exit_game"`           // TODO: rename to insert_mode
+	ExitGameBlocklist     []string `ini:"exit_game_blocklist"` // TODO: rename to insert_mode_blocklist
+	ExitGameDelay         int      `ini:"exit_game_delay"`     // TODO: rename to insert_mode_delay
+	ExitGameDelayOverride []string `ini:"exit_game_delay_override,omitempty,allowshadow"`
+	ExitGameGrace         int      `ini:"exit_game_grace"`
+	SessionTime           int      `ini:"session_time"`
+	SessionWarning        int      `ini:"session_warning"`
+	RetapInterval         string   `ini:"retap_interval,omitempty"`
+	DisableRelaunch       bool     `ini:"disable_relaunch"`
+	ConfirmCommands       []string `ini:"confirm_commands,omitempty"`
+	ConfirmTimeout        string   `ini:"confirm_timeout,omitempty"`
+	UriStripPrefix        []string `ini:"uri_strip_prefix,omitempty,allowshadow"`
+	MifareKey             []string `ini:"mifare_key,omitempty,allowshadow"`
+	ConsoleLogging        bool     `ini:"console_logging"`
+	Debug                 bool     `ini:"debug"`
+	ConnectionString      string   `ini:"connection_string,omitempty"` // DEPRECATED
+}
+
+const (
+	ReaderRoleLaunch   = "launch"
+	ReaderRoleCommands = "commands"
+	ReaderRoleWrite    = "write"
+)
+
+const (
+	ReaderTokenValueUid  = "uid"
+	ReaderTokenValueText = "text"
+)
+
+const (
+	ReaderFileRemovalEmpty  = "empty"
+	ReaderFileRemovalDelete = "delete"
+)
+
+// ReadersConfig holds per-reader options. Each entry is in the format
+// <value>:<device>, where device is the full reader connection string.
+type ReadersConfig struct {
+	Role           []string `ini:"role,omitempty,allowshadow"`
+	Player         []string `ini:"player,omitempty,allowshadow"`
+	ExitGame       []string `ini:"exit_game,omitempty,allowshadow"`
+	RemovalTimeout []string `ini:"removal_timeout,omitempty,allowshadow"`
+	TokenValue     []string `ini:"token_value,omitempty,allowshadow"`
+	Secret         []string `ini:"secret,omitempty,allowshadow"`
+	FileRemoval    []string `ini:"file_removal,omitempty,allowshadow"`
 }
 
 type SystemsConfig struct {
@@ -64,14 +105,28 @@ type ApiConfig struct {
 	AllowLaunch []string `ini:"allow_launch,omitempty,allowshadow"`
 }
 
+// MqttConfig connects to an MQTT broker to publish events and receive
+// launch commands. Leaving the broker empty disables MQTT.
+type MqttConfig struct {
+	Broker          string `ini:"broker,omitempty"`
+	Username        string `ini:"username,omitempty"`
+	Password        string `ini:"password,omitempty"`
+	ClientId        string `ini:"client_id,omitempty"`
+	TopicPrefix     string `ini:"topic_prefix,omitempty"`
+	Discovery       bool   `ini:"discovery"`
+	DiscoveryPrefix string `ini:"discovery_prefix,omitempty"`
+}
+
 type UserConfig struct {
 	mu        sync.RWMutex
 	AppPath   string          `ini:"-"`
 	IniPath   string          `ini:"-"`
 	TapTo     TapToConfig     `ini:"tapto"`
+	Readers   ReadersConfig   `ini:"readers"`
 	Systems   SystemsConfig   `ini:"systems"`
 	Launchers LaunchersConfig `ini:"launchers"`
 	Api       ApiConfig       `ini:"api"`
+	Mqtt      MqttConfig      `ini:"mqtt"`
 }
 
 func (c *UserConfig) GetConnectionString() string {
@@ -170,6 +225,177 @@ func (c *UserConfig) SetExitGameBlocklist(exitGameBlocklist []string) {
 	c.TapTo.ExitGameBlocklist = exitGameBlocklist
 }
 
+// GetExitGameDelayOverride returns the list of per-system exit delays in the
+// format <system>:<seconds>.
+func (c *UserConfig) GetExitGameDelayOverride() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.TapTo.ExitGameDelayOverride
+}
+
+func (c *UserConfig) SetExitGameDelayOverride(overrides []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.TapTo.ExitGameDelayOverride = overrides
+}
+
+// GetUriStripPrefix returns the list of URL prefixes which are removed from
+// URI records so the rest of the URI can be used as token text.
+func (c *UserConfig) GetUriStripPrefix() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.TapTo.UriStripPrefix
+}
+
+func (c *UserConfig) SetUriStripPrefix(prefixes []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.TapTo.UriStripPrefix = prefixes
+}
+
+// GetMifareKey returns the list of extra MIFARE Classic keys, each one hex
+// encoded and optionally in the format <sector>:<key>.
+func (c *UserConfig) GetMifareKey() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.TapTo.MifareKey
+}
+
+func (c *UserConfig) SetMifareKey(keys []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.TapTo.MifareKey = keys
+}
+
+func (c *UserConfig) GetExitGameGrace() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.TapTo.ExitGameGrace
+}
+
+func (c *UserConfig) SetExitGameGrace(exitGameGrace int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.TapTo.ExitGameGrace = exitGameGrace
+}
+
+func (c *UserConfig) GetSessionTime() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.TapTo.SessionTime
+}
+
+func (c *UserConfig) SetSessionTime(sessionTime int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.TapTo.SessionTime = sessionTime
+}
+
+func (c *UserConfig) GetSessionWarning() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.TapTo.SessionWarning
+}
+
+func (c *UserConfig) SetSessionWarning(sessionWarning int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.TapTo.SessionWarning = sessionWarning
+}
+
+// parseDuration reads a duration like "1500ms" or a number of seconds.
+func parseDuration(v string) (time.Duration, bool) {
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		secs, ferr := strconv.ParseFloat(v, 64)
+		if ferr != nil {
+			return 0, false
+		}
+		d = time.Duration(secs * float64(time.Second))
+	}
+
+	if d < 0 {
+		return 0, false
+	}
+
+	return d, true
+}
+
+// GetRetapInterval returns how long after a token is scanned that scanning
+// the same token again is ignored, so double taps don't launch twice. Zero
+// disables it.
+func (c *UserConfig) GetRetapInterval() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	v := c.TapTo.RetapInterval
+	if v == "" {
+		return 0
+	}
+
+	d, ok := parseDuration(v)
+	if !ok {
+		log.Warn().Msgf("invalid retap interval: %s", v)
+		return 0
+	}
+
+	return d
+}
+
+func (c *UserConfig) SetRetapInterval(retapInterval time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.TapTo.RetapInterval = retapInterval.String()
+}
+
+// GetDisableRelaunch returns true if scanning the token which launched the
+// running software should be ignored instead of launching it again.
+func (c *UserConfig) GetDisableRelaunch() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.TapTo.DisableRelaunch
+}
+
+func (c *UserConfig) SetDisableRelaunch(disableRelaunch bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.TapTo.DisableRelaunch = disableRelaunch
+}
+
+// GetConfirmCommands returns the commands which only run if their token is
+// tapped a second time, e.g. shell.
+func (c *UserConfig) GetConfirmCommands() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.TapTo.ConfirmCommands
+}
+
+func (c *UserConfig) SetConfirmCommands(confirmCommands []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.TapTo.ConfirmCommands = confirmCommands
+}
+
+// GetConfirmTimeout returns how long a token which needs confirming can be
+// tapped again to run it.
+func (c *UserConfig) GetConfirmTimeout() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	v := c.TapTo.ConfirmTimeout
+	if v == "" {
+		return DefaultConfirmTimeout
+	}
+
+	d, ok := parseDuration(v)
+	if !ok || d == 0 {
+		log.Warn().Msgf("invalid confirm timeout: %s", v)
+		return DefaultConfirmTimeout
+	}
+
+	return d
+}
+
 func (c *UserConfig) GetDebug() bool {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
@@ -187,6 +413,271 @@ func (c *UserConfig) SetDebug(debug bool) {
 	}
 }
 
+// sameDevice returns true if two device strings refer to the same reader.
+// Local device paths are compared after resolving symlinks, so a reader can
+// be configured by its /dev/serial/by-id link.
+func sameDevice(a string, b string) bool {
+	if a == b {
+		return true
+	}
+
+	pa := readers.DevicePath(a)
+	pb := readers.DevicePath(b)
+	if pa == "" || pb == "" {
+		return false
+	}
+
+	// the driver part must still match, only the path may differ
+	ida := strings.SplitN(a, ":", 2)[0]
+	idb := strings.SplitN(b, ":", 2)[0]
+	if ida != idb {
+		return false
+	}
+
+	return readers.CanonicalPath(pa) == readers.CanonicalPath(pb)
+}
+
+// Find the value of a per-reader option for the given device, keeping its
+// original case.
+func lookupReaderOptionRaw(opts []string, device string) (string, bool) {
+	for _, v := range opts {
+		ps := strings.SplitN(v, ":", 2)
+		if len(ps) != 2 {
+			continue
+		}
+
+		if sameDevice(strings.TrimSpace(ps[1]), device) {
+			return strings.TrimSpace(ps[0]), true
+		}
+	}
+	return "", false
+}
+
+// Find the value of a per-reader option for the given device.
+func lookupReaderOption(opts []string, device string) (string, bool) {
+	v, ok := lookupReaderOptionRaw(opts, device)
+	return strings.ToLower(v), ok
+}
+
+// GetReaderRole returns the configured role of a reader device, defaulting to
+// the launch role if none is set or the role is unknown.
+func (c *UserConfig) GetReaderRole(device string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	role, ok := lookupReaderOption(c.Readers.Role, device)
+	if !ok {
+		return ReaderRoleLaunch
+	}
+
+	switch role {
+	case ReaderRoleLaunch, ReaderRoleCommands, ReaderRoleWrite:
+		return role
+	default:
+		log.Warn().Msgf("unknown reader role for %s: %s", device, role)
+		return ReaderRoleLaunch
+	}
+}
+
+// GetReaderPlayer returns the player slot assigned to a reader device, or 0
+// if the reader has no player slot.
+func (c *UserConfig) GetReaderPlayer(device string) int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	v, ok := lookupReaderOption(c.Readers.Player, device)
+	if !ok {
+		return 0
+	}
+
+	player, err := strconv.Atoi(v)
+	if err != nil || player < 0 {
+		log.Warn().Msgf("invalid reader player slot for %s: %s", device, v)
+		return 0
+	}
+
+	return player
+}
+
+// GetReaderExitGame returns whether removing a token from the reader device
+// should exit the running game. Readers without an explicit setting use the
+// global exit_game option, except non-launching readers which never exit.
+func (c *UserConfig) GetReaderExitGame(device string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	v, ok := lookupReaderOption(c.Readers.ExitGame, device)
+	if ok {
+		exitGame, err := strconv.ParseBool(v)
+		if err == nil {
+			return exitGame
+		}
+		log.Warn().Msgf("invalid reader exit game option for %s: %s", device, v)
+	}
+
+	role, ok := lookupReaderOption(c.Readers.Role, device)
+	if ok && role != ReaderRoleLaunch {
+		return false
+	}
+
+	return c.TapTo.ExitGame
+}
+
+// GetReaderRemovalTimeout returns how long a reader which can't sense tokens
+// being removed waits after the last scan before reporting a removal. The
+// value is a duration like "1500ms" or a number of seconds, and 0 disables
+// removals. Returns def if the device has no valid setting.
+func (c *UserConfig) GetReaderRemovalTimeout(device string, def time.Duration) time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	v, ok := lookupReaderOption(c.Readers.RemovalTimeout, device)
+	if !ok {
+		return def
+	}
+
+	timeout, ok := parseDuration(v)
+	if !ok {
+		log.Warn().Msgf("invalid reader removal timeout for %s: %s", device, v)
+		return def
+	}
+
+	return timeout
+}
+
+// GetReaderTokenValue returns which token field a reader that only reads
+// plain values, like a barcode scanner, should store them in. Returns def if
+// the device has no valid setting.
+func (c *UserConfig) GetReaderTokenValue(device string, def string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	v, ok := lookupReaderOption(c.Readers.TokenValue, device)
+	if !ok {
+		return def
+	}
+
+	switch v {
+	case ReaderTokenValueUid, ReaderTokenValueText:
+		return v
+	default:
+		log.Warn().Msgf("unknown reader token value for %s: %s", device, v)
+		return def
+	}
+}
+
+// GetReaderSecret returns the shared secret network devices must prove they
+// know to use a reader, or an empty string if they don't need to. The
+// secret can't contain a colon.
+func (c *UserConfig) GetReaderSecret(device string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	v, _ := lookupReaderOptionRaw(c.Readers.Secret, device)
+	return v
+}
+
+// GetReaderFileRemoval returns what removes the token from a file reader:
+// either the file being emptied or deleted, or only the file being deleted.
+func (c *UserConfig) GetReaderFileRemoval(device string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	v, ok := lookupReaderOption(c.Readers.FileRemoval, device)
+	if !ok {
+		return ReaderFileRemovalEmpty
+	}
+
+	switch v {
+	case ReaderFileRemovalEmpty, ReaderFileRemovalDelete:
+		return v
+	default:
+		log.Warn().Msgf("unknown reader file removal for %s: %s", device, v)
+		return ReaderFileRemovalEmpty
+	}
+}
+
+func (c *UserConfig) GetMqttBroker() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Mqtt.Broker
+}
+
+func (c *UserConfig) SetMqttBroker(broker string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Mqtt.Broker = broker
+}
+
+func (c *UserConfig) GetMqttUsername() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Mqtt.Username
+}
+
+func (c *UserConfig) GetMqttPassword() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Mqtt.Password
+}
+
+// GetMqttClientId returns the client ID used to connect to the broker,
+// defaulting to one based on the hostname.
+func (c *UserConfig) GetMqttClientId() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.Mqtt.ClientId != "" {
+		return c.Mqtt.ClientId
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		return AppName
+	}
+
+	return AppName + "-" + hostname
+}
+
+// GetMqttTopicPrefix returns the prefix of all topics published and
+// subscribed to, without a trailing slash.
+func (c *UserConfig) GetMqttTopicPrefix() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	prefix := strings.Trim(c.Mqtt.TopicPrefix, "/")
+	if prefix == "" {
+		return DefaultMqttPrefix
+	}
+
+	return prefix
+}
+
+func (c *UserConfig) GetMqttDiscovery() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Mqtt.Discovery
+}
+
+func (c *UserConfig) SetMqttDiscovery(discovery bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Mqtt.Discovery = discovery
+}
+
+// GetMqttDiscoveryPrefix returns the Home Assistant discovery topic prefix.
+func (c *UserConfig) GetMqttDiscoveryPrefix() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	prefix := strings.Trim(c.Mqtt.DiscoveryPrefix, "/")
+	if prefix == "" {
+		return DefaultHaPrefix
+	}
+
+	return prefix
+}
+
 func (c *UserConfig) IsFileAllowed(path string) bool {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
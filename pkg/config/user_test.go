@@ -0,0 +1,37 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLookupReaderOptionByLink(t *testing.T) {
+	dir := t.TempDir()
+	dev := filepath.Join(dir, "ttyUSB0")
+	link := filepath.Join(dir, "usb-reader-if00")
+
+	err := os.WriteFile(dev, nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Symlink(dev, link)
+	if err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+
+	opts := []string{"2:pn532_uart:" + link}
+
+	v, ok := lookupReaderOption(opts, "pn532_uart:"+dev)
+	if !ok || v != "2" {
+		t.Fatalf("expected option for linked device, got: %q %v", v, ok)
+	}
+
+	if _, ok := lookupReaderOption(opts, "simple_serial:"+dev); ok {
+		t.Fatal("expected option to not match another driver")
+	}
+
+	if _, ok := lookupReaderOption(opts, "tcp:7497"); ok {
+		t.Fatal("expected option to not match a network reader")
+	}
+}
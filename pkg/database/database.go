@@ -8,6 +8,7 @@ import (
 
 	"github.com/ZaparooProject/zaparoo-core/pkg/config"
 	"github.com/ZaparooProject/zaparoo-core/pkg/platforms"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/figures"
 	bolt "go.etcd.io/bbolt"
 )
 
@@ -15,6 +16,7 @@ const (
 	BucketHistory  = "history"
 	BucketMappings = "mappings"
 	BucketClients  = "clients"
+	BucketWebhooks = "webhooks"
 )
 
 func dbFile(pl platforms.Platform) string {
@@ -45,6 +47,7 @@ func open(pl platforms.Platform, options *bolt.Options) (*bolt.DB, error) {
 			BucketHistory,
 			BucketMappings,
 			BucketClients,
+			BucketWebhooks,
 		} {
 			_, err := txn.CreateBucketIfNotExists([]byte(bucket))
 			if err != nil {
@@ -81,12 +84,13 @@ func (d *Database) Close() error {
 // TODO: reader source (physical reader vs web)
 // TODO: metadata
 type HistoryEntry struct {
-	Time    time.Time `json:"time"`
-	Type    string    `json:"type"`
-	UID     string    `json:"uid"`
-	Text    string    `json:"text"`
-	Data    string    `json:"data"`
-	Success bool      `json:"success"`
+	Time    time.Time       `json:"time"`
+	Type    string          `json:"type"`
+	UID     string          `json:"uid"`
+	Text    string          `json:"text"`
+	Data    string          `json:"data"`
+	Success bool            `json:"success"`
+	Figure  *figures.Figure `json:"figure,omitempty"`
 }
 
 func HistoryKey(entry HistoryEntry) string {
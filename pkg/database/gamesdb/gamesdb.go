@@ -465,6 +465,25 @@ func SearchNamesWords(platform platforms.Platform, systems []System, query strin
 	})
 }
 
+var serialSepRe = regexp.MustCompile(`[^A-Z0-9]`)
+
+func normalizeSerial(s string) string {
+	return serialSepRe.ReplaceAllString(strings.ToUpper(s), "")
+}
+
+// nameHasSerial returns true if a name contains a serial, ignoring case and
+// separators, e.g. "Game (USA) [SLUS_005.94]" has SLUS-00594.
+func nameHasSerial(name string, serial string) bool {
+	s := normalizeSerial(serial)
+	return s != "" && strings.Contains(normalizeSerial(name), s)
+}
+
+// Return indexed names containing a game serial, like SLUS-00594, ignoring
+// case and separators.
+func SearchNamesSerial(platform platforms.Platform, systems []System, serial string) ([]SearchResult, error) {
+	return searchNamesGeneric(platform, systems, serial, nameHasSerial)
+}
+
 // Return indexed names matching query using regular expression.
 func SearchNamesRegexp(platform platforms.Platform, systems []System, query string) ([]SearchResult, error) {
 	return searchNamesGeneric(platform, systems, query, func(query, keyName string) bool {
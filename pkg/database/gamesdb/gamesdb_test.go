@@ -0,0 +1,25 @@
+package gamesdb
+
+import "testing"
+
+func TestNameHasSerial(t *testing.T) {
+	tests := []struct {
+		name   string
+		serial string
+		want   bool
+	}{
+		{"Final Fantasy VII (USA) (Disc 1) [SCUS-94163]", "SCUS-94163", true},
+		{"Game (USA) [SLUS_005.94]", "SLUS-00594", true},
+		{"slus00594", "SLUS-00594", true},
+		{"Game (USA) [SLUS-00595]", "SLUS-00594", false},
+		{"Game (USA)", "SLUS-00594", false},
+		{"Game (USA)", "", false},
+	}
+
+	for _, tt := range tests {
+		got := nameHasSerial(tt.name, tt.serial)
+		if got != tt.want {
+			t.Errorf("nameHasSerial(%q, %q) = %t, want %t", tt.name, tt.serial, got, tt.want)
+		}
+	}
+}
@@ -14,18 +14,21 @@ import (
 )
 
 const (
-	MappingTypeUID   = "uid"
-	MappingTypeText  = "text"
-	MappingTypeData  = "data"
-	MatchTypeExact   = "exact"
-	MatchTypePartial = "partial"
-	MatchTypeRegex   = "regex"
+	MappingTypeUID  = "uid"
+	MappingTypeText = "text"
+	MappingTypeData = "data"
+	// MappingTypeFigure matches the ID or name of a decoded toy figure.
+	MappingTypeFigure = "figure"
+	MatchTypeExact    = "exact"
+	MatchTypePartial  = "partial"
+	MatchTypeRegex    = "regex"
 )
 
 var AllowedMappingTypes = []string{
 	MappingTypeUID,
 	MappingTypeText,
 	MappingTypeData,
+	MappingTypeFigure,
 }
 
 var AllowedMatchTypes = []string{
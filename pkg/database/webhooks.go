@@ -0,0 +1,185 @@
+package database
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Webhook is a URL which receives service notifications as HTTP POST
+// requests. An empty list of events receives every notification.
+type Webhook struct {
+	Id      string   `json:"id"`
+	Added   int64    `json:"added"`
+	Label   string   `json:"label"`
+	Enabled bool     `json:"enabled"`
+	Url     string   `json:"url"`
+	Events  []string `json:"events"`
+	Secret  string   `json:"secret"`
+}
+
+func webhookKey(id string) []byte {
+	return []byte(fmt.Sprintf("webhooks:%s", id))
+}
+
+// ValidateWebhookUrl checks a webhook URL is an absolute HTTP or HTTPS URL.
+func ValidateWebhookUrl(s string) error {
+	u, err := url.Parse(s)
+	if err != nil {
+		return fmt.Errorf("invalid webhook url: %s", s)
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("webhook url must be http or https: %s", s)
+	}
+
+	if u.Host == "" {
+		return fmt.Errorf("missing webhook url host: %s", s)
+	}
+
+	return nil
+}
+
+func validateWebhook(w *Webhook) error {
+	err := ValidateWebhookUrl(w.Url)
+	if err != nil {
+		return err
+	}
+
+	events := make([]string, 0, len(w.Events))
+	for _, e := range w.Events {
+		e = strings.TrimSpace(e)
+		if e == "" {
+			return fmt.Errorf("empty webhook event")
+		}
+		events = append(events, e)
+	}
+	w.Events = events
+
+	return nil
+}
+
+func (d *Database) AddWebhook(w Webhook) error {
+	err := validateWebhook(&w)
+	if err != nil {
+		return err
+	}
+
+	w.Added = time.Now().Unix()
+
+	return d.bdb.Update(func(txn *bolt.Tx) error {
+		b := txn.Bucket([]byte(BucketWebhooks))
+		id, _ := b.NextSequence()
+		w.Id = strconv.Itoa(int(id))
+
+		wd, err := json.Marshal(w)
+		if err != nil {
+			return err
+		}
+
+		return b.Put(webhookKey(w.Id), wd)
+	})
+}
+
+func (d *Database) GetWebhook(id string) (Webhook, error) {
+	var w Webhook
+
+	err := d.bdb.View(func(txn *bolt.Tx) error {
+		b := txn.Bucket([]byte(BucketWebhooks))
+
+		v := b.Get(webhookKey(id))
+		if v == nil {
+			return fmt.Errorf("webhook not found: %s", id)
+		}
+
+		return json.Unmarshal(v, &w)
+	})
+
+	w.Id = id
+
+	return w, err
+}
+
+func (d *Database) DeleteWebhook(id string) error {
+	return d.bdb.Update(func(txn *bolt.Tx) error {
+		b := txn.Bucket([]byte(BucketWebhooks))
+		return b.Delete(webhookKey(id))
+	})
+}
+
+func (d *Database) UpdateWebhook(id string, w Webhook) error {
+	err := validateWebhook(&w)
+	if err != nil {
+		return err
+	}
+
+	w.Id = id
+
+	wd, err := json.Marshal(w)
+	if err != nil {
+		return err
+	}
+
+	return d.bdb.Update(func(txn *bolt.Tx) error {
+		b := txn.Bucket([]byte(BucketWebhooks))
+
+		if b.Get(webhookKey(id)) == nil {
+			return fmt.Errorf("webhook not found: %s", id)
+		}
+
+		return b.Put(webhookKey(id), wd)
+	})
+}
+
+func (d *Database) GetAllWebhooks() ([]Webhook, error) {
+	var ws = make([]Webhook, 0)
+
+	err := d.bdb.View(func(txn *bolt.Tx) error {
+		b := txn.Bucket([]byte(BucketWebhooks))
+
+		c := b.Cursor()
+		prefix := []byte("webhooks:")
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			var w Webhook
+			err := json.Unmarshal(v, &w)
+			if err != nil {
+				return err
+			}
+
+			ps := strings.Split(string(k), ":")
+			if len(ps) != 2 {
+				return fmt.Errorf("invalid webhook key: %s", k)
+			}
+
+			w.Id = ps[1]
+
+			ws = append(ws, w)
+		}
+
+		return nil
+	})
+
+	return ws, err
+}
+
+func (d *Database) GetEnabledWebhooks() ([]Webhook, error) {
+	ws, err := d.GetAllWebhooks()
+	if err != nil {
+		return nil, err
+	}
+
+	var enabled = make([]Webhook, 0)
+	for _, w := range ws {
+		if w.Enabled {
+			enabled = append(enabled, w)
+		}
+	}
+
+	return enabled, nil
+}
@@ -37,6 +37,10 @@ import (
 	"github.com/ZaparooProject/zaparoo-core/pkg/platforms"
 )
 
+// Named args which can be added to the end of a token's text. Any other
+// key=value pair after a ? is part of the text.
+var namedArgKeys = []string{"launcher", "max", "mode", "order", "hidden", "session"}
+
 // TODO: adding some logging for each command
 // TODO: game file by hash
 
@@ -47,6 +51,7 @@ var commandMappings = map[string]func(platforms.Platform, platforms.CmdEnv) erro
 	"launch.search": cmdSearch,
 
 	"playlist.play":     cmdPlaylistPlay,
+	"playlist.search":   cmdPlaylistSearch,
 	"playlist.next":     cmdPlaylistNext,
 	"playlist.previous": cmdPlaylistPrevious,
 
@@ -87,6 +92,21 @@ var softwareChangeCommands = []string{
 	"mister.mgl",
 }
 
+// CommandName returns the name of the command in a token's text, like
+// shell in "**shell:reboot", or an empty string if it's not a command.
+func CommandName(text string) string {
+	if !strings.HasPrefix(text, "**") {
+		return ""
+	}
+
+	ps := strings.SplitN(strings.TrimPrefix(text, "**"), ":", 2)
+	if len(ps) < 2 {
+		return ""
+	}
+
+	return strings.ToLower(strings.TrimSpace(ps[0]))
+}
+
 func forwardCmd(pl platforms.Platform, env platforms.CmdEnv) error {
 	return pl.ForwardCmd(env)
 }
@@ -125,6 +145,42 @@ func findFile(pl platforms.Platform, cfg *config.UserConfig, path string) (strin
 	return path, fmt.Errorf("file not found: %s", path)
 }
 
+// SplitNamedArgs removes the named args from the end of a token's text,
+// e.g. ?launcher=foo&max=10. The text after the last ? is only treated as
+// named args if it's all key=value pairs with known keys, so a ? in a path,
+// glob or regex is left alone.
+func SplitNamedArgs(text string) (string, map[string]string) {
+	namedArgs := make(map[string]string)
+
+	i := strings.LastIndex(text, "?")
+	if i == -1 {
+		return text, namedArgs
+	}
+
+	query := text[i+1:]
+	if query == "" {
+		return text, namedArgs
+	}
+
+	for _, pair := range strings.Split(query, "&") {
+		k, _, ok := strings.Cut(pair, "=")
+		if !ok || !slices.Contains(namedArgKeys, k) {
+			return text, namedArgs
+		}
+	}
+
+	qs, err := url.ParseQuery(query)
+	if err != nil {
+		return text, namedArgs
+	}
+
+	for k, v := range qs {
+		namedArgs[k] = v[0]
+	}
+
+	return text[:i], namedArgs
+}
+
 /**
  * Will launch a command related to the token, and if it is a software that will
  * change the currently loaded software will also return a boolean set to true
@@ -139,26 +195,13 @@ func LaunchToken(
 	totalCommands int,
 	currentIndex int,
 ) (error, bool) {
-	namedArgs := make(map[string]string)
-	if i := strings.LastIndex(text, "?"); i != -1 {
-		u, err := url.Parse(text[i:])
-		if err != nil {
-			return err, false
-		}
-
-		qs, err := url.ParseQuery(u.RawQuery)
-		if err != nil {
-			return err, false
-		}
-
-		text = text[:i]
-
-		for k, v := range qs {
-			namedArgs[k] = v[0]
-		}
-	}
+	text, namedArgs := SplitNamedArgs(text)
 	log.Debug().Msgf("named args: %v", namedArgs)
 
+	// readers with the commands role are not allowed to change software
+	commandsOnly := cfg.GetReaderRole(t.Source) == config.ReaderRoleCommands
+	player := cfg.GetReaderPlayer(t.Source)
+
 	// explicit commands must begin with **
 	if strings.HasPrefix(text, "**") {
 		if t.Source == tokens.SourcePlaylist {
@@ -184,12 +227,15 @@ func LaunchToken(
 			Text:          text,
 			TotalCommands: totalCommands,
 			CurrentIndex:  currentIndex,
+			Player:        player,
 		}
 
 		if f, ok := commandMappings[cmd]; ok {
 			log.Info().Msgf("launching command: %s", cmd)
 			softwareChange := slices.Contains(softwareChangeCommands, cmd)
-			if softwareChange {
+			if softwareChange && commandsOnly {
+				return fmt.Errorf("reader only allows commands: %s", t.Source), false
+			} else if softwareChange {
 				// a launch triggered outside a playlist itself
 				log.Debug().Msg("clearing current playlist")
 				plsc.Queue <- nil
@@ -200,6 +246,10 @@ func LaunchToken(
 		}
 	}
 
+	if commandsOnly {
+		return fmt.Errorf("reader only allows commands: %s", t.Source), false
+	}
+
 	if t.Source != tokens.SourcePlaylist {
 		// a launch triggered outside a playlist itself
 		log.Debug().Msg("clearing current playlist")
@@ -216,5 +266,6 @@ func LaunchToken(
 		Text:          text,
 		TotalCommands: totalCommands,
 		CurrentIndex:  currentIndex,
+		Player:        player,
 	}), true
 }
@@ -0,0 +1,38 @@
+package launcher
+
+import "testing"
+
+func TestSplitNamedArgs(t *testing.T) {
+	tests := []struct {
+		input string
+		text  string
+		args  map[string]string
+	}{
+		{"**launch.random:snes", "**launch.random:snes", map[string]string{}},
+		{"snes/game.sfc?launcher=foo", "snes/game.sfc", map[string]string{"launcher": "foo"}},
+		{"**playlist.search:snes/mario?mode=glob&max=5", "**playlist.search:snes/mario", map[string]string{"mode": "glob", "max": "5"}},
+		{"**playlist.search:snes/mari?", "**playlist.search:snes/mari?", map[string]string{}},
+		{"**playlist.search:snes/mari?.sfc", "**playlist.search:snes/mari?.sfc", map[string]string{}},
+		{"**playlist.search:snes/colou?r?mode=regex", "**playlist.search:snes/colou?r", map[string]string{"mode": "regex"}},
+		{"**playlist.search:snes/colou?r", "**playlist.search:snes/colou?r", map[string]string{}},
+		{"**playlist.search:snes/a?b=c", "**playlist.search:snes/a?b=c", map[string]string{}},
+		{"**playlist.search:snes/a?b=c&mode=regex", "**playlist.search:snes/a?b=c&mode=regex", map[string]string{}},
+		{"**launch.system:snes?session=30", "**launch.system:snes", map[string]string{"session": "30"}},
+	}
+
+	for _, tt := range tests {
+		text, args := SplitNamedArgs(tt.input)
+		if text != tt.text {
+			t.Errorf("SplitNamedArgs(%q) text = %q, want %q", tt.input, text, tt.text)
+		}
+		if len(args) != len(tt.args) {
+			t.Errorf("SplitNamedArgs(%q) args = %v, want %v", tt.input, args, tt.args)
+			continue
+		}
+		for k, v := range tt.args {
+			if args[k] != v {
+				t.Errorf("SplitNamedArgs(%q) args = %v, want %v", tt.input, args, tt.args)
+			}
+		}
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/rs/zerolog/log"
@@ -328,6 +330,99 @@ func cmdPlaylistPlay(_ platforms.Platform, env platforms.CmdEnv) error {
 	return nil
 }
 
+// Build a new playlist from the results of a media database query. The
+// query is re-run every time the command is launched, so the playlist will
+// always reflect the current index. Format is <systems>/<query> where
+// systems is a comma separated list of system IDs or "all". Supported named
+// args are "mode" (glob or regex), "max" and "order" (name or random). A ?
+// in the query is part of the query unless it's followed by named args.
+func cmdPlaylistSearch(pl platforms.Platform, env platforms.CmdEnv) error {
+	if env.Args == "" {
+		return fmt.Errorf("no playlist query specified")
+	}
+
+	ps := strings.SplitN(env.Args, "/", 2)
+	if len(ps) < 2 {
+		return fmt.Errorf("invalid playlist query format: %s", env.Args)
+	}
+
+	systemIds, query := ps[0], strings.TrimSpace(ps[1])
+
+	systems := make([]gamesdb.System, 0)
+	if strings.EqualFold(systemIds, "all") {
+		systems = gamesdb.AllSystems()
+	} else {
+		for _, id := range strings.Split(systemIds, ",") {
+			system, err := gamesdb.LookupSystem(strings.TrimSpace(id))
+			if err != nil {
+				return err
+			}
+
+			systems = append(systems, *system)
+		}
+	}
+
+	maxResults := 0
+	if v, ok := env.NamedArgs["max"]; ok {
+		var err error
+		maxResults, err = strconv.Atoi(v)
+		if err != nil || maxResults < 0 {
+			return fmt.Errorf("invalid max value: %s", v)
+		}
+	}
+
+	var res []gamesdb.SearchResult
+	var err error
+
+	switch strings.ToLower(env.NamedArgs["mode"]) {
+	case "", "glob":
+		if query == "" {
+			query = "*"
+		}
+		res, err = gamesdb.SearchNamesGlob(pl, systems, strings.ToLower(query))
+	case "regex":
+		if _, err := regexp.Compile(query); err != nil {
+			return fmt.Errorf("invalid regex query: %s", err)
+		}
+		res, err = gamesdb.SearchNamesRegexp(pl, systems, query)
+	default:
+		return fmt.Errorf("unknown playlist query mode: %s", env.NamedArgs["mode"])
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(res) == 0 {
+		return fmt.Errorf("no results found for: %s", env.Args)
+	}
+
+	switch strings.ToLower(env.NamedArgs["order"]) {
+	case "", "name":
+		sort.SliceStable(res, func(i, j int) bool {
+			return strings.ToLower(res[i].Name) < strings.ToLower(res[j].Name)
+		})
+	case "random":
+		utils.Shuffle(res)
+	default:
+		return fmt.Errorf("unknown playlist order: %s", env.NamedArgs["order"])
+	}
+
+	if maxResults > 0 && len(res) > maxResults {
+		res = res[:maxResults]
+	}
+
+	media := make([]string, 0, len(res))
+	for _, r := range res {
+		media = append(media, r.Path)
+	}
+
+	log.Info().Any("media", media).Msgf("new playlist from query: %s", env.Args)
+	pls := playlists.NewPlaylist(media)
+	env.Playlist.Queue <- pls
+
+	return nil
+}
+
 func cmdPlaylistNext(_ platforms.Platform, env platforms.CmdEnv) error {
 	if env.Playlist.Active == nil {
 		return fmt.Errorf("no playlist active")
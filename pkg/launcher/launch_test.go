@@ -0,0 +1,197 @@
+package launcher
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/ZaparooProject/zaparoo-core/pkg/config"
+	"github.com/ZaparooProject/zaparoo-core/pkg/database/gamesdb"
+	"github.com/ZaparooProject/zaparoo-core/pkg/platforms"
+	"github.com/ZaparooProject/zaparoo-core/pkg/service/playlists"
+)
+
+// testPlatform only provides a config folder, any other method panics.
+type testPlatform struct {
+	platforms.Platform
+	dir string
+}
+
+func (p *testPlatform) ConfigFolder() string {
+	return p.dir
+}
+
+// newSearchPlatform returns a platform with a media database containing
+// the given SNES game names.
+func newSearchPlatform(t *testing.T, names ...string) *testPlatform {
+	t.Helper()
+
+	pl := &testPlatform{dir: t.TempDir()}
+
+	db, err := bolt.Open(filepath.Join(pl.dir, config.GamesDbFilename), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(gamesdb.BucketNames))
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			key := gamesdb.NameKey(gamesdb.SystemSNES, name)
+			err := b.Put([]byte(key), []byte("/games/snes/"+name+".sfc"))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pl
+}
+
+// searchPlaylist runs a playlist.search command and returns the queued
+// playlist media.
+func searchPlaylist(t *testing.T, pl platforms.Platform, args string, namedArgs map[string]string) ([]string, error) {
+	t.Helper()
+
+	queue := make(chan *playlists.Playlist, 1)
+	err := cmdPlaylistSearch(pl, platforms.CmdEnv{
+		Args:      args,
+		NamedArgs: namedArgs,
+		Playlist:  playlists.PlaylistController{Queue: queue},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return (<-queue).Media, nil
+}
+
+func TestPlaylistSearch(t *testing.T) {
+	pl := newSearchPlatform(t,
+		"Super Mario World",
+		"Super Mario Kart",
+		"Donkey Kong Country",
+		"Zelda",
+	)
+
+	tests := []struct {
+		name      string
+		args      string
+		namedArgs map[string]string
+		want      []string
+	}{
+		{
+			"glob",
+			"snes/super mario*",
+			map[string]string{},
+			[]string{"Super Mario Kart", "Super Mario World"},
+		},
+		{
+			"glob with ?",
+			"snes/zeld?",
+			map[string]string{"mode": "glob"},
+			[]string{"Zelda"},
+		},
+		{
+			"empty glob",
+			"snes/",
+			map[string]string{},
+			[]string{"Donkey Kong Country", "Super Mario Kart", "Super Mario World", "Zelda"},
+		},
+		{
+			"regex",
+			"snes/^(Zelda|Donkey)",
+			map[string]string{"mode": "regex"},
+			[]string{"Donkey Kong Country", "Zelda"},
+		},
+		{
+			"max",
+			"snes/*",
+			map[string]string{"max": "2"},
+			[]string{"Donkey Kong Country", "Super Mario Kart"},
+		},
+	}
+
+	for _, tt := range tests {
+		media, err := searchPlaylist(t, pl, tt.args, tt.namedArgs)
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+
+		want := make([]string, 0, len(tt.want))
+		for _, name := range tt.want {
+			want = append(want, "/games/snes/"+name+".sfc")
+		}
+
+		if strings.Join(media, ",") != strings.Join(want, ",") {
+			t.Errorf("%s: expected %v, got %v", tt.name, want, media)
+		}
+	}
+}
+
+func TestPlaylistSearchRandom(t *testing.T) {
+	names := []string{"A", "B", "C", "D", "E", "F"}
+	pl := newSearchPlatform(t, names...)
+
+	media, err := searchPlaylist(t, pl, "snes/*", map[string]string{"order": "random"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every result is still included once
+	sorted := append([]string{}, media...)
+	sort.Strings(sorted)
+	want := make([]string, 0, len(names))
+	for _, name := range names {
+		want = append(want, "/games/snes/"+name+".sfc")
+	}
+	if strings.Join(sorted, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected shuffled %v, got %v", want, media)
+	}
+
+	// max is applied after shuffling
+	media, err = searchPlaylist(t, pl, "snes/*", map[string]string{"order": "random", "max": "3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(media) != 3 {
+		t.Fatalf("expected 3 results, got %v", media)
+	}
+}
+
+func TestPlaylistSearchErrors(t *testing.T) {
+	pl := newSearchPlatform(t, "Zelda")
+
+	tests := []struct {
+		name      string
+		args      string
+		namedArgs map[string]string
+	}{
+		{"unknown mode", "snes/*", map[string]string{"mode": "fuzzy"}},
+		{"unknown order", "snes/*", map[string]string{"order": "date"}},
+		{"invalid max", "snes/*", map[string]string{"max": "-1"}},
+		{"invalid regex", "snes/(", map[string]string{"mode": "regex"}},
+		{"unknown system", "nope/*", map[string]string{}},
+		{"no results", "snes/mario*", map[string]string{}},
+		{"no query", "snes", map[string]string{}},
+	}
+
+	for _, tt := range tests {
+		if _, err := searchPlaylist(t, pl, tt.args, tt.namedArgs); err == nil {
+			t.Errorf("%s: expected error", tt.name)
+		}
+	}
+}
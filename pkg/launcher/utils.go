@@ -28,5 +28,11 @@ func cmdShell(pl platforms.Platform, env platforms.CmdEnv) error {
 		return fmt.Errorf("shell commands must be manually run")
 	}
 
-	return pl.Shell(env.Args)
+	// expose the reader's player slot to the command, like MiSTer scripts
+	cmd := env.Args
+	if env.Player > 0 {
+		cmd = "export TAPTO_PLAYER=" + strconv.Itoa(env.Player) + "; " + cmd
+	}
+
+	return pl.Shell(cmd)
 }
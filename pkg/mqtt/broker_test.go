@@ -0,0 +1,434 @@
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testBroker is a minimal in-process MQTT 3.1.1 broker, just enough to run
+// the client against. Messages are only ever delivered at QoS 0.
+type testBroker struct {
+	t        *testing.T
+	ln       net.Listener
+	mu       sync.Mutex
+	conns    map[*brokerConn]struct{}
+	retained map[string][]byte
+	// published receives every message published by a client
+	published chan brokerMsg
+}
+
+type brokerMsg struct {
+	Topic    string
+	Payload  []byte
+	Retained bool
+}
+
+type brokerConn struct {
+	conn    net.Conn
+	writeMu sync.Mutex
+	mu      sync.Mutex
+	subs    []string
+}
+
+const (
+	pktConnect     = 1
+	pktConnack     = 2
+	pktPublish     = 3
+	pktPuback      = 4
+	pktSubscribe   = 8
+	pktSuback      = 9
+	pktUnsubscribe = 10
+	pktUnsuback    = 11
+	pktPingreq     = 12
+	pktPingresp    = 13
+	pktDisconnect  = 14
+)
+
+func newTestBroker(t *testing.T) *testBroker {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := &testBroker{
+		t:         t,
+		ln:        ln,
+		conns:     make(map[*brokerConn]struct{}),
+		retained:  make(map[string][]byte),
+		published: make(chan brokerMsg, 100),
+	}
+
+	go b.accept()
+	t.Cleanup(b.close)
+
+	return b
+}
+
+func (b *testBroker) url() string {
+	return "tcp://" + b.ln.Addr().String()
+}
+
+func (b *testBroker) close() {
+	_ = b.ln.Close()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for c := range b.conns {
+		_ = c.conn.Close()
+	}
+}
+
+func (b *testBroker) accept() {
+	for {
+		conn, err := b.ln.Accept()
+		if err != nil {
+			return
+		}
+
+		c := &brokerConn{conn: conn}
+		b.mu.Lock()
+		b.conns[c] = struct{}{}
+		b.mu.Unlock()
+
+		go b.serve(c)
+	}
+}
+
+// topicMatches returns true if a topic matches a subscription filter,
+// including the + and # wildcards.
+func topicMatches(filter string, topic string) bool {
+	fs := strings.Split(filter, "/")
+	ts := strings.Split(topic, "/")
+
+	for i, f := range fs {
+		if f == "#" {
+			return true
+		}
+		if i >= len(ts) {
+			return false
+		}
+		if f != "+" && f != ts[i] {
+			return false
+		}
+	}
+
+	return len(fs) == len(ts)
+}
+
+func readPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	length := 0
+	for shift := 0; ; shift += 7 {
+		if shift > 21 {
+			return 0, nil, errors.New("invalid remaining length")
+		}
+		d, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length |= int(d&0x7f) << shift
+		if d&0x80 == 0 {
+			break
+		}
+	}
+
+	body := make([]byte, length)
+	_, err = io.ReadFull(r, body)
+	return header, body, err
+}
+
+func encodePacket(header byte, body []byte) []byte {
+	pkt := []byte{header}
+	length := len(body)
+	for {
+		d := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			d |= 0x80
+		}
+		pkt = append(pkt, d)
+		if length == 0 {
+			break
+		}
+	}
+	return append(pkt, body...)
+}
+
+func encodeString(s string) []byte {
+	b := make([]byte, 2, 2+len(s))
+	binary.BigEndian.PutUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+func readString(body []byte) (string, []byte) {
+	if len(body) < 2 {
+		return "", nil
+	}
+	n := int(binary.BigEndian.Uint16(body))
+	if len(body) < 2+n {
+		return "", nil
+	}
+	return string(body[2 : 2+n]), body[2+n:]
+}
+
+func (c *brokerConn) write(header byte, body []byte) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, _ = c.conn.Write(encodePacket(header, body))
+}
+
+func (c *brokerConn) subscribed(topic string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, f := range c.subs {
+		if topicMatches(f, topic) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *brokerConn) deliver(m brokerMsg) {
+	header := byte(pktPublish << 4)
+	if m.Retained {
+		header |= 0x01
+	}
+	c.write(header, append(encodeString(m.Topic), m.Payload...))
+}
+
+// inject publishes a message to subscribed clients as if it came from
+// another client.
+func (b *testBroker) inject(topic string, payload string) {
+	b.route(brokerMsg{Topic: topic, Payload: []byte(payload)})
+}
+
+func (b *testBroker) route(m brokerMsg) {
+	b.mu.Lock()
+	if m.Retained {
+		if len(m.Payload) == 0 {
+			delete(b.retained, m.Topic)
+		} else {
+			b.retained[m.Topic] = m.Payload
+		}
+	}
+	conns := make([]*brokerConn, 0, len(b.conns))
+	for c := range b.conns {
+		conns = append(conns, c)
+	}
+	b.mu.Unlock()
+
+	// retained messages are only flagged when sent for a new subscription
+	m.Retained = false
+	for _, c := range conns {
+		if c.subscribed(m.Topic) {
+			c.deliver(m)
+		}
+	}
+}
+
+// getRetained returns the retained message of a topic.
+func (b *testBroker) getRetained(topic string) ([]byte, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	v, ok := b.retained[topic]
+	return v, ok
+}
+
+// waitRetained waits until a topic's retained message is the expected one.
+func (b *testBroker) waitRetained(topic string, want string) {
+	b.t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		v, ok := b.getRetained(topic)
+		if ok && string(v) == want {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	v, _ := b.getRetained(topic)
+	b.t.Fatalf("retained %s: got %q, want %q", topic, v, want)
+}
+
+// waitPublished waits for a client to publish to a topic.
+func (b *testBroker) waitPublished(topic string) brokerMsg {
+	b.t.Helper()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case m := <-b.published:
+			if m.Topic == topic {
+				return m
+			}
+		case <-timeout:
+			b.t.Fatalf("timed out waiting for publish to %s", topic)
+		}
+	}
+}
+
+// waitSubscribed waits until a client has subscribed to a topic.
+func (b *testBroker) waitSubscribed(topic string) {
+	b.t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		b.mu.Lock()
+		conns := make([]*brokerConn, 0, len(b.conns))
+		for c := range b.conns {
+			conns = append(conns, c)
+		}
+		b.mu.Unlock()
+
+		for _, c := range conns {
+			if c.subscribed(topic) {
+				return
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	b.t.Fatalf("timed out waiting for subscription to %s", topic)
+}
+
+func (b *testBroker) serve(c *brokerConn) {
+	defer func() {
+		_ = c.conn.Close()
+		b.mu.Lock()
+		delete(b.conns, c)
+		b.mu.Unlock()
+	}()
+
+	r := bufio.NewReader(c.conn)
+	for {
+		header, body, err := readPacket(r)
+		if err != nil {
+			return
+		}
+
+		switch header >> 4 {
+		case pktConnect:
+			c.write(pktConnack<<4, []byte{0, 0})
+		case pktPublish:
+			qos := (header >> 1) & 0x03
+			topic, rest := readString(body)
+			if qos > 0 {
+				if len(rest) < 2 {
+					return
+				}
+				c.write(pktPuback<<4, rest[:2])
+				rest = rest[2:]
+			}
+
+			m := brokerMsg{
+				Topic:    topic,
+				Payload:  append([]byte(nil), rest...),
+				Retained: header&0x01 != 0,
+			}
+			select {
+			case b.published <- m:
+			default:
+			}
+			b.route(m)
+		case pktSubscribe:
+			if len(body) < 2 {
+				return
+			}
+			id, rest := body[:2], body[2:]
+			var filters []string
+			granted := append([]byte(nil), id...)
+			for len(rest) > 0 {
+				var f string
+				f, rest = readString(rest)
+				if len(rest) < 1 {
+					return
+				}
+				rest = rest[1:]
+				filters = append(filters, f)
+				granted = append(granted, 0)
+			}
+
+			c.mu.Lock()
+			c.subs = append(c.subs, filters...)
+			c.mu.Unlock()
+			c.write(pktSuback<<4, granted)
+
+			b.mu.Lock()
+			var retained []brokerMsg
+			for topic, payload := range b.retained {
+				for _, f := range filters {
+					if topicMatches(f, topic) {
+						retained = append(retained, brokerMsg{
+							Topic:    topic,
+							Payload:  payload,
+							Retained: true,
+						})
+						break
+					}
+				}
+			}
+			b.mu.Unlock()
+
+			for _, m := range retained {
+				c.deliver(m)
+			}
+		case pktUnsubscribe:
+			if len(body) < 2 {
+				return
+			}
+			id, rest := body[:2], body[2:]
+			c.mu.Lock()
+			for len(rest) > 0 {
+				var f string
+				f, rest = readString(rest)
+				for i, s := range c.subs {
+					if s == f {
+						c.subs = append(c.subs[:i], c.subs[i+1:]...)
+						break
+					}
+				}
+			}
+			c.mu.Unlock()
+			c.write(pktUnsuback<<4, id)
+		case pktPingreq:
+			c.write(pktPingresp<<4, nil)
+		case pktDisconnect:
+			return
+		}
+	}
+}
+
+func TestTopicMatches(t *testing.T) {
+	tests := []struct {
+		filter string
+		topic  string
+		want   bool
+	}{
+		{"zaparoo/command", "zaparoo/command", true},
+		{"zaparoo/command", "zaparoo/token", false},
+		{"zaparoo/+", "zaparoo/token", true},
+		{"zaparoo/+", "zaparoo/events/media.started", false},
+		{"zaparoo/#", "zaparoo/events/media.started", true},
+		{"#", "zaparoo/status", true},
+		{"zaparoo/status/extra", "zaparoo/status", false},
+	}
+
+	for _, tt := range tests {
+		got := topicMatches(tt.filter, tt.topic)
+		if got != tt.want {
+			t.Errorf("topicMatches(%q, %q) = %t, want %t", tt.filter, tt.topic, got, tt.want)
+		}
+	}
+}
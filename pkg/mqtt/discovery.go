@@ -0,0 +1,98 @@
+package mqtt
+
+import (
+	"regexp"
+
+	"github.com/ZaparooProject/zaparoo-core/pkg/config"
+)
+
+// Home Assistant MQTT discovery, see:
+// https://www.home-assistant.io/integrations/mqtt/#mqtt-discovery
+
+type haDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+	SwVersion    string   `json:"sw_version"`
+}
+
+type haEntity struct {
+	Name                string   `json:"name"`
+	UniqueId            string   `json:"unique_id"`
+	Icon                string   `json:"icon,omitempty"`
+	StateTopic          string   `json:"state_topic,omitempty"`
+	ValueTemplate       string   `json:"value_template,omitempty"`
+	JsonAttributesTopic string   `json:"json_attributes_topic,omitempty"`
+	CommandTopic        string   `json:"command_topic,omitempty"`
+	Max                 int      `json:"max,omitempty"`
+	AvailabilityTopic   string   `json:"availability_topic"`
+	Device              haDevice `json:"device"`
+}
+
+var nodeIdRe = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// nodeId is the client ID made safe for use in discovery topics.
+func nodeId(clientId string) string {
+	return nodeIdRe.ReplaceAllString(clientId, "_")
+}
+
+// discoveryConfigs returns the discovery config of each entity, by topic.
+func (c *Client) discoveryConfigs() map[string]haEntity {
+	node := nodeId(c.cfg.GetMqttClientId())
+	prefix := c.cfg.GetMqttDiscoveryPrefix()
+
+	device := haDevice{
+		Identifiers:  []string{node},
+		Name:         "Zaparoo",
+		Manufacturer: "Zaparoo",
+		SwVersion:    config.Version,
+	}
+
+	return map[string]haEntity{
+		prefix + "/sensor/" + node + "/token/config": {
+			Name:                "Active token",
+			UniqueId:            node + "_token",
+			Icon:                "mdi:nfc-variant",
+			StateTopic:          c.topic(TopicToken),
+			ValueTemplate:       "{{ value_json.text if value_json.text else value_json.uid }}",
+			JsonAttributesTopic: c.topic(TopicToken),
+			AvailabilityTopic:   c.topic(TopicStatus),
+			Device:              device,
+		},
+		prefix + "/sensor/" + node + "/media/config": {
+			Name:                "Media",
+			UniqueId:            node + "_media",
+			Icon:                "mdi:gamepad-variant",
+			StateTopic:          c.topic(TopicMedia),
+			ValueTemplate:       "{{ value_json.mediaName }}",
+			JsonAttributesTopic: c.topic(TopicMedia),
+			AvailabilityTopic:   c.topic(TopicStatus),
+			Device:              device,
+		},
+		prefix + "/sensor/" + node + "/readers/config": {
+			Name:              "Readers",
+			UniqueId:          node + "_readers",
+			Icon:              "mdi:contactless-payment",
+			StateTopic:        c.topic(TopicReaders),
+			ValueTemplate:     "{{ value_json | count }}",
+			AvailabilityTopic: c.topic(TopicStatus),
+			Device:            device,
+		},
+		prefix + "/text/" + node + "/launch/config": {
+			Name:              "Launch",
+			UniqueId:          node + "_launch",
+			Icon:              "mdi:play",
+			CommandTopic:      c.topic(TopicCommand),
+			Max:               255,
+			AvailabilityTopic: c.topic(TopicStatus),
+			Device:            device,
+		},
+	}
+}
+
+// publishDiscovery announces the service's entities to Home Assistant.
+func (c *Client) publishDiscovery() {
+	for topic, entity := range c.discoveryConfigs() {
+		c.publish(topic, true, entity)
+	}
+}
@@ -0,0 +1,256 @@
+// Package mqtt publishes service notifications to an MQTT broker and
+// accepts tokens to launch from a command topic, for use with home
+// automation systems like Home Assistant.
+//
+// All topics start with the configured prefix, zaparoo by default:
+//
+//	zaparoo/status          online or offline, retained
+//	zaparoo/token           the active token, retained
+//	zaparoo/media           the running media, retained
+//	zaparoo/readers         connected reader devices, retained
+//	zaparoo/events/<method> every notification, e.g. zaparoo/events/media.started
+//	zaparoo/command         text or launch params of a token to launch
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ZaparooProject/zaparoo-core/pkg/api/models"
+	"github.com/ZaparooProject/zaparoo-core/pkg/config"
+	"github.com/ZaparooProject/zaparoo-core/pkg/service/state"
+	"github.com/ZaparooProject/zaparoo-core/pkg/service/tokens"
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	TopicStatus   = "status"
+	TopicToken    = "token"
+	TopicMedia    = "media"
+	TopicReaders  = "readers"
+	TopicEvents   = "events"
+	TopicCommand  = "command"
+	StatusOnline  = "online"
+	StatusOffline = "offline"
+	// SourceMqtt is the source of tokens launched from the command topic.
+	SourceMqtt = "MQTT"
+)
+
+const (
+	connectTimeout    = 10 * time.Second
+	disconnectTimeout = 250 // milliseconds
+)
+
+type Client struct {
+	cfg    *config.UserConfig
+	st     *state.State
+	itq    chan<- tokens.Token
+	prefix string
+	client paho.Client
+}
+
+func (c *Client) topic(name string) string {
+	return c.prefix + "/" + name
+}
+
+// publish sends a message without waiting for it to be delivered, errors
+// are logged when they happen.
+func (c *Client) publish(topic string, retained bool, payload any) {
+	var data []byte
+	switch v := payload.(type) {
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		var err error
+		data, err = json.Marshal(v)
+		if err != nil {
+			log.Error().Err(err).Msgf("error marshalling mqtt payload for %s", topic)
+			return
+		}
+	}
+
+	t := c.client.Publish(topic, 1, retained, data)
+	go func() {
+		<-t.Done()
+		if t.Error() != nil {
+			log.Warn().Err(t.Error()).Msgf("error publishing to mqtt topic %s", topic)
+		}
+	}()
+}
+
+func (c *Client) publishReaders() {
+	rs := c.st.ListReaders()
+	if rs == nil {
+		rs = make([]string, 0)
+	}
+	sort.Strings(rs)
+	c.publish(c.topic(TopicReaders), true, rs)
+}
+
+func (c *Client) publishToken(t tokens.Token) {
+	c.publish(c.topic(TopicToken), true, models.TokenResponse{
+		Type:     t.Type,
+		UID:      t.UID,
+		Text:     t.Text,
+		Data:     t.Data,
+		ScanTime: t.ScanTime,
+		Figure:   t.Figure,
+	})
+}
+
+// handleNotification publishes a service notification as an event and
+// updates the matching state topic.
+func (c *Client) handleNotification(n models.Notification) {
+	c.publish(c.topic(TopicEvents+"/"+n.Method), false, n.Params)
+
+	switch n.Method {
+	case models.TokensActive:
+		c.publish(c.topic(TopicToken), true, n.Params)
+	case models.MediaStarted:
+		c.publish(c.topic(TopicMedia), true, n.Params)
+	case models.MediaStopped:
+		c.publish(c.topic(TopicMedia), true, models.MediaStartedParams{})
+	case models.ReadersConnected, models.ReadersDisconnected:
+		c.publishReaders()
+	}
+}
+
+// parseCommand builds a token from a command message, which is either
+// launch params in JSON like the API's launch method or plain token text.
+func parseCommand(payload []byte) (tokens.Token, bool) {
+	var t tokens.Token
+
+	var params models.LaunchParams
+	err := json.Unmarshal(payload, &params)
+	if err == nil {
+		if params.Type != nil {
+			t.Type = *params.Type
+		}
+		if params.UID != nil {
+			t.UID = *params.UID
+		}
+		if params.Text != nil {
+			t.Text = norm.NFC.String(*params.Text)
+		}
+		if params.Data != nil {
+			t.Data = *params.Data
+		}
+	} else {
+		t.Text = norm.NFC.String(strings.TrimSpace(string(payload)))
+	}
+
+	if t.UID == "" && t.Text == "" && t.Data == "" {
+		return t, false
+	}
+
+	t.ScanTime = time.Now()
+	t.Remote = true
+	t.Source = SourceMqtt
+
+	return t, true
+}
+
+func (c *Client) handleCommand(_ paho.Client, msg paho.Message) {
+	t, ok := parseCommand(msg.Payload())
+	if !ok {
+		log.Warn().Msgf("invalid mqtt command: %s", msg.Payload())
+		return
+	}
+
+	log.Info().Msgf("launching mqtt token: %v", t)
+	c.st.SetActiveCard(t)
+	c.itq <- t
+}
+
+// onConnect runs on every connection to the broker, including reconnects,
+// because the broker may have forgotten the session.
+func (c *Client) onConnect(client paho.Client) {
+	log.Info().Msgf("connected to mqtt broker: %s", c.cfg.GetMqttBroker())
+
+	c.publish(c.topic(TopicStatus), true, StatusOnline)
+	c.publishReaders()
+	c.publishToken(c.st.GetActiveCard())
+
+	if c.cfg.GetMqttDiscovery() {
+		c.publishDiscovery()
+	}
+
+	t := client.Subscribe(c.topic(TopicCommand), 1, c.handleCommand)
+	go func() {
+		<-t.Done()
+		if t.Error() != nil {
+			log.Error().Err(t.Error()).Msg("error subscribing to mqtt command topic")
+		}
+	}()
+}
+
+// Start connects to the configured MQTT broker and publishes notifications
+// until the service stops. The returned function disconnects from the
+// broker.
+func Start(
+	cfg *config.UserConfig,
+	st *state.State,
+	itq chan<- tokens.Token,
+	ns <-chan models.Notification,
+) (func(), error) {
+	broker := cfg.GetMqttBroker()
+	u, err := url.Parse(broker)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid mqtt broker, must be a url like tcp://host:1883: %s", broker)
+	}
+
+	c := &Client{
+		cfg:    cfg,
+		st:     st,
+		itq:    itq,
+		prefix: cfg.GetMqttTopicPrefix(),
+	}
+
+	opts := paho.NewClientOptions().
+		AddBroker(broker).
+		SetClientID(cfg.GetMqttClientId()).
+		SetUsername(cfg.GetMqttUsername()).
+		SetPassword(cfg.GetMqttPassword()).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectTimeout(connectTimeout).
+		SetOrderMatters(false).
+		SetWill(c.topic(TopicStatus), StatusOffline, 1, true).
+		SetOnConnectHandler(c.onConnect).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			log.Warn().Err(err).Msg("lost connection to mqtt broker")
+		})
+
+	c.client = paho.NewClient(opts)
+
+	// with connect retry enabled, this keeps trying to connect in the
+	// background and onConnect runs once it has
+	c.client.Connect()
+
+	go func() {
+		for !st.ShouldStopService() {
+			select {
+			case n := <-ns:
+				c.handleNotification(n)
+			case <-time.After(500 * time.Millisecond):
+				continue
+			}
+		}
+	}()
+
+	return func() {
+		if c.client.IsConnected() {
+			t := c.client.Publish(c.topic(TopicStatus), 1, true, StatusOffline)
+			t.WaitTimeout(time.Second)
+		}
+		c.client.Disconnect(disconnectTimeout)
+	}, nil
+}
@@ -0,0 +1,234 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/ZaparooProject/zaparoo-core/pkg/api/models"
+	"github.com/ZaparooProject/zaparoo-core/pkg/config"
+	"github.com/ZaparooProject/zaparoo-core/pkg/service/state"
+	"github.com/ZaparooProject/zaparoo-core/pkg/service/tokens"
+)
+
+func startClient(t *testing.T, cfg *config.UserConfig) (*testBroker, *state.State, chan tokens.Token) {
+	t.Helper()
+
+	b := newTestBroker(t)
+	cfg.SetMqttBroker(b.url())
+	if cfg.Mqtt.ClientId == "" {
+		cfg.Mqtt.ClientId = "test"
+	}
+
+	st, ns := state.NewState(nil)
+	itq := make(chan tokens.Token, 10)
+
+	stop, err := Start(cfg, st, itq, ns)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		stop()
+		st.StopService()
+	})
+
+	b.waitSubscribed("zaparoo/command")
+
+	return b, st, itq
+}
+
+func mustJson(t *testing.T, v any) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestStartInvalidBroker(t *testing.T) {
+	cfg := &config.UserConfig{}
+	cfg.SetMqttBroker("localhost")
+
+	st, ns := state.NewState(nil)
+	_, err := Start(cfg, st, make(chan tokens.Token), ns)
+	if err == nil {
+		t.Fatal("expected error for broker without scheme")
+	}
+}
+
+func TestConnectPublishesState(t *testing.T) {
+	cfg := &config.UserConfig{}
+	cfg.Mqtt.ClientId = "tapto-my.host"
+	cfg.SetMqttDiscovery(true)
+
+	b, _, _ := startClient(t, cfg)
+
+	b.waitRetained("zaparoo/status", StatusOnline)
+	b.waitRetained("zaparoo/readers", "[]")
+
+	raw := b.waitPublished("homeassistant/text/tapto-my_host/launch/config")
+	var entity haEntity
+	err := json.Unmarshal(raw.Payload, &entity)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if entity.CommandTopic != "zaparoo/command" {
+		t.Errorf("command topic = %s, want zaparoo/command", entity.CommandTopic)
+	}
+	if entity.AvailabilityTopic != "zaparoo/status" {
+		t.Errorf("availability topic = %s, want zaparoo/status", entity.AvailabilityTopic)
+	}
+
+	_, ok := b.getRetained("homeassistant/sensor/tapto-my_host/token/config")
+	if !ok {
+		t.Error("missing token sensor discovery config")
+	}
+}
+
+func TestNoDiscovery(t *testing.T) {
+	b, _, _ := startClient(t, &config.UserConfig{})
+
+	b.waitRetained("zaparoo/status", StatusOnline)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for topic := range b.retained {
+		if topicMatches("homeassistant/#", topic) {
+			t.Errorf("unexpected discovery config: %s", topic)
+		}
+	}
+}
+
+func TestTopicPrefix(t *testing.T) {
+	cfg := &config.UserConfig{}
+	cfg.Mqtt.TopicPrefix = "/house/arcade/"
+
+	b := newTestBroker(t)
+	cfg.SetMqttBroker(b.url())
+	cfg.Mqtt.ClientId = "test"
+
+	st, ns := state.NewState(nil)
+	stop, err := Start(cfg, st, make(chan tokens.Token), ns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		stop()
+		st.StopService()
+	}()
+
+	b.waitRetained("house/arcade/status", StatusOnline)
+}
+
+func TestNotifications(t *testing.T) {
+	b, st, _ := startClient(t, &config.UserConfig{})
+
+	token := tokens.Token{
+		UID:      "04aabbccdd2280",
+		Text:     "**launch.random:snes",
+		ScanTime: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	st.SetActiveCard(token)
+
+	want := mustJson(t, models.TokenResponse{
+		UID:      token.UID,
+		Text:     token.Text,
+		ScanTime: token.ScanTime,
+	})
+
+	m := b.waitPublished("zaparoo/events/" + models.TokensActive)
+	if string(m.Payload) != want {
+		t.Errorf("event payload = %s, want %s", m.Payload, want)
+	}
+	b.waitRetained("zaparoo/token", want)
+
+	media := models.MediaStartedParams{
+		SystemId:   "SNES",
+		SystemName: "Super Nintendo",
+		MediaPath:  "/media/fat/games/SNES/game.sfc",
+		MediaName:  "Game",
+	}
+	st.Notifications <- models.Notification{
+		Method: models.MediaStarted,
+		Params: media,
+	}
+	b.waitRetained("zaparoo/media", mustJson(t, media))
+
+	st.Notifications <- models.Notification{
+		Method: models.MediaStopped,
+	}
+	b.waitPublished("zaparoo/events/" + models.MediaStopped)
+	b.waitRetained("zaparoo/media", mustJson(t, models.MediaStartedParams{}))
+}
+
+func TestCommand(t *testing.T) {
+	b, st, itq := startClient(t, &config.UserConfig{})
+
+	b.inject("zaparoo/command", "**launch.random:snes\n")
+
+	select {
+	case tok := <-itq:
+		if tok.Text != "**launch.random:snes" {
+			t.Errorf("text = %q, want **launch.random:snes", tok.Text)
+		}
+		if !tok.Remote || tok.Source != SourceMqtt {
+			t.Errorf("token not marked as remote mqtt token: %v", tok)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for token")
+	}
+
+	if st.GetActiveCard().Text != "**launch.random:snes" {
+		t.Errorf("active card not set: %v", st.GetActiveCard())
+	}
+
+	b.inject("zaparoo/command", `{"uid":"04aabbccdd2280","text":"Genesis/Sonic.md"}`)
+
+	select {
+	case tok := <-itq:
+		if tok.UID != "04aabbccdd2280" || tok.Text != "Genesis/Sonic.md" {
+			t.Errorf("unexpected token: %v", tok)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for token")
+	}
+}
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		ok      bool
+		uid     string
+		text    string
+	}{
+		{"plain text", "**launch.random:snes", true, "", "**launch.random:snes"},
+		{"trimmed", "  SNES/game.sfc\r\n", true, "", "SNES/game.sfc"},
+		{"json text", `{"text":"SNES/game.sfc"}`, true, "", "SNES/game.sfc"},
+		{"json uid", `{"uid":"04aabbcc"}`, true, "04aabbcc", ""},
+		{"empty", "", false, "", ""},
+		{"whitespace", " \n", false, "", ""},
+		{"empty json", `{}`, false, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tok, ok := parseCommand([]byte(tt.payload))
+			if ok != tt.ok {
+				t.Fatalf("ok = %t, want %t", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if tok.UID != tt.uid || tok.Text != tt.text {
+				t.Errorf("got uid=%q text=%q, want uid=%q text=%q", tok.UID, tok.Text, tt.uid, tt.text)
+			}
+			if !tok.Remote || tok.Source != SourceMqtt || tok.ScanTime.IsZero() {
+				t.Errorf("token not marked as scanned remote mqtt token: %v", tok)
+			}
+		})
+	}
+}
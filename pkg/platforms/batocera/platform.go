@@ -14,7 +14,11 @@ import (
 	"github.com/ZaparooProject/zaparoo-core/pkg/platforms"
 	"github.com/ZaparooProject/zaparoo-core/pkg/readers"
 	"github.com/ZaparooProject/zaparoo-core/pkg/readers/file"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/hid_keyboard"
 	"github.com/ZaparooProject/zaparoo-core/pkg/readers/libnfc"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/network"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/pn532_i2c"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/pn532_spi"
 	"github.com/ZaparooProject/zaparoo-core/pkg/readers/simple_serial"
 	"github.com/rs/zerolog/log"
 )
@@ -29,8 +33,12 @@ func (p *Platform) Id() string {
 func (p *Platform) SupportedReaders(cfg *config.UserConfig) []readers.Reader {
 	return []readers.Reader{
 		libnfc.NewReader(cfg),
+		pn532_i2c.NewReader(cfg),
+		pn532_spi.NewReader(cfg),
 		file.NewReader(cfg),
 		simple_serial.NewReader(cfg),
+		network.NewReader(cfg),
+		hid_keyboard.NewReader(cfg),
 	}
 }
 
@@ -11,6 +11,7 @@ import (
 	"github.com/ZaparooProject/zaparoo-core/pkg/platforms"
 	"github.com/ZaparooProject/zaparoo-core/pkg/readers"
 	"github.com/ZaparooProject/zaparoo-core/pkg/readers/file"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/network"
 	"github.com/ZaparooProject/zaparoo-core/pkg/readers/pn532_uart"
 	"github.com/ZaparooProject/zaparoo-core/pkg/readers/simple_serial"
 	"github.com/rs/zerolog/log"
@@ -27,6 +28,7 @@ func (p *Platform) SupportedReaders(cfg *config.UserConfig) []readers.Reader {
 	return []readers.Reader{
 		file.NewReader(cfg),
 		simple_serial.NewReader(cfg),
+		network.NewReader(cfg),
 		pn532_uart.NewReader(cfg),
 	}
 }
@@ -76,9 +76,15 @@ func cmdMisterScript(plm Platform) func(platforms.Platform, platforms.CmdEnv) er
 
 		script = scriptPath
 
+		// expose the reader's player slot to the script
+		var scriptEnv []string
+		if env.Player > 0 {
+			scriptEnv = append(scriptEnv, "TAPTO_PLAYER="+strconv.Itoa(env.Player))
+		}
+
 		args = args[1:]
 		if len(args) == 0 {
-			return runScript(plm, script, "", hidden)
+			return runScript(plm, script, "", hidden, scriptEnv)
 		}
 
 		cleaned := "'"
@@ -103,7 +109,7 @@ func cmdMisterScript(plm Platform) func(platforms.Platform, platforms.CmdEnv) er
 		cleaned += "'"
 
 		log.Info().Msgf("running script: %s", script+" "+cleaned)
-		return runScript(plm, script, cleaned, hidden)
+		return runScript(plm, script, cleaned, hidden, scriptEnv)
 	}
 }
 
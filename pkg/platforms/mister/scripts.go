@@ -62,7 +62,7 @@ func openConsole(kbd input.Keyboard, vt string) error {
 	return nil
 }
 
-func runScript(pl Platform, bin string, args string, hidden bool) error {
+func runScript(pl Platform, bin string, args string, hidden bool, env []string) error {
 	if _, err := os.Stat(bin); err != nil {
 		return err
 	}
@@ -93,14 +93,19 @@ func runScript(pl Platform, bin string, args string, hidden bool) error {
 			return err
 		}
 
+		exports := ""
+		for _, v := range env {
+			exports += "export " + v + "\n"
+		}
+
 		// this is how mister launches scripts itself
 		launcher := fmt.Sprintf(`#!/bin/bash
 export LC_ALL=en_US.UTF-8
 export HOME=/root
 export LESSKEY=/media/fat/linux/lesskey
-cd $(dirname "%s")
+%scd $(dirname "%s")
 %s
-`, bin, bin+" "+args)
+`, exports, bin, bin+" "+args)
 
 		err = os.WriteFile("/tmp/script", []byte(launcher), 0755)
 		if err != nil {
@@ -131,6 +136,7 @@ cd $(dirname "%s")
 		cmd.Env = append(cmd.Env, "LC_ALL=en_US.UTF-8")
 		cmd.Env = append(cmd.Env, "HOME=/root")
 		cmd.Env = append(cmd.Env, "LESSKEY=/media/fat/linux/lesskey")
+		cmd.Env = append(cmd.Env, env...)
 		cmd.Dir = filepath.Dir(bin)
 		return cmd.Run()
 	}
@@ -18,6 +18,8 @@ type CmdEnv struct {
 	Text          string
 	TotalCommands int
 	CurrentIndex  int
+	// Player slot of the reader the token was scanned on, 0 if none.
+	Player int
 }
 
 type ScanResult struct {
@@ -22,8 +22,11 @@ package steamos
 
 import (
 	"errors"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/hid_keyboard"
 	"github.com/ZaparooProject/zaparoo-core/pkg/readers/libnfc"
 	"github.com/ZaparooProject/zaparoo-core/pkg/readers/optical_drive"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/pn532_i2c"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/pn532_spi"
 	"github.com/ZaparooProject/zaparoo-core/pkg/service/tokens"
 	"github.com/ZaparooProject/zaparoo-core/pkg/utils"
 	"github.com/adrg/xdg"
@@ -38,6 +41,7 @@ import (
 	"github.com/ZaparooProject/zaparoo-core/pkg/platforms"
 	"github.com/ZaparooProject/zaparoo-core/pkg/readers"
 	"github.com/ZaparooProject/zaparoo-core/pkg/readers/file"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/network"
 	"github.com/ZaparooProject/zaparoo-core/pkg/readers/simple_serial"
 	"github.com/rs/zerolog/log"
 )
@@ -52,8 +56,12 @@ func (p *Platform) SupportedReaders(cfg *config.UserConfig) []readers.Reader {
 	return []readers.Reader{
 		file.NewReader(cfg),
 		simple_serial.NewReader(cfg),
+		network.NewReader(cfg),
+		hid_keyboard.NewReader(cfg),
 		libnfc.NewReader(cfg),
-		optical_drive.NewReader(cfg),
+		pn532_i2c.NewReader(cfg),
+		pn532_spi.NewReader(cfg),
+		optical_drive.NewReader(cfg, p),
 	}
 }
 
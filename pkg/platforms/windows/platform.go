@@ -20,6 +20,7 @@ import (
 	"github.com/ZaparooProject/zaparoo-core/pkg/readers"
 	"github.com/ZaparooProject/zaparoo-core/pkg/readers/acr122_pcsc"
 	"github.com/ZaparooProject/zaparoo-core/pkg/readers/file"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/network"
 	"github.com/ZaparooProject/zaparoo-core/pkg/readers/pn532_uart"
 	"github.com/ZaparooProject/zaparoo-core/pkg/readers/simple_serial"
 	"github.com/rs/zerolog/log"
@@ -36,6 +37,7 @@ func (p *Platform) SupportedReaders(cfg *config.UserConfig) []readers.Reader {
 	return []readers.Reader{
 		file.NewReader(cfg),
 		simple_serial.NewReader(cfg),
+		network.NewReader(cfg),
 		acr122_pcsc.NewAcr122Pcsc(cfg),
 		pn532_uart.NewReader(cfg),
 	}
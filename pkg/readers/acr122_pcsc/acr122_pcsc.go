@@ -1,31 +1,53 @@
 package acr122_pcsc
 
 import (
-	"bytes"
 	"encoding/hex"
 	"errors"
+	"fmt"
 	"github.com/ZaparooProject/zaparoo-core/pkg/service/tokens"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ZaparooProject/zaparoo-core/pkg/config"
 	"github.com/ZaparooProject/zaparoo-core/pkg/readers"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/mifare"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/ndef"
 	"github.com/ZaparooProject/zaparoo-core/pkg/utils"
 	"github.com/ebfe/scard"
 	"github.com/rs/zerolog/log"
 )
 
+type writeRequestResult struct {
+	Token *tokens.Token
+	Err   error
+}
+
+type writeRequest struct {
+	Text   string
+	Status func(readers.WriteStatus)
+	Result chan writeRequestResult
+}
+
 type Acr122Pcsc struct {
-	cfg     *config.UserConfig
-	device  string
-	name    string
-	polling bool
-	ctx     *scard.Context
+	cfg         *config.UserConfig
+	device      string
+	name        string
+	polling     atomic.Bool
+	ctx         *scard.Context
+	write       chan writeRequest
+	cancelWrite chan bool
+	// error which made the reader close itself
+	errMu sync.Mutex
+	err   error
 }
 
 func NewAcr122Pcsc(cfg *config.UserConfig) *Acr122Pcsc {
 	return &Acr122Pcsc{
-		cfg: cfg,
+		cfg:         cfg,
+		write:       make(chan writeRequest),
+		cancelWrite: make(chan bool, 1),
 	}
 }
 
@@ -62,24 +84,33 @@ func (r *Acr122Pcsc) Open(device string, iq chan<- readers.Scan) error {
 
 	r.device = device
 	r.name = ps[1]
-	r.polling = true
+	r.setErr(nil)
+	r.polling.Store(true)
+
+	// the context is released by Close, which also stops the loop
+	ctx := r.ctx
 
 	go func() {
-		for r.polling {
-			ctx := r.ctx
-			if ctx == nil {
-				continue
+		for r.polling.Load() {
+			select {
+			case req := <-r.write:
+				r.writeTag(ctx, req)
+			default:
 			}
 
 			rls, err := ctx.ListReaders()
 			if err != nil {
+				// the context is gone, retrying would spin
 				log.Debug().Msgf("error listing pcsc readers: %s", err)
-				continue
+				r.setErr(fmt.Errorf("error listing pcsc readers: %w", err))
+				r.polling.Store(false)
+				break
 			}
 
 			if !utils.Contains(rls, r.name) {
 				log.Debug().Msgf("reader not found: %s", r.name)
-				r.polling = false
+				r.setErr(errors.New("reader not found: " + r.name))
+				r.polling.Store(false)
 				break
 			}
 
@@ -113,69 +144,21 @@ func (r *Acr122Pcsc) Open(device string, iq chan<- readers.Scan) error {
 
 			log.Debug().Msgf("status: %v", hex.EncodeToString(status.Atr))
 
-			res, err := tag.Transmit([]byte{0xFF, 0xCA, 0x00, 0x00, 0x00})
+			token, err := r.readToken(tag, status.Atr)
 			if err != nil {
-				log.Debug().Msgf("error transmitting: %s", err)
-				continue
-			}
-
-			if len(res) < 2 {
-				log.Debug().Msgf("invalid response")
-				_ = tag.Disconnect(scard.ResetCard)
-				continue
-			}
-
-			resCode := res[len(res)-2:]
-			if resCode[0] != 0x90 && resCode[1] != 0x00 {
-				log.Debug().Msgf("invalid response code: %x", resCode)
+				log.Debug().Msgf("error reading token: %s", err)
 				_ = tag.Disconnect(scard.ResetCard)
 				continue
 			}
 
-			log.Debug().Msgf("response: %x", res)
-			uid := res[:len(res)-2]
-
-			i := 0
-			data := make([]byte, 0)
-			for {
-				res, err = tag.Transmit([]byte{0xFF, 0xB0, 0x00, byte(i), 0x04})
-				if err != nil {
-					log.Debug().Msgf("error transmitting: %s", err)
-					break
-				} else if bytes.Equal(res, []byte{0x00, 0x00, 0x00, 0x00, 0x90, 0x00}) {
-					break
-				} else if len(res) < 6 {
-					log.Debug().Msgf("invalid response")
-					break
-				} else if i >= 221 {
-					break
-				}
-
-				data = append(data, res[:len(res)-2]...)
-				i++
-			}
-
-			log.Debug().Msgf("data: %x", data)
-
-			text, err := ParseRecordText(data)
-			if err != nil {
-				log.Debug().Msgf("error parsing NDEF record: %s", err)
-				text = ""
-			}
-
 			iq <- readers.Scan{
 				Source: r.device,
-				Token: &tokens.Token{
-					UID:      hex.EncodeToString(uid),
-					Text:     text,
-					ScanTime: time.Now(),
-					Source:   r.device,
-				},
+				Token:  token,
 			}
 
 			_ = tag.Disconnect(scard.ResetCard)
 
-			for r.polling {
+			for r.polling.Load() {
 				rs := []scard.ReaderState{{
 					Reader:       r.name,
 					CurrentState: scard.StatePresent,
@@ -190,6 +173,12 @@ func (r *Acr122Pcsc) Open(device string, iq chan<- readers.Scan) error {
 				if rs[0].EventState&scard.StatePresent == 0 {
 					break
 				}
+
+				select {
+				case req := <-r.write:
+					r.writeTag(ctx, req)
+				default:
+				}
 			}
 
 			iq <- readers.Scan{
@@ -203,9 +192,10 @@ func (r *Acr122Pcsc) Open(device string, iq chan<- readers.Scan) error {
 }
 
 func (r *Acr122Pcsc) Close() error {
-	r.polling = false
+	r.polling.Store(false)
 	if r.ctx != nil {
 		err := r.ctx.Release()
+		r.ctx = nil
 		if err != nil {
 			return err
 		}
@@ -252,13 +242,258 @@ func (r *Acr122Pcsc) Device() string {
 }
 
 func (r *Acr122Pcsc) Connected() bool {
-	return r.polling
+	return r.polling.Load()
 }
 
 func (r *Acr122Pcsc) Info() string {
 	return r.name
 }
 
-func (r *Acr122Pcsc) Write(_ string) (*tokens.Token, error) {
-	return nil, errors.New("writing not supported on this reader")
+func (r *Acr122Pcsc) Write(
+	text string,
+	opts readers.WriteOptions,
+	status func(readers.WriteStatus),
+) (*tokens.Token, error) {
+	if !r.Connected() {
+		return nil, errors.New("not connected")
+	}
+
+	if opts.Protected() {
+		return nil, errors.New("protection not supported on this reader")
+	}
+
+	// clear any cancel request left over from a previous write
+	select {
+	case <-r.cancelWrite:
+	default:
+	}
+
+	req := writeRequest{
+		Text:   text,
+		Status: status,
+		Result: make(chan writeRequestResult),
+	}
+
+	r.write <- req
+
+	res := <-req.Result
+	if res.Err != nil {
+		log.Error().Msgf("error writing to tag: %s", res.Err)
+		return nil, res.Err
+	}
+
+	return res.Token, nil
+}
+
+func (r *Acr122Pcsc) CancelWrite() {
+	select {
+	case r.cancelWrite <- true:
+	default:
+	}
+}
+
+func (r *Acr122Pcsc) Capabilities() readers.Capabilities {
+	return readers.Capabilities{
+		Write:    true,
+		Removal:  true,
+		TagTypes: []string{tokens.TypeNTAG, tokens.TypeMifare, tokens.TypeType4},
+	}
+}
+
+// readToken reads the UID and NDEF text from a connected card.
+func (r *Acr122Pcsc) readToken(tag *scard.Card, atr []byte) (*tokens.Token, error) {
+	uid, err := getTagUID(tag)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debug().Msgf("uid: %x", uid)
+
+	tagType := getTagType(atr)
+	data, err := readTag(tag, atr, tagType, mifare.ParseKeys(r.cfg.GetMifareKey()))
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debug().Msgf("data: %x", data)
+
+	var records []ndef.Record
+	if tagType == tokens.TypeType4 {
+		records, err = ndef.ParseMessage(data)
+	} else {
+		records, err = ndef.ParseRecords(ndefData(data, tagType))
+	}
+	if err != nil {
+		log.Debug().Msgf("error parsing NDEF record: %s", err)
+	}
+
+	text := ndef.TokenText(records, r.cfg.GetUriStripPrefix())
+
+	token := &tokens.Token{
+		Type:     tagType,
+		UID:      hex.EncodeToString(uid),
+		Text:     text,
+		Data:     hex.EncodeToString(data),
+		ScanTime: time.Now(),
+		Source:   r.device,
+		Records:  records,
+	}
+
+	if tagType == tokens.TypeNTAG {
+		token.Figure = readFigure(tag, uid)
+	}
+
+	return token, nil
+}
+
+func (r *Acr122Pcsc) writeTag(ctx *scard.Context, req writeRequest) {
+	log.Info().Msgf("acr122 write request: %s", req.Text)
+
+	fail := func(err error) {
+		req.Status(readers.WriteStatus{
+			Device: r.device,
+			Status: readers.WriteStatusFailed,
+			Error:  err,
+		})
+		req.Result <- writeRequestResult{
+			Err: err,
+		}
+	}
+
+	req.Status(readers.WriteStatus{
+		Device: r.device,
+		Status: readers.WriteStatusWaiting,
+	})
+
+	present := false
+	tries := 4 * 30 // ~30 seconds
+
+	for tries > 0 && r.polling.Load() {
+		select {
+		case <-r.cancelWrite:
+			log.Info().Msg("write request cancelled")
+			fail(errors.New("write cancelled"))
+			return
+		default:
+		}
+
+		rs := []scard.ReaderState{{
+			Reader:       r.name,
+			CurrentState: scard.StateUnaware,
+		}}
+
+		err := ctx.GetStatusChange(rs, 250*time.Millisecond)
+		if err != nil {
+			log.Debug().Msgf("error getting status change: %s", err)
+		} else if rs[0].EventState&scard.StatePresent != 0 {
+			present = true
+			break
+		}
+
+		tries--
+	}
+
+	if !present {
+		log.Error().Msgf("could not detect a tag")
+		fail(errors.New("could not detect a tag"))
+		return
+	}
+
+	tag, err := ctx.Connect(r.name, scard.ShareShared, scard.ProtocolAny)
+	if err != nil {
+		fail(fmt.Errorf("error connecting to tag: %w", err))
+		return
+	}
+	defer func(tag *scard.Card) {
+		_ = tag.Disconnect(scard.LeaveCard)
+	}(tag)
+
+	status, err := tag.Status()
+	if err != nil {
+		fail(fmt.Errorf("error getting tag status: %w", err))
+		return
+	}
+
+	uid, err := getTagUID(tag)
+	if err != nil {
+		fail(fmt.Errorf("error reading tag UID: %w", err))
+		return
+	}
+
+	log.Info().Msgf("found tag with UID: %x", uid)
+
+	req.Status(readers.WriteStatus{
+		Device: r.device,
+		Status: readers.WriteStatusWriting,
+	})
+
+	payload, err := ndef.BuildMessage(req.Text)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	tagType := getTagType(status.Atr)
+	switch tagType {
+	case tokens.TypeMifare:
+		err = mifare.Write(
+			mifareCard{card: tag},
+			getMifareSectorCount(status.Atr),
+			mifare.ParseKeys(r.cfg.GetMifareKey()),
+			payload,
+		)
+	case tokens.TypeNTAG:
+		err = writeNtag(tag, payload)
+	default:
+		err = fmt.Errorf("unsupported tag type: %x", status.Atr)
+	}
+	if err != nil {
+		log.Error().Msgf("error writing to tag: %s", err)
+		fail(err)
+		return
+	}
+
+	t, err := r.readToken(tag, status.Atr)
+	if err != nil {
+		log.Error().Msgf("error reading written tag: %s", err)
+		fail(err)
+		return
+	}
+
+	if t.Text != req.Text {
+		log.Error().Msgf("text mismatch after write: %s != %s", t.Text, req.Text)
+		fail(errors.New("text mismatch after write"))
+		return
+	}
+
+	log.Info().Msgf("successfully wrote to card: %x", payload)
+	req.Status(readers.WriteStatus{
+		Device: r.device,
+		Status: readers.WriteStatusVerified,
+	})
+	req.Result <- writeRequestResult{
+		Token: t,
+	}
+}
+
+func (r *Acr122Pcsc) setErr(err error) {
+	r.errMu.Lock()
+	defer r.errMu.Unlock()
+	r.err = err
+}
+
+func (r *Acr122Pcsc) getErr() error {
+	r.errMu.Lock()
+	defer r.errMu.Unlock()
+	return r.err
+}
+
+func (r *Acr122Pcsc) Health() error {
+	if !r.Connected() {
+		if err := r.getErr(); err != nil {
+			return err
+		}
+		return readers.ErrNotConnected
+	}
+	return nil
 }
@@ -0,0 +1,282 @@
+package acr122_pcsc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/figures"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/mifare"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/ndef"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/type4"
+	"github.com/ZaparooProject/zaparoo-core/pkg/service/tokens"
+	"github.com/ebfe/scard"
+	"github.com/rs/zerolog/log"
+)
+
+// PC/SC part 3 ATRs for contactless cards contain a 2 byte card name which
+// identifies the type of tag on the reader.
+const atrCardNameIndex = 13
+
+var (
+	cardNameMifare1K   = []byte{0x00, 0x01}
+	cardNameMifare4K   = []byte{0x00, 0x02}
+	cardNameUltralight = []byte{0x00, 0x03}
+)
+
+// Storage cards have an RID in their historical bytes, ISO 14443-4 cards
+// report their ATS historical bytes instead.
+var (
+	atrContactlessPrefix = []byte{0x3B, 0x80, 0x80, 0x01}
+	atrStorageCard       = []byte{0x80, 0x4F}
+)
+
+const (
+	ntagPageSize       = 4
+	ntagMaxPage        = 221
+	ntagFirstDataPage  = 0x04
+	ntagCapabilityPage = 0x03
+
+	// volatile key slot of the reader used for MIFARE authentication
+	mifareKeySlot = 0x00
+)
+
+// transmit sends an APDU to the card and returns the response data with the
+// status word removed. Any status other than 90 00 is returned as an error.
+func transmit(card *scard.Card, cmd []byte) ([]byte, error) {
+	res, err := card.Transmit(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(res) < 2 {
+		return nil, fmt.Errorf("invalid response: %x", res)
+	}
+
+	sw := res[len(res)-2:]
+	if sw[0] != 0x90 || sw[1] != 0x00 {
+		return nil, fmt.Errorf("invalid response code: %x", sw)
+	}
+
+	return res[:len(res)-2], nil
+}
+
+func getTagUID(card *scard.Card) ([]byte, error) {
+	return transmit(card, []byte{0xFF, 0xCA, 0x00, 0x00, 0x00})
+}
+
+// getTagType returns the token type of a card based on its ATR, an empty
+// string is returned if the card is not supported.
+func getTagType(atr []byte) string {
+	if isType4(atr) {
+		return tokens.TypeType4
+	}
+
+	if len(atr) < atrCardNameIndex+2 {
+		return ""
+	}
+
+	name := atr[atrCardNameIndex : atrCardNameIndex+2]
+	switch {
+	case bytes.Equal(name, cardNameMifare1K), bytes.Equal(name, cardNameMifare4K):
+		return tokens.TypeMifare
+	case bytes.Equal(name, cardNameUltralight):
+		return tokens.TypeNTAG
+	default:
+		return ""
+	}
+}
+
+// isType4 returns true if the ATR belongs to an ISO 14443-4 card, PC/SC
+// part 3 section 3.1.3.2.3.
+func isType4(atr []byte) bool {
+	if len(atr) < len(atrContactlessPrefix) {
+		return false
+	}
+
+	// low nibble of T0 is the number of historical bytes
+	if atr[0] != atrContactlessPrefix[0] || atr[1]&0xF0 != atrContactlessPrefix[1] ||
+		!bytes.Equal(atr[2:4], atrContactlessPrefix[2:]) {
+		return false
+	}
+
+	return !bytes.HasPrefix(atr[4:], atrStorageCard)
+}
+
+func readBinary(card *scard.Card, block byte, length byte) ([]byte, error) {
+	return transmit(card, []byte{0xFF, 0xB0, 0x00, block, length})
+}
+
+func updateBinary(card *scard.Card, block byte, data []byte) error {
+	cmd := append([]byte{0xFF, 0xD6, 0x00, block, byte(len(data))}, data...)
+	_, err := transmit(card, cmd)
+	return err
+}
+
+// readNtag reads pages from the start of the tag until the whole NDEF
+// message has been read, the end of the tag or the maximum NTAG216 size is
+// reached.
+func readNtag(card *scard.Card) ([]byte, error) {
+	data := make([]byte, 0)
+
+	for i := 0; i < ntagMaxPage; i++ {
+		page, err := readBinary(card, byte(i), ntagPageSize)
+		if err != nil {
+			if i == 0 {
+				return nil, err
+			}
+			break
+		} else if len(page) < ntagPageSize {
+			return nil, fmt.Errorf("invalid page %d: %x", i, page)
+		}
+
+		data = append(data, page[:ntagPageSize]...)
+
+		if i >= ntagFirstDataPage && ndef.MessageComplete(ndefData(data, tokens.TypeNTAG)) {
+			break
+		}
+	}
+
+	return data, nil
+}
+
+// readFigure decodes the ID of an Amiibo or Lego Dimensions tag, nil is
+// returned for any other tag.
+func readFigure(card *scard.Card, uid []byte) *figures.Figure {
+	f, err := figures.Read(func(page byte) ([]byte, error) {
+		return readBinary(card, page, ntagPageSize*4)
+	}, uid)
+	if err != nil {
+		log.Warn().Err(err).Msg("error reading figure")
+		return nil
+	} else if f != nil {
+		log.Info().Msgf("decoded figure: %s %s", f.Id, f.Name)
+	}
+	return f
+}
+
+// getNtagCapacity returns the size of the NDEF data area in bytes, read from
+// the capability container.
+func getNtagCapacity(card *scard.Card) (int, error) {
+	cc, err := readBinary(card, ntagCapabilityPage, ntagPageSize)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(cc) < ntagPageSize || cc[0] != 0xE1 {
+		return 0, errors.New("tag is not NDEF formatted")
+	}
+
+	return int(cc[2]) * 8, nil
+}
+
+func writeNtag(card *scard.Card, payload []byte) error {
+	capacity, err := getNtagCapacity(card)
+	if err != nil {
+		return err
+	}
+
+	if len(payload) > capacity {
+		return fmt.Errorf("payload too big for card: [%d/%d] bytes used", len(payload), capacity)
+	}
+
+	for i, chunk := range chunkBy(payload, ntagPageSize) {
+		for len(chunk) < ntagPageSize {
+			chunk = append(chunk, 0x00)
+		}
+
+		err := updateBinary(card, ntagFirstDataPage+byte(i), chunk)
+		if err != nil {
+			return fmt.Errorf("error writing page %d: %w", ntagFirstDataPage+i, err)
+		}
+	}
+
+	return nil
+}
+
+// mifareCard sends MIFARE Classic commands through the reader's PC/SC
+// storage card APDUs.
+type mifareCard struct {
+	card *scard.Card
+}
+
+// Auth loads a key into the reader and authenticates a block with it. A
+// failed authentication halts the card, so it's reset to select it again.
+func (c mifareCard) Auth(block int, keyType byte, key []byte) error {
+	_, err := transmit(c.card, append(
+		[]byte{0xFF, 0x82, 0x00, mifareKeySlot, byte(len(key))},
+		key...,
+	))
+	if err != nil {
+		return fmt.Errorf("error loading key: %w", err)
+	}
+
+	_, err = transmit(c.card, []byte{
+		0xFF, 0x86, 0x00, 0x00, 0x05,
+		0x01, 0x00, byte(block), keyType, mifareKeySlot,
+	})
+	if err == nil {
+		return nil
+	}
+
+	rcErr := c.card.Reconnect(scard.ShareShared, scard.ProtocolAny, scard.ResetCard)
+	if rcErr != nil {
+		log.Debug().Err(rcErr).Msg("error reselecting card after failed auth")
+	}
+
+	return fmt.Errorf("error authenticating block %d: %w", block, err)
+}
+
+func (c mifareCard) ReadBlock(block int) ([]byte, error) {
+	return readBinary(c.card, byte(block), mifare.BlockSize)
+}
+
+func (c mifareCard) WriteBlock(block int, data []byte) error {
+	return updateBinary(c.card, byte(block), data)
+}
+
+// getMifareSectorCount returns the number of sectors on a MIFARE Classic
+// card, based on the card name in its ATR.
+func getMifareSectorCount(atr []byte) int {
+	if len(atr) >= atrCardNameIndex+2 &&
+		bytes.Equal(atr[atrCardNameIndex:atrCardNameIndex+2], cardNameMifare4K) {
+		return mifare.Sectors4K
+	}
+	return mifare.Sectors1K
+}
+
+// ndefData returns the part of the raw tag data where the TLV blocks start.
+// NTAG data is read from the first page, which is the UID and header.
+func ndefData(data []byte, tagType string) []byte {
+	if tagType == tokens.TypeMifare {
+		return data
+	}
+
+	offset := ntagFirstDataPage * ntagPageSize
+	if len(data) < offset {
+		return nil
+	}
+
+	return data[offset:]
+}
+
+// readTag returns the raw data from a supported tag type. MIFARE Classic
+// cards are authenticated with the given keys.
+func readTag(card *scard.Card, atr []byte, tagType string, keys mifare.Keys) ([]byte, error) {
+	switch tagType {
+	case tokens.TypeMifare:
+		return mifare.Read(mifareCard{card: card}, getMifareSectorCount(atr), keys)
+	case tokens.TypeType4:
+		// APDUs are passed straight through to the card
+		return type4.ReadNdef(card.Transmit)
+	default:
+		return readNtag(card)
+	}
+}
+
+func chunkBy[T any](items []T, chunkSize int) (chunks [][]T) {
+	for chunkSize < len(items) {
+		items, chunks = items[chunkSize:], append(chunks, items[0:chunkSize:chunkSize])
+	}
+	return append(chunks, items)
+}
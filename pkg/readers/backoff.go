@@ -0,0 +1,118 @@
+package readers
+
+import (
+	"sync"
+	"time"
+)
+
+type backoffEntry struct {
+	failures int
+	until    time.Time
+}
+
+// Backoff tracks failed attempts to use devices and how long to wait before
+// trying each device again. The wait doubles after every failure, up to a
+// maximum, so a device which glitched once is retried soon but one which is
+// never going to work isn't retried constantly. It's safe for concurrent
+// use.
+type Backoff struct {
+	mu      sync.Mutex
+	min     time.Duration
+	max     time.Duration
+	entries map[string]*backoffEntry
+	now     func() time.Time
+}
+
+func NewBackoff(minWait time.Duration, maxWait time.Duration) *Backoff {
+	return &Backoff{
+		min:     minWait,
+		max:     maxWait,
+		entries: make(map[string]*backoffEntry),
+		now:     time.Now,
+	}
+}
+
+// Fail records a failed attempt on a device and returns how long until it
+// can be tried again.
+func (b *Backoff) Fail(key string) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e, ok := b.entries[key]
+	if !ok {
+		e = &backoffEntry{}
+		b.entries[key] = e
+	}
+
+	wait := b.min
+	for i := 0; i < e.failures && wait < b.max; i++ {
+		wait *= 2
+	}
+	if wait > b.max {
+		wait = b.max
+	}
+
+	e.failures++
+	e.until = b.now().Add(wait)
+
+	return wait
+}
+
+// Ready returns true if a device has no recent failures or its wait has
+// expired.
+func (b *Backoff) Ready(key string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e, ok := b.entries[key]
+	if !ok {
+		return true
+	}
+
+	return !b.now().Before(e.until)
+}
+
+// Expired returns true if the wait of any device ended after from and no
+// later than to, so a caller checking periodically sees each wait end once.
+func (b *Backoff) Expired(from time.Time, to time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, e := range b.entries {
+		if e.until.After(from) && !e.until.After(to) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Failures returns the number of failures recorded for a device since it
+// was last reset.
+func (b *Backoff) Failures(key string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e, ok := b.entries[key]
+	if !ok {
+		return 0
+	}
+
+	return e.failures
+}
+
+// Reset forgets all failures of a device, after it has been used
+// successfully.
+func (b *Backoff) Reset(key string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.entries, key)
+}
+
+// Clear forgets the failures of all devices, e.g. after devices have been
+// plugged in or removed and any of them may work now.
+func (b *Backoff) Clear() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.entries = make(map[string]*backoffEntry)
+}
@@ -0,0 +1,81 @@
+package readers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := NewBackoff(time.Second, 5*time.Second)
+	b.now = func() time.Time { return now }
+
+	if !b.Ready("a") {
+		t.Error("expected unknown device to be ready")
+	}
+
+	want := []time.Duration{
+		time.Second,
+		2 * time.Second,
+		4 * time.Second,
+		5 * time.Second,
+		5 * time.Second,
+	}
+	for i, w := range want {
+		if got := b.Fail("a"); got != w {
+			t.Errorf("failure %d: wait = %s, want %s", i+1, got, w)
+		}
+	}
+
+	if b.Failures("a") != len(want) {
+		t.Errorf("failures = %d, want %d", b.Failures("a"), len(want))
+	}
+
+	if b.Ready("a") {
+		t.Error("expected failed device to not be ready")
+	}
+	if !b.Ready("b") {
+		t.Error("expected other device to be ready")
+	}
+
+	now = now.Add(4 * time.Second)
+	if b.Ready("a") {
+		t.Error("expected device to not be ready before wait expires")
+	}
+
+	now = now.Add(time.Second)
+	if !b.Ready("a") {
+		t.Error("expected device to be ready after wait expires")
+	}
+
+	b.Reset("a")
+	if b.Failures("a") != 0 {
+		t.Errorf("failures = %d, want 0 after reset", b.Failures("a"))
+	}
+	if got := b.Fail("a"); got != time.Second {
+		t.Errorf("wait = %s, want %s after reset", got, time.Second)
+	}
+
+	b.Clear()
+	if !b.Ready("a") {
+		t.Error("expected device to be ready after clear")
+	}
+}
+
+func TestBackoffExpired(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := NewBackoff(time.Second, 5*time.Second)
+	b.now = func() time.Time { return now }
+
+	b.Fail("a")
+
+	if b.Expired(now, now.Add(500*time.Millisecond)) {
+		t.Error("expected wait to not have expired yet")
+	}
+	if !b.Expired(now.Add(500*time.Millisecond), now.Add(time.Second)) {
+		t.Error("expected wait to expire in this check")
+	}
+	if b.Expired(now.Add(time.Second), now.Add(2*time.Second)) {
+		t.Error("expected expired wait to only be seen once")
+	}
+}
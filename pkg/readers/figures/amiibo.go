@@ -0,0 +1,43 @@
+package figures
+
+import (
+	"encoding/hex"
+	"fmt"
+)
+
+// AmiiboIdPage is the first of the two NTAG215 pages holding the model info
+// of an Amiibo, which is stored unencrypted.
+const AmiiboIdPage = 21
+
+const amiiboIdSize = 8
+
+// DecodeAmiibo decodes the 8 byte ID from pages 21-22 of an Amiibo:
+//
+//	bytes 0-1: game and character ID, the game is the top 12 bits
+//	byte 2:    variant
+//	byte 3:    figure type
+//	bytes 4-5: model number
+//	byte 6:    series
+//	byte 7:    always 0x02
+func DecodeAmiibo(data []byte) (Figure, error) {
+	if len(data) < amiiboIdSize {
+		return Figure{}, fmt.Errorf("invalid amiibo id: %x", data)
+	}
+
+	loadTables()
+
+	id := hex.EncodeToString(data[:amiiboIdSize])
+	character := hex.EncodeToString(data[0:2])
+	series := hex.EncodeToString(data[6:7])
+
+	return Figure{
+		Type:        TypeAmiibo,
+		Id:          id,
+		Name:        amiibos.Figures[id],
+		Series:      amiibos.Series[series],
+		GameId:      character[:3],
+		CharacterId: character,
+		Variant:     hex.EncodeToString(data[2:3]),
+		SeriesId:    series,
+	}, nil
+}
@@ -0,0 +1,75 @@
+// Package figures decodes the character IDs stored on toy figure tags, like
+// Amiibo and Lego Dimensions, and looks up their names in the embedded
+// tables from the assets package.
+package figures
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/ZaparooProject/zaparoo-core/pkg/assets"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	TypeAmiibo         = "amiibo"
+	TypeLegoDimensions = "lego_dimensions"
+)
+
+// Figure is the decoded identity of a toy figure.
+type Figure struct {
+	// Type is the toy platform, one of the Type constants.
+	Type string `json:"type"`
+	// Id uniquely identifies the character or model. Amiibo use the 16
+	// character hex ID, Lego Dimensions use the decimal character or
+	// vehicle ID.
+	Id string `json:"id"`
+	// Name is the character name from the lookup table, empty if the ID
+	// isn't known.
+	Name   string `json:"name,omitempty"`
+	Series string `json:"series,omitempty"`
+
+	// Amiibo only fields, as hex.
+	GameId      string `json:"gameId,omitempty"`
+	CharacterId string `json:"characterId,omitempty"`
+	Variant     string `json:"variant,omitempty"`
+	SeriesId    string `json:"seriesId,omitempty"`
+}
+
+type amiiboTable struct {
+	Series  map[string]string `json:"series"`
+	Figures map[string]string `json:"figures"`
+}
+
+type legoTable struct {
+	Characters map[string]string `json:"characters"`
+	Vehicles   map[string]string `json:"vehicles"`
+}
+
+var (
+	loadOnce sync.Once
+	amiibos  amiiboTable
+	legos    legoTable
+)
+
+// loadTables reads the embedded lookup tables on first use. Missing tables
+// only mean names can't be looked up.
+func loadTables() {
+	loadOnce.Do(func() {
+		data, err := assets.Figures.ReadFile("figures/amiibo.json")
+		if err == nil {
+			err = json.Unmarshal(data, &amiibos)
+		}
+		if err != nil {
+			log.Error().Err(err).Msg("error loading amiibo table")
+		}
+
+		data, err = assets.Figures.ReadFile("figures/lego_dimensions.json")
+		if err == nil {
+			err = json.Unmarshal(data, &legos)
+		}
+		if err != nil {
+			log.Error().Err(err).Msg("error loading lego dimensions table")
+		}
+	})
+}
@@ -0,0 +1,137 @@
+package figures
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+)
+
+func TestDecodeAmiibo(t *testing.T) {
+	data, _ := hex.DecodeString("0000000000000002")
+
+	f, err := DecodeAmiibo(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f.Type != TypeAmiibo || f.Id != "0000000000000002" {
+		t.Fatalf("unexpected figure: %+v", f)
+	}
+
+	if f.Name != "Mario" || f.Series != "Super Smash Bros." {
+		t.Fatalf("unexpected lookup: %+v", f)
+	}
+
+	data, _ = hex.DecodeString("0100000003530902")
+	f, err = DecodeAmiibo(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f.GameId != "010" || f.CharacterId != "0100" || f.Variant != "00" || f.SeriesId != "09" {
+		t.Fatalf("unexpected ids: %+v", f)
+	}
+
+	if f.Name != "" || f.Series != "The Legend of Zelda" {
+		t.Fatalf("unexpected lookup: %+v", f)
+	}
+}
+
+func TestDecodeLegoVehicle(t *testing.T) {
+	data := []byte{
+		0xE8, 0x03, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00,
+		0x00, 0x01, 0x00, 0x00,
+	}
+
+	f, err := DecodeLegoDimensions(nil, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f.Id != "1000" || f.Name != "Police Car" {
+		t.Fatalf("unexpected figure: %+v", f)
+	}
+}
+
+func teaEncrypt(k [4]uint32, v0 uint32, v1 uint32) (uint32, uint32) {
+	var sum uint32
+	for i := 0; i < teaRounds; i++ {
+		sum += teaDelta
+		v0 += ((v1 << 4) + k[0]) ^ (v1 + sum) ^ ((v1 >> 5) + k[1])
+		v1 += ((v0 << 4) + k[2]) ^ (v0 + sum) ^ ((v0 >> 5) + k[3])
+	}
+	return v0, v1
+}
+
+func TestDecodeLegoCharacter(t *testing.T) {
+	uid, _ := hex.DecodeString("04a1b2c3d4e580")
+
+	v0, v1 := teaEncrypt(legoKey(uid), 2, 2)
+	data := make([]byte, legoDataSize)
+	binary.LittleEndian.PutUint32(data[0:4], v0)
+	binary.LittleEndian.PutUint32(data[4:8], v1)
+
+	f, err := DecodeLegoDimensions(uid, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f.Id != "2" || f.Name != "Gandalf" {
+		t.Fatalf("unexpected figure: %+v", f)
+	}
+
+	// a different tag's UID gives a different key
+	other, _ := hex.DecodeString("04a1b2c3d4e581")
+	_, err = DecodeLegoDimensions(other, data)
+	if err != ErrLegoDecrypt {
+		t.Fatalf("expected ErrLegoDecrypt, got: %v", err)
+	}
+}
+
+// readPages returns a ReadPages over an in-memory NTAG.
+func readPages(mem []byte) ReadPages {
+	return func(page byte) ([]byte, error) {
+		out := make([]byte, 16)
+		copy(out, mem[int(page)*4:])
+		return out, nil
+	}
+}
+
+func TestRead(t *testing.T) {
+	amiibo := make([]byte, 540)
+	copy(amiibo[9:], AmiiboMatcher)
+	id, _ := hex.DecodeString("0100000003530902")
+	copy(amiibo[AmiiboIdPage*4:], id)
+
+	f, err := Read(readPages(amiibo), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f == nil || f.Type != TypeAmiibo || f.Id != "0100000003530902" {
+		t.Fatalf("unexpected figure: %+v", f)
+	}
+
+	lego := make([]byte, 180)
+	copy(lego[legoMatchPage*4:], LegoDimensionsMatcher)
+	copy(lego[LegoIdPage*4:], []byte{
+		0xE8, 0x03, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00,
+		0x00, 0x01, 0x00, 0x00,
+	})
+
+	f, err = Read(readPages(lego), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f == nil || f.Type != TypeLegoDimensions || f.Id != "1000" || f.Name != "Police Car" {
+		t.Fatalf("unexpected figure: %+v", f)
+	}
+
+	f, err = Read(readPages(make([]byte, 180)), nil)
+	if err != nil || f != nil {
+		t.Fatalf("expected no figure, got: %+v %v", f, err)
+	}
+}
@@ -0,0 +1,113 @@
+package figures
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/bits"
+	"strconv"
+)
+
+// LegoIdPage is the first page of the character data on a Lego Dimensions
+// tag. Pages 0x24-0x25 hold the character or vehicle ID and page 0x26
+// marks vehicles.
+const LegoIdPage = 0x24
+
+const (
+	legoDataSize = 12
+	legoUidSize  = 7
+	teaDelta     = 0x9E3779B9
+	teaRounds    = 32
+	// teaDelta * teaRounds, truncated to 32 bits
+	teaSum = 0xC6EF3720
+	// IDs above this are vehicles and gadgets
+	legoMaxCharacter = 1000
+)
+
+var legoVehicleMarker = []byte{0x00, 0x01, 0x00, 0x00}
+
+// Constant mixed with the tag UID to derive the character encryption key.
+var legoKeyConst = []byte{
+	0xB7, 0xD5, 0xD7, 0xE6, 0xE7, 0xBA, 0x3C, 0xA8,
+	0xD8, 0x75, 0x47, 0x68, 0xCF, 0x23, 0xE9, 0xFE, 0xAA,
+}
+
+var ErrLegoDecrypt = errors.New("unable to decrypt lego dimensions character")
+
+// DecodeLegoDimensions decodes the ID of a Lego Dimensions tag from the 12
+// bytes starting at page 0x24. Vehicle IDs are stored as plain text, while
+// character IDs are encrypted with a key derived from the 7 byte UID.
+func DecodeLegoDimensions(uid []byte, data []byte) (Figure, error) {
+	if len(data) < legoDataSize {
+		return Figure{}, fmt.Errorf("invalid lego dimensions data: %x", data)
+	}
+
+	loadTables()
+
+	if bytes.Equal(data[8:12], legoVehicleMarker) {
+		id := strconv.Itoa(int(binary.LittleEndian.Uint16(data[0:2])))
+		return Figure{
+			Type: TypeLegoDimensions,
+			Id:   id,
+			Name: legos.Vehicles[id],
+		}, nil
+	}
+
+	if len(uid) != legoUidSize {
+		return Figure{}, fmt.Errorf("invalid lego dimensions uid: %x", uid)
+	}
+
+	v0, v1 := teaDecrypt(
+		legoKey(uid),
+		binary.LittleEndian.Uint32(data[0:4]),
+		binary.LittleEndian.Uint32(data[4:8]),
+	)
+
+	// both halves hold the same ID, which also verifies the key
+	if v0 != v1 || v0 == 0 || v0 >= legoMaxCharacter {
+		return Figure{}, ErrLegoDecrypt
+	}
+
+	id := strconv.Itoa(int(v0))
+	return Figure{
+		Type: TypeLegoDimensions,
+		Id:   id,
+		Name: legos.Characters[id],
+	}, nil
+}
+
+// legoScramble mixes the UID with the key constant, cnt is the number of
+// 4 byte words used.
+func legoScramble(uid []byte, cnt int) uint32 {
+	base := make([]byte, 0, len(uid)+len(legoKeyConst))
+	base = append(base, uid...)
+	base = append(base, legoKeyConst...)
+	base[cnt*4-1] = 0xAA
+
+	var v uint32
+	for i := 0; i < cnt; i++ {
+		b := binary.LittleEndian.Uint32(base[i*4 : i*4+4])
+		v = b + bits.RotateLeft32(v, -25) + bits.RotateLeft32(v, -10) - v
+	}
+
+	return v
+}
+
+func legoKey(uid []byte) [4]uint32 {
+	var key [4]uint32
+	for i := range key {
+		key[i] = bits.ReverseBytes32(legoScramble(uid, i+3))
+	}
+	return key
+}
+
+func teaDecrypt(k [4]uint32, v0 uint32, v1 uint32) (uint32, uint32) {
+	sum := uint32(teaSum)
+	for i := 0; i < teaRounds; i++ {
+		v1 -= ((v0 << 4) + k[2]) ^ (v0 + sum) ^ ((v0 >> 5) + k[3])
+		v0 -= ((v1 << 4) + k[0]) ^ (v1 + sum) ^ ((v1 >> 5) + k[1])
+		sum -= teaDelta
+	}
+	return v0, v1
+}
@@ -0,0 +1,81 @@
+package figures
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// AmiiboMatcher identifies an Amiibo by bytes 0x09-0x0F of its first pages,
+// the lock bytes and capability container of an NTAG215.
+var AmiiboMatcher = []byte{
+	0x48, 0x0F, 0xE0,
+	0xF1, 0x10, 0xFF, 0xEE}
+
+// LegoDimensionsMatcher identifies a Lego Dimensions tag by the NDEF data
+// it ships with, starting at page 0x04.
+// https://github.com/RfidResearchGroup/proxmark3/blob/master/client/src/cmdhfmfu.c
+var LegoDimensionsMatcher = []byte{
+	0x01, 0x03, 0xA0, 0x0C,
+	0x34, 0x03, 0x13, 0xD1,
+	0x01, 0x0F, 0x54, 0x02,
+	0x65, 0x6E}
+
+const legoMatchPage = 0x04
+
+// ReadPages returns the 16 bytes starting at an NTAG page, like the NTAG
+// READ command.
+type ReadPages func(page byte) ([]byte, error)
+
+// IsAmiibo returns true if the data read from page 0 belongs to an Amiibo.
+func IsAmiibo(header []byte) bool {
+	return len(header) >= 9+len(AmiiboMatcher) &&
+		bytes.Equal(header[9:9+len(AmiiboMatcher)], AmiiboMatcher)
+}
+
+// IsLegoDimensions returns true if the data read from page 0x04 belongs to
+// a Lego Dimensions tag.
+func IsLegoDimensions(data []byte) bool {
+	return bytes.HasPrefix(data, LegoDimensionsMatcher)
+}
+
+// Read checks if an NTAG is a toy figure and decodes its ID. A nil figure
+// and no error are returned for tags which aren't figures.
+func Read(read ReadPages, uid []byte) (*Figure, error) {
+	header, err := read(0)
+	if err != nil {
+		return nil, err
+	}
+
+	if IsAmiibo(header) {
+		data, err := read(AmiiboIdPage)
+		if err != nil {
+			return nil, fmt.Errorf("error reading amiibo id: %w", err)
+		}
+
+		f, err := DecodeAmiibo(data)
+		if err != nil {
+			return nil, err
+		}
+		return &f, nil
+	}
+
+	data, err := read(legoMatchPage)
+	if err != nil {
+		return nil, err
+	}
+
+	if IsLegoDimensions(data) {
+		data, err := read(LegoIdPage)
+		if err != nil {
+			return nil, fmt.Errorf("error reading lego dimensions id: %w", err)
+		}
+
+		f, err := DecodeLegoDimensions(uid, data)
+		if err != nil {
+			return nil, err
+		}
+		return &f, nil
+	}
+
+	return nil, nil
+}
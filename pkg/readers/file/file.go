@@ -1,27 +1,51 @@
+// Package file reads tokens from a file, so other software and scripts can
+// trigger scans without any hardware. The file contains either plain token
+// text, or a JSON object with any of the uid, text, data and type fields:
+//
+//	{"uid": "04aabbccdd2280", "text": "**launch.random:snes"}
+//
+// Emptying or deleting the file removes the token. With the file_removal
+// reader option set to delete, only deleting the file removes it.
 package file
 
 import (
 	"encoding/hex"
+	"encoding/json"
 	"errors"
-	"github.com/ZaparooProject/zaparoo-core/pkg/service/tokens"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/ZaparooProject/zaparoo-core/pkg/config"
 	"github.com/ZaparooProject/zaparoo-core/pkg/readers"
+	"github.com/ZaparooProject/zaparoo-core/pkg/service/tokens"
 	"github.com/ZaparooProject/zaparoo-core/pkg/utils"
+	"github.com/fsnotify/fsnotify"
 	"github.com/rs/zerolog/log"
 )
 
 const TokenType = "file"
 
+const (
+	// the file is polled this often if it can't be watched
+	pollInterval = 100 * time.Millisecond
+	// watched files are still checked this often, in case events are
+	// missed, like on network filesystems
+	watchInterval = 1 * time.Second
+	// wait for writes to finish before reading the file, fsnotify has no
+	// close write event
+	settleDelay = 20 * time.Millisecond
+)
+
 type Reader struct {
 	cfg     *config.UserConfig
 	device  string
 	path    string
-	polling bool
+	removal string
+	polling atomic.Bool
+	watcher *fsnotify.Watcher
 }
 
 func NewReader(cfg *config.UserConfig) *Reader {
@@ -34,6 +58,56 @@ func (r *Reader) Ids() []string {
 	return []string{"file"}
 }
 
+// tokenFile is the JSON format of a token file.
+type tokenFile struct {
+	Type string `json:"type"`
+	UID  string `json:"uid"`
+	Text string `json:"text"`
+	Data string `json:"data"`
+}
+
+// parseToken returns the token in a file's contents, or nil if it's empty.
+// Contents which are a JSON object are read as a token file, anything else
+// is the token's text.
+func parseToken(contents []byte) *tokens.Token {
+	text := strings.TrimSpace(string(contents))
+	if text == "" {
+		return nil
+	}
+
+	if strings.HasPrefix(text, "{") {
+		var tf tokenFile
+		err := json.Unmarshal([]byte(text), &tf)
+		if err == nil {
+			if tf.UID == "" && tf.Text == "" && tf.Data == "" {
+				return nil
+			}
+
+			t := &tokens.Token{
+				Type: tf.Type,
+				UID:  tf.UID,
+				Text: tf.Text,
+				Data: tf.Data,
+			}
+			if t.Type == "" {
+				t.Type = TokenType
+			}
+
+			return t
+		}
+	}
+
+	return &tokens.Token{
+		Type: TokenType,
+		Text: text,
+		Data: hex.EncodeToString(contents),
+	}
+}
+
+func sameToken(a *tokens.Token, b *tokens.Token) bool {
+	return utils.TokensEqual(a, b) && a.Type == b.Type && a.Data == b.Data
+}
+
 func (r *Reader) Open(device string, iq chan<- readers.Scan) error {
 	ps := strings.SplitN(device, ":", 2)
 	if len(ps) != 2 {
@@ -44,7 +118,7 @@ func (r *Reader) Open(device string, iq chan<- readers.Scan) error {
 		return errors.New("invalid reader id: " + ps[0])
 	}
 
-	path := ps[1]
+	path := filepath.Clean(ps[1])
 
 	if !filepath.IsAbs(path) {
 		return errors.New("invalid device path, must be absolute")
@@ -59,7 +133,9 @@ func (r *Reader) Open(device string, iq chan<- readers.Scan) error {
 		return err
 	}
 
-	if _, err := os.Stat(path); err != nil {
+	removal := r.cfg.GetReaderFileRemoval(device)
+
+	if _, err := os.Stat(path); err != nil && removal == config.ReaderFileRemovalEmpty {
 		// attempt to create empty file
 		f, err := os.Create(path)
 		if err != nil {
@@ -68,68 +144,129 @@ func (r *Reader) Open(device string, iq chan<- readers.Scan) error {
 		_ = f.Close()
 	}
 
+	// the parent directory is watched instead of the file, so the file can
+	// be deleted and created again, or replaced by a rename
+	interval := watchInterval
+	watcher, err := fsnotify.NewWatcher()
+	if err == nil {
+		err = watcher.Add(parent)
+		if err != nil {
+			_ = watcher.Close()
+		}
+	}
+	if err != nil {
+		log.Warn().Err(err).Msgf("error watching %s, polling instead", path)
+		watcher = nil
+		interval = pollInterval
+	}
+
 	r.device = device
 	r.path = path
-	r.polling = true
+	r.removal = removal
+	r.watcher = watcher
+	r.polling.Store(true)
 
 	go func() {
 		var token *tokens.Token
 
-		for r.polling {
-			time.Sleep(100 * time.Millisecond)
-
+		check := func() {
 			contents, err := os.ReadFile(r.path)
-			if err != nil {
-				// TODO: have a max retries?
+			if errors.Is(err, os.ErrNotExist) {
+				if token != nil {
+					log.Debug().Msg("file was deleted, removing token")
+					token = nil
+					iq <- readers.Scan{
+						Source: r.device,
+						Token:  nil,
+					}
+				}
+				return
+			} else if err != nil {
 				iq <- readers.Scan{
 					Source: r.device,
 					Error:  err,
 				}
-				continue
+				return
 			}
 
-			text := strings.TrimSpace(string(contents))
+			t := parseToken(contents)
 
-			// "remove" the token if the file is now empty
-			if text == "" && token != nil {
-				log.Debug().Msg("file is empty, removing token")
-				token = nil
-				iq <- readers.Scan{
-					Source: r.device,
-					Token:  nil,
+			if t == nil {
+				// "remove" the token if the file is now empty
+				if token != nil && r.removal == config.ReaderFileRemovalEmpty {
+					log.Debug().Msg("file is empty, removing token")
+					token = nil
+					iq <- readers.Scan{
+						Source: r.device,
+						Token:  nil,
+					}
 				}
-				continue
-			}
-
-			if token != nil && token.Text == text {
-				continue
+				return
 			}
 
-			if text == "" {
-				continue
+			if token != nil && sameToken(t, token) {
+				return
 			}
 
-			token = &tokens.Token{
-				Type:     TokenType,
-				Text:     text,
-				Data:     hex.EncodeToString(contents),
-				ScanTime: time.Now(),
-				Source:   r.device,
-			}
+			t.ScanTime = time.Now()
+			t.Source = r.device
+			token = t
 
-			log.Debug().Msgf("new token: %s", token.Text)
+			log.Debug().Msgf("new token: %v", token)
 			iq <- readers.Scan{
 				Source: r.device,
 				Token:  token,
 			}
 		}
+
+		var events <-chan fsnotify.Event
+		var errs <-chan error
+		if watcher != nil {
+			events = watcher.Events
+			errs = watcher.Errors
+		}
+
+		check()
+
+		for r.polling.Load() {
+			select {
+			case e, ok := <-events:
+				if !ok {
+					return
+				}
+
+				if filepath.Clean(e.Name) != r.path {
+					continue
+				}
+
+				// a write is often several events, let them all arrive
+				time.Sleep(settleDelay)
+				for len(events) > 0 {
+					<-events
+				}
+
+				if r.polling.Load() {
+					check()
+				}
+			case err, ok := <-errs:
+				if !ok {
+					return
+				}
+				log.Warn().Err(err).Msgf("error watching %s", r.path)
+			case <-time.After(interval):
+				check()
+			}
+		}
 	}()
 
 	return nil
 }
 
 func (r *Reader) Close() error {
-	r.polling = false
+	r.polling.Store(false)
+	if r.watcher != nil {
+		return r.watcher.Close()
+	}
 	return nil
 }
 
@@ -142,13 +279,31 @@ func (r *Reader) Device() string {
 }
 
 func (r *Reader) Connected() bool {
-	return r.polling
+	return r.polling.Load()
 }
 
 func (r *Reader) Info() string {
 	return r.path
 }
 
-func (r *Reader) Write(text string) (*tokens.Token, error) {
+func (r *Reader) Write(text string, _ readers.WriteOptions, _ func(readers.WriteStatus)) (*tokens.Token, error) {
 	return nil, errors.New("writing not supported on this reader")
 }
+
+func (r *Reader) CancelWrite() {
+	// no writes to cancel
+}
+
+func (r *Reader) Capabilities() readers.Capabilities {
+	return readers.Capabilities{
+		Removal:  true,
+		TagTypes: []string{TokenType},
+	}
+}
+
+func (r *Reader) Health() error {
+	if !r.Connected() {
+		return readers.ErrNotConnected
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ZaparooProject/zaparoo-core/pkg/config"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers"
+)
+
+func openReader(t *testing.T, cfg *config.UserConfig, path string) chan readers.Scan {
+	t.Helper()
+
+	r := NewReader(cfg)
+	scans := make(chan readers.Scan, 10)
+
+	err := r.Open("file:"+path, scans)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = r.Close()
+	})
+
+	return scans
+}
+
+func writeFile(t *testing.T, path string, contents string) {
+	t.Helper()
+	err := os.WriteFile(path, []byte(contents), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func nextScan(t *testing.T, scans chan readers.Scan) readers.Scan {
+	t.Helper()
+	select {
+	case s := <-scans:
+		if s.Error != nil {
+			t.Fatalf("unexpected scan error: %s", s.Error)
+		}
+		return s
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for scan")
+		return readers.Scan{}
+	}
+}
+
+func noScan(t *testing.T, scans chan readers.Scan) {
+	t.Helper()
+	select {
+	case s := <-scans:
+		t.Fatalf("unexpected scan: %v", s.Token)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestParseToken(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		nil      bool
+		tokType  string
+		uid      string
+		text     string
+		data     string
+	}{
+		{"empty", "", true, "", "", "", ""},
+		{"whitespace", " \n", true, "", "", "", ""},
+		{"text", "**launch.random:snes\n", false, TokenType, "", "**launch.random:snes", "2a2a6c61756e63682e72616e646f6d3a736e65730a"},
+		{"json", `{"uid":"04aabbcc","text":"SNES/game.sfc"}`, false, TokenType, "04aabbcc", "SNES/game.sfc", ""},
+		{"json type", `{"type":"NTAG215","uid":"04aabbcc","data":"0102"}`, false, "NTAG215", "04aabbcc", "", "0102"},
+		{"empty json", `{}`, true, "", "", "", ""},
+		{"invalid json", `{not json`, false, TokenType, "", "{not json", "7b6e6f74206a736f6e"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tok := parseToken([]byte(tt.contents))
+			if tt.nil {
+				if tok != nil {
+					t.Fatalf("expected no token, got %v", tok)
+				}
+				return
+			}
+			if tok == nil {
+				t.Fatal("expected token")
+			}
+			if tok.Type != tt.tokType || tok.UID != tt.uid || tok.Text != tt.text || tok.Data != tt.data {
+				t.Errorf("got %+v", tok)
+			}
+		})
+	}
+}
+
+func TestScanAndEmpty(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token.txt")
+	scans := openReader(t, &config.UserConfig{}, path)
+
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("file not created: %s", err)
+	}
+
+	writeFile(t, path, "**launch.random:snes\n")
+	s := nextScan(t, scans)
+	if s.Token == nil || s.Token.Text != "**launch.random:snes" {
+		t.Fatalf("unexpected token: %v", s.Token)
+	}
+	if s.Source != "file:"+path || s.Token.ScanTime.IsZero() {
+		t.Errorf("unexpected scan: %+v", s)
+	}
+
+	// rewriting the same token isn't a new scan
+	writeFile(t, path, "**launch.random:snes\n")
+	noScan(t, scans)
+
+	writeFile(t, path, `{"uid":"04aabbcc","text":"SNES/game.sfc"}`)
+	s = nextScan(t, scans)
+	if s.Token == nil || s.Token.UID != "04aabbcc" || s.Token.Text != "SNES/game.sfc" {
+		t.Fatalf("unexpected token: %v", s.Token)
+	}
+
+	writeFile(t, path, "")
+	s = nextScan(t, scans)
+	if s.Token != nil {
+		t.Fatalf("expected removal, got %v", s.Token)
+	}
+}
+
+func TestDeleteRemoves(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token.txt")
+	scans := openReader(t, &config.UserConfig{}, path)
+
+	writeFile(t, path, "SNES/game.sfc")
+	s := nextScan(t, scans)
+	if s.Token == nil {
+		t.Fatal("expected token")
+	}
+
+	err := os.Remove(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s = nextScan(t, scans)
+	if s.Token != nil {
+		t.Fatalf("expected removal, got %v", s.Token)
+	}
+
+	// the file is still watched once created again
+	writeFile(t, path, "SNES/game.sfc")
+	s = nextScan(t, scans)
+	if s.Token == nil || s.Token.Text != "SNES/game.sfc" {
+		t.Fatalf("unexpected token: %v", s.Token)
+	}
+}
+
+func TestDeleteOnlyRemoval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token.txt")
+
+	cfg := &config.UserConfig{}
+	cfg.Readers.FileRemoval = []string{"delete:file:" + path}
+	scans := openReader(t, cfg, path)
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal("file should not be created when deletes remove tokens")
+	}
+
+	writeFile(t, path, "SNES/game.sfc")
+	s := nextScan(t, scans)
+	if s.Token == nil {
+		t.Fatal("expected token")
+	}
+
+	// emptying the file, like a script truncating it before writing, is
+	// ignored
+	writeFile(t, path, "")
+	noScan(t, scans)
+
+	err := os.Remove(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s = nextScan(t, scans)
+	if s.Token != nil {
+		t.Fatalf("expected removal, got %v", s.Token)
+	}
+}
+
+func TestExistingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token.txt")
+	writeFile(t, path, "SNES/game.sfc")
+
+	scans := openReader(t, &config.UserConfig{}, path)
+
+	s := nextScan(t, scans)
+	if s.Token == nil || s.Token.Text != "SNES/game.sfc" {
+		t.Fatalf("unexpected token: %v", s.Token)
+	}
+}
@@ -0,0 +1,75 @@
+//go:build linux
+
+package hid_keyboard
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	// _IOW('E', 0x90, int) from linux/input.h
+	ioctlEvioCGrab = 0x40044590
+	evKey          = 0x01
+	// struct input_event, a timeval followed by type, code and value
+	timevalSize = int(unsafe.Sizeof(syscall.Timeval{}))
+	eventSize   = timevalSize + 8
+)
+
+// evdevDevice is an input device grabbed exclusively, so the keys typed by
+// it don't also reach the system or a running core.
+type evdevDevice struct {
+	dev *os.File
+	buf []byte
+}
+
+func openDevice(path string) (keyDevice, error) {
+	dev, err := os.OpenFile(path, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	_, _, errno := syscall.Syscall(
+		syscall.SYS_IOCTL,
+		dev.Fd(),
+		ioctlEvioCGrab,
+		1,
+	)
+	if errno != 0 {
+		_ = dev.Close()
+		return nil, fmt.Errorf("error grabbing input device: %w", errno)
+	}
+
+	return &evdevDevice{
+		dev: dev,
+		buf: make([]byte, eventSize),
+	}, nil
+}
+
+func (d *evdevDevice) ReadKey() (uint16, int32, error) {
+	for {
+		_, err := io.ReadFull(d.dev, d.buf)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		typ := binary.LittleEndian.Uint16(d.buf[timevalSize:])
+		if typ != evKey {
+			continue
+		}
+
+		code := binary.LittleEndian.Uint16(d.buf[timevalSize+2:])
+		value := int32(binary.LittleEndian.Uint32(d.buf[timevalSize+4:]))
+		return code, value, nil
+	}
+}
+
+// Close also releases the grab, which the kernel does when the last file
+// descriptor is closed.
+func (d *evdevDevice) Close() error {
+	return d.dev.Close()
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package hid_keyboard
+
+import "errors"
+
+func openDevice(_ string) (keyDevice, error) {
+	return nil, errors.New("hid keyboard readers are only supported on linux")
+}
@@ -0,0 +1,244 @@
+// Package hid_keyboard reads tokens from keyboard wedge devices, like USB
+// barcode scanners and 125kHz RFID readers, which type each value they read
+// followed by Enter, e.g. hid_keyboard:/dev/input/event3.
+package hid_keyboard
+
+import (
+	"encoding/hex"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ZaparooProject/zaparoo-core/pkg/config"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers"
+	"github.com/ZaparooProject/zaparoo-core/pkg/service/tokens"
+	"github.com/ZaparooProject/zaparoo-core/pkg/utils"
+	"github.com/rs/zerolog/log"
+)
+
+const TokenType = "keyboard"
+
+// The device gives no signal when a token is taken away, so tokens are never
+// removed unless a removal timeout is configured, after which it's treated
+// as removed that long after the last scan.
+const defaultRemovalTimeout = 0
+
+// keyDevice is a source of key events, an evdev device on Linux.
+type keyDevice interface {
+	// ReadKey blocks until the next key event, returning its code and
+	// value.
+	ReadKey() (uint16, int32, error)
+	Close() error
+}
+
+type Reader struct {
+	cfg        *config.UserConfig
+	open       func(string) (keyDevice, error)
+	device     string
+	path       string
+	polling    atomic.Bool
+	dev        keyDevice
+	lastToken  *tokens.Token
+	tokenValue string
+	// tokens are removed this long after their scan, zero disables removal
+	removalTimeout time.Duration
+	// error which made the reader close itself
+	errMu sync.Mutex
+	err   error
+}
+
+func NewReader(cfg *config.UserConfig) *Reader {
+	return &Reader{
+		cfg:  cfg,
+		open: openDevice,
+	}
+}
+
+func (r *Reader) Ids() []string {
+	return []string{"hid_keyboard"}
+}
+
+// readLines sends each line typed on the device until reading fails, then
+// closes the channel.
+func (r *Reader) readLines(lines chan<- string) {
+	defer close(lines)
+
+	var kb keyBuffer
+	for {
+		code, value, err := r.dev.ReadKey()
+		if err != nil {
+			if r.polling.Load() {
+				log.Error().Err(err).Msg("failed to read from hid keyboard")
+				r.setErr(err)
+			}
+			return
+		}
+
+		line, ok := kb.handleKey(code, value)
+		if ok {
+			lines <- line
+		}
+	}
+}
+
+func (r *Reader) newToken(line string) *tokens.Token {
+	t := tokens.Token{
+		Type:     TokenType,
+		Data:     hex.EncodeToString([]byte(line)),
+		ScanTime: time.Now(),
+		Source:   r.device,
+	}
+
+	if r.tokenValue == config.ReaderTokenValueText {
+		t.Text = line
+	} else {
+		t.UID = line
+	}
+
+	return &t
+}
+
+func (r *Reader) Open(device string, iq chan<- readers.Scan) error {
+	ps := strings.SplitN(device, ":", 2)
+	if len(ps) != 2 {
+		return errors.New("invalid device string: " + device)
+	}
+
+	if !utils.Contains(r.Ids(), ps[0]) {
+		return errors.New("invalid reader id: " + ps[0])
+	}
+
+	path := ps[1]
+
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+
+	dev, err := r.open(path)
+	if err != nil {
+		return err
+	}
+
+	r.dev = dev
+	r.device = device
+	r.path = path
+	r.setErr(nil)
+	r.polling.Store(true)
+	r.tokenValue = r.cfg.GetReaderTokenValue(device, config.ReaderTokenValueUid)
+
+	removalTimeout := r.cfg.GetReaderRemovalTimeout(device, defaultRemovalTimeout)
+	r.removalTimeout = removalTimeout
+	lines := make(chan string)
+	go r.readLines(lines)
+
+	go func() {
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case line, ok := <-lines:
+				if !ok {
+					if r.polling.Load() {
+						err := r.Close()
+						if err != nil {
+							log.Error().Err(err).Msg("failed to close hid keyboard")
+						}
+					}
+					return
+				}
+
+				t := r.newToken(line)
+				log.Debug().Msgf("hid keyboard read: %s", line)
+
+				// without removal the same token is never cleared, so a
+				// repeat is the token being scanned again
+				if removalTimeout <= 0 || !utils.TokensEqual(t, r.lastToken) {
+					iq <- readers.Scan{
+						Source: r.device,
+						Token:  t,
+					}
+				}
+
+				r.lastToken = t
+			case <-ticker.C:
+				if r.lastToken != nil && removalTimeout > 0 && time.Since(r.lastToken.ScanTime) > removalTimeout {
+					iq <- readers.Scan{
+						Source: r.device,
+						Token:  nil,
+					}
+					r.lastToken = nil
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (r *Reader) Close() error {
+	r.polling.Store(false)
+	if r.dev != nil {
+		err := r.dev.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Reader) Detect(connected []string) string {
+	return ""
+}
+
+func (r *Reader) Device() string {
+	return r.device
+}
+
+func (r *Reader) Connected() bool {
+	return r.polling.Load() && r.dev != nil
+}
+
+func (r *Reader) Info() string {
+	return r.path
+}
+
+func (r *Reader) Write(text string, _ readers.WriteOptions, _ func(readers.WriteStatus)) (*tokens.Token, error) {
+	return nil, errors.New("writing not supported on this reader")
+}
+
+func (r *Reader) CancelWrite() {
+	// no writes to cancel
+}
+
+func (r *Reader) Capabilities() readers.Capabilities {
+	return readers.Capabilities{
+		Removal:  r.removalTimeout > 0,
+		TagTypes: []string{TokenType},
+	}
+}
+
+func (r *Reader) setErr(err error) {
+	r.errMu.Lock()
+	defer r.errMu.Unlock()
+	r.err = err
+}
+
+func (r *Reader) getErr() error {
+	r.errMu.Lock()
+	defer r.errMu.Unlock()
+	return r.err
+}
+
+func (r *Reader) Health() error {
+	if !r.Connected() {
+		if err := r.getErr(); err != nil {
+			return err
+		}
+		return readers.ErrNotConnected
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package hid_keyboard
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ZaparooProject/zaparoo-core/pkg/config"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/readertest"
+)
+
+type fakeKey struct {
+	code  uint16
+	value int32
+}
+
+// fakeDevice replays key events sent on its channel.
+type fakeDevice struct {
+	keys      chan fakeKey
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newFakeDevice() *fakeDevice {
+	return &fakeDevice{
+		keys:   make(chan fakeKey, 100),
+		closed: make(chan struct{}),
+	}
+}
+
+func (d *fakeDevice) ReadKey() (uint16, int32, error) {
+	select {
+	case k := <-d.keys:
+		return k.code, k.value, nil
+	case <-d.closed:
+		return 0, 0, errors.New("device closed")
+	}
+}
+
+func (d *fakeDevice) Close() error {
+	d.closeOnce.Do(func() {
+		close(d.closed)
+	})
+	return nil
+}
+
+func (d *fakeDevice) typeKeys(codes ...uint16) {
+	for _, code := range codes {
+		d.keys <- fakeKey{code, keyPressed}
+		d.keys <- fakeKey{code, keyReleased}
+	}
+}
+
+// openFakeReader opens a reader which reads key events from a fake device.
+// Any options are added to the reader's config before it's opened.
+func openFakeReader(t *testing.T, dev *fakeDevice, opts ...func(*config.UserConfig, string)) (*Reader, chan readers.Scan) {
+	t.Helper()
+
+	device := "hid_keyboard:" + readertest.DevicePath(t, "event0")
+	cfg := &config.UserConfig{}
+	for _, opt := range opts {
+		opt(cfg, device)
+	}
+
+	r := NewReader(cfg)
+	r.open = func(_ string) (keyDevice, error) {
+		return dev, nil
+	}
+
+	return r, readertest.Open(t, r, device)
+}
+
+func TestReaderScanAndRemove(t *testing.T) {
+	dev := newFakeDevice()
+	r, scans := openFakeReader(t, dev, func(cfg *config.UserConfig, device string) {
+		cfg.Readers.RemovalTimeout = []string{"0.2:" + device}
+	})
+
+	if !r.Capabilities().Removal {
+		t.Fatal("expected removal with a removal timeout")
+	}
+
+	// 123, enter
+	dev.typeKeys(2, 3, 4, keyEnter)
+
+	scan := readertest.WaitScan(t, scans)
+	if scan.Token == nil || scan.Token.UID != "123" || scan.Token.Text != "" {
+		t.Fatalf("unexpected scan: %+v", scan)
+	}
+
+	scan = readertest.WaitScan(t, scans)
+	if scan.Token != nil {
+		t.Fatalf("expected removal, got: %+v", scan.Token)
+	}
+}
+
+func TestReaderTokenValueText(t *testing.T) {
+	dev := newFakeDevice()
+	_, scans := openFakeReader(t, dev, func(cfg *config.UserConfig, device string) {
+		cfg.Readers.TokenValue = []string{"text:" + device}
+	})
+
+	dev.typeKeys(30, 31, keyEnter)
+
+	scan := readertest.WaitScan(t, scans)
+	if scan.Token == nil || scan.Token.Text != "as" || scan.Token.UID != "" {
+		t.Fatalf("unexpected scan: %+v", scan)
+	}
+
+	// removal is disabled by default
+	select {
+	case scan := <-scans:
+		t.Fatalf("unexpected scan: %+v", scan)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func TestReaderRepeatWithoutRemoval(t *testing.T) {
+	dev := newFakeDevice()
+	_, scans := openFakeReader(t, dev)
+
+	for i := 0; i < 2; i++ {
+		dev.typeKeys(2, 3, 4, keyEnter)
+
+		scan := readertest.WaitScan(t, scans)
+		if scan.Token == nil || scan.Token.UID != "123" {
+			t.Fatalf("scan %d: unexpected scan: %+v", i+1, scan)
+		}
+	}
+}
+
+func TestReaderDeviceError(t *testing.T) {
+	dev := newFakeDevice()
+	r, _ := openFakeReader(t, dev)
+
+	_ = dev.Close()
+
+	readertest.WaitFor(t, func() bool {
+		return !r.Connected()
+	})
+}
@@ -0,0 +1,158 @@
+package hid_keyboard
+
+import "strings"
+
+// Key codes from linux/input-event-codes.h which aren't printable.
+const (
+	keyBackspace  = 14
+	keyEnter      = 28
+	keyLeftShift  = 42
+	keyRightShift = 54
+	keyCapsLock   = 58
+	keyKpEnter    = 96
+)
+
+// Key values of an EV_KEY event.
+const (
+	keyReleased = 0
+	keyPressed  = 1
+)
+
+// Limit of characters buffered without an Enter, so a stuck or misbehaving
+// device can't grow the buffer forever.
+const maxLineLength = 1024
+
+// keyChar is the character typed by a key with a US layout, without and
+// with shift held.
+type keyChar struct {
+	normal  rune
+	shifted rune
+}
+
+var keymap = map[uint16]keyChar{
+	2:  {'1', '!'},
+	3:  {'2', '@'},
+	4:  {'3', '#'},
+	5:  {'4', '$'},
+	6:  {'5', '%'},
+	7:  {'6', '^'},
+	8:  {'7', '&'},
+	9:  {'8', '*'},
+	10: {'9', '('},
+	11: {'0', ')'},
+	12: {'-', '_'},
+	13: {'=', '+'},
+	16: {'q', 'Q'},
+	17: {'w', 'W'},
+	18: {'e', 'E'},
+	19: {'r', 'R'},
+	20: {'t', 'T'},
+	21: {'y', 'Y'},
+	22: {'u', 'U'},
+	23: {'i', 'I'},
+	24: {'o', 'O'},
+	25: {'p', 'P'},
+	26: {'[', '{'},
+	27: {']', '}'},
+	30: {'a', 'A'},
+	31: {'s', 'S'},
+	32: {'d', 'D'},
+	33: {'f', 'F'},
+	34: {'g', 'G'},
+	35: {'h', 'H'},
+	36: {'j', 'J'},
+	37: {'k', 'K'},
+	38: {'l', 'L'},
+	39: {';', ':'},
+	40: {'\'', '"'},
+	41: {'`', '~'},
+	43: {'\\', '|'},
+	44: {'z', 'Z'},
+	45: {'x', 'X'},
+	46: {'c', 'C'},
+	47: {'v', 'V'},
+	48: {'b', 'B'},
+	49: {'n', 'N'},
+	50: {'m', 'M'},
+	51: {',', '<'},
+	52: {'.', '>'},
+	53: {'/', '?'},
+	55: {'*', '*'},
+	57: {' ', ' '},
+	// keypad, always as if num lock is on
+	71: {'7', '7'},
+	72: {'8', '8'},
+	73: {'9', '9'},
+	74: {'-', '-'},
+	75: {'4', '4'},
+	76: {'5', '5'},
+	77: {'6', '6'},
+	78: {'+', '+'},
+	79: {'1', '1'},
+	80: {'2', '2'},
+	81: {'3', '3'},
+	82: {'0', '0'},
+	83: {'.', '.'},
+	98: {'/', '/'},
+}
+
+// keyBuffer assembles key events into lines of text.
+type keyBuffer struct {
+	leftShift  bool
+	rightShift bool
+	capsLock   bool
+	line       strings.Builder
+}
+
+// handleKey processes a single key event. It returns the buffered line and
+// true when Enter is pressed with a non-empty line.
+func (k *keyBuffer) handleKey(code uint16, value int32) (string, bool) {
+	switch code {
+	case keyLeftShift:
+		k.leftShift = value != keyReleased
+		return "", false
+	case keyRightShift:
+		k.rightShift = value != keyReleased
+		return "", false
+	}
+
+	// only act on the initial press, not releases or auto repeats
+	if value != keyPressed {
+		return "", false
+	}
+
+	switch code {
+	case keyCapsLock:
+		k.capsLock = !k.capsLock
+		return "", false
+	case keyEnter, keyKpEnter:
+		line := k.line.String()
+		k.line.Reset()
+		return line, line != ""
+	case keyBackspace:
+		line := []rune(k.line.String())
+		if len(line) > 0 {
+			k.line.Reset()
+			k.line.WriteString(string(line[:len(line)-1]))
+		}
+		return "", false
+	}
+
+	c, ok := keymap[code]
+	if !ok || k.line.Len() >= maxLineLength {
+		return "", false
+	}
+
+	shift := k.leftShift || k.rightShift
+	if k.capsLock && c.normal >= 'a' && c.normal <= 'z' {
+		shift = !shift
+	}
+
+	if shift {
+		k.line.WriteRune(c.shifted)
+	} else {
+		k.line.WriteRune(c.normal)
+	}
+
+	return "", false
+}
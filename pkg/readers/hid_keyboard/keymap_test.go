@@ -0,0 +1,77 @@
+package hid_keyboard
+
+import "testing"
+
+// typeKeys presses and releases each key code in order, returning the
+// completed lines.
+func typeKeys(kb *keyBuffer, codes ...uint16) []string {
+	var lines []string
+	for _, code := range codes {
+		line, ok := kb.handleKey(code, keyPressed)
+		if ok {
+			lines = append(lines, line)
+		}
+		kb.handleKey(code, keyReleased)
+	}
+	return lines
+}
+
+func TestKeyBufferDigits(t *testing.T) {
+	var kb keyBuffer
+
+	// 0123456789, keypad 42, enter
+	lines := typeKeys(&kb, 11, 2, 3, 4, 5, 6, 7, 8, 9, 10, 75, 80, keyEnter)
+	if len(lines) != 1 || lines[0] != "012345678942" {
+		t.Fatalf("unexpected lines: %q", lines)
+	}
+}
+
+func TestKeyBufferShift(t *testing.T) {
+	var kb keyBuffer
+
+	// shift+a, b, right shift+1, keypad enter
+	kb.handleKey(keyLeftShift, keyPressed)
+	typeKeys(&kb, 30)
+	kb.handleKey(keyLeftShift, keyReleased)
+	typeKeys(&kb, 48)
+	kb.handleKey(keyRightShift, keyPressed)
+	typeKeys(&kb, 2)
+	kb.handleKey(keyRightShift, keyReleased)
+
+	lines := typeKeys(&kb, keyKpEnter)
+	if len(lines) != 1 || lines[0] != "Ab!" {
+		t.Fatalf("unexpected lines: %q", lines)
+	}
+}
+
+func TestKeyBufferCapsLock(t *testing.T) {
+	var kb keyBuffer
+
+	lines := typeKeys(&kb, keyCapsLock, 30, 2, keyCapsLock, 30, keyEnter)
+	if len(lines) != 1 || lines[0] != "A1a" {
+		t.Fatalf("unexpected lines: %q", lines)
+	}
+}
+
+func TestKeyBufferBackspaceAndEmpty(t *testing.T) {
+	var kb keyBuffer
+
+	// an empty line is ignored
+	lines := typeKeys(&kb, keyEnter, 30, 31, keyBackspace, 32, keyEnter)
+	if len(lines) != 1 || lines[0] != "ad" {
+		t.Fatalf("unexpected lines: %q", lines)
+	}
+}
+
+func TestKeyBufferIgnoresRepeats(t *testing.T) {
+	var kb keyBuffer
+
+	kb.handleKey(30, keyPressed)
+	kb.handleKey(30, 2)
+	kb.handleKey(30, keyReleased)
+
+	lines := typeKeys(&kb, keyEnter)
+	if len(lines) != 1 || lines[0] != "a" {
+		t.Fatalf("unexpected lines: %q", lines)
+	}
+}
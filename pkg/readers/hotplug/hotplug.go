@@ -0,0 +1,142 @@
+// Package hotplug reports when devices are added to or removed from the
+// system, so readers only need to be detected when something has changed
+// instead of probing every serial port on a timer.
+package hotplug
+
+import (
+	"bytes"
+	"sync"
+	"time"
+)
+
+// SettleDelay is how long to wait after a device event before detecting
+// readers. Plugging in a device causes a burst of events, and udev needs a
+// moment to set permissions and create symlinks for the new device node.
+const SettleDelay = 500 * time.Millisecond
+
+// isDeviceEvent returns true if a kernel uevent message is a device being
+// added or removed. Messages are a header followed by null separated
+// key=value pairs, e.g. "add@/devices/...\x00ACTION=add\x00SUBSYSTEM=tty".
+func isDeviceEvent(msg []byte) bool {
+	for _, f := range bytes.Split(msg, []byte{0}) {
+		k, v, ok := bytes.Cut(f, []byte("="))
+		if !ok || !bytes.Equal(k, []byte("ACTION")) {
+			continue
+		}
+		return bytes.Equal(v, []byte("add")) || bytes.Equal(v, []byte("remove"))
+	}
+	return false
+}
+
+// notify sends an event without blocking. Events are only a hint that
+// something changed, so one pending event is enough.
+func notify(events chan<- struct{}) {
+	select {
+	case events <- struct{}{}:
+	default:
+	}
+}
+
+// subscriber receives an event for each message its filter accepts.
+type subscriber struct {
+	filter func(msg []byte) bool
+	events chan struct{}
+}
+
+// fanout shares one message source, like the uevent socket, between any
+// number of subscribers. The source is opened for the first subscriber and
+// stopped when the last one leaves.
+type fanout struct {
+	// open starts the source, which passes each message to recv and calls
+	// fail if it stops by itself. A nil message means messages were
+	// dropped and is sent to every subscriber.
+	open func(recv func(msg []byte), fail func()) (stop func(), err error)
+	mu   sync.Mutex
+	subs map[*subscriber]struct{}
+	stop func()
+	// incremented each time the source is opened, so a stopped source
+	// can't affect the subscribers of the next one
+	gen int
+}
+
+// subscribe returns a channel which receives an event for each message the
+// filter accepts, and a function to unsubscribe. The channel is closed if
+// the source fails.
+func (f *fanout) subscribe(filter func(msg []byte) bool) (<-chan struct{}, func(), error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.stop == nil {
+		f.gen++
+		gen := f.gen
+		stop, err := f.open(
+			func(msg []byte) { f.dispatch(gen, msg) },
+			func() { f.fail(gen) },
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+		f.stop = stop
+		f.subs = make(map[*subscriber]struct{})
+	}
+
+	s := &subscriber{
+		filter: filter,
+		events: make(chan struct{}, 1),
+	}
+	f.subs[s] = struct{}{}
+
+	var once sync.Once
+	return s.events, func() {
+		once.Do(func() { f.unsubscribe(s) })
+	}, nil
+}
+
+func (f *fanout) unsubscribe(s *subscriber) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// the source may have already failed and dropped its subscribers
+	if _, ok := f.subs[s]; !ok {
+		return
+	}
+
+	delete(f.subs, s)
+	if len(f.subs) == 0 {
+		f.stop()
+		f.stop = nil
+		f.subs = nil
+	}
+}
+
+func (f *fanout) dispatch(gen int, msg []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if gen != f.gen {
+		return
+	}
+
+	for s := range f.subs {
+		if msg == nil || s.filter(msg) {
+			notify(s.events)
+		}
+	}
+}
+
+// fail closes the channels of all subscribers after the source has
+// stopped by itself. The next subscriber opens it again.
+func (f *fanout) fail(gen int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if gen != f.gen || f.stop == nil {
+		return
+	}
+
+	for s := range f.subs {
+		close(s.events)
+	}
+	f.subs = nil
+	f.stop = nil
+}
@@ -0,0 +1,160 @@
+package hotplug
+
+import "testing"
+
+func TestIsDeviceEvent(t *testing.T) {
+	tests := []struct {
+		msg  string
+		want bool
+	}{
+		{
+			"add@/devices/pci0000:00/usb1/1-1/1-1:1.0/ttyUSB0/tty/ttyUSB0\x00" +
+				"ACTION=add\x00DEVPATH=/devices/pci0000:00/usb1/1-1/1-1:1.0/ttyUSB0/tty/ttyUSB0\x00" +
+				"SUBSYSTEM=tty\x00DEVNAME=ttyUSB0\x00SEQNUM=4242\x00",
+			true,
+		},
+		{
+			"remove@/devices/virtual/input/input12\x00ACTION=remove\x00SUBSYSTEM=input\x00",
+			true,
+		},
+		{
+			"change@/devices/virtual/block/sr0\x00ACTION=change\x00DISK_MEDIA_CHANGE=1\x00",
+			false,
+		},
+		{
+			"bind@/devices/pci0000:00/usb1/1-1\x00ACTION=bind\x00SUBSYSTEM=usb\x00",
+			false,
+		},
+		{"add@/devices/pci0000:00/usb1/1-1", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := isDeviceEvent([]byte(tt.msg)); got != tt.want {
+			t.Errorf("isDeviceEvent(%q) = %t, want %t", tt.msg, got, tt.want)
+		}
+	}
+}
+
+func TestNotify(t *testing.T) {
+	events := make(chan struct{}, 1)
+
+	// a burst of events only leaves one pending
+	notify(events)
+	notify(events)
+	notify(events)
+
+	if len(events) != 1 {
+		t.Errorf("pending events = %d, want 1", len(events))
+	}
+}
+
+// fakeSource is a fanout source controlled by the test.
+type fakeSource struct {
+	opened  int
+	stopped int
+	recv    func(msg []byte)
+	fail    func()
+}
+
+func (s *fakeSource) open(recv func(msg []byte), fail func()) (func(), error) {
+	s.opened++
+	s.recv = recv
+	s.fail = fail
+	return func() { s.stopped++ }, nil
+}
+
+func pending(events <-chan struct{}) bool {
+	select {
+	case _, ok := <-events:
+		return ok
+	default:
+		return false
+	}
+}
+
+func TestFanoutSharesSource(t *testing.T) {
+	src := &fakeSource{}
+	f := &fanout{open: src.open}
+
+	devs, stopDevs, err := f.subscribe(isDeviceEvent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	all, stopAll, err := f.subscribe(func([]byte) bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if src.opened != 1 {
+		t.Fatalf("source opened %d times, want 1", src.opened)
+	}
+
+	src.recv([]byte("change@/devices/virtual/block/sr0\x00ACTION=change\x00"))
+	if pending(devs) || !pending(all) {
+		t.Fatal("expected only the matching subscriber to get an event")
+	}
+
+	// dropped messages notify everyone
+	src.recv(nil)
+	if !pending(devs) || !pending(all) {
+		t.Fatal("expected dropped messages to notify every subscriber")
+	}
+
+	stopDevs()
+	stopDevs()
+	if src.stopped != 0 {
+		t.Fatal("expected source to stay open for the remaining subscriber")
+	}
+
+	stopAll()
+	if src.stopped != 1 {
+		t.Fatalf("source stopped %d times, want 1", src.stopped)
+	}
+
+	// the next subscriber opens a new source
+	_, stop, err := f.subscribe(isDeviceEvent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	if src.opened != 2 {
+		t.Fatalf("source opened %d times, want 2", src.opened)
+	}
+}
+
+func TestFanoutFail(t *testing.T) {
+	src := &fakeSource{}
+	f := &fanout{open: src.open}
+
+	events, stop, err := f.subscribe(isDeviceEvent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	staleFail := src.fail
+
+	src.fail()
+	if _, ok := <-events; ok {
+		t.Fatal("expected channel to be closed when the source fails")
+	}
+
+	// stopping after a failure does nothing
+	stop()
+	if src.stopped != 0 {
+		t.Fatal("expected failed source to not be stopped")
+	}
+
+	events, stop, err = f.subscribe(isDeviceEvent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	// a failure of the previous source doesn't affect the new one
+	staleFail()
+	src.recv([]byte("remove@/devices/virtual/input/input12\x00ACTION=remove\x00"))
+	if !pending(events) {
+		t.Fatal("expected new source to keep sending events")
+	}
+}
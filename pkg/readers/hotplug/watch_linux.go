@@ -0,0 +1,160 @@
+//go:build linux
+
+package hotplug
+
+import (
+	"errors"
+	"os"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog/log"
+)
+
+// from linux/netlink.h
+const netlinkKobjectUevent = 15
+
+// directories watched if uevents aren't available, which is where new
+// serial ports and input devices appear
+var devDirs = []string{"/dev", "/dev/input"}
+
+// Watch returns a channel which receives an event when a device is added
+// or removed, and a function to stop watching. The kernel's uevents are
+// used, falling back to watching /dev. The channel is closed if the
+// watcher fails, after which the caller should poll instead.
+func Watch() (<-chan struct{}, func(), error) {
+	events, stop, err := WatchUevents(isDeviceEvent)
+	if err == nil {
+		return events, stop, nil
+	}
+
+	log.Debug().Err(err).Msg("uevents not available, watching /dev")
+	return watchDev()
+}
+
+// uevents shares a single netlink socket between every uevent watcher.
+var uevents = &fanout{open: openUevents}
+
+// WatchUevents subscribes to the kernel's uevents and returns a channel
+// which receives an event for each message the filter accepts, and a
+// function to stop watching. Dropped messages also send an event, because
+// one of them may have been accepted. The channel is closed if receiving
+// fails. All watchers share one socket, which is closed after the last
+// watcher stops.
+func WatchUevents(filter func(msg []byte) bool) (<-chan struct{}, func(), error) {
+	return uevents.subscribe(filter)
+}
+
+// openUevents opens the netlink socket and passes each uevent message to
+// recv until it's stopped.
+func openUevents(recv func(msg []byte), fail func()) (func(), error) {
+	fd, err := syscall.Socket(
+		syscall.AF_NETLINK,
+		syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC,
+		netlinkKobjectUevent,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	err = syscall.Bind(fd, &syscall.SockaddrNetlink{
+		Family: syscall.AF_NETLINK,
+		Groups: 1,
+	})
+	if err != nil {
+		_ = syscall.Close(fd)
+		return nil, err
+	}
+
+	// closing the socket doesn't interrupt a blocked receive, so it times
+	// out regularly to check if the watcher has stopped
+	err = syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &syscall.Timeval{Sec: 1})
+	if err != nil {
+		_ = syscall.Close(fd)
+		return nil, err
+	}
+
+	var stopped atomic.Bool
+
+	go func() {
+		defer func() {
+			_ = syscall.Close(fd)
+		}()
+
+		buf := make([]byte, 8192)
+		for !stopped.Load() {
+			n, _, err := syscall.Recvfrom(fd, buf, 0)
+			if errors.Is(err, syscall.EINTR) || errors.Is(err, syscall.EAGAIN) {
+				continue
+			} else if errors.Is(err, syscall.ENOBUFS) {
+				recv(nil)
+				continue
+			} else if err != nil {
+				log.Warn().Err(err).Msg("error receiving uevent")
+				fail()
+				return
+			}
+
+			if n > 0 {
+				recv(buf[:n])
+			}
+		}
+	}()
+
+	return func() {
+		stopped.Store(true)
+	}, nil
+}
+
+func watchDev() (<-chan struct{}, func(), error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	watching := 0
+	for _, dir := range devDirs {
+		if _, err := os.Stat(dir); err != nil {
+			continue
+		}
+		err := watcher.Add(dir)
+		if err != nil {
+			log.Debug().Err(err).Msgf("error watching %s", dir)
+			continue
+		}
+		watching++
+	}
+
+	if watching == 0 {
+		_ = watcher.Close()
+		return nil, nil, errors.New("no device directories could be watched")
+	}
+
+	events := make(chan struct{}, 1)
+
+	go func() {
+		defer close(events)
+
+		for {
+			select {
+			case e, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if e.Has(fsnotify.Create) || e.Has(fsnotify.Remove) {
+					notify(events)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Warn().Err(err).Msg("error watching /dev")
+			}
+		}
+	}()
+
+	return events, func() {
+		_ = watcher.Close()
+	}, nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package hotplug
+
+import "errors"
+
+func Watch() (<-chan struct{}, func(), error) {
+	return nil, nil, errors.New("hotplug events are only supported on linux")
+}
+
+func WatchUevents(_ func(msg []byte) bool) (<-chan struct{}, func(), error) {
+	return nil, nil, errors.New("uevents are only supported on linux")
+}
@@ -7,15 +7,15 @@ import (
 	"errors"
 	"fmt"
 	"github.com/ZaparooProject/zaparoo-core/pkg/service/tokens"
-	"os"
-	"path/filepath"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/ZaparooProject/zaparoo-core/pkg/config"
 	"github.com/ZaparooProject/zaparoo-core/pkg/readers"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/figures"
 	"github.com/ZaparooProject/zaparoo-core/pkg/readers/libnfc/tags"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/mifare"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/ndef"
 	"github.com/ZaparooProject/zaparoo-core/pkg/utils"
 	"github.com/clausecker/nfc/v2"
 	"github.com/rs/zerolog/log"
@@ -28,6 +28,10 @@ const (
 	periodBetweenPolls = 250 * time.Millisecond
 	periodBetweenLoop  = 250 * time.Millisecond
 	autoConnStr        = "libnfc_auto:"
+	// serial devices which fail to open are blocked from detection for
+	// this long, doubling each time they fail again
+	blockMinTime = 1 * time.Minute
+	blockMaxTime = 15 * time.Minute
 )
 
 type WriteRequestResult struct {
@@ -36,23 +40,28 @@ type WriteRequestResult struct {
 }
 
 type WriteRequest struct {
-	Text   string
-	Result chan WriteRequestResult
+	Text    string
+	Options readers.WriteOptions
+	Status  func(readers.WriteStatus)
+	Result  chan WriteRequestResult
 }
 
 type Reader struct {
-	cfg       *config.UserConfig
-	conn      string
-	pnd       *nfc.Device
-	polling   bool
-	prevToken *tokens.Token
-	write     chan WriteRequest
+	cfg         *config.UserConfig
+	conn        string
+	pnd         *nfc.Device
+	polling     bool
+	prevToken   *tokens.Token
+	write       chan WriteRequest
+	cancelWrite chan bool
+	err         error
 }
 
 func NewReader(cfg *config.UserConfig) *Reader {
 	return &Reader{
-		cfg:   cfg,
-		write: make(chan WriteRequest),
+		cfg:         cfg,
+		write:       make(chan WriteRequest),
+		cancelWrite: make(chan bool, 1),
 	}
 }
 
@@ -75,6 +84,7 @@ func (r *Reader) Open(device string, iq chan<- readers.Scan) error {
 
 	r.conn = device
 	r.pnd = &pnd
+	r.err = nil
 	r.polling = true
 	r.prevToken = nil
 
@@ -91,6 +101,7 @@ func (r *Reader) Open(device string, iq chan<- readers.Scan) error {
 			if errors.Is(err, nfc.Error(nfc.EIO)) {
 				log.Error().Msgf("error during poll: %s", err)
 				log.Error().Msg("fatal IO error, device was possibly unplugged")
+				r.err = fmt.Errorf("device was possibly unplugged: %w", err)
 
 				err = r.Close()
 				if err != nil {
@@ -181,14 +192,26 @@ func (r *Reader) Info() string {
 	return r.pnd.String()
 }
 
-func (r *Reader) Write(text string) (*tokens.Token, error) {
+func (r *Reader) Write(
+	text string,
+	opts readers.WriteOptions,
+	status func(readers.WriteStatus),
+) (*tokens.Token, error) {
 	if !r.Connected() {
 		return nil, errors.New("not connected")
 	}
 
+	// clear any cancel request left over from a previous write
+	select {
+	case <-r.cancelWrite:
+	default:
+	}
+
 	req := WriteRequest{
-		Text:   text,
-		Result: make(chan WriteRequestResult),
+		Text:    text,
+		Options: opts,
+		Status:  status,
+		Result:  make(chan WriteRequestResult),
 	}
 
 	r.write <- req
@@ -202,9 +225,30 @@ func (r *Reader) Write(text string) (*tokens.Token, error) {
 	return res.Token, nil
 }
 
-// keep track of serial devices that had failed opens
-var serialCacheMu = &sync.RWMutex{}
-var serialBlockList []string
+func (r *Reader) CancelWrite() {
+	select {
+	case r.cancelWrite <- true:
+	default:
+	}
+}
+
+func (r *Reader) Capabilities() readers.Capabilities {
+	return readers.Capabilities{
+		Write:   true,
+		Removal: true,
+		TagTypes: []string{
+			tokens.TypeNTAG,
+			tokens.TypeMifare,
+			tokens.TypeAmiibo,
+			tokens.TypeLegoDimensions,
+			tokens.TypeType4,
+		},
+	}
+}
+
+// keep track of serial devices that had failed opens, they're not probed
+// again until their block expires
+var serialBlockList = readers.NewBackoff(blockMinTime, blockMaxTime)
 
 func detectSerialReaders(connected []string) string {
 	devices, err := utils.GetSerialDeviceList()
@@ -219,57 +263,27 @@ func detectSerialReaders(connected []string) string {
 		connStr := "pn532_uart:" + device
 
 		// ignore if device is in block list
-		serialCacheMu.RLock()
-		if utils.Contains(serialBlockList, device) {
-			serialCacheMu.RUnlock()
+		if !serialBlockList.Ready(device) {
 			continue
 		}
-		serialCacheMu.RUnlock()
 
 		// ignore if exact same device and reader are connected
 		if utils.Contains(connected, connStr) {
 			continue
 		}
 
-		// resolve device symlink if necessary
-		realPath := ""
-		symPath, err := os.Readlink(device)
-		if err == nil {
-			parent := filepath.Dir(device)
-			abs, err := filepath.Abs(filepath.Join(parent, symPath))
-			if err == nil {
-				realPath = abs
-			}
-		}
-
-		// ignore if same resolved device and reader connected
-		if realPath != "" && utils.Contains(connected, realPath) {
-			continue
-		}
-
-		// ignore if different reader already connected
-		match := false
-		for _, c := range connected {
-			if strings.HasSuffix(c, ":"+device) {
-				match = true
-				break
-			}
-		}
-		if match {
-			continue
-		}
-
-		// ignore if different resolved device and reader connected
-		if realPath != "" && strings.HasSuffix(realPath, ":"+realPath) {
+		// ignore if the same physical device is connected with any reader,
+		// including through a symlink
+		if readers.PathConnected(connected, device) {
 			continue
 		}
 
 		pnd, err := nfc.Open(connStr)
 		if err != nil {
-			serialCacheMu.Lock()
-			serialBlockList = append(serialBlockList, device)
-			serialCacheMu.Unlock()
+			wait := serialBlockList.Fail(device)
+			log.Debug().Err(err).Msgf("failed to open detected serial device, blocking for %s: %s", wait, device)
 		} else {
+			serialBlockList.Reset(device)
 			err := pnd.Close()
 			if err != nil {
 				log.Warn().Err(err).Msgf("error closing device: %s", device)
@@ -361,20 +375,32 @@ func (r *Reader) pollDevice(
 		cardType = tokens.TypeNTAG
 	} else if cardType == tokens.TypeMifare {
 		log.Info().Msg("MIFARE detected")
-		record, err = tags.ReadMifare(*pnd, tagUid)
+		record, err = tags.ReadMifare(*pnd, target, tagUid, mifare.ParseKeys(r.cfg.GetMifareKey()))
 		if err != nil {
 			log.Error().Msgf("error reading mifare: %s", err)
 		}
 		cardType = tokens.TypeMifare
+	} else if cardType == tokens.TypeType4 {
+		log.Info().Msg("ISO 14443-4 tag detected")
+		record, err = tags.ReadType4(*pnd)
+		if err != nil {
+			log.Error().Msgf("error reading type 4 tag: %s", err)
+		}
 	}
 
 	log.Debug().Msgf("record bytes: %s", hex.EncodeToString(record.Bytes))
-	tagText, err := tags.ParseRecordText(record.Bytes)
+	var records []ndef.Record
+	if record.Type == tokens.TypeType4 {
+		records, err = ndef.ParseMessage(record.Bytes)
+	} else {
+		records, err = ndef.ParseRecords(record.Bytes)
+	}
 	if err != nil {
 		log.Error().Err(err).Msgf("error parsing NDEF record")
-		tagText = ""
 	}
 
+	tagText := ndef.TokenText(records, r.cfg.GetUriStripPrefix())
+
 	if tagText == "" {
 		log.Warn().Msg("no text NDEF found")
 	} else {
@@ -388,6 +414,8 @@ func (r *Reader) pollDevice(
 		Data:     hex.EncodeToString(record.Bytes),
 		ScanTime: time.Now(),
 		Source:   r.conn,
+		Records:  records,
+		Figure:   decodeFigure(record, tagUid),
 	}
 
 	return card, removed, nil
@@ -396,12 +424,36 @@ func (r *Reader) pollDevice(
 func (r *Reader) writeTag(req WriteRequest) {
 	log.Info().Msgf("libnfc write request: %s", req.Text)
 
+	fail := func(err error) {
+		req.Status(readers.WriteStatus{
+			Device: r.conn,
+			Status: readers.WriteStatusFailed,
+			Error:  err,
+		})
+		req.Result <- WriteRequestResult{
+			Err: err,
+		}
+	}
+
+	req.Status(readers.WriteStatus{
+		Device: r.conn,
+		Status: readers.WriteStatusWaiting,
+	})
+
 	var count int
 	var target nfc.Target
 	var err error
 	tries := 4 * 30 // ~30 seconds
 
 	for tries > 0 {
+		select {
+		case <-r.cancelWrite:
+			log.Info().Msg("write request cancelled")
+			fail(errors.New("write cancelled"))
+			return
+		default:
+		}
+
 		count, target, err = r.pnd.InitiatorPollTarget(
 			tags.SupportedCardTypes,
 			timesToPoll,
@@ -421,72 +473,115 @@ func (r *Reader) writeTag(req WriteRequest) {
 
 	if count == 0 {
 		log.Error().Msgf("could not detect a tag")
-		req.Result <- WriteRequestResult{
-			Err: errors.New("could not detect a tag"),
-		}
+		fail(errors.New("could not detect a tag"))
 		return
 	}
 
 	cardUid := tags.GetTagUID(target)
 	log.Info().Msgf("found tag with UID: %s", cardUid)
 
+	req.Status(readers.WriteStatus{
+		Device: r.conn,
+		Status: readers.WriteStatusWriting,
+	})
+
 	cardType := tags.GetTagType(target)
 	var bytesWritten []byte
 
 	switch cardType {
 	case tokens.TypeMifare:
-		bytesWritten, err = tags.WriteMifare(*r.pnd, req.Text, cardUid)
+		if req.Options.Protected() {
+			fail(errors.New("protection is only supported on NTAG tags"))
+			return
+		}
+		bytesWritten, err = tags.WriteMifare(
+			*r.pnd,
+			target,
+			req.Text,
+			cardUid,
+			mifare.ParseKeys(r.cfg.GetMifareKey()),
+		)
 		if err != nil {
 			log.Error().Msgf("error writing to mifare: %s", err)
-			req.Result <- WriteRequestResult{
-				Err: err,
-			}
+			fail(err)
 			return
 		}
 	case tokens.TypeNTAG:
-		bytesWritten, err = tags.WriteNtag(*r.pnd, req.Text)
+		bytesWritten, err = tags.WriteNtag(*r.pnd, req.Text, req.Options)
 		if err != nil {
 			log.Error().Msgf("error writing to ntag: %s", err)
-			req.Result <- WriteRequestResult{
-				Err: err,
-			}
+			fail(err)
 			return
 		}
 	default:
 		log.Error().Msgf("unsupported tag type: %s", cardType)
-		req.Result <- WriteRequestResult{
-			Err: err,
-		}
+		fail(fmt.Errorf("unsupported tag type: %s", cardType))
 		return
 	}
 
 	t, _, err := r.pollDevice(r.pnd, nil, timesToPoll, periodBetweenPolls)
 	if err != nil || t == nil {
 		log.Error().Msgf("error reading written tag: %s", err)
-		req.Result <- WriteRequestResult{
-			Err: err,
+		if err == nil {
+			err = errors.New("could not read written tag")
 		}
+		fail(err)
 		return
 	}
 
 	if t.UID != cardUid {
 		log.Error().Msgf("UID mismatch after write: %s != %s", t.UID, cardUid)
-		req.Result <- WriteRequestResult{
-			Err: errors.New("UID mismatch after write"),
-		}
+		fail(errors.New("UID mismatch after write"))
 		return
 	}
 
 	if t.Text != req.Text {
 		log.Error().Msgf("text mismatch after write: %s != %s", t.Text, req.Text)
-		req.Result <- WriteRequestResult{
-			Err: errors.New("text mismatch after write"),
-		}
+		fail(errors.New("text mismatch after write"))
 		return
 	}
 
 	log.Info().Msgf("successfully wrote to card: %s", hex.EncodeToString(bytesWritten))
+	req.Status(readers.WriteStatus{
+		Device: r.conn,
+		Status: readers.WriteStatusVerified,
+	})
 	req.Result <- WriteRequestResult{
 		Token: t,
 	}
 }
+
+// decodeFigure returns the character of a toy figure tag, or nil if the tag
+// isn't a figure or couldn't be decoded.
+func decodeFigure(record tags.TagData, uid string) *figures.Figure {
+	var f figures.Figure
+	var err error
+
+	switch record.Type {
+	case tokens.TypeAmiibo:
+		f, err = figures.DecodeAmiibo(record.Bytes)
+	case tokens.TypeLegoDimensions:
+		uidBytes, _ := hex.DecodeString(uid)
+		f, err = figures.DecodeLegoDimensions(uidBytes, record.Bytes)
+	default:
+		return nil
+	}
+
+	if err != nil {
+		log.Warn().Err(err).Msg("error decoding figure")
+		return nil
+	}
+
+	log.Info().Msgf("decoded figure: %s %s", f.Id, f.Name)
+	return &f
+}
+
+func (r *Reader) Health() error {
+	if !r.Connected() {
+		if r.err != nil {
+			return r.err
+		}
+		return readers.ErrNotConnected
+	}
+	return nil
+}
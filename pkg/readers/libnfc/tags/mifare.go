@@ -23,134 +23,115 @@ along with TapTo.  If not, see <http://www.gnu.org/licenses/>.
 package tags
 
 import (
-	"bytes"
 	"encoding/hex"
-	"errors"
 	"fmt"
+
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/mifare"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/ndef"
 	"github.com/ZaparooProject/zaparoo-core/pkg/service/tokens"
-	"github.com/rs/zerolog/log"
 
 	"github.com/clausecker/nfc/v2"
-	"golang.org/x/exp/slices"
 )
 
-const (
-	MifareWritableSectorCount     = 15
-	MifareWritableBlocksPerSector = 3
-	MifareBlockSizeBytes          = 16
-)
+// mifareCard sends MIFARE Classic commands to a card through libnfc.
+type mifareCard struct {
+	pnd    nfc.Device
+	target nfc.Target
+	uid    []byte
+}
 
-// buildMifareAuthCommand returns a command to authenticate against a block
-func buildMifareAuthCommand(block byte, cardUid string) []byte {
-	command := []byte{
-		// Auth using key A
-		0x60, block,
-		// Using the NDEF well known private key
-		0xd3, 0xf7, 0xd3, 0xf7, 0xd3, 0xf7,
+func newMifareCard(pnd nfc.Device, target nfc.Target, cardUid string) *mifareCard {
+	uid, _ := hex.DecodeString(cardUid)
+	return &mifareCard{
+		pnd:    pnd,
+		target: target,
+		uid:    uid,
 	}
-	// And finally append the card UID to the end
-	uidBytes, _ := hex.DecodeString(cardUid)
-	return append(command, uidBytes...)
 }
 
-// ReadMifare reads data from all blocks in sectors 1-15
-func ReadMifare(pnd nfc.Device, cardUid string) (TagData, error) {
-	permissionSectors := []int{4, 8, 12, 16, 20, 24, 28, 32, 36, 40, 44, 48, 52, 56, 60}
-	var allBlocks []byte
-	for block := 0; block < 64; block++ {
-		if block <= 3 {
-			// The first sector contains infomation we don't care about and
-			// also has a different key (0xA0A1A2A3A4A5) YAGNI, so skip over
-			continue
-		}
-
-		// The last block of a sector contains KeyA + Permissions + KeyB
-		// We don't care about that info so skip if present.
-		if slices.Contains(permissionSectors, block+1) {
-			continue
-		}
-
-		// Mifare is split up into 16 sectors each containing 4 blocks.
-		// We need to authenticate before any read/ write operations can be performed
-		// Only need to authenticate once per sector
-		if block%4 == 0 {
-			_, err := comm(pnd, buildMifareAuthCommand(byte(block), cardUid), 2)
-			if err != nil {
-				log.Warn().Err(err).Msg("authenticating sector error")
-			}
-		}
-
-		blockData, err := comm(pnd, []byte{0x30, byte(block)}, 16)
-		if err != nil {
-			return TagData{}, err
-		}
-
-		allBlocks = append(allBlocks, blockData...)
-
-		if bytes.Contains(blockData, NdefEnd) {
-			// Once we find the end of the NDEF text record there is no need to
-			// continue reading the rest of the card.
-			// This should make things "load" quicker
-			break
-		}
+// GetMifareSectorCount returns the number of sectors on a MIFARE Classic
+// card, based on the SAK reported during anticollision.
+func GetMifareSectorCount(target nfc.Target) int {
+	card, ok := target.(*nfc.ISO14443aTarget)
+	if ok && card.Sak == 0x18 {
+		return mifare.Sectors4K
+	}
+	return mifare.Sectors1K
+}
 
+// buildMifareAuthCommand returns a command to authenticate against a block.
+// Cards with 7 byte UIDs use the last 4 bytes.
+func buildMifareAuthCommand(keyType byte, block int, key []byte, uid []byte) []byte {
+	command := append([]byte{keyType, byte(block)}, key...)
+	if len(uid) > 4 {
+		uid = uid[len(uid)-4:]
 	}
+	return append(command, uid...)
+}
 
-	return TagData{
-		Type:  tokens.TypeMifare,
-		Bytes: allBlocks,
-	}, nil
+// Auth authenticates a block, waking the card up again if it fails because
+// a failed authentication halts the card.
+func (c *mifareCard) Auth(block int, keyType byte, key []byte) error {
+	_, err := comm(c.pnd, buildMifareAuthCommand(keyType, block, key, c.uid), 2)
+	if err == nil {
+		return nil
+	}
+
+	_, selErr := c.pnd.InitiatorSelectPassiveTarget(c.target.Modulation(), c.uid)
+	if selErr != nil {
+		return fmt.Errorf("error reselecting card: %w", selErr)
+	}
+
+	return err
 }
 
-// getMifareCapacityInBytes returns the Mifare card capacity
-func getMifareCapacityInBytes() int {
-	return (MifareWritableBlocksPerSector * MifareWritableSectorCount) * MifareBlockSizeBytes
+func (c *mifareCard) ReadBlock(block int) ([]byte, error) {
+	return comm(c.pnd, []byte{mifare.ReadCommand, byte(block)}, mifare.BlockSize)
 }
 
-// WriteMifare writes the given text string to a Mifare card starting from sector, skipping any trailer blocks
-func WriteMifare(pnd nfc.Device, text string, cardUid string) ([]byte, error) {
-	var payload, err = BuildMessage(text)
+func (c *mifareCard) WriteBlock(block int, data []byte) error {
+	_, err := comm(c.pnd, append([]byte{mifare.WriteCommand, byte(block)}, data...), 2)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("error writing block %d: %w", block, err)
 	}
+	return nil
+}
+
+// ReadMifare reads the NDEF data blocks of a MIFARE Classic card until the
+// end of the NDEF message is found.
+func ReadMifare(pnd nfc.Device, target nfc.Target, cardUid string, keys mifare.Keys) (TagData, error) {
+	card := newMifareCard(pnd, target, cardUid)
 
-	var cardCapacity = getMifareCapacityInBytes()
-	if len(payload) > cardCapacity {
-		return nil, errors.New(fmt.Sprintf("Payload too big for card: [%d/%d] bytes used\n", len(payload), cardCapacity))
+	data, err := mifare.Read(card, GetMifareSectorCount(target), keys)
+	if err != nil {
+		return TagData{}, err
 	}
 
-	var chunks [][]byte
-	for _, chunk := range chunkBy(payload, 16) {
-		for len(chunk) < 16 {
-			chunk = append(chunk, []byte{0x00}...)
-		}
-		chunks = append(chunks, chunk)
+	return TagData{
+		Type:  tokens.TypeMifare,
+		Bytes: data,
+	}, nil
+}
+
+// WriteMifare writes the given text string to the NDEF sectors of a MIFARE
+// Classic card. Blank cards are formatted first.
+func WriteMifare(
+	pnd nfc.Device,
+	target nfc.Target,
+	text string,
+	cardUid string,
+	keys mifare.Keys,
+) ([]byte, error) {
+	var payload, err = ndef.BuildMessage(text)
+	if err != nil {
+		return nil, err
 	}
 
-	var chunkIndex = 0
-	for sector := 1; sector <= 15; sector++ {
-		// Iterate over blocks in sector (0-2) skipping trailer block (3)
-		for sectorIndex := 0; sectorIndex < 3; sectorIndex++ {
-			blockToWrite := (sector * 4) + sectorIndex
-			if sectorIndex == 0 {
-				// We changed sectors, time to authenticate
-				_, err := comm(pnd, buildMifareAuthCommand(byte(blockToWrite), cardUid), 2)
-				if err != nil {
-					return nil, err
-				}
-			}
-
-			writeBlockCommand := append([]byte{0xA0, byte(blockToWrite)}, chunks[chunkIndex]...)
-			_, err := comm(pnd, writeBlockCommand, 2)
-			if err != nil {
-				return nil, err
-			}
-			chunkIndex++
-			if chunkIndex >= len(chunks) {
-				// All data has been written, we are done
-				return payload, nil
-			}
-		}
+	card := newMifareCard(pnd, target, cardUid)
+
+	err = mifare.Write(card, GetMifareSectorCount(target), keys, payload)
+	if err != nil {
+		return nil, err
 	}
 
 	return payload, nil
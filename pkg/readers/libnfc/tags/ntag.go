@@ -23,10 +23,13 @@ along with TapTo.  If not, see <http://www.gnu.org/licenses/>.
 package tags
 
 import (
-	"bytes"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/figures"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/ndef"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/ntag"
 	"github.com/ZaparooProject/zaparoo-core/pkg/service/tokens"
 
 	"github.com/clausecker/nfc/v2"
@@ -44,20 +47,6 @@ const (
 	Ntag216Identifier    = 0x6D
 )
 
-// Can be identified by matching blocks 0x03-0x07
-// https://github.com/RfidResearchGroup/proxmark3/blob/master/client/src/cmdhfmfu.c
-var LegoDimensionsMatcher = []byte{
-	//0xE1, 0x10, 0x12, 0x00, // Skip as we never read 0x03
-	0x01, 0x03, 0xA0, 0x0C,
-	0x34, 0x03, 0x13, 0xD1,
-	0x01, 0x0F, 0x54, 0x02,
-	0x65, 0x6E}
-
-// Can be identified by matching address 0x09-0x0F
-var AmiiboMatcher = []byte{
-	0x48, 0x0F, 0xE0,
-	0xF1, 0x10, 0xFF, 0xEE}
-
 func ReadNtag(pnd nfc.Device) (TagData, error) {
 	blockCount, err := getNtagBlockCount(pnd)
 	if err != nil {
@@ -67,9 +56,9 @@ func ReadNtag(pnd nfc.Device) (TagData, error) {
 	log.Debug().Msgf("NTAG has %d blocks", blockCount)
 
 	header, _ := comm(pnd, []byte{ReadCommand, byte(0)}, 16)
-	if len(header) > 9 && bytes.Equal(header[9:], AmiiboMatcher) {
+	if figures.IsAmiibo(header) {
 		log.Info().Msg("found Amiibo")
-		amiibo, _ := comm(pnd, []byte{ReadCommand, byte(21)}, 16)
+		amiibo, _ := comm(pnd, []byte{ReadCommand, byte(figures.AmiiboIdPage)}, 16)
 		amiibo = amiibo[:8]
 		log.Info().Msg("Amiibo identifier:" + hex.EncodeToString(amiibo))
 		return TagData{
@@ -87,19 +76,23 @@ func ReadNtag(pnd nfc.Device) (TagData, error) {
 			return TagData{}, err
 		}
 
-		if byte(currentBlock) == 0x04 && len(blocks) >= 13 && bytes.Equal(blocks[0:14], LegoDimensionsMatcher) {
+		if byte(currentBlock) == 0x04 && figures.IsLegoDimensions(blocks) {
 			log.Info().Msg("found Lego Dimensions tag")
+			character, err := comm(pnd, []byte{ReadCommand, byte(figures.LegoIdPage)}, 16)
+			if err != nil {
+				return TagData{}, err
+			}
 			return TagData{
 				Type:  tokens.TypeLegoDimensions,
-				Bytes: []byte{},
+				Bytes: character[:12],
 			}, nil
 		}
 
 		allBlocks = append(allBlocks, blocks...)
 		currentBlock = currentBlock + 4
 
-		if bytes.Contains(allBlocks, NdefEnd) {
-			// Once we find the end of the NDEF text record there is no need to
+		if ndef.MessageComplete(allBlocks) {
+			// Once we have the whole NDEF message there is no need to
 			// continue reading the rest of the card.
 			// This should make things "load" quicker
 			log.Debug().Msg("found end of ndef record")
@@ -113,8 +106,8 @@ func ReadNtag(pnd nfc.Device) (TagData, error) {
 	}, nil
 }
 
-func WriteNtag(pnd nfc.Device, text string) ([]byte, error) {
-	var payload, err = BuildMessage(text)
+func WriteNtag(pnd nfc.Device, text string, opts readers.WriteOptions) ([]byte, error) {
+	var payload, err = ndef.BuildMessage(text)
 	if err != nil {
 		return nil, err
 	}
@@ -128,6 +121,13 @@ func WriteNtag(pnd nfc.Device, text string) ([]byte, error) {
 		return nil, errors.New(fmt.Sprintf("Payload too big for card: [%d/%d] bytes used\n", len(payload), cardCapacity))
 	}
 
+	tx := ntagTransceive(pnd)
+
+	err = ntag.Unlock(tx, opts.Password)
+	if err != nil {
+		return nil, err
+	}
+
 	var startingBlock byte = 0x04
 	for i, chunk := range chunkBy(payload, 4) {
 		for len(chunk) < 4 {
@@ -141,9 +141,28 @@ func WriteNtag(pnd nfc.Device, text string) ([]byte, error) {
 		}
 	}
 
+	err = ntag.Protect(tx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error protecting tag: %w", err)
+	}
+
 	return payload, nil
 }
 
+// ntagTransceive wraps the device for use with the shared NTAG commands.
+func ntagTransceive(pnd nfc.Device) ntag.Transceive {
+	return func(tx []byte) ([]byte, error) {
+		replySize := 1
+		switch tx[0] {
+		case ReadCommand:
+			replySize = 16
+		case ntag.PwdAuthCommand:
+			replySize = 2
+		}
+		return comm(pnd, tx, replySize)
+	}
+}
+
 func getNtagBlockCount(pnd nfc.Device) (int, error) {
 	// Find tag capacity by looking in block 3 (capability container)
 	tx := []byte{ReadCommand, 0x03}
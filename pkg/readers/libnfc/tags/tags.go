@@ -79,10 +79,18 @@ func GetTagType(target nfc.Target) string {
 			// https://www.nxp.com/docs/en/application-note/AN10833.pdf page 9
 			return tokens.TypeMifare
 		}
+		if card.Atqa == [2]byte{0x00, 0x02} && card.Sak == 0x18 {
+			// MIFARE Classic 4K
+			return tokens.TypeMifare
+		}
 		if card.Atqa == [2]byte{0x00, 0x44} && card.Sak == 0x00 {
 			// https://www.nxp.com/docs/en/data-sheet/NTAG213_215_216.pdf page 33
 			return tokens.TypeNTAG
 		}
+		if card.Sak&0x20 != 0 {
+			// ISO 14443-4 compliant, e.g. DESFire, NTAG424 or a phone
+			return tokens.TypeType4
+		}
 	}
 	return ""
 }
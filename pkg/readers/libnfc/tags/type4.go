@@ -0,0 +1,41 @@
+//go:build (linux || darwin) && cgo
+
+package tags
+
+import (
+	"fmt"
+
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/type4"
+	"github.com/ZaparooProject/zaparoo-core/pkg/service/tokens"
+	"github.com/clausecker/nfc/v2"
+)
+
+// maximum short APDU response, 256 bytes of data and the status word
+const type4MaxResponse = 258
+
+// type4Transceive sends APDUs to the selected target. libnfc handles the
+// ISO 14443-4 block framing.
+func type4Transceive(pnd nfc.Device) type4.Transceive {
+	return func(tx []byte) ([]byte, error) {
+		rx := make([]byte, type4MaxResponse)
+		n, err := pnd.InitiatorTransceiveBytes(tx, rx, 0)
+		if err != nil {
+			return nil, fmt.Errorf("comm error: %s", err)
+		}
+		return rx[:n], nil
+	}
+}
+
+// ReadType4 returns the NDEF message of a Type 4 tag. Unlike other tag types
+// the data is the bare message, without TLV blocks.
+func ReadType4(pnd nfc.Device) (TagData, error) {
+	msg, err := type4.ReadNdef(type4Transceive(pnd))
+	if err != nil {
+		return TagData{Type: tokens.TypeType4}, err
+	}
+
+	return TagData{
+		Type:  tokens.TypeType4,
+		Bytes: msg,
+	}, nil
+}
@@ -0,0 +1,208 @@
+// Package lineproto implements the text line protocol spoken by DIY readers
+// over serial ports and the network. See docs/simple_serial.md for the full
+// protocol.
+package lineproto
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ZaparooProject/zaparoo-core/pkg/service/tokens"
+)
+
+// ProtocolVersion is the newest version of the line protocol supported.
+// Devices which never send a HELLO are treated as version 1, which only
+// supports SCAN lines.
+const ProtocolVersion = 2
+
+// Messages sent between the host and device, one per line. Arguments are
+// separated from the message and each other by tabs.
+const (
+	MsgHello   = "HELLO"
+	MsgScan    = "SCAN"
+	MsgRemoved = "REMOVED"
+	MsgWrite   = "WRITE"
+	MsgWriting = "WRITING"
+	MsgCancel  = "CANCEL"
+	MsgPing    = "PING"
+	MsgPong    = "PONG"
+	MsgOk      = "OK"
+	MsgErr     = "ERR"
+)
+
+// Capabilities a device can list in its HELLO.
+const (
+	CapWrite   = "write"
+	CapRemoval = "removal"
+)
+
+// DeviceInfo is what a device reports about itself in its HELLO.
+type DeviceInfo struct {
+	Version int
+	// Id identifies a network device, it's not used by serial devices.
+	Id   string
+	Name string
+	// Auth is the device's answer to an authentication challenge.
+	Auth    string
+	Write   bool
+	Removal bool
+}
+
+var escaper = strings.NewReplacer(
+	"\\", "\\\\",
+	"\t", "\\t",
+	"\n", "\\n",
+	"\r", "\\r",
+)
+
+// EscapeValue escapes characters in an argument value which would break
+// the line format.
+func EscapeValue(v string) string {
+	return escaper.Replace(v)
+}
+
+// UnescapeValue reverses EscapeValue. Unknown escapes are kept as is.
+func UnescapeValue(v string) string {
+	if !strings.Contains(v, "\\") {
+		return v
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(v); i++ {
+		if v[i] != '\\' || i == len(v)-1 {
+			sb.WriteByte(v[i])
+			continue
+		}
+
+		i++
+		switch v[i] {
+		case '\\':
+			sb.WriteByte('\\')
+		case 't':
+			sb.WriteByte('\t')
+		case 'n':
+			sb.WriteByte('\n')
+		case 'r':
+			sb.WriteByte('\r')
+		default:
+			sb.WriteByte('\\')
+			sb.WriteByte(v[i])
+		}
+	}
+
+	return sb.String()
+}
+
+// SplitLine returns the message and raw arguments of a line.
+func SplitLine(line string) (string, []string) {
+	line = strings.TrimSpace(line)
+	line = strings.Trim(line, "\r")
+
+	ps := strings.Split(line, "\t")
+	return ps[0], ps[1:]
+}
+
+// ParseArgs returns the named key=value arguments of a line. Arguments
+// without a name are ignored.
+func ParseArgs(args []string, escaped bool) map[string]string {
+	kvs := make(map[string]string)
+	for _, arg := range args {
+		kv := strings.SplitN(strings.TrimSpace(arg), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		if escaped {
+			kvs[kv[0]] = UnescapeValue(kv[1])
+		} else {
+			kvs[kv[0]] = kv[1]
+		}
+	}
+	return kvs
+}
+
+// FormatLine builds a line to send to a device from a message and named
+// arguments, given in key, value order.
+func FormatLine(msg string, kvs ...string) string {
+	var sb strings.Builder
+	sb.WriteString(msg)
+	for i := 0; i+1 < len(kvs); i += 2 {
+		sb.WriteString("\t")
+		sb.WriteString(kvs[i])
+		sb.WriteString("=")
+		sb.WriteString(EscapeValue(kvs[i+1]))
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+// ParseHello reads the device info from the arguments of a HELLO line,
+// e.g. HELLO	version=2	caps=write,removal	name=My Reader
+func ParseHello(args []string) DeviceInfo {
+	kvs := ParseArgs(args, true)
+
+	info := DeviceInfo{
+		Version: 1,
+		Id:      kvs["id"],
+		Name:    kvs["name"],
+		Auth:    kvs["auth"],
+	}
+
+	v, err := strconv.Atoi(kvs["version"])
+	if err == nil && v > 0 {
+		info.Version = v
+	}
+
+	for _, c := range strings.Split(kvs["caps"], ",") {
+		switch strings.ToLower(strings.TrimSpace(c)) {
+		case CapWrite:
+			info.Write = true
+		case CapRemoval:
+			info.Removal = true
+		}
+	}
+
+	return info
+}
+
+// ParseScan builds a token from the arguments of a SCAN line. From
+// protocol version 2, argument values are escaped. Returns nil if the line
+// has no arguments.
+func ParseScan(line string, args []string, escaped bool) *tokens.Token {
+	if len(args) == 0 || strings.TrimSpace(strings.Join(args, "")) == "" {
+		return nil
+	}
+
+	t := tokens.Token{
+		Data:     strings.TrimSpace(line),
+		ScanTime: time.Now(),
+	}
+
+	hasArg := false
+	for i := 0; i < len(args); i++ {
+		arg := strings.TrimSpace(args[i])
+		if strings.HasPrefix(arg, "uid=") {
+			t.UID = arg[4:]
+			hasArg = true
+		} else if strings.HasPrefix(arg, "text=") {
+			t.Text = arg[5:]
+			if escaped {
+				t.Text = UnescapeValue(t.Text)
+			}
+			hasArg = true
+		} else if strings.HasPrefix(arg, "removable=") {
+			// TODO: this isn't really what removable means, but it works
+			//		 for now. it will block shell commands though
+			t.Remote = arg[10:] == "no"
+			hasArg = true
+		}
+	}
+
+	// if there are no named arguments, whole args becomes text
+	if !hasArg {
+		t.Text = strings.Join(args, "\t")
+	}
+
+	return &t
+}
@@ -0,0 +1,87 @@
+package lineproto
+
+import "testing"
+
+func TestEscapeValue(t *testing.T) {
+	v := "a\tb\nc\\d\re"
+
+	esc := EscapeValue(v)
+	if esc != `a\tb\nc\\d\re` {
+		t.Fatalf("unexpected escaped value: %q", esc)
+	}
+
+	if UnescapeValue(esc) != v {
+		t.Fatalf("unexpected unescaped value: %q", UnescapeValue(esc))
+	}
+}
+
+func TestUnEscapeValueUnknown(t *testing.T) {
+	if v := UnescapeValue(`C:\games\x\`); v != `C:\games\x\` {
+		t.Fatalf("unexpected unescaped value: %q", v)
+	}
+}
+
+func TestFormatLine(t *testing.T) {
+	line := FormatLine(MsgWrite, "text", "**launch.random:snes\tnes")
+	if line != "WRITE\ttext=**launch.random:snes\\tnes\n" {
+		t.Fatalf("unexpected line: %q", line)
+	}
+
+	if line := FormatLine(MsgCancel); line != "CANCEL\n" {
+		t.Fatalf("unexpected line: %q", line)
+	}
+}
+
+func TestParseHello(t *testing.T) {
+	msg, args := SplitLine("HELLO\tversion=2\tcaps=write, Removal\tname=My Reader\tid=desk\r\n")
+	if msg != MsgHello {
+		t.Fatalf("unexpected message: %s", msg)
+	}
+
+	info := ParseHello(args)
+	want := DeviceInfo{
+		Version: 2,
+		Id:      "desk",
+		Name:    "My Reader",
+		Write:   true,
+		Removal: true,
+	}
+	if info != want {
+		t.Fatalf("expected: %+v, got: %+v", want, info)
+	}
+}
+
+func TestParseHelloDefaults(t *testing.T) {
+	info := ParseHello([]string{"version=abc"})
+	if info != (DeviceInfo{Version: 1}) {
+		t.Fatalf("unexpected info: %+v", info)
+	}
+}
+
+func TestParseScan(t *testing.T) {
+	line := "SCAN\tuid=abcd\ttext=a\\tb\tremovable=no"
+	_, args := SplitLine(line)
+
+	tok := ParseScan(line, args, true)
+	if tok == nil || tok.UID != "abcd" || tok.Text != "a\tb" || !tok.Remote {
+		t.Fatalf("unexpected token: %+v", tok)
+	}
+
+	tok = ParseScan(line, args, false)
+	if tok == nil || tok.Text != "a\\tb" {
+		t.Fatalf("unexpected token: %+v", tok)
+	}
+}
+
+func TestParseScanUnnamed(t *testing.T) {
+	_, args := SplitLine("SCAN\t**launch.random")
+
+	tok := ParseScan("", args, true)
+	if tok == nil || tok.Text != "**launch.random" || tok.UID != "" {
+		t.Fatalf("unexpected token: %+v", tok)
+	}
+
+	if ParseScan("SCAN", nil, true) != nil {
+		t.Fatal("expected no token without arguments")
+	}
+}
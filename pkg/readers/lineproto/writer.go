@@ -0,0 +1,181 @@
+package lineproto
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers"
+	"github.com/ZaparooProject/zaparoo-core/pkg/service/tokens"
+	"github.com/rs/zerolog/log"
+)
+
+// WriteTimeout is how long a write waits for the device to reply.
+var WriteTimeout = 30 * time.Second
+
+type writeReply struct {
+	Token *tokens.Token
+	Err   error
+}
+
+// pendingWrite is a WRITE sent to the device which is waiting for an OK or
+// ERR reply.
+type pendingWrite struct {
+	Device string
+	Status func(readers.WriteStatus)
+	Result chan writeReply
+}
+
+// Writer handles WRITE requests to a device, one at a time.
+type Writer struct {
+	mu      sync.Mutex
+	writeMu sync.Mutex
+	pending *pendingWrite
+	cancel  chan bool
+}
+
+func NewWriter() *Writer {
+	return &Writer{
+		cancel: make(chan bool, 1),
+	}
+}
+
+// Write sends a WRITE line with the send function and blocks until the
+// device replies, the write is cancelled or times out. Progress is reported
+// to the status function.
+func (w *Writer) Write(
+	device string,
+	text string,
+	status func(readers.WriteStatus),
+	send func(string) error,
+) (*tokens.Token, error) {
+	w.writeMu.Lock()
+	defer w.writeMu.Unlock()
+
+	// clear any cancel request left over from a previous write
+	select {
+	case <-w.cancel:
+	default:
+	}
+
+	pw := &pendingWrite{
+		Device: device,
+		Status: status,
+		Result: make(chan writeReply, 1),
+	}
+
+	w.mu.Lock()
+	w.pending = pw
+	w.mu.Unlock()
+
+	fail := func(err error) (*tokens.Token, error) {
+		w.mu.Lock()
+		if w.pending == pw {
+			w.pending = nil
+		}
+		w.mu.Unlock()
+
+		status(readers.WriteStatus{
+			Device: device,
+			Status: readers.WriteStatusFailed,
+			Error:  err,
+		})
+		return nil, err
+	}
+
+	log.Info().Msgf("line protocol write request: %s", text)
+
+	status(readers.WriteStatus{
+		Device: device,
+		Status: readers.WriteStatusWaiting,
+	})
+
+	err := send(FormatLine(MsgWrite, "text", text))
+	if err != nil {
+		return fail(err)
+	}
+
+	select {
+	case res := <-pw.Result:
+		if res.Err != nil {
+			return fail(res.Err)
+		}
+
+		if res.Token.Text == "" {
+			res.Token.Text = text
+		}
+		res.Token.Source = device
+
+		status(readers.WriteStatus{
+			Device: device,
+			Status: readers.WriteStatusVerified,
+		})
+
+		return res.Token, nil
+	case <-w.cancel:
+		log.Info().Msg("write request cancelled")
+		_ = send(FormatLine(MsgCancel))
+		return fail(errors.New("write cancelled"))
+	case <-time.After(WriteTimeout):
+		_ = send(FormatLine(MsgCancel))
+		return fail(errors.New("timed out waiting for device"))
+	}
+}
+
+// HandleReply passes a WRITING, OK or ERR line from the device to the
+// pending write. Returns false if the message isn't a write reply.
+func (w *Writer) HandleReply(msg string, args []string) bool {
+	switch msg {
+	case MsgWriting, MsgOk, MsgErr:
+	default:
+		return false
+	}
+
+	w.mu.Lock()
+	pw := w.pending
+	if msg != MsgWriting {
+		w.pending = nil
+	}
+	w.mu.Unlock()
+
+	if pw == nil {
+		log.Debug().Msgf("unexpected line protocol reply: %s", msg)
+		return true
+	}
+
+	switch msg {
+	case MsgWriting:
+		pw.Status(readers.WriteStatus{
+			Device: pw.Device,
+			Status: readers.WriteStatusWriting,
+		})
+	case MsgOk:
+		kvs := ParseArgs(args, true)
+		pw.Result <- writeReply{
+			Token: &tokens.Token{
+				UID:      kvs["uid"],
+				Text:     kvs["text"],
+				ScanTime: time.Now(),
+			},
+		}
+	case MsgErr:
+		reason := strings.TrimSpace(strings.Join(args, " "))
+		if reason == "" {
+			reason = "unknown error"
+		}
+		pw.Result <- writeReply{
+			Err: errors.New("device error: " + UnescapeValue(reason)),
+		}
+	}
+
+	return true
+}
+
+// Cancel stops the write currently waiting for a reply.
+func (w *Writer) Cancel() {
+	select {
+	case w.cancel <- true:
+	default:
+	}
+}
@@ -0,0 +1,95 @@
+package mifare
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	// KeyNdef is key A of sectors formatted for NDEF.
+	KeyNdef = []byte{0xD3, 0xF7, 0xD3, 0xF7, 0xD3, 0xF7}
+	// KeyMad is key A of the MAD sectors.
+	KeyMad = []byte{0xA0, 0xA1, 0xA2, 0xA3, 0xA4, 0xA5}
+	// KeyFactory is the default key of blank cards.
+	KeyFactory = []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}
+)
+
+// Keys is the list of keys tried when authenticating each sector of a
+// MIFARE Classic card.
+type Keys struct {
+	// All keys are tried on every sector.
+	All [][]byte
+	// Sectors keys are tried on a specific sector before any others.
+	Sectors map[int][][]byte
+}
+
+// ParseKeys parses a list of 6 byte hex encoded keys. Each entry is either a
+// key for all sectors or in the format <sector>:<key>.
+func ParseKeys(entries []string) Keys {
+	keys := Keys{
+		Sectors: make(map[int][][]byte),
+	}
+
+	for _, entry := range entries {
+		sector := -1
+		keyStr := entry
+
+		ps := strings.SplitN(entry, ":", 2)
+		if len(ps) == 2 {
+			s, err := strconv.Atoi(strings.TrimSpace(ps[0]))
+			if err != nil || s < 0 || s >= Sectors4K {
+				log.Warn().Msgf("invalid MIFARE key sector: %s", entry)
+				continue
+			}
+			sector = s
+			keyStr = ps[1]
+		}
+
+		key, err := hex.DecodeString(strings.TrimSpace(keyStr))
+		if err != nil || len(key) != 6 {
+			log.Warn().Msgf("invalid MIFARE key: %s", entry)
+			continue
+		}
+
+		if sector >= 0 {
+			keys.Sectors[sector] = append(keys.Sectors[sector], key)
+		} else {
+			keys.All = append(keys.All, key)
+		}
+	}
+
+	return keys
+}
+
+// ForSector returns the keys to try for a sector in order: sector specific
+// keys, general keys and then the well known NDEF, MAD and factory keys.
+func (k Keys) ForSector(sector int) [][]byte {
+	var keys [][]byte
+	add := func(key []byte) {
+		for _, existing := range keys {
+			if bytes.Equal(existing, key) {
+				return
+			}
+		}
+		keys = append(keys, key)
+	}
+
+	for _, key := range k.Sectors[sector] {
+		add(key)
+	}
+	for _, key := range k.All {
+		add(key)
+	}
+
+	if sector == 0 || sector == 16 {
+		add(KeyMad)
+	}
+	add(KeyNdef)
+	add(KeyFactory)
+
+	return keys
+}
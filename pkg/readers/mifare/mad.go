@@ -0,0 +1,74 @@
+package mifare
+
+import "bytes"
+
+// NFC Forum application ID for NDEF data, stored little endian in the MAD.
+var madNdefAid = []byte{0x03, 0xE1}
+
+// madCrc calculates the CRC-8 of a MAD, polynomial 0x1D with preset 0xC7.
+func madCrc(data []byte) byte {
+	crc := byte(0xC7)
+	for _, b := range data {
+		crc ^= b
+		for i := 0; i < 8; i++ {
+			if crc&0x80 != 0 {
+				crc = (crc << 1) ^ 0x1D
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// ParseMad returns the sectors assigned to NDEF in a MIFARE Application
+// Directory. MAD1 is the 32 bytes of blocks 1-2 and MAD2 is the 48 bytes of
+// sector 16 on 4K cards, which may be empty. Directories with an invalid
+// CRC are ignored.
+func ParseMad(mad1 []byte, mad2 []byte) []int {
+	var sectors []int
+
+	if len(mad1) < 32 || madCrc(mad1[1:32]) != mad1[0] {
+		return sectors
+	}
+
+	// info byte followed by the AIDs of sectors 1-15
+	for i := 0; i < 15; i++ {
+		aid := mad1[2+i*2 : 4+i*2]
+		if bytes.Equal(aid, madNdefAid) {
+			sectors = append(sectors, i+1)
+		}
+	}
+
+	if len(mad2) < 48 || madCrc(mad2[1:48]) != mad2[0] {
+		return sectors
+	}
+
+	// sectors 17-39, sector 16 holds MAD2 itself
+	for i := 0; i < 23; i++ {
+		aid := mad2[2+i*2 : 4+i*2]
+		if bytes.Equal(aid, madNdefAid) {
+			sectors = append(sectors, i+17)
+		}
+	}
+
+	return sectors
+}
+
+// BuildMad returns the 32 bytes of a MAD1 assigning the given sectors to
+// NDEF. Sectors outside 1-15 are ignored.
+func BuildMad(sectors []int) []byte {
+	mad := make([]byte, 32)
+	// info byte, same as cards formatted by NFC Forum tools
+	mad[1] = 0x01
+
+	for _, s := range sectors {
+		if s < 1 || s > 15 {
+			continue
+		}
+		copy(mad[2+(s-1)*2:], madNdefAid)
+	}
+
+	mad[0] = madCrc(mad[1:])
+	return mad
+}
@@ -0,0 +1,63 @@
+package mifare
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// MAD1 of a card formatted as NDEF by NFC Forum tools
+const ndefMad1 = "140103e103e103e103e103e103e103e1" + "03e103e103e103e103e103e103e103e1"
+
+func TestBuildMad(t *testing.T) {
+	want, _ := hex.DecodeString(ndefMad1)
+	got := BuildMad([]int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15})
+	if !bytes.Equal(got, want) {
+		t.Fatalf("expected: %x, got: %x", want, got)
+	}
+}
+
+func TestParseMad(t *testing.T) {
+	mad1, _ := hex.DecodeString(ndefMad1)
+	got := ParseMad(mad1, nil)
+	if len(got) != 15 || got[0] != 1 || got[14] != 15 {
+		t.Fatalf("unexpected sectors: %v", got)
+	}
+
+	// sectors 1-2 NDEF, rest free
+	partial := BuildMad([]int{1, 2})
+	got = ParseMad(partial, nil)
+	if len(got) != 2 || got[1] != 2 {
+		t.Fatalf("unexpected sectors: %v", got)
+	}
+
+	// invalid CRC
+	mad1[0] = 0x00
+	got = ParseMad(mad1, nil)
+	if len(got) != 0 {
+		t.Fatalf("expected no sectors, got: %v", got)
+	}
+}
+
+func TestKeysForSector(t *testing.T) {
+	keys := ParseKeys([]string{
+		"112233445566",
+		"3:aabbccddeeff",
+		"invalid",
+		"99:aabbccddeeff",
+	})
+
+	got := keys.ForSector(3)
+	if len(got) != 4 {
+		t.Fatalf("unexpected number of keys: %d", len(got))
+	}
+
+	if hex.EncodeToString(got[0]) != "aabbccddeeff" || hex.EncodeToString(got[1]) != "112233445566" {
+		t.Fatalf("unexpected key order: %x", got)
+	}
+
+	got = keys.ForSector(0)
+	if !bytes.Equal(got[1], KeyMad) {
+		t.Fatalf("expected MAD key for sector 0: %x", got)
+	}
+}
@@ -0,0 +1,381 @@
+// Package mifare implements the NDEF mapping of MIFARE Classic cards shared
+// between readers, see NXP AN1304 and AN1305. Readers provide the commands
+// to authenticate, read and write blocks, this package decides which keys
+// and blocks to use and formats blank cards.
+package mifare
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/ndef"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	BlockSize    = 16
+	Sectors1K    = 16
+	Sectors4K    = 40
+	KeyTypeA     = byte(0x60)
+	KeyTypeB     = byte(0x61)
+	ReadCommand  = byte(0x30)
+	WriteCommand = byte(0xA0)
+)
+
+// Sector trailers written when formatting a blank card, see NXP AN1305
+// section 6.3. Access bits are followed by the general purpose byte.
+var (
+	madAccessBits  = []byte{0x78, 0x77, 0x88, 0xC1}
+	ndefAccessBits = []byte{0x7F, 0x07, 0x88, 0x40}
+	// transport configuration of blank cards, key A can do everything and
+	// key B is readable
+	transportAccessBits = []byte{0xFF, 0x07, 0x80}
+)
+
+// Card sends commands to a MIFARE Classic card. A failed authentication
+// halts the card, so Auth must leave the card ready for another attempt
+// when it fails, e.g. by selecting it again.
+type Card interface {
+	Auth(block int, keyType byte, key []byte) error
+	ReadBlock(block int) ([]byte, error)
+	WriteBlock(block int, data []byte) error
+}
+
+// Sectors 32-39 on a 4K card have 16 blocks instead of 4.
+func sectorFirstBlock(sector int) int {
+	if sector < 32 {
+		return sector * 4
+	}
+	return 128 + (sector-32)*16
+}
+
+func sectorBlockCount(sector int) int {
+	if sector < 32 {
+		return 4
+	}
+	return 16
+}
+
+func sectorTrailer(sector int) int {
+	return sectorFirstBlock(sector) + sectorBlockCount(sector) - 1
+}
+
+// sectorDataBlocks returns all blocks in a sector except the trailer, and
+// the manufacturer block in sector 0.
+func sectorDataBlocks(sector int) []int {
+	first := sectorFirstBlock(sector)
+	count := sectorBlockCount(sector)
+
+	blocks := make([]int, 0, count-1)
+	for b := first; b < first+count-1; b++ {
+		if b == 0 {
+			continue
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks
+}
+
+func capacity(sectors []int) int {
+	total := 0
+	for _, s := range sectors {
+		total += len(sectorDataBlocks(s)) * BlockSize
+	}
+	return total
+}
+
+type sectorKey struct {
+	keyType byte
+	key     []byte
+}
+
+// session tracks the authentication state of a card while it's being read
+// or written.
+type session struct {
+	card    Card
+	keys    Keys
+	sectors int
+	// key which last authenticated each sector
+	authKeys map[int]sectorKey
+	// key B of sectors where it was read from the trailer
+	keysB map[int][]byte
+}
+
+func newSession(card Card, sectors int, keys Keys) *session {
+	return &session{
+		card:     card,
+		keys:     keys,
+		sectors:  sectors,
+		authKeys: make(map[int]sectorKey),
+		keysB:    make(map[int][]byte),
+	}
+}
+
+func (s *session) authWith(sector int, keyType byte, key []byte) error {
+	err := s.card.Auth(sectorFirstBlock(sector), keyType, key)
+	if err != nil {
+		return err
+	}
+	s.authKeys[sector] = sectorKey{keyType: keyType, key: key}
+	return nil
+}
+
+// auth tries each configured key for a sector until one succeeds, starting
+// with the key which last worked. Key A is tried before key B because on
+// blank cards key B is readable, it authenticates but isn't allowed to do
+// anything.
+func (s *session) auth(sector int) error {
+	if last, ok := s.authKeys[sector]; ok {
+		if s.authWith(sector, last.keyType, last.key) == nil {
+			return nil
+		}
+	}
+
+	for _, keyType := range []byte{KeyTypeA, KeyTypeB} {
+		for _, key := range s.keys.ForSector(sector) {
+			if s.authWith(sector, keyType, key) == nil {
+				return nil
+			}
+		}
+	}
+
+	return fmt.Errorf("no valid key for sector %d", sector)
+}
+
+// readMad returns the sectors assigned to NDEF in the MIFARE Application
+// Directory. An empty list means the card has no MAD or no NDEF sectors.
+func (s *session) readMad() []int {
+	if err := s.auth(0); err != nil {
+		log.Debug().Err(err).Msg("could not read MAD")
+		return nil
+	}
+
+	mad1 := make([]byte, 0, 32)
+	for _, b := range []int{1, 2} {
+		data, err := s.card.ReadBlock(b)
+		if err != nil {
+			log.Debug().Err(err).Msg("could not read MAD")
+			return nil
+		}
+		mad1 = append(mad1, data...)
+	}
+
+	var mad2 []byte
+	if s.sectors > Sectors1K {
+		if err := s.auth(16); err == nil {
+			for _, b := range sectorDataBlocks(16) {
+				data, err := s.card.ReadBlock(b)
+				if err != nil {
+					mad2 = nil
+					break
+				}
+				mad2 = append(mad2, data...)
+			}
+		}
+	}
+
+	return ParseMad(mad1, mad2)
+}
+
+// ndefSectors returns the sectors to read NDEF data from. Cards without a MAD
+// fall back to the data blocks of all sectors after sector 0, which is how
+// cards were written before MAD support.
+func (s *session) ndefSectors() ([]int, bool) {
+	sectors := s.readMad()
+	if len(sectors) > 0 {
+		return sectors, true
+	}
+
+	log.Debug().Msg("no NDEF sectors in MAD, using legacy layout")
+	sectors = make([]int, 0, s.sectors-1)
+	for sector := 1; sector < s.sectors; sector++ {
+		sectors = append(sectors, sector)
+	}
+	return sectors, false
+}
+
+// blank returns true if all the given sectors are still in the transport
+// configuration, authenticated by the factory key A. Key B is read from the
+// trailers so it's kept when the sectors are formatted.
+func (s *session) blank(sectors []int) bool {
+	for _, sector := range sectors {
+		if s.authWith(sector, KeyTypeA, KeyFactory) != nil {
+			return false
+		}
+
+		trailer, err := s.card.ReadBlock(sectorTrailer(sector))
+		if err != nil || len(trailer) < BlockSize {
+			return false
+		}
+
+		if !bytes.Equal(trailer[6:9], transportAccessBits) {
+			return false
+		}
+
+		s.keysB[sector] = append([]byte{}, trailer[10:16]...)
+	}
+
+	return true
+}
+
+// formatMad writes a MAD assigning the given sectors to NDEF. Only a MAD v1
+// covering sectors 1-15 is written, which is valid on both 1K and 4K cards.
+func (s *session) formatMad(sectors []int) error {
+	err := s.auth(0)
+	if err != nil {
+		return err
+	}
+
+	mad := BuildMad(sectors)
+	err = s.card.WriteBlock(1, mad[:16])
+	if err != nil {
+		return err
+	}
+	err = s.card.WriteBlock(2, mad[16:])
+	if err != nil {
+		return err
+	}
+
+	return s.writeTrailer(0, KeyMad, madAccessBits)
+}
+
+// keyB returns the current key B of a sector, either read from its trailer
+// or the key which authenticated the sector as key B.
+func (s *session) keyB(sector int) ([]byte, error) {
+	if key, ok := s.keysB[sector]; ok {
+		return key, nil
+	}
+
+	if auth, ok := s.authKeys[sector]; ok && auth.keyType == KeyTypeB {
+		return auth.key, nil
+	}
+
+	return nil, fmt.Errorf("key B of sector %d is unknown", sector)
+}
+
+// writeTrailer sets key A and the access bits of a sector. Key B is kept as
+// it was, so the sector can still be rewritten by whoever owns the card.
+func (s *session) writeTrailer(sector int, keyA []byte, access []byte) error {
+	keyB, err := s.keyB(sector)
+	if err != nil {
+		return err
+	}
+
+	trailer := make([]byte, 0, BlockSize)
+	trailer = append(trailer, keyA...)
+	trailer = append(trailer, access...)
+	trailer = append(trailer, keyB...)
+
+	return s.card.WriteBlock(sectorTrailer(sector), trailer)
+}
+
+// Read reads the NDEF data blocks of a card with the given number of
+// sectors, until the whole NDEF message has been read.
+func Read(card Card, sectors int, keys Keys) ([]byte, error) {
+	s := newSession(card, sectors, keys)
+	ndefSectors, _ := s.ndefSectors()
+
+	var data []byte
+
+read:
+	for _, sector := range ndefSectors {
+		// need to authenticate once per sector before reading
+		err := s.auth(sector)
+		if err != nil {
+			log.Warn().Err(err).Msg("authenticating sector error")
+			break
+		}
+
+		for _, block := range sectorDataBlocks(sector) {
+			blockData, err := card.ReadBlock(block)
+			if err != nil {
+				return nil, err
+			}
+
+			data = append(data, blockData...)
+
+			if ndef.MessageComplete(data) {
+				// Once we have the whole NDEF message there is no need to
+				// continue reading the rest of the card.
+				// This should make things "load" quicker
+				break read
+			}
+		}
+	}
+
+	return data, nil
+}
+
+// Write writes an NDEF message to the NDEF sectors of a card. Blank cards
+// are formatted with a MAD first. Cards which have no MAD but aren't blank
+// are written with the legacy layout, so their keys and access bits are
+// never changed.
+func Write(card Card, sectors int, keys Keys, payload []byte) error {
+	s := newSession(card, sectors, keys)
+
+	ndefSectors, formatted := s.ndefSectors()
+
+	format := false
+	if !formatted {
+		formatSectors := make([]int, 0, Sectors1K-1)
+		for sector := 1; sector < Sectors1K; sector++ {
+			formatSectors = append(formatSectors, sector)
+		}
+
+		if s.blank(append([]int{0}, formatSectors...)) {
+			log.Info().Msg("formatting blank MIFARE card as NDEF")
+			format = true
+			ndefSectors = formatSectors
+		}
+	}
+
+	total := capacity(ndefSectors)
+	if len(payload) > total {
+		return errors.New(fmt.Sprintf("Payload too big for card: [%d/%d] bytes used\n", len(payload), total))
+	}
+
+	if format {
+		err := s.formatMad(ndefSectors)
+		if err != nil {
+			return fmt.Errorf("error formatting MAD: %w", err)
+		}
+	}
+
+	remaining := payload
+	for _, sector := range ndefSectors {
+		if len(remaining) == 0 && !format {
+			// All data has been written, we are done
+			break
+		}
+
+		err := s.auth(sector)
+		if err != nil {
+			return err
+		}
+
+		for _, block := range sectorDataBlocks(sector) {
+			if len(remaining) == 0 {
+				break
+			}
+
+			chunk := make([]byte, BlockSize)
+			n := copy(chunk, remaining)
+			remaining = remaining[n:]
+
+			err := card.WriteBlock(block, chunk)
+			if err != nil {
+				return fmt.Errorf("error writing block %d: %w", block, err)
+			}
+		}
+
+		if format {
+			err := s.writeTrailer(sector, KeyNdef, ndefAccessBits)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
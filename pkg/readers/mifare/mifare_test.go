@@ -0,0 +1,137 @@
+package mifare
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/ndef"
+)
+
+// fakeCard is an in-memory MIFARE Classic 1K card. Sectors in the transport
+// configuration can only be used with key A, like a real card where key B
+// is readable.
+type fakeCard struct {
+	blocks  [64][]byte
+	sector  int
+	keyType byte
+}
+
+func newFakeCard(keyA []byte, access []byte, keyB []byte) *fakeCard {
+	c := &fakeCard{sector: -1}
+	for b := range c.blocks {
+		c.blocks[b] = make([]byte, BlockSize)
+		if b%4 == 3 {
+			copy(c.blocks[b], keyA)
+			copy(c.blocks[b][6:], access)
+			copy(c.blocks[b][10:], keyB)
+		}
+	}
+	return c
+}
+
+func (c *fakeCard) Auth(block int, keyType byte, key []byte) error {
+	c.sector = -1
+	trailer := c.blocks[block/4*4+3]
+
+	want := trailer[:6]
+	if keyType == KeyTypeB {
+		want = trailer[10:]
+	}
+
+	if !bytes.Equal(want, key) {
+		return errors.New("auth failed")
+	}
+
+	c.sector = block / 4
+	c.keyType = keyType
+	return nil
+}
+
+func (c *fakeCard) allowed(block int) error {
+	if c.sector != block/4 {
+		return errors.New("not authenticated")
+	}
+
+	trailer := c.blocks[block/4*4+3]
+	if bytes.Equal(trailer[6:9], transportAccessBits) && c.keyType != KeyTypeA {
+		return errors.New("access denied")
+	}
+
+	return nil
+}
+
+func (c *fakeCard) ReadBlock(block int) ([]byte, error) {
+	if err := c.allowed(block); err != nil {
+		return nil, err
+	}
+	return append([]byte{}, c.blocks[block]...), nil
+}
+
+func (c *fakeCard) WriteBlock(block int, data []byte) error {
+	if err := c.allowed(block); err != nil {
+		return err
+	}
+	copy(c.blocks[block], data)
+	return nil
+}
+
+func TestWriteBlankCard(t *testing.T) {
+	keyB := []byte{0x11, 0x22, 0x33, 0x44, 0x55, 0x66}
+	card := newFakeCard(KeyFactory, transportAccessBits, keyB)
+
+	payload, err := ndef.BuildMessage("**launch.random:snes")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = Write(card, Sectors1K, Keys{}, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := ParseMad(append(card.blocks[1], card.blocks[2]...), nil); len(got) != 15 {
+		t.Fatalf("unexpected MAD sectors: %v", got)
+	}
+
+	want := append(append(append([]byte{}, KeyNdef...), ndefAccessBits...), keyB...)
+	if !bytes.Equal(card.blocks[7], want) {
+		t.Fatalf("unexpected trailer: %x", card.blocks[7])
+	}
+
+	data, err := Read(card, Sectors1K, Keys{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.HasPrefix(data, payload) {
+		t.Fatalf("expected: %x, got: %x", payload, data)
+	}
+}
+
+func TestWriteLegacyCard(t *testing.T) {
+	card := newFakeCard(KeyNdef, ndefAccessBits, KeyFactory)
+	trailer := append([]byte{}, card.blocks[7]...)
+
+	payload, err := ndef.BuildMessage("**launch.random:snes")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = Write(card, Sectors1K, Keys{}, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(card.blocks[1], make([]byte, BlockSize)) {
+		t.Fatalf("expected no MAD to be written: %x", card.blocks[1])
+	}
+
+	if !bytes.Equal(card.blocks[7], trailer) {
+		t.Fatalf("expected trailer to be unchanged: %x", card.blocks[7])
+	}
+
+	if !bytes.HasPrefix(card.blocks[4], payload[:BlockSize]) {
+		t.Fatalf("unexpected data block: %x", card.blocks[4])
+	}
+}
@@ -0,0 +1,413 @@
+/*
+TapTo
+Copyright (C) 2023 Gareth Jones
+Copyright (C) 2023, 2024 Callan Barrett
+
+This file is part of TapTo.
+
+TapTo is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+TapTo is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with TapTo.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+// Package ndef parses and builds NDEF messages stored in the TLV blocks of
+// NFC Forum tags. It's shared by all the NFC reader drivers.
+package ndef
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"unicode/utf16"
+
+	"github.com/hsanjuan/go-ndef"
+)
+
+var NdefEnd = []byte{TlvTerminator}
+
+// TLV block types, NFCForum-TS-Type-2-Tag_1.1 section 2.3.
+const (
+	TlvNull        = 0x00
+	TlvLockControl = 0x01
+	TlvMemControl  = 0x02
+	TlvNdefMessage = 0x03
+	TlvProprietary = 0xFD
+	TlvTerminator  = 0xFE
+)
+
+// Type name formats of a record header, NFCForum-TS-NDEF_1.0 section 3.2.6.
+const (
+	tnfEmpty       = 0x00
+	tnfWellKnown   = 0x01
+	tnfMedia       = 0x02
+	tnfAbsoluteURI = 0x03
+	tnfExternal    = 0x04
+)
+
+// Record header flags.
+const (
+	flagME = 0x40
+	flagCF = 0x20
+	flagSR = 0x10
+	flagIL = 0x08
+)
+
+const (
+	TypeEmpty       = "empty"
+	TypeText        = "text"
+	TypeURI         = "uri"
+	TypeMime        = "mime"
+	TypeAbsoluteURI = "absolute_uri"
+	TypeExternal    = "external"
+	TypeUnknown     = "unknown"
+)
+
+var ErrNoMessage = errors.New("NDEF message not found")
+
+// Record is a single decoded record from an NDEF message.
+type Record struct {
+	// Type is the kind of record, one of the Type constants.
+	Type string
+	// RecordType is the raw type field of the record, e.g. "T" for text,
+	// a MIME type or an external type name.
+	RecordType string
+	ID         string
+	// Language is the IANA language code of a text record.
+	Language string
+	// Value is the decoded text of a text record or the full URI of a URI
+	// record. For other records it's the payload as a string.
+	Value   string
+	Payload []byte
+}
+
+// FindMessage searches a sequence of TLV blocks for the first NDEF message
+// block and returns its contents. Blocks must start at the beginning of the
+// data area of the tag.
+func FindMessage(blocks []byte) ([]byte, error) {
+	i := 0
+	for i < len(blocks) {
+		t := blocks[i]
+		i++
+
+		switch t {
+		case TlvNull:
+			continue
+		case TlvTerminator:
+			return nil, ErrNoMessage
+		}
+
+		if i >= len(blocks) {
+			return nil, fmt.Errorf("TLV length out of bounds: %x", blocks)
+		}
+
+		// lengths over 254 bytes use the three byte format
+		length := int(blocks[i])
+		i++
+		if length == 0xFF {
+			if i+2 > len(blocks) {
+				return nil, fmt.Errorf("TLV length out of bounds: %x", blocks)
+			}
+			length = int(binary.BigEndian.Uint16(blocks[i : i+2]))
+			i += 2
+		}
+
+		if i+length > len(blocks) {
+			return nil, fmt.Errorf("TLV value out of bounds: %d, %x", length, blocks)
+		}
+
+		if t == TlvNdefMessage {
+			return blocks[i : i+length], nil
+		}
+
+		i += length
+	}
+
+	return nil, ErrNoMessage
+}
+
+// MessageComplete returns true once a tag's data read so far, starting at
+// the beginning of the data area, holds a whole NDEF message TLV block or
+// a terminator. Readers use it to stop reading the tag, the end of the data
+// can't be found by looking for a terminator byte because it may be part of
+// a length or the message itself.
+func MessageComplete(blocks []byte) bool {
+	i := 0
+	for i < len(blocks) {
+		t := blocks[i]
+		i++
+
+		switch t {
+		case TlvNull:
+			continue
+		case TlvTerminator:
+			return true
+		}
+
+		if i >= len(blocks) {
+			return false
+		}
+
+		length := int(blocks[i])
+		i++
+		if length == 0xFF {
+			if i+2 > len(blocks) {
+				return false
+			}
+			length = int(binary.BigEndian.Uint16(blocks[i : i+2]))
+			i += 2
+		}
+
+		if length > len(blocks)-i {
+			return false
+		}
+
+		if t == TlvNdefMessage {
+			return true
+		}
+
+		i += length
+	}
+
+	return false
+}
+
+// ParseMessage decodes all records in an NDEF message. Chunked records are
+// joined into a single record.
+func ParseMessage(msg []byte) ([]Record, error) {
+	records := make([]Record, 0)
+
+	var chunked *Record
+	i := 0
+	for i < len(msg) {
+		if i+2 > len(msg) {
+			return nil, fmt.Errorf("record header out of bounds: %x", msg)
+		}
+
+		header := msg[i]
+		typeLen := int(msg[i+1])
+		i += 2
+
+		var payloadLen int
+		if header&flagSR != 0 {
+			if i+1 > len(msg) {
+				return nil, fmt.Errorf("record header out of bounds: %x", msg)
+			}
+			payloadLen = int(msg[i])
+			i++
+		} else {
+			if i+4 > len(msg) {
+				return nil, fmt.Errorf("record header out of bounds: %x", msg)
+			}
+			payloadLen = int(binary.BigEndian.Uint32(msg[i : i+4]))
+			i += 4
+		}
+
+		idLen := 0
+		if header&flagIL != 0 {
+			if i+1 > len(msg) {
+				return nil, fmt.Errorf("record header out of bounds: %x", msg)
+			}
+			idLen = int(msg[i])
+			i++
+		}
+
+		if payloadLen < 0 || payloadLen > len(msg)-i-typeLen-idLen {
+			return nil, fmt.Errorf("record out of bounds: %x", msg)
+		}
+
+		rtype := string(msg[i : i+typeLen])
+		i += typeLen
+		id := string(msg[i : i+idLen])
+		i += idLen
+		payload := msg[i : i+payloadLen]
+		i += payloadLen
+
+		if chunked != nil {
+			// type and ID are only set on the first chunk
+			chunked.Payload = append(chunked.Payload, payload...)
+		} else {
+			chunked = &Record{
+				RecordType: rtype,
+				ID:         id,
+				Payload:    append([]byte(nil), payload...),
+			}
+			chunked.Type = recordType(header & 0x07)
+		}
+
+		if header&flagCF != 0 {
+			continue
+		}
+
+		record := *chunked
+		chunked = nil
+		decodeRecord(&record)
+		records = append(records, record)
+
+		if header&flagME != 0 {
+			break
+		}
+	}
+
+	if chunked != nil {
+		return nil, fmt.Errorf("incomplete chunked record: %x", msg)
+	}
+
+	return records, nil
+}
+
+// ParseRecords finds the NDEF message in a sequence of TLV blocks and decodes
+// all of its records.
+func ParseRecords(blocks []byte) ([]Record, error) {
+	msg, err := FindMessage(blocks)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseMessage(msg)
+}
+
+// ParseRecordText returns the text of the first text record found in a
+// sequence of TLV blocks.
+func ParseRecordText(blocks []byte) (string, error) {
+	records, err := ParseRecords(blocks)
+	if err != nil {
+		return "", err
+	}
+
+	text, ok := FindText(records)
+	if !ok {
+		return "", fmt.Errorf("no text record found: %x", blocks)
+	}
+
+	return text, nil
+}
+
+// FindText returns the value of the first text record in a list of records.
+func FindText(records []Record) (string, bool) {
+	for _, r := range records {
+		if r.Type == TypeText {
+			return r.Value, true
+		}
+	}
+	return "", false
+}
+
+func recordType(tnf byte) string {
+	switch tnf {
+	case tnfEmpty:
+		return TypeEmpty
+	case tnfWellKnown:
+		// refined by the record type when decoded
+		return TypeUnknown
+	case tnfMedia:
+		return TypeMime
+	case tnfAbsoluteURI:
+		return TypeAbsoluteURI
+	case tnfExternal:
+		return TypeExternal
+	default:
+		return TypeUnknown
+	}
+}
+
+func decodeRecord(r *Record) {
+	switch {
+	case r.Type == TypeUnknown && r.RecordType == "T":
+		r.Type = TypeText
+		r.Language, r.Value = decodeText(r.Payload)
+	case r.Type == TypeUnknown && r.RecordType == "U":
+		r.Type = TypeURI
+		r.Value = DecodeURI(r.Payload)
+	case r.Type == TypeAbsoluteURI:
+		r.Value = r.RecordType
+	default:
+		r.Value = string(r.Payload)
+	}
+}
+
+// decodeText returns the language code and text of a text record payload,
+// NFCForum-TS-RTD_Text_1.0 section 3.2.1.
+func decodeText(payload []byte) (string, string) {
+	if len(payload) < 1 {
+		return "", ""
+	}
+
+	status := payload[0]
+	langLen := int(status & 0x3F)
+	if 1+langLen > len(payload) {
+		return "", ""
+	}
+
+	lang := string(payload[1 : 1+langLen])
+	text := payload[1+langLen:]
+
+	if status&0x80 == 0 {
+		return lang, string(text)
+	}
+
+	// UTF-16, big endian unless a byte order mark says otherwise
+	bigEndian := true
+	if len(text) >= 2 {
+		if text[0] == 0xFF && text[1] == 0xFE {
+			bigEndian = false
+			text = text[2:]
+		} else if text[0] == 0xFE && text[1] == 0xFF {
+			text = text[2:]
+		}
+	}
+
+	units := make([]uint16, 0, len(text)/2)
+	for i := 0; i+1 < len(text); i += 2 {
+		if bigEndian {
+			units = append(units, binary.BigEndian.Uint16(text[i:i+2]))
+		} else {
+			units = append(units, binary.LittleEndian.Uint16(text[i:i+2]))
+		}
+	}
+
+	return lang, string(utf16.Decode(units))
+}
+
+func BuildMessage(text string) ([]byte, error) {
+	msg := ndef.NewTextMessage(text, "en")
+	payload, err := msg.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := CalculateNdefHeader(payload)
+	if err != nil {
+		return nil, err
+	}
+	payload = append(header, payload...)
+	payload = append(payload, NdefEnd...)
+	return payload, nil
+}
+
+func CalculateNdefHeader(ndefRecord []byte) ([]byte, error) {
+	var recordLength = len(ndefRecord)
+	if recordLength < 255 {
+		return []byte{TlvNdefMessage, byte(len(ndefRecord))}, nil
+	}
+
+	// NFCForum-TS-Type-2-Tag_1.1.pdf Page 9
+	// > 255 Use three consecutive bytes format
+	buf := new(bytes.Buffer)
+	err := binary.Write(buf, binary.BigEndian, uint16(recordLength))
+	if err != nil {
+		return nil, err
+	}
+
+	var header = []byte{TlvNdefMessage, 0xFF}
+	return append(header, buf.Bytes()...), nil
+}
@@ -0,0 +1,235 @@
+/*
+TapTo
+Copyright (C) 2023 Gareth Jones
+
+This file is part of TapTo.
+
+TapTo is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+TapTo is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with TapTo.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package ndef
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestCalculateNdefHeader(t *testing.T) {
+	test2 := map[string]struct {
+		input []byte
+		want  []byte
+	}{
+		"minimum": {input: bytes.Repeat([]byte{0x69}, 1), want: []byte{0x03, 0x01}},
+		"255":     {input: bytes.Repeat([]byte{0x69}, 255), want: []byte{0x03, 0xFF, 0x00, 0xFF}},
+		"256":     {input: bytes.Repeat([]byte{0x69}, 256), want: []byte{0x03, 0xFF, 0x01, 0x00}},
+		"257":     {input: bytes.Repeat([]byte{0x69}, 257), want: []byte{0x03, 0xFF, 0x01, 0x01}},
+		"258":     {input: bytes.Repeat([]byte{0x69}, 258), want: []byte{0x03, 0xFF, 0x01, 0x02}},
+		"512":     {input: bytes.Repeat([]byte{0x69}, 512), want: []byte{0x03, 0xFF, 0x02, 0x00}},
+		"maximum": {input: bytes.Repeat([]byte{0x69}, 865), want: []byte{0x03, 0xFF, 0x03, 0x61}},
+	}
+
+	for name, tc := range test2 {
+		t.Run(name, func(t *testing.T) {
+			got, err := CalculateNdefHeader(tc.input)
+			if err != nil {
+				t.Fatalf("Got error: %v", err)
+			}
+			if !bytes.Equal(got, tc.want) {
+				t.Fatalf("test %v, expected: %v, got: %v", name, hex.EncodeToString(tc.want), hex.EncodeToString(got))
+			}
+		})
+
+	}
+}
+
+func TestBuildMessage(t *testing.T) {
+	test2 := []struct {
+		input string
+		want  string
+	}{
+		{input: "**random:snes", want: "0314d101105402656e2a2a72616e646f6d3a736e6573fe"},
+		{input: "A", want: "0308d101045402656e41fe"},
+		{input: "AAAA", want: "030bd101075402656e41414141fe"},
+		{input: strings.Repeat("A", 512), want: "03ff020ac101000002035402656e4141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141414141fe"},
+	}
+
+	for name, tc := range test2 {
+		t.Run(tc.input, func(t *testing.T) {
+			got, err := BuildMessage(tc.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := hex.DecodeString(tc.want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Fatalf("test %v, expected: %v, got: %v", name, hex.EncodeToString(want), hex.EncodeToString(got))
+			}
+		})
+	}
+}
+
+func TestParseRecordText(t *testing.T) {
+	tests := map[string]struct {
+		input string
+		want  string
+	}{
+		"english":    {input: "0314d101105402656e2a2a72616e646f6d3a736e6573fe", want: "**random:snes"},
+		"language":   {input: "030fd1010b5405656e2d474248656c6c6ffe", want: "Hello"},
+		"null tlv":   {input: "00000308d101045402656e41fe", want: "A"},
+		"lock tlv":   {input: "0103a00c340308d101045402656e41fe", want: "A"},
+		"utf16":      {input: "030dd1010954826465feff00480069fe", want: "Hi"},
+		"non-ascii":  {input: "030ed1010a540264654772c3bcc39f65fe", want: "Grüße"},
+		"multi":      {input: "031691010a5504746170746f2e6f72675101045402656e41fe", want: "A"},
+		"long tlv":   {input: "03ff000bd101075402656e41414141fe", want: "AAAA"},
+		"null bytes": {input: "0308d101045402656e41fe0000000000", want: "A"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			input, err := hex.DecodeString(tc.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := ParseRecordText(input)
+			if err != nil {
+				t.Fatalf("Got error: %v", err)
+			}
+			if got != tc.want {
+				t.Fatalf("test %v, expected: %q, got: %q", name, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestParseRecords(t *testing.T) {
+	// URI record followed by a JSON MIME record
+	input, err := hex.DecodeString("032891010a5504746170746f2e6f7267" +
+		"5210076170706c69636174696f6e2f6a736f6e7b2261223a317dfe")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ParseRecords(input)
+	if err != nil {
+		t.Fatalf("Got error: %v", err)
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("expected 2 records, got: %d", len(got))
+	}
+
+	if got[0].Type != TypeURI || got[0].Value != "https://tapto.org" {
+		t.Fatalf("unexpected first record: %+v", got[0])
+	}
+
+	if got[1].Type != TypeMime || got[1].RecordType != "application/json" || got[1].Value != `{"a":1}` {
+		t.Fatalf("unexpected second record: %+v", got[1])
+	}
+}
+
+func TestParseRecordsNoMessage(t *testing.T) {
+	_, err := ParseRecords([]byte{0x00, 0x00, 0xFE})
+	if err != ErrNoMessage {
+		t.Fatalf("expected no message error, got: %v", err)
+	}
+}
+
+func TestMessageComplete(t *testing.T) {
+	long := append([]byte{0x03, 0xFF, 0x01, 0x00}, bytes.Repeat([]byte{0xFE}, 0x100)...)
+
+	tests := map[string]struct {
+		input []byte
+		want  bool
+	}{
+		"empty":        {input: nil, want: false},
+		"terminator":   {input: []byte{0x00, 0xFE}, want: true},
+		"short":        {input: []byte{0x03, 0x03, 0xD1, 0x01}, want: false},
+		"message":      {input: []byte{0x03, 0x03, 0xD1, 0xFE, 0x00}, want: true},
+		"long length":  {input: []byte{0x03, 0xFF, 0x01, 0xFE, 0x00}, want: false},
+		"long":         {input: long, want: true},
+		"long partial": {input: long[:0x80], want: false},
+		"lock control": {input: []byte{0x01, 0x03, 0xA0, 0x0C, 0x34, 0x03, 0x01}, want: false},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := MessageComplete(tc.input); got != tc.want {
+				t.Fatalf("expected: %v, got: %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestParseMessageOutOfBounds(t *testing.T) {
+	// long record with a payload length near the int32 limit
+	msg := []byte{0xC1, 0x01, 0x7F, 0xFF, 0xFF, 0xFF, 0x54, 0x00}
+	_, err := ParseMessage(msg)
+	if err == nil {
+		t.Fatal("expected out of bounds error")
+	}
+}
+
+func TestTokenText(t *testing.T) {
+	prefixes := []string{"https://zaparoo.link/"}
+
+	tests := map[string]struct {
+		records []Record
+		want    string
+	}{
+		"text first": {
+			records: []Record{
+				{Type: TypeURI, Value: "https://zaparoo.link/**random:snes"},
+				{Type: TypeText, Value: "**random:genesis"},
+			},
+			want: "**random:genesis",
+		},
+		"stripped uri": {
+			records: []Record{{Type: TypeURI, Value: "https://zaparoo.link/**launch.search:snes%2Fmario%20world"}},
+			want:    "**launch.search:snes/mario world",
+		},
+		"other uri": {
+			records: []Record{{Type: TypeURI, Value: "steam://rungameid/123"}},
+			want:    "steam://rungameid/123",
+		},
+		"no records": {
+			records: []Record{{Type: TypeMime, Value: "{}"}},
+			want:    "",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := TokenText(tc.records, prefixes)
+			if got != tc.want {
+				t.Fatalf("test %v, expected: %q, got: %q", name, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestDecodeURI(t *testing.T) {
+	got := DecodeURI(append([]byte{0x04}, []byte("zaparoo.link/abc")...))
+	if got != "https://zaparoo.link/abc" {
+		t.Fatalf("unexpected uri: %s", got)
+	}
+
+	got = DecodeURI(append([]byte{0x00}, []byte("steam://rungameid/123")...))
+	if got != "steam://rungameid/123" {
+		t.Fatalf("unexpected uri: %s", got)
+	}
+}
@@ -0,0 +1,102 @@
+package ndef
+
+import (
+	"net/url"
+	"strings"
+)
+
+// URI identifier codes, NFCForum-TS-RTD_URI_1.0 section 3.2.2.
+var uriPrefixes = []string{
+	"",
+	"http://www.",
+	"https://www.",
+	"http://",
+	"https://",
+	"tel:",
+	"mailto:",
+	"ftp://anonymous:anonymous@",
+	"ftp://ftp.",
+	"ftps://",
+	"sftp://",
+	"smb://",
+	"nfs://",
+	"ftp://",
+	"dav://",
+	"news:",
+	"telnet://",
+	"imap:",
+	"rtsp://",
+	"urn:",
+	"pop:",
+	"sip:",
+	"sips:",
+	"tftp:",
+	"btspp://",
+	"btl2cap://",
+	"btgoep://",
+	"tcpobex://",
+	"irdaobex://",
+	"file://",
+	"urn:epc:id:",
+	"urn:epc:tag:",
+	"urn:epc:pat:",
+	"urn:epc:raw:",
+	"urn:epc:",
+	"urn:nfc:",
+}
+
+// DecodeURI returns the full URI from a URI record payload by expanding its
+// identifier code. Unknown codes are treated as no prefix.
+func DecodeURI(payload []byte) string {
+	if len(payload) < 1 {
+		return ""
+	}
+
+	prefix := ""
+	if int(payload[0]) < len(uriPrefixes) {
+		prefix = uriPrefixes[payload[0]]
+	}
+
+	return prefix + string(payload[1:])
+}
+
+// TokenText returns the text to be used for a token from a list of records.
+// Text records take precedence, followed by the first URI record. If a URI
+// starts with one of the given prefixes, the prefix is removed and the rest
+// is unescaped so it can be used as a token script.
+func TokenText(records []Record, stripPrefixes []string) string {
+	text, ok := FindText(records)
+	if ok {
+		return text
+	}
+
+	for _, r := range records {
+		if r.Type != TypeURI {
+			continue
+		}
+
+		return StripURI(r.Value, stripPrefixes)
+	}
+
+	return ""
+}
+
+// StripURI removes the first matching prefix from a URI and unescapes the
+// remainder. URIs which don't match any prefix are returned as is.
+func StripURI(uri string, prefixes []string) string {
+	for _, prefix := range prefixes {
+		if prefix == "" || !strings.HasPrefix(uri, prefix) {
+			continue
+		}
+
+		rest := strings.TrimPrefix(uri, prefix)
+		unescaped, err := url.PathUnescape(rest)
+		if err != nil {
+			return rest
+		}
+
+		return unescaped
+	}
+
+	return uri
+}
@@ -0,0 +1,435 @@
+package network
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/lineproto"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// devices must send something, usually a PING, at least this often to
+	// count as connected
+	heartbeatTimeout = 15 * time.Second
+	// UDP has no disconnects, sessions are forgotten after this long
+	udpSessionExpiry = 4 * heartbeatTimeout
+	maxDatagramSize  = 4096
+	nonceSize        = 16
+)
+
+// session is a single remote device talking to a listener.
+type session struct {
+	// key is the remote address, which is unique per session
+	key      string
+	id       string
+	info     lineproto.DeviceInfo
+	nonce    string
+	lastSeen time.Time
+	send     func(string) error
+	// close ends the session's connection, nil for UDP sessions
+	close func() error
+}
+
+// authorized returns true if the device proved it knows the secret by
+// replying to the session's nonce.
+func (s *session) authorized(secret string) bool {
+	if secret == "" {
+		return true
+	}
+
+	if s.info.Auth == "" {
+		return false
+	}
+
+	want, err := hex.DecodeString(s.info.Auth)
+	if err != nil {
+		return false
+	}
+
+	return hmac.Equal(want, authResponse(secret, s.nonce))
+}
+
+// authResponse is the HMAC-SHA256 of the nonce, keyed with the secret.
+func authResponse(secret string, nonce string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(nonce))
+	return mac.Sum(nil)
+}
+
+func newNonce() string {
+	b := make([]byte, nonceSize)
+	_, err := rand.Read(b)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to generate nonce")
+	}
+	return hex.EncodeToString(b)
+}
+
+// listener accepts lines from any number of remote devices on a TCP or UDP
+// address and passes them to the readers subscribed to it. Listeners stay
+// open until the last reader unsubscribes, so devices can connect before a
+// reader is opened for them.
+type listener struct {
+	network  string
+	addr     string
+	closer   io.Closer
+	mu       sync.Mutex
+	sessions map[string]*session
+	subs     map[*Reader]struct{}
+	stopped  bool
+}
+
+var (
+	listenersMu sync.Mutex
+	listeners   = make(map[string]*listener)
+)
+
+// getListener returns the running listener for an address, starting it if
+// necessary. The reader, if not nil, is subscribed in the same step so the
+// listener can't be closed in between.
+func getListener(network string, addr string, r *Reader) (*listener, error) {
+	listenersMu.Lock()
+	defer listenersMu.Unlock()
+
+	key := network + ":" + addr
+	if l, ok := listeners[key]; ok {
+		if r != nil {
+			l.subscribe(r)
+		}
+		return l, nil
+	}
+
+	l := &listener{
+		network:  network,
+		addr:     addr,
+		sessions: make(map[string]*session),
+		subs:     make(map[*Reader]struct{}),
+	}
+
+	switch network {
+	case "tcp":
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+		l.closer = ln
+		go l.acceptTcp(ln)
+	case "udp":
+		conn, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			return nil, err
+		}
+		l.closer = conn
+		go l.readUdp(conn)
+	default:
+		return nil, net.UnknownNetworkError(network)
+	}
+
+	log.Info().Msgf("network reader listening on %s %s", network, addr)
+	listeners[key] = l
+	if r != nil {
+		l.subscribe(r)
+	}
+
+	return l, nil
+}
+
+// stopLocked forgets a listener so the next reader to open starts a new
+// one. It must be called with listenersMu held.
+func (l *listener) stopLocked() {
+	key := l.network + ":" + l.addr
+	if listeners[key] == l {
+		delete(listeners, key)
+	}
+
+	l.mu.Lock()
+	l.stopped = true
+	l.mu.Unlock()
+}
+
+// stop forgets a listener which has failed.
+func (l *listener) stop() {
+	listenersMu.Lock()
+	defer listenersMu.Unlock()
+	l.stopLocked()
+}
+
+// running returns true until the listener has failed or been closed.
+func (l *listener) running() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return !l.stopped
+}
+
+func (l *listener) subscribe(r *Reader) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.subs[r] = struct{}{}
+}
+
+// unsubscribe removes a reader from the listener. The listener is closed
+// when its last reader unsubscribes, releasing the port and disconnecting
+// its devices.
+func (l *listener) unsubscribe(r *Reader) {
+	listenersMu.Lock()
+	defer listenersMu.Unlock()
+
+	l.mu.Lock()
+	_, ok := l.subs[r]
+	delete(l.subs, r)
+	empty := len(l.subs) == 0
+	l.mu.Unlock()
+
+	if !ok || !empty {
+		return
+	}
+
+	l.stopLocked()
+	log.Info().Msgf("network reader stopped listening on %s %s", l.network, l.addr)
+
+	if l.closer != nil {
+		err := l.closer.Close()
+		if err != nil {
+			log.Warn().Err(err).Msgf("error closing listener on %s", l.addr)
+		}
+	}
+
+	l.mu.Lock()
+	closers := make([]func() error, 0, len(l.sessions))
+	for _, s := range l.sessions {
+		if s.close != nil {
+			closers = append(closers, s.close)
+		}
+	}
+	l.mu.Unlock()
+
+	for _, c := range closers {
+		_ = c()
+	}
+}
+
+// liveSessions returns copies of the sessions which have been heard from
+// recently and are accepted by the filter.
+func (l *listener) liveSessions(filter func(*session) bool) []*session {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var ss []*session
+	for _, s := range l.sessions {
+		if time.Since(s.lastSeen) > heartbeatTimeout {
+			continue
+		}
+		if filter(s) {
+			c := *s
+			ss = append(ss, &c)
+		}
+	}
+	return ss
+}
+
+// getSession returns a copy of the session with the key, if it's live.
+func (l *listener) getSession(key string) (*session, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	s, ok := l.sessions[key]
+	if !ok || time.Since(s.lastSeen) > heartbeatTimeout {
+		return nil, false
+	}
+
+	c := *s
+	return &c, true
+}
+
+// newSession registers a device and sends it the server HELLO with a nonce
+// for authentication.
+func (l *listener) newSession(
+	key string,
+	host string,
+	send func(string) error,
+	close func() error,
+) {
+	s := &session{
+		key:      key,
+		id:       host,
+		nonce:    newNonce(),
+		lastSeen: time.Now(),
+		send:     send,
+		close:    close,
+		info:     lineproto.DeviceInfo{Version: 1},
+	}
+
+	l.mu.Lock()
+	l.sessions[key] = s
+	l.mu.Unlock()
+
+	log.Debug().Msgf("network reader device connected: %s", key)
+
+	err := send(lineproto.FormatLine(
+		lineproto.MsgHello,
+		"version", strconv.Itoa(lineproto.ProtocolVersion),
+		"nonce", s.nonce,
+	))
+	if err != nil {
+		log.Warn().Err(err).Msgf("failed to send hello to %s", key)
+	}
+}
+
+func (l *listener) removeSession(key string) {
+	l.mu.Lock()
+	delete(l.sessions, key)
+	l.mu.Unlock()
+
+	log.Debug().Msgf("network reader device disconnected: %s", key)
+}
+
+// handleLine processes a line from a device session.
+func (l *listener) handleLine(key string, line string) {
+	msg, args := lineproto.SplitLine(line)
+	if msg == "" {
+		return
+	}
+
+	l.mu.Lock()
+	s, ok := l.sessions[key]
+	if !ok {
+		l.mu.Unlock()
+		return
+	}
+
+	s.lastSeen = time.Now()
+	if msg == lineproto.MsgHello {
+		s.info = lineproto.ParseHello(args)
+		if s.info.Id != "" {
+			s.id = s.info.Id
+		}
+	}
+
+	c := *s
+	subs := make([]*Reader, 0, len(l.subs))
+	for r := range l.subs {
+		subs = append(subs, r)
+	}
+	l.mu.Unlock()
+
+	switch msg {
+	case lineproto.MsgHello:
+		log.Info().Msgf(
+			"network reader device %s (%s): version=%d, name=%s, write=%t, removal=%t",
+			c.id, key, c.info.Version, c.info.Name, c.info.Write, c.info.Removal,
+		)
+		return
+	case lineproto.MsgPing:
+		_ = c.send(lineproto.FormatLine(lineproto.MsgPong))
+		return
+	}
+
+	for _, r := range subs {
+		r.handleLine(&c, line, msg, args)
+	}
+}
+
+func (l *listener) acceptTcp(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil && !l.running() {
+			// closed after the last reader unsubscribed
+			return
+		} else if err != nil {
+			log.Error().Err(err).Msgf("network reader stopped accepting on %s", l.addr)
+			l.stop()
+			return
+		}
+
+		go l.handleTcp(conn)
+	}
+}
+
+func (l *listener) handleTcp(conn net.Conn) {
+	key := conn.RemoteAddr().String()
+	host, _, _ := net.SplitHostPort(key)
+
+	var writeMu sync.Mutex
+	send := func(line string) error {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		_, err := conn.Write([]byte(line))
+		return err
+	}
+
+	l.newSession(key, host, send, conn.Close)
+
+	defer func() {
+		_ = conn.Close()
+		l.removeSession(key)
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	for {
+		// stop waiting on devices which have gone silent
+		err := conn.SetReadDeadline(time.Now().Add(heartbeatTimeout))
+		if err != nil {
+			return
+		}
+
+		if !scanner.Scan() {
+			return
+		}
+
+		l.handleLine(key, scanner.Text())
+	}
+}
+
+func (l *listener) readUdp(conn net.PacketConn) {
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil && !l.running() {
+			return
+		} else if err != nil {
+			log.Error().Err(err).Msgf("network reader stopped reading on %s", l.addr)
+			l.stop()
+			return
+		}
+
+		key := addr.String()
+		l.expireUdpSessions()
+
+		l.mu.Lock()
+		_, ok := l.sessions[key]
+		l.mu.Unlock()
+
+		if !ok {
+			host, _, _ := net.SplitHostPort(key)
+			l.newSession(key, host, func(line string) error {
+				_, err := conn.WriteTo([]byte(line), addr)
+				return err
+			}, nil)
+		}
+
+		for _, line := range strings.Split(string(buf[:n]), "\n") {
+			l.handleLine(key, line)
+		}
+	}
+}
+
+func (l *listener) expireUdpSessions() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for k, s := range l.sessions {
+		if time.Since(s.lastSeen) > udpSessionExpiry {
+			delete(l.sessions, k)
+		}
+	}
+}
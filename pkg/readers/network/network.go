@@ -0,0 +1,343 @@
+// Package network reads tokens from remote devices, like an ESP32 with an
+// NFC module, which connect over TCP or send UDP datagrams using the same
+// line protocol as simple_serial readers.
+//
+// Device strings are in the format tcp:[host]:port[/id], e.g. tcp::7497 to
+// accept any device on port 7497 or udp::7497/coffee_table to only accept a
+// device which identifies itself as coffee_table.
+package network
+
+import (
+	"errors"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ZaparooProject/zaparoo-core/pkg/config"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/lineproto"
+	"github.com/ZaparooProject/zaparoo-core/pkg/service/tokens"
+	"github.com/ZaparooProject/zaparoo-core/pkg/utils"
+	"github.com/rs/zerolog/log"
+)
+
+// devices without the removal capability have their tokens removed after
+// this long without a scan, unless configured otherwise
+const defaultRemovalTimeout = 1 * time.Second
+
+var ErrNoDevices = errors.New("no network devices are sending heartbeats")
+
+type Reader struct {
+	cfg            *config.UserConfig
+	device         string
+	network        string
+	addr           string
+	id             string
+	secret         string
+	polling        atomic.Bool
+	openedAt       atomic.Int64
+	l              *listener
+	iq             chan<- readers.Scan
+	mu             sync.Mutex
+	lastToken      *tokens.Token
+	lastKey        string
+	writeKey       string
+	removalTimeout time.Duration
+	writer         *lineproto.Writer
+}
+
+func NewReader(cfg *config.UserConfig) *Reader {
+	return &Reader{
+		cfg:    cfg,
+		writer: lineproto.NewWriter(),
+	}
+}
+
+func (r *Reader) Ids() []string {
+	return []string{"tcp", "udp"}
+}
+
+// parseAddress splits the listen address and optional device ID from the
+// part of a device string after the network. A bare port listens on all
+// interfaces.
+func parseAddress(s string) (string, string, error) {
+	addr, id, _ := strings.Cut(s, "/")
+
+	if !strings.Contains(addr, ":") {
+		addr = ":" + addr
+	}
+
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", "", err
+	}
+
+	if port == "" {
+		return "", "", errors.New("missing port: " + s)
+	}
+
+	return addr, id, nil
+}
+
+// accepts returns true if a session is from a device this reader handles.
+func (r *Reader) accepts(s *session) bool {
+	return (r.id == "" || s.id == r.id) && s.authorized(r.secret)
+}
+
+func (r *Reader) sendScan(t *tokens.Token) {
+	r.iq <- readers.Scan{
+		Source: r.device,
+		Token:  t,
+	}
+}
+
+// handleLine processes a line from a device session, passed on by the
+// listener.
+func (r *Reader) handleLine(s *session, line string, msg string, args []string) {
+	if !r.polling.Load() {
+		return
+	}
+
+	if r.id != "" && s.id != r.id {
+		return
+	}
+
+	if !s.authorized(r.secret) {
+		log.Warn().Msgf("ignoring unauthorized network device: %s (%s)", s.id, s.key)
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch msg {
+	case lineproto.MsgWriting, lineproto.MsgOk, lineproto.MsgErr:
+		if s.key == r.writeKey {
+			r.writer.HandleReply(msg, args)
+		}
+	case lineproto.MsgScan:
+		t := lineproto.ParseScan(line, args, s.info.Version >= 2)
+		if t == nil {
+			return
+		}
+		t.Source = r.device
+
+		log.Debug().Msgf("network device %s scanned: %v", s.id, t)
+
+		if !utils.TokensEqual(t, r.lastToken) {
+			r.sendScan(t)
+		}
+
+		r.lastToken = t
+		r.lastKey = s.key
+	case lineproto.MsgRemoved:
+		if r.lastToken != nil && r.lastKey == s.key {
+			r.sendScan(nil)
+			r.lastToken = nil
+		}
+	default:
+		log.Debug().Msgf("unknown network reader message: %s", msg)
+	}
+}
+
+// checkRemoval removes the last token if its device has gone away, or it
+// has timed out on devices which don't report removals.
+func (r *Reader) checkRemoval() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.lastToken == nil {
+		return
+	}
+
+	s, ok := r.l.getSession(r.lastKey)
+	if ok && (s.info.Removal || r.removalTimeout <= 0) {
+		return
+	}
+
+	if ok && time.Since(r.lastToken.ScanTime) <= r.removalTimeout {
+		return
+	}
+
+	r.sendScan(nil)
+	r.lastToken = nil
+}
+
+func (r *Reader) Open(device string, iq chan<- readers.Scan) error {
+	ps := strings.SplitN(device, ":", 2)
+	if len(ps) != 2 {
+		return errors.New("invalid device string: " + device)
+	}
+
+	if !utils.Contains(r.Ids(), ps[0]) {
+		return errors.New("invalid reader id: " + ps[0])
+	}
+
+	addr, id, err := parseAddress(ps[1])
+	if err != nil {
+		return err
+	}
+
+	r.device = device
+	r.network = ps[0]
+	r.addr = addr
+	r.id = id
+	r.secret = r.cfg.GetReaderSecret(device)
+	r.iq = iq
+	r.removalTimeout = r.cfg.GetReaderRemovalTimeout(device, defaultRemovalTimeout)
+
+	l, err := getListener(ps[0], addr, r)
+	if err != nil {
+		return err
+	}
+
+	r.l = l
+	r.openedAt.Store(time.Now().UnixNano())
+	r.polling.Store(true)
+
+	go func() {
+		for r.polling.Load() {
+			time.Sleep(100 * time.Millisecond)
+			r.checkRemoval()
+		}
+	}()
+
+	return nil
+}
+
+func (r *Reader) Close() error {
+	r.polling.Store(false)
+	if r.l != nil {
+		r.l.unsubscribe(r)
+	}
+	return nil
+}
+
+func (r *Reader) Detect(connected []string) string {
+	return ""
+}
+
+func (r *Reader) Device() string {
+	return r.device
+}
+
+// listening returns true while the reader is open and its listener is
+// running.
+func (r *Reader) listening() bool {
+	return r.polling.Load() && r.l != nil && r.l.running()
+}
+
+// Connected returns true while a device this reader accepts is sending
+// heartbeats. Just after opening the reader counts as connected for one
+// heartbeat, so devices have time to connect.
+func (r *Reader) Connected() bool {
+	if !r.listening() {
+		return false
+	}
+
+	if time.Since(time.Unix(0, r.openedAt.Load())) < heartbeatTimeout {
+		return true
+	}
+
+	return len(r.l.liveSessions(r.accepts)) > 0
+}
+
+func (r *Reader) Info() string {
+	var names []string
+	if r.l != nil {
+		for _, s := range r.l.liveSessions(r.accepts) {
+			if s.info.Name != "" {
+				names = append(names, s.info.Name+" ["+s.id+"]")
+			} else {
+				names = append(names, s.id)
+			}
+		}
+	}
+	sort.Strings(names)
+
+	return r.network + " " + r.addr + " (" + strings.Join(names, ", ") + ")"
+}
+
+// writeSession picks the device to write to, which is either the only
+// connected device or the one which scanned last.
+func (r *Reader) writeSession() (*session, error) {
+	ss := r.l.liveSessions(r.accepts)
+	if len(ss) == 0 {
+		return nil, errors.New("not connected")
+	}
+
+	r.mu.Lock()
+	lastKey := r.lastKey
+	r.mu.Unlock()
+
+	for _, s := range ss {
+		if s.key == lastKey {
+			return s, nil
+		}
+	}
+
+	if len(ss) > 1 {
+		return nil, errors.New("multiple network devices connected, scan a token on the device first")
+	}
+
+	return ss[0], nil
+}
+
+func (r *Reader) Write(
+	text string,
+	opts readers.WriteOptions,
+	status func(readers.WriteStatus),
+) (*tokens.Token, error) {
+	if !r.Connected() {
+		return nil, errors.New("not connected")
+	}
+
+	s, err := r.writeSession()
+	if err != nil {
+		return nil, err
+	}
+
+	if !s.info.Write {
+		return nil, errors.New("writing not supported on this device")
+	}
+
+	if opts.Protected() {
+		return nil, errors.New("token protection not supported on this reader")
+	}
+
+	r.mu.Lock()
+	r.writeKey = s.key
+	r.mu.Unlock()
+
+	return r.writer.Write(r.device, text, status, s.send)
+}
+
+func (r *Reader) CancelWrite() {
+	r.writer.Cancel()
+}
+
+func (r *Reader) Capabilities() readers.Capabilities {
+	write := false
+	if r.l != nil {
+		for _, s := range r.l.liveSessions(r.accepts) {
+			write = write || s.info.Write
+		}
+	}
+
+	return readers.Capabilities{
+		Write:   write,
+		Removal: true,
+	}
+}
+
+func (r *Reader) Health() error {
+	if !r.listening() {
+		return readers.ErrNotConnected
+	} else if !r.Connected() {
+		return ErrNoDevices
+	}
+	return nil
+}
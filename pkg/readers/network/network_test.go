@@ -0,0 +1,407 @@
+package network
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ZaparooProject/zaparoo-core/pkg/config"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/lineproto"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/readertest"
+)
+
+// freePort returns a port which was just free on localhost.
+func freePort(t *testing.T) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = ln.Close()
+	}()
+
+	return strconv.Itoa(ln.Addr().(*net.TCPAddr).Port)
+}
+
+// testDevice is a remote device connected over TCP.
+type testDevice struct {
+	t       *testing.T
+	conn    net.Conn
+	scanner *bufio.Scanner
+}
+
+// dialDevice connects a device to the listener, waiting for it to start.
+func dialDevice(t *testing.T, addr string) *testDevice {
+	t.Helper()
+
+	deadline := time.Now().Add(readertest.Timeout)
+	for {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			d := &testDevice{t: t, conn: conn, scanner: bufio.NewScanner(conn)}
+			t.Cleanup(func() {
+				_ = conn.Close()
+			})
+			return d
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (d *testDevice) send(lines ...string) {
+	d.t.Helper()
+	for _, l := range lines {
+		_, err := d.conn.Write([]byte(l + "\n"))
+		if err != nil {
+			d.t.Fatal(err)
+		}
+	}
+}
+
+// readLine returns the next line sent by the host.
+func (d *testDevice) readLine() string {
+	d.t.Helper()
+
+	_ = d.conn.SetReadDeadline(time.Now().Add(readertest.Timeout))
+	if !d.scanner.Scan() {
+		d.t.Fatalf("failed to read line: %v", d.scanner.Err())
+	}
+	return d.scanner.Text()
+}
+
+// hello reads the server HELLO and returns its nonce.
+func (d *testDevice) hello() string {
+	d.t.Helper()
+
+	msg, args := lineproto.SplitLine(d.readLine())
+	if msg != lineproto.MsgHello {
+		d.t.Fatalf("expected hello, got: %s", msg)
+	}
+
+	return lineproto.ParseArgs(args, true)["nonce"]
+}
+
+// expireOpenGrace makes a reader behave as if it was opened longer than a
+// heartbeat ago.
+func expireOpenGrace(r *Reader) {
+	r.openedAt.Store(time.Now().Add(-heartbeatTimeout).UnixNano())
+}
+
+// openReader opens a reader and waits until a device has connected.
+func openReader(t *testing.T, cfg *config.UserConfig, device string) (*Reader, chan readers.Scan) {
+	t.Helper()
+
+	r := NewReader(cfg)
+	scans := make(chan readers.Scan, 10)
+
+	err := r.Open(device, scans)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	readertest.WaitFor(t, func() bool {
+		return len(r.l.liveSessions(r.accepts)) > 0
+	})
+
+	t.Cleanup(func() {
+		_ = r.Close()
+	})
+
+	return r, scans
+}
+
+func TestParseAddress(t *testing.T) {
+	tests := []struct {
+		s    string
+		addr string
+		id   string
+	}{
+		{"7497", ":7497", ""},
+		{":7497", ":7497", ""},
+		{"0.0.0.0:7497/desk", "0.0.0.0:7497", "desk"},
+		{"[::1]:7497", "[::1]:7497", ""},
+	}
+
+	for _, tt := range tests {
+		addr, id, err := parseAddress(tt.s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if addr != tt.addr || id != tt.id {
+			t.Fatalf("%s: unexpected address %s and id %s", tt.s, addr, id)
+		}
+	}
+
+	if _, _, err := parseAddress("host:"); err == nil {
+		t.Fatal("expected missing port error")
+	}
+}
+
+func TestOpenWithoutDevice(t *testing.T) {
+	r := NewReader(&config.UserConfig{})
+	err := r.Open("tcp:127.0.0.1:"+freePort(t), make(chan readers.Scan))
+	if err != nil {
+		t.Fatalf("expected open to succeed without a device: %s", err)
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+
+	// the reader waits a heartbeat for devices instead of failing
+	if !r.Connected() || r.Health() != nil {
+		t.Fatal("expected reader to be connected while waiting for devices")
+	}
+
+	expireOpenGrace(r)
+
+	if r.Connected() || !errors.Is(r.Health(), ErrNoDevices) {
+		t.Fatal("expected reader to be disconnected without devices")
+	}
+
+	_, err = r.Write("**launch.random", readers.WriteOptions{}, func(readers.WriteStatus) {})
+	if err == nil {
+		t.Fatal("expected write to fail without a device")
+	}
+}
+
+func TestTcpScanAndRemove(t *testing.T) {
+	addr := "127.0.0.1:" + freePort(t)
+	_, err := getListener("tcp", addr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dev := dialDevice(t, addr)
+	dev.hello()
+	dev.send("HELLO\tversion=2\tid=desk\tcaps=removal\tname=Desk")
+
+	r, scans := openReader(t, &config.UserConfig{}, "tcp:"+addr+"/desk")
+
+	expireOpenGrace(r)
+
+	if !r.Connected() || !strings.Contains(r.Info(), "Desk [desk]") {
+		t.Fatalf("unexpected reader state: %s", r.Info())
+	}
+
+	dev.send("SCAN\tuid=abcd\ttext=**launch.random")
+
+	scan := readertest.WaitScan(t, scans)
+	if scan.Token == nil || scan.Token.UID != "abcd" || scan.Token.Source != "tcp:"+addr+"/desk" {
+		t.Fatalf("unexpected scan: %+v", scan)
+	}
+
+	dev.send("PING")
+	if line := dev.readLine(); line != lineproto.MsgPong {
+		t.Fatalf("expected pong, got: %s", line)
+	}
+
+	dev.send(lineproto.MsgRemoved)
+
+	scan = readertest.WaitScan(t, scans)
+	if scan.Token != nil {
+		t.Fatalf("expected removal, got: %+v", scan.Token)
+	}
+
+	// disconnecting the device leaves the reader listening, but it no
+	// longer counts as connected
+	_ = dev.conn.Close()
+
+	readertest.WaitFor(t, func() bool {
+		return !strings.Contains(r.Info(), "desk")
+	})
+
+	if r.Connected() || !errors.Is(r.Health(), ErrNoDevices) {
+		t.Fatal("expected reader to be disconnected without devices")
+	}
+	if !r.l.running() {
+		t.Fatal("expected reader to keep listening")
+	}
+}
+
+func TestCloseReleasesPort(t *testing.T) {
+	addr := "127.0.0.1:" + freePort(t)
+	_, err := getListener("tcp", addr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dev := dialDevice(t, addr)
+	dev.hello()
+	dev.send("HELLO\tversion=2\tid=desk")
+
+	r := NewReader(&config.UserConfig{})
+	err = r.Open("tcp:"+addr, make(chan readers.Scan))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = r.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// connected devices are dropped along with the listener
+	err = dev.conn.SetReadDeadline(time.Now().Add(readertest.Timeout))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dev.scanner.Scan() {
+		t.Fatal("expected device connection to be closed")
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("expected port to be released: %s", err)
+	}
+	_ = ln.Close()
+}
+
+func TestTcpOtherDeviceIgnored(t *testing.T) {
+	addr := "127.0.0.1:" + freePort(t)
+	_, err := getListener("tcp", addr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	desk := dialDevice(t, addr)
+	desk.hello()
+	desk.send("HELLO\tversion=2\tid=desk")
+
+	other := dialDevice(t, addr)
+	other.hello()
+	other.send("HELLO\tversion=2\tid=other")
+
+	_, scans := openReader(t, &config.UserConfig{}, "tcp:"+addr+"/desk")
+
+	other.send("SCAN\tuid=1111")
+	desk.send("SCAN\tuid=2222")
+
+	scan := readertest.WaitScan(t, scans)
+	if scan.Token == nil || scan.Token.UID != "2222" {
+		t.Fatalf("unexpected scan: %+v", scan)
+	}
+}
+
+func TestTcpSecret(t *testing.T) {
+	addr := "127.0.0.1:" + freePort(t)
+	device := "tcp:" + addr
+	_, err := getListener("tcp", addr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.UserConfig{}
+	cfg.Readers.Secret = []string{"Sup3rSecret:" + device}
+
+	bad := dialDevice(t, addr)
+	bad.hello()
+	bad.send("HELLO\tversion=2\tid=bad\tauth=00112233")
+
+	time.Sleep(50 * time.Millisecond)
+
+	good := dialDevice(t, addr)
+	nonce := good.hello()
+	auth := hex.EncodeToString(authResponse("Sup3rSecret", nonce))
+	good.send("HELLO\tversion=2\tid=good\tauth=" + auth)
+
+	r, scans := openReader(t, cfg, device)
+
+	if strings.Contains(r.Info(), "bad") {
+		t.Fatalf("expected unauthorized device to not be listed: %s", r.Info())
+	}
+
+	bad.send("SCAN\tuid=1111")
+	good.send("SCAN\tuid=2222")
+
+	scan := readertest.WaitScan(t, scans)
+	if scan.Token == nil || scan.Token.UID != "2222" {
+		t.Fatalf("unexpected scan: %+v", scan)
+	}
+}
+
+func TestTcpWrite(t *testing.T) {
+	addr := "127.0.0.1:" + freePort(t)
+	_, err := getListener("tcp", addr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dev := dialDevice(t, addr)
+	dev.hello()
+	dev.send("HELLO\tversion=2\tcaps=write")
+
+	r, _ := openReader(t, &config.UserConfig{}, "tcp:"+addr)
+
+	// the reader may open before the device's hello arrives
+	readertest.WaitFor(t, func() bool {
+		return r.Capabilities().Write
+	})
+
+	go func() {
+		line := dev.readLine()
+		if line != "WRITE\ttext=**launch.random" {
+			t.Errorf("unexpected write line: %s", line)
+		}
+		dev.send("OK\tuid=04aabb")
+	}()
+
+	token, err := r.Write("**launch.random", readers.WriteOptions{}, func(readers.WriteStatus) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token.UID != "04aabb" || token.Text != "**launch.random" {
+		t.Fatalf("unexpected token: %+v", token)
+	}
+}
+
+func TestUdpScanWithTimeoutRemoval(t *testing.T) {
+	addr := "127.0.0.1:" + freePort(t)
+	_, err := getListener("udp", addr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	_, err = conn.Write([]byte("HELLO\tversion=2\tid=table\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, scans := openReader(t, &config.UserConfig{}, "udp:"+addr+"/table")
+
+	_, err = conn.Write([]byte("SCAN\tuid=abcd\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scan := readertest.WaitScan(t, scans)
+	if scan.Token == nil || scan.Token.UID != "abcd" {
+		t.Fatalf("unexpected scan: %+v", scan)
+	}
+
+	// device doesn't report removals
+	scan = readertest.WaitScan(t, scans)
+	if scan.Token != nil {
+		t.Fatalf("expected removal, got: %+v", scan.Token)
+	}
+}
@@ -0,0 +1,254 @@
+// Package ntag implements the NTAG21x commands shared between readers which
+// talk to tags directly, like password protection and permanent locking.
+package ntag
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers"
+)
+
+const (
+	ReadCommand    = byte(0x30)
+	WriteCommand   = byte(0xA2)
+	PwdAuthCommand = byte(0x1B)
+)
+
+const (
+	PageSize          = 4
+	StaticLockPage    = 0x02
+	CapabilityPage    = 0x03
+	FirstUserPage     = 0x04
+	ccReadOnlyAccess  = 0x0F
+	cfg0Auth0Index    = 3
+	disabledAuth0Page = 0xFF
+)
+
+// Transceive sends a command to a tag and returns its response.
+type Transceive func(tx []byte) ([]byte, error)
+
+// ConfigPages are the addresses of the configuration pages at the end of
+// the tag's memory, which differ for each NTAG21x model.
+type ConfigPages struct {
+	DynamicLock byte
+	Cfg0        byte
+	Cfg1        byte
+	Pwd         byte
+	Pack        byte
+}
+
+// NTAG21x data sheet, section 8.5. Tags are identified by the size byte of
+// the capability container.
+var configPages = map[byte]ConfigPages{
+	// NTAG213
+	0x12: {DynamicLock: 0x28, Cfg0: 0x29, Cfg1: 0x2A, Pwd: 0x2B, Pack: 0x2C},
+	// NTAG215
+	0x3E: {DynamicLock: 0x82, Cfg0: 0x83, Cfg1: 0x84, Pwd: 0x85, Pack: 0x86},
+	// NTAG216
+	0x6D: {DynamicLock: 0xE2, Cfg0: 0xE3, Cfg1: 0xE4, Pwd: 0xE5, Pack: 0xE6},
+}
+
+func GetConfigPages(ccSize byte) (ConfigPages, error) {
+	pages, ok := configPages[ccSize]
+	if !ok {
+		return ConfigPages{}, fmt.Errorf("unsupported NTAG size: %x", ccSize)
+	}
+	return pages, nil
+}
+
+// ReadPage returns the 4 bytes of a single page. The read command always
+// returns 4 pages, the rest are discarded.
+func ReadPage(tx Transceive, page byte) ([]byte, error) {
+	res, err := tx([]byte{ReadCommand, page})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(res) < PageSize {
+		return nil, fmt.Errorf("invalid read response for page %d: %x", page, res)
+	}
+
+	return res[:PageSize], nil
+}
+
+func WritePage(tx Transceive, page byte, data []byte) error {
+	if len(data) != PageSize {
+		return fmt.Errorf("invalid page data length: %d", len(data))
+	}
+
+	_, err := tx(append([]byte{WriteCommand, page}, data...))
+	if err != nil {
+		return fmt.Errorf("error writing page %d: %w", page, err)
+	}
+
+	return nil
+}
+
+// Authenticate sends the password to the tag, which unlocks protected pages
+// until the tag leaves the field. The tag's PACK is returned on success.
+func Authenticate(tx Transceive, password []byte) ([]byte, error) {
+	if len(password) != 4 {
+		return nil, errors.New("password must be 4 bytes")
+	}
+
+	res, err := tx(append([]byte{PwdAuthCommand}, password...))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(res) < 2 {
+		return nil, errors.New("password authentication failed")
+	}
+
+	return res[:2], nil
+}
+
+// Unlock authenticates with the tag if it has password protection enabled,
+// so protected pages can be written. Unknown tag models are ignored.
+func Unlock(tx Transceive, password []byte) error {
+	cc, err := ReadPage(tx, CapabilityPage)
+	if err != nil {
+		return fmt.Errorf("error reading capability container: %w", err)
+	}
+
+	pages, err := GetConfigPages(cc[2])
+	if err != nil {
+		return nil
+	}
+
+	cfg0, err := ReadPage(tx, pages.Cfg0)
+	if err != nil {
+		return err
+	}
+
+	// AUTH0 past the end of the tag's memory disables protection
+	if cfg0[cfg0Auth0Index] > pages.Pack {
+		return nil
+	}
+
+	if len(password) == 0 {
+		return errors.New("tag is password protected")
+	}
+
+	_, err = Authenticate(tx, password)
+	if err != nil {
+		return fmt.Errorf("error authenticating: %w", err)
+	}
+
+	return nil
+}
+
+// Protect applies the password and lock options to a tag which has already
+// been written. The password is always set before the tag is locked, so
+// the tag is authenticated again before locking because the lock pages are
+// protected once AUTH0 is set.
+func Protect(tx Transceive, opts readers.WriteOptions) error {
+	if !opts.Protected() {
+		return nil
+	}
+
+	cc, err := ReadPage(tx, CapabilityPage)
+	if err != nil {
+		return fmt.Errorf("error reading capability container: %w", err)
+	}
+
+	pages, err := GetConfigPages(cc[2])
+	if err != nil {
+		return err
+	}
+
+	if len(opts.Password) > 0 {
+		err := setPassword(tx, pages, opts)
+		if err != nil {
+			return err
+		}
+
+		if opts.Lock {
+			_, err = Authenticate(tx, opts.Password)
+			if err != nil {
+				return fmt.Errorf("error authenticating: %w", err)
+			}
+		}
+	}
+
+	if opts.Lock {
+		err := lock(tx, pages, cc)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func setPassword(tx Transceive, pages ConfigPages, opts readers.WriteOptions) error {
+	if len(opts.Password) != 4 {
+		return errors.New("password must be 4 bytes")
+	}
+
+	pack := []byte{0x00, 0x00}
+	if len(opts.Pack) > 0 {
+		if len(opts.Pack) != 2 {
+			return errors.New("pack must be 2 bytes")
+		}
+		pack = opts.Pack
+	}
+
+	auth0 := opts.ProtectFrom
+	if auth0 == 0 {
+		auth0 = FirstUserPage
+	} else if auth0 == disabledAuth0Page {
+		return fmt.Errorf("invalid protect from page: %d", auth0)
+	}
+
+	err := WritePage(tx, pages.Pwd, opts.Password)
+	if err != nil {
+		return err
+	}
+
+	err = WritePage(tx, pages.Pack, append(append([]byte{}, pack...), 0x00, 0x00))
+	if err != nil {
+		return err
+	}
+
+	// AUTH0 is set last, it enables the protection
+	cfg0, err := ReadPage(tx, pages.Cfg0)
+	if err != nil {
+		return err
+	}
+
+	cfg0[cfg0Auth0Index] = auth0
+	return WritePage(tx, pages.Cfg0, cfg0)
+}
+
+func lock(tx Transceive, pages ConfigPages, cc []byte) error {
+	// mark NDEF as read-only for apps which check the capability container
+	ro := append([]byte{}, cc...)
+	ro[3] = ccReadOnlyAccess
+	err := WritePage(tx, CapabilityPage, ro)
+	if err != nil {
+		return err
+	}
+
+	dyn, err := ReadPage(tx, pages.DynamicLock)
+	if err != nil {
+		return err
+	}
+
+	dyn[0], dyn[1], dyn[2] = 0xFF, 0xFF, 0xFF
+	err = WritePage(tx, pages.DynamicLock, dyn)
+	if err != nil {
+		return err
+	}
+
+	// lock bits are OR'd with the existing values, the serial number bytes
+	// of the page are ignored by the tag
+	static, err := ReadPage(tx, StaticLockPage)
+	if err != nil {
+		return err
+	}
+
+	static[2], static[3] = 0xFF, 0xFF
+	return WritePage(tx, StaticLockPage, static)
+}
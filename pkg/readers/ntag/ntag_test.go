@@ -0,0 +1,141 @@
+package ntag
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers"
+)
+
+// fakeTag is an in-memory NTAG213 which handles read and write commands.
+// Like a real tag, writes to pages at or above AUTH0 are NAKed until the
+// tag is authenticated with its password.
+type fakeTag struct {
+	pages [45][4]byte
+	auth  []byte
+}
+
+func (t *fakeTag) writable(page byte) bool {
+	if page < t.pages[0x29][3] {
+		return true
+	}
+
+	return t.auth != nil && bytes.Equal(t.auth, t.pages[0x2B][:])
+}
+
+func newFakeTag() *fakeTag {
+	t := &fakeTag{}
+	t.pages[CapabilityPage] = [4]byte{0xE1, 0x10, 0x12, 0x00}
+	t.pages[0x29] = [4]byte{0x04, 0x00, 0x00, 0xFF}
+	return t
+}
+
+func (t *fakeTag) transceive(tx []byte) ([]byte, error) {
+	switch tx[0] {
+	case ReadCommand:
+		res := make([]byte, 0, 16)
+		for i := 0; i < 4; i++ {
+			p := t.pages[(int(tx[1])+i)%len(t.pages)]
+			res = append(res, p[:]...)
+		}
+		return res, nil
+	case WriteCommand:
+		if !t.writable(tx[1]) {
+			return nil, errors.New("nak")
+		}
+		copy(t.pages[tx[1]][:], tx[2:6])
+		return []byte{0x0A}, nil
+	case PwdAuthCommand:
+		if !bytes.Equal(tx[1:5], t.pages[0x2B][:]) {
+			t.auth = nil
+			return nil, errors.New("nak")
+		}
+		t.auth = append([]byte{}, tx[1:5]...)
+		return t.pages[0x2C][:2], nil
+	}
+	return nil, nil
+}
+
+func TestProtectPassword(t *testing.T) {
+	tag := newFakeTag()
+	err := Protect(tag.transceive, readers.WriteOptions{
+		Password: []byte{0x01, 0x02, 0x03, 0x04},
+		Pack:     []byte{0xAA, 0xBB},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(tag.pages[0x2B][:], []byte{0x01, 0x02, 0x03, 0x04}) {
+		t.Fatalf("unexpected password page: %x", tag.pages[0x2B])
+	}
+
+	if !bytes.Equal(tag.pages[0x2C][:2], []byte{0xAA, 0xBB}) {
+		t.Fatalf("unexpected pack page: %x", tag.pages[0x2C])
+	}
+
+	if tag.pages[0x29][3] != FirstUserPage {
+		t.Fatalf("unexpected auth0: %x", tag.pages[0x29][3])
+	}
+
+	// tag is now protected and requires the password to unlock
+	err = Unlock(tag.transceive, nil)
+	if err == nil {
+		t.Fatal("expected error unlocking without password")
+	}
+
+	err = Unlock(tag.transceive, []byte{0x01, 0x02, 0x03, 0x04})
+	if err != nil || tag.auth == nil {
+		t.Fatalf("expected tag to be unlocked: %v", err)
+	}
+}
+
+func TestProtectLock(t *testing.T) {
+	tag := newFakeTag()
+	err := Protect(tag.transceive, readers.WriteOptions{Lock: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tag.pages[CapabilityPage][3] != ccReadOnlyAccess {
+		t.Fatalf("unexpected capability container: %x", tag.pages[CapabilityPage])
+	}
+
+	if !bytes.Equal(tag.pages[StaticLockPage][2:], []byte{0xFF, 0xFF}) {
+		t.Fatalf("unexpected static lock bytes: %x", tag.pages[StaticLockPage])
+	}
+
+	if !bytes.Equal(tag.pages[0x28][:3], []byte{0xFF, 0xFF, 0xFF}) {
+		t.Fatalf("unexpected dynamic lock bytes: %x", tag.pages[0x28])
+	}
+
+	// unprotected tags don't need a password
+	err = Unlock(tag.transceive, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProtectPasswordLock(t *testing.T) {
+	tag := newFakeTag()
+	err := Protect(tag.transceive, readers.WriteOptions{
+		Password: []byte{0x01, 0x02, 0x03, 0x04},
+		Lock:     true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tag.pages[0x29][3] != FirstUserPage {
+		t.Fatalf("unexpected auth0: %x", tag.pages[0x29][3])
+	}
+
+	if tag.pages[CapabilityPage][3] != ccReadOnlyAccess {
+		t.Fatalf("unexpected capability container: %x", tag.pages[CapabilityPage])
+	}
+
+	if !bytes.Equal(tag.pages[0x28][:3], []byte{0xFF, 0xFF, 0xFF}) {
+		t.Fatalf("unexpected dynamic lock bytes: %x", tag.pages[0x28])
+	}
+}
@@ -0,0 +1,143 @@
+//go:build linux
+
+package optical_drive
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/hotplug"
+)
+
+// from linux/cdrom.h
+const (
+	cdromReadTocHdr   = 0x5305
+	cdromReadTocEntry = 0x5306
+	cdromDriveStatus  = 0x5326
+	cdslCurrent       = 0x7fffffff
+	cdsDiscOk         = 4
+	cdromLba          = 0x01
+	cdromDataTrack    = 0x04
+	cdromLeadout      = 0xaa
+)
+
+type cdromTocHdr struct {
+	First uint8
+	Last  uint8
+}
+
+type cdromTocEntry struct {
+	Track    uint8
+	AdrCtrl  uint8
+	Format   uint8
+	_        uint8
+	Addr     int32
+	DataMode uint8
+	_        [3]uint8
+}
+
+func ioctl(fd uintptr, req uintptr, arg uintptr) (uintptr, error) {
+	r, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, arg)
+	if errno != 0 {
+		return r, errno
+	}
+	return r, nil
+}
+
+// discPresent returns true if the drive has a readable disc in it. It only
+// asks the drive, so it's cheap enough to call often and doesn't spin up
+// the disc.
+func discPresent(path string) bool {
+	f, err := os.OpenFile(path, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return false
+	}
+	defer func(f *os.File) {
+		_ = f.Close()
+	}(f)
+
+	status, err := ioctl(f.Fd(), cdromDriveStatus, cdslCurrent)
+	if err != nil {
+		return false
+	}
+
+	return status == cdsDiscOk
+}
+
+// readToc reads the table of contents of the disc in the drive, returning
+// the tracks and the lead-out address.
+func readToc(f *os.File) ([]tocTrack, int, error) {
+	var hdr cdromTocHdr
+	_, err := ioctl(f.Fd(), cdromReadTocHdr, uintptr(unsafe.Pointer(&hdr)))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if hdr.Last < hdr.First {
+		return nil, 0, errors.New("invalid table of contents")
+	}
+
+	var tracks []tocTrack
+	for n := int(hdr.First); n <= int(hdr.Last); n++ {
+		e := cdromTocEntry{
+			Track:  uint8(n),
+			Format: cdromLba,
+		}
+		_, err := ioctl(f.Fd(), cdromReadTocEntry, uintptr(unsafe.Pointer(&e)))
+		if err != nil {
+			return nil, 0, err
+		}
+
+		tracks = append(tracks, tocTrack{
+			Number: n,
+			Lba:    int(e.Addr),
+			Data:   (e.AdrCtrl>>4)&cdromDataTrack != 0,
+		})
+	}
+
+	leadout := cdromTocEntry{
+		Track:  cdromLeadout,
+		Format: cdromLba,
+	}
+	_, err = ioctl(f.Fd(), cdromReadTocEntry, uintptr(unsafe.Pointer(&leadout)))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return tracks, int(leadout.Addr), nil
+}
+
+// isMediaChange returns true if a uevent message is media being inserted
+// or removed from the drive with the device name.
+func isMediaChange(msg []byte, devName []byte) bool {
+	var dev, change bool
+	for _, f := range bytes.Split(msg, []byte{0}) {
+		if bytes.Equal(f, devName) {
+			dev = true
+		} else if bytes.Equal(f, []byte("DISK_MEDIA_CHANGE=1")) ||
+			bytes.Equal(f, []byte("DISK_EJECT_REQUEST=1")) {
+			change = true
+		}
+	}
+	return dev && change
+}
+
+// watchMediaChanges listens for the kernel's uevents about media being
+// inserted or removed from the drive. The kernel only sends them if it's
+// polling the drive, which udev usually enables, so the returned channel
+// may never receive anything.
+func watchMediaChanges(path string) (<-chan struct{}, func(), error) {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	devName := []byte("DEVNAME=" + filepath.Base(resolved))
+
+	return hotplug.WatchUevents(func(msg []byte) bool {
+		return isMediaChange(msg, devName)
+	})
+}
@@ -0,0 +1,25 @@
+//go:build linux
+
+package optical_drive
+
+import "testing"
+
+func TestIsMediaChange(t *testing.T) {
+	devName := []byte("DEVNAME=sr0")
+
+	tests := []struct {
+		msg  string
+		want bool
+	}{
+		{"change@/devices/virtual/block/sr0\x00ACTION=change\x00DEVNAME=sr0\x00DISK_MEDIA_CHANGE=1\x00", true},
+		{"change@/devices/virtual/block/sr0\x00ACTION=change\x00DEVNAME=sr0\x00DISK_EJECT_REQUEST=1\x00", true},
+		{"change@/devices/virtual/block/sr1\x00ACTION=change\x00DEVNAME=sr1\x00DISK_MEDIA_CHANGE=1\x00", false},
+		{"add@/devices/virtual/block/sr0\x00ACTION=add\x00DEVNAME=sr0\x00", false},
+	}
+
+	for _, tt := range tests {
+		if got := isMediaChange([]byte(tt.msg), devName); got != tt.want {
+			t.Errorf("isMediaChange(%q) = %t, want %t", tt.msg, got, tt.want)
+		}
+	}
+}
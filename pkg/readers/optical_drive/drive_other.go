@@ -0,0 +1,30 @@
+//go:build !linux
+
+package optical_drive
+
+import (
+	"errors"
+	"os"
+)
+
+// discPresent returns true if the start of the disc can be read.
+func discPresent(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer func(f *os.File) {
+		_ = f.Close()
+	}(f)
+
+	_, err = readSector(f, 0)
+	return err == nil
+}
+
+func readToc(_ *os.File) ([]tocTrack, int, error) {
+	return nil, 0, errors.New("reading the table of contents is only supported on linux")
+}
+
+func watchMediaChanges(_ string) (<-chan struct{}, func(), error) {
+	return nil, nil, errors.New("media change events are only supported on linux")
+}
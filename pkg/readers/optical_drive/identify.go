@@ -0,0 +1,283 @@
+package optical_drive
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/ZaparooProject/zaparoo-core/pkg/database/gamesdb"
+)
+
+const (
+	sectorSize = 2048
+	// the ISO 9660 primary volume descriptor is always in this sector
+	pvdSector = 16
+	// the largest SYSTEM.CNF which will be read
+	maxSystemCnfSize = 4096
+	// system ID of PS2 discs, which have no system in the media database
+	systemPS2 = "PS2"
+)
+
+// Disc is everything which could be identified about a disc.
+type Disc struct {
+	// System is the ID of the console the disc is for, if it's a game.
+	System string
+	// Serial is the game's product code, like SLUS-00594.
+	Serial string
+	// Label is the ISO 9660 volume label.
+	Label string
+	// Uuid is the filesystem UUID, which is the volume date for ISO 9660
+	// discs.
+	Uuid string
+	// CddbId is the CDDB disc ID calculated from the table of contents,
+	// only set for audio CDs and discs with no other identifier.
+	CddbId string
+}
+
+// Id returns the most specific identifier of a disc, which is used as the
+// token UID.
+func (d Disc) Id() string {
+	for _, v := range []string{d.Serial, d.Uuid, d.CddbId, d.Label} {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func readSector(r io.ReaderAt, lba int64) ([]byte, error) {
+	buf := make([]byte, sectorSize)
+	_, err := r.ReadAt(buf, lba*sectorSize)
+	if err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+func trimField(b []byte) string {
+	return strings.TrimSpace(string(bytes.TrimRight(b, "\x00")))
+}
+
+// segaCdSerial returns the serial from a Mega Drive style product code
+// field, e.g. "GM MK-4407 -00" is MK-4407.
+func segaCdSerial(field []byte) string {
+	fs := strings.Fields(trimField(field))
+	if len(fs) > 1 && len(fs[0]) == 2 {
+		fs = fs[1:]
+	}
+	if len(fs) == 0 {
+		return ""
+	}
+	return fs[0]
+}
+
+// isoDate formats an ISO 9660 volume date like blkid does for the UUID, or
+// returns an empty string if it's not set.
+func isoDate(b []byte) string {
+	if len(b) < 16 {
+		return ""
+	}
+
+	s := string(b[:16])
+	if strings.Trim(s, "0 \x00") == "" {
+		return ""
+	}
+
+	return fmt.Sprintf(
+		"%s-%s-%s-%s-%s-%s-%s",
+		s[0:4], s[4:6], s[6:8], s[8:10], s[10:12], s[12:14], s[14:16],
+	)
+}
+
+// findRootFile returns the extent and size of a file in the root directory
+// of an ISO 9660 filesystem.
+func findRootFile(r io.ReaderAt, pvd []byte, name string) (int64, int, bool) {
+	root := pvd[156 : 156+34]
+	extent := int64(binary.LittleEndian.Uint32(root[2:6]))
+	size := int(binary.LittleEndian.Uint32(root[10:14]))
+
+	// a sanity limit for broken discs, root directories are small
+	if size <= 0 || size > 64*sectorSize {
+		return 0, 0, false
+	}
+
+	dir := make([]byte, size)
+	_, err := r.ReadAt(dir, extent*sectorSize)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	for i := 0; i < len(dir); {
+		recLen := int(dir[i])
+		if recLen == 0 {
+			// records don't cross sectors, skip the padding to the next
+			i = (i/sectorSize + 1) * sectorSize
+			continue
+		}
+
+		if i+recLen > len(dir) || recLen < 34 {
+			break
+		}
+
+		rec := dir[i : i+recLen]
+		nameLen := int(rec[32])
+		if 33+nameLen <= len(rec) {
+			recName := string(rec[33 : 33+nameLen])
+			recName, _, _ = strings.Cut(recName, ";")
+			if strings.EqualFold(recName, name) {
+				return int64(binary.LittleEndian.Uint32(rec[2:6])),
+					int(binary.LittleEndian.Uint32(rec[10:14])),
+					true
+			}
+		}
+
+		i += recLen
+	}
+
+	return 0, 0, false
+}
+
+var psSerialRe = regexp.MustCompile(`^[A-Z]{4}-\d{5}$`)
+
+// parseSystemCnf returns the system and serial from the boot line of a
+// PlayStation SYSTEM.CNF, e.g. "BOOT = cdrom:\SLUS_005.94;1" is a PS1 disc
+// with the serial SLUS-00594.
+func parseSystemCnf(cnf string) (string, string) {
+	for _, line := range strings.Split(cnf, "\n") {
+		k, v, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+
+		var system string
+		switch strings.ToUpper(strings.TrimSpace(k)) {
+		case "BOOT":
+			system = gamesdb.SystemPSX
+		case "BOOT2":
+			system = systemPS2
+		default:
+			continue
+		}
+
+		exe := strings.TrimSpace(v)
+		if i := strings.LastIndexAny(exe, `\/:`); i >= 0 {
+			exe = exe[i+1:]
+		}
+		exe, _, _ = strings.Cut(exe, ";")
+		exe, _, _ = strings.Cut(exe, " ")
+
+		serial := strings.ToUpper(exe)
+		serial = strings.ReplaceAll(serial, "_", "-")
+		serial = strings.ReplaceAll(serial, ".", "")
+
+		if psSerialRe.MatchString(serial) {
+			return system, serial
+		}
+
+		return system, ""
+	}
+
+	return "", ""
+}
+
+// identifyData reads the boot header and filesystem of a data disc.
+func identifyData(r io.ReaderAt) Disc {
+	var d Disc
+
+	boot, err := readSector(r, 0)
+	if err != nil {
+		return d
+	}
+
+	switch {
+	case bytes.HasPrefix(boot, []byte("SEGA SEGASATURN")):
+		d.System = gamesdb.SystemSaturn
+		d.Serial = trimField(boot[0x20:0x2a])
+	case bytes.HasPrefix(boot, []byte("SEGADISCSYSTEM")),
+		bytes.HasPrefix(boot, []byte("SEGABOOTDISC")):
+		d.System = gamesdb.SystemMegaCD
+		d.Serial = segaCdSerial(boot[0x180:0x18e])
+	}
+
+	pvd, err := readSector(r, pvdSector)
+	if err != nil || pvd[0] != 1 || string(pvd[1:6]) != "CD001" {
+		return d
+	}
+
+	d.Label = trimField(pvd[40:72])
+
+	// blkid uses the modification date, then the creation date
+	d.Uuid = isoDate(pvd[830:847])
+	if d.Uuid == "" {
+		d.Uuid = isoDate(pvd[813:830])
+	}
+
+	if d.System != "" {
+		return d
+	}
+
+	extent, size, ok := findRootFile(r, pvd, "SYSTEM.CNF")
+	if !ok {
+		return d
+	}
+
+	if size > maxSystemCnfSize {
+		size = maxSystemCnfSize
+	}
+
+	cnf := make([]byte, size)
+	_, err = r.ReadAt(cnf, extent*sectorSize)
+	if err != nil {
+		return d
+	}
+
+	d.System, d.Serial = parseSystemCnf(string(cnf))
+
+	return d
+}
+
+type tocTrack struct {
+	Number int
+	Lba    int
+	Data   bool
+}
+
+// cddbId calculates the CDDB (freedb) disc ID from a table of contents.
+func cddbId(tracks []tocTrack, leadout int) string {
+	if len(tracks) == 0 {
+		return ""
+	}
+
+	// track offsets are in seconds including the 2 second pregap
+	secs := func(lba int) int {
+		return (lba + 150) / 75
+	}
+
+	sum := 0
+	for _, t := range tracks {
+		for n := secs(t.Lba); n > 0; n /= 10 {
+			sum += n % 10
+		}
+	}
+
+	total := secs(leadout) - secs(tracks[0].Lba)
+	id := (sum%0xff)<<24 | total<<8 | len(tracks)
+
+	return fmt.Sprintf("%08x", id)
+}
+
+// isAudio returns true if a table of contents has no data tracks.
+func isAudio(tracks []tocTrack) bool {
+	if len(tracks) == 0 {
+		return false
+	}
+	for _, t := range tracks {
+		if t.Data {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,196 @@
+package optical_drive
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/ZaparooProject/zaparoo-core/pkg/database/gamesdb"
+)
+
+const (
+	testRootSector = 18
+	testCnfSector  = 19
+	testSectors    = 20
+)
+
+func dirRecord(name string, extent int, size int) []byte {
+	recLen := 33 + len(name)
+	if recLen%2 != 0 {
+		recLen++
+	}
+
+	rec := make([]byte, recLen)
+	rec[0] = byte(recLen)
+	binary.LittleEndian.PutUint32(rec[2:6], uint32(extent))
+	binary.BigEndian.PutUint32(rec[6:10], uint32(extent))
+	binary.LittleEndian.PutUint32(rec[10:14], uint32(size))
+	binary.BigEndian.PutUint32(rec[14:18], uint32(size))
+	rec[32] = byte(len(name))
+	copy(rec[33:], name)
+
+	return rec
+}
+
+// isoImage builds a minimal ISO 9660 image with a volume label and an
+// optional SYSTEM.CNF in the root directory.
+func isoImage(label string, modified string, systemCnf string) []byte {
+	img := make([]byte, testSectors*sectorSize)
+
+	pvd := img[pvdSector*sectorSize:]
+	pvd[0] = 1
+	copy(pvd[1:6], "CD001")
+	pvd[6] = 1
+	copy(pvd[40:72], bytes.Repeat([]byte(" "), 32))
+	copy(pvd[40:72], label)
+	copy(pvd[813:829], bytes.Repeat([]byte("0"), 16))
+	copy(pvd[830:846], bytes.Repeat([]byte("0"), 16))
+	copy(pvd[830:846], modified)
+	copy(pvd[156:], dirRecord("\x00", testRootSector, sectorSize))
+
+	root := img[testRootSector*sectorSize:]
+	i := copy(root, dirRecord("\x00", testRootSector, sectorSize))
+	i += copy(root[i:], dirRecord("\x01", testRootSector, sectorSize))
+	if systemCnf != "" {
+		copy(root[i:], dirRecord("SYSTEM.CNF;1", testCnfSector, len(systemCnf)))
+		copy(img[testCnfSector*sectorSize:], systemCnf)
+	}
+
+	return img
+}
+
+func TestIdentifyPS1(t *testing.T) {
+	img := isoImage(
+		"SLUS_00594",
+		"1997090112000000",
+		"BOOT = cdrom:\\SLUS_005.94;1\r\nTCB = 4\r\nEVENT = 10\r\n",
+	)
+
+	d := identifyData(bytes.NewReader(img))
+
+	if d.System != gamesdb.SystemPSX {
+		t.Errorf("system = %q, want %q", d.System, gamesdb.SystemPSX)
+	}
+	if d.Serial != "SLUS-00594" {
+		t.Errorf("serial = %q, want SLUS-00594", d.Serial)
+	}
+	if d.Label != "SLUS_00594" {
+		t.Errorf("label = %q, want SLUS_00594", d.Label)
+	}
+	if d.Uuid != "1997-09-01-12-00-00-00" {
+		t.Errorf("uuid = %q, want 1997-09-01-12-00-00-00", d.Uuid)
+	}
+	if d.Id() != "SLUS-00594" {
+		t.Errorf("id = %q, want SLUS-00594", d.Id())
+	}
+}
+
+func TestIdentifyDataDisc(t *testing.T) {
+	img := isoImage("PHOTOS", "", "")
+
+	d := identifyData(bytes.NewReader(img))
+
+	if d.System != "" || d.Serial != "" {
+		t.Errorf("unexpected game disc: %+v", d)
+	}
+	if d.Uuid != "" {
+		t.Errorf("uuid = %q, want empty for unset dates", d.Uuid)
+	}
+	if d.Id() != "PHOTOS" {
+		t.Errorf("id = %q, want PHOTOS", d.Id())
+	}
+}
+
+func TestIdentifySaturn(t *testing.T) {
+	img := isoImage("SONIC_JAM", "", "")
+	copy(img, "SEGA SEGASATURN SEGA ENTERPRISES")
+	copy(img[0x20:], "MK-81079  V1.003")
+
+	d := identifyData(bytes.NewReader(img))
+
+	if d.System != gamesdb.SystemSaturn {
+		t.Errorf("system = %q, want %q", d.System, gamesdb.SystemSaturn)
+	}
+	if d.Serial != "MK-81079" {
+		t.Errorf("serial = %q, want MK-81079", d.Serial)
+	}
+}
+
+func TestIdentifySegaCd(t *testing.T) {
+	img := isoImage("", "", "")
+	copy(img, "SEGADISCSYSTEM  ")
+	copy(img[0x100:], "SEGA MEGA DRIVE ")
+	copy(img[0x180:], "GM MK-4407 -00")
+
+	d := identifyData(bytes.NewReader(img))
+
+	if d.System != gamesdb.SystemMegaCD {
+		t.Errorf("system = %q, want %q", d.System, gamesdb.SystemMegaCD)
+	}
+	if d.Serial != "MK-4407" {
+		t.Errorf("serial = %q, want MK-4407", d.Serial)
+	}
+}
+
+func TestIdentifyUnknown(t *testing.T) {
+	d := identifyData(bytes.NewReader(make([]byte, testSectors*sectorSize)))
+	if d.Id() != "" {
+		t.Errorf("id = %q, want empty", d.Id())
+	}
+
+	d = identifyData(bytes.NewReader(make([]byte, 100)))
+	if d.Id() != "" {
+		t.Errorf("id = %q, want empty for short image", d.Id())
+	}
+}
+
+func TestParseSystemCnf(t *testing.T) {
+	tests := []struct {
+		cnf    string
+		system string
+		serial string
+	}{
+		{"BOOT = cdrom:\\SCUS_941.63;1", gamesdb.SystemPSX, "SCUS-94163"},
+		{"BOOT=cdrom:SLPS_012.34;1", gamesdb.SystemPSX, "SLPS-01234"},
+		{"BOOT2 = cdrom0:\\SLES_123.45;1\nVER = 1.00", systemPS2, "SLES-12345"},
+		{"BOOT = cdrom:\\MAIN.EXE;1", gamesdb.SystemPSX, ""},
+		{"TCB = 4", "", ""},
+	}
+
+	for _, tt := range tests {
+		system, serial := parseSystemCnf(tt.cnf)
+		if system != tt.system || serial != tt.serial {
+			t.Errorf("parseSystemCnf(%q) = %q, %q, want %q, %q", tt.cnf, system, serial, tt.system, tt.serial)
+		}
+	}
+}
+
+func TestCddbId(t *testing.T) {
+	// track starts are 2 and 202 seconds, digit sum 6, and the disc is
+	// 400 seconds long
+	tracks := []tocTrack{
+		{Number: 1, Lba: 0},
+		{Number: 2, Lba: 15000},
+	}
+
+	got := cddbId(tracks, 30000)
+	if got != "06019002" {
+		t.Errorf("cddbId = %s, want 06019002", got)
+	}
+
+	if cddbId(nil, 0) != "" {
+		t.Error("expected empty id for empty toc")
+	}
+}
+
+func TestIsAudio(t *testing.T) {
+	if !isAudio([]tocTrack{{Number: 1}, {Number: 2}}) {
+		t.Error("expected audio disc")
+	}
+	if isAudio([]tocTrack{{Number: 1, Data: true}, {Number: 2}}) {
+		t.Error("expected mixed mode disc to not be audio")
+	}
+	if isAudio(nil) {
+		t.Error("expected empty toc to not be audio")
+	}
+}
@@ -1,31 +1,48 @@
+// Package optical_drive identifies discs inserted in a CD or DVD drive. The
+// token UID is the most specific identifier found for the disc: the serial
+// of a PS1, PS2, Saturn or Sega CD game, the filesystem UUID, the CDDB ID
+// of an audio CD, or the volume label. If a game disc's serial is in the
+// name of an indexed game, the token text is set to its path so inserting
+// an original disc launches the matching image.
 package optical_drive
 
 import (
 	"errors"
-	"github.com/ZaparooProject/zaparoo-core/pkg/config"
-	"github.com/ZaparooProject/zaparoo-core/pkg/readers"
-	"github.com/ZaparooProject/zaparoo-core/pkg/service/tokens"
-	"github.com/ZaparooProject/zaparoo-core/pkg/utils"
-	"github.com/rs/zerolog/log"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
+
+	"github.com/ZaparooProject/zaparoo-core/pkg/config"
+	"github.com/ZaparooProject/zaparoo-core/pkg/database/gamesdb"
+	"github.com/ZaparooProject/zaparoo-core/pkg/platforms"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers"
+	"github.com/ZaparooProject/zaparoo-core/pkg/service/tokens"
+	"github.com/ZaparooProject/zaparoo-core/pkg/utils"
+	"github.com/rs/zerolog/log"
 )
 
 const TokenType = "disc"
 
+// the drive is asked if it has a disc this often, in case media change
+// events aren't available. Asking doesn't spin up the disc.
+const statusInterval = 1 * time.Second
+
 type FileReader struct {
-	cfg     *config.UserConfig
-	device  string
-	path    string
-	polling bool
+	cfg       *config.UserConfig
+	pl        platforms.Platform
+	device    string
+	path      string
+	polling   bool
+	stopWatch func()
 }
 
-func NewReader(cfg *config.UserConfig) *FileReader {
+func NewReader(cfg *config.UserConfig, pl platforms.Platform) *FileReader {
 	return &FileReader{
 		cfg: cfg,
+		pl:  pl,
 	}
 }
 
@@ -33,6 +50,80 @@ func (r *FileReader) Ids() []string {
 	return []string{"optical_drive"}
 }
 
+// blkidUuid returns the filesystem UUID reported by blkid, which also
+// supports filesystems like UDF, or an empty string if it's not available.
+func blkidUuid(path string) string {
+	out, err := exec.Command("blkid", "-o", "value", "-s", "UUID", path).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// identify reads the disc in the drive.
+func (r *FileReader) identify() Disc {
+	f, err := os.Open(r.path)
+	if err != nil {
+		log.Debug().Err(err).Msg("error opening optical drive")
+		return Disc{}
+	}
+	defer func(f *os.File) {
+		_ = f.Close()
+	}(f)
+
+	tracks, leadout, err := readToc(f)
+	if err != nil {
+		log.Debug().Err(err).Msg("error reading disc table of contents")
+	}
+
+	if isAudio(tracks) {
+		return Disc{CddbId: cddbId(tracks, leadout)}
+	}
+
+	d := identifyData(f)
+
+	uuid := blkidUuid(r.path)
+	if uuid != "" {
+		d.Uuid = uuid
+	}
+
+	if d.Id() == "" {
+		d.CddbId = cddbId(tracks, leadout)
+	}
+
+	return d
+}
+
+// findGame returns the path of an indexed game matching a disc's serial.
+func (r *FileReader) findGame(d Disc) string {
+	if r.pl == nil || d.Serial == "" || d.System == "" {
+		return ""
+	}
+
+	system, err := gamesdb.GetSystem(d.System)
+	if err != nil || !gamesdb.Exists(r.pl) {
+		return ""
+	}
+
+	results, err := gamesdb.SearchNamesSerial(r.pl, []gamesdb.System{*system}, d.Serial)
+	if err != nil {
+		log.Warn().Err(err).Msgf("error searching for disc serial: %s", d.Serial)
+		return ""
+	} else if len(results) == 0 {
+		return ""
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Path < results[j].Path
+	})
+
+	if len(results) > 1 {
+		log.Info().Msgf("found %d games for disc serial %s, using first", len(results), d.Serial)
+	}
+
+	return results[0].Path
+}
+
 func (r *FileReader) Open(device string, iq chan<- readers.Scan) error {
 	ps := strings.SplitN(device, ":", 2)
 	if len(ps) != 2 {
@@ -58,54 +149,71 @@ func (r *FileReader) Open(device string, iq chan<- readers.Scan) error {
 		return err
 	}
 
+	changes, stopWatch, err := watchMediaChanges(path)
+	if err != nil {
+		log.Debug().Err(err).Msg("media change events not available, polling drive")
+	}
+
 	r.device = device
 	r.path = path
+	r.stopWatch = stopWatch
 	r.polling = true
 
 	go func() {
 		var token *tokens.Token
+		identified := false
 
-		for r.polling {
-			time.Sleep(1 * time.Second)
+		remove := func() {
+			if token == nil {
+				return
+			}
+			token = nil
+			iq <- readers.Scan{
+				Source: r.device,
+				Token:  nil,
+			}
+		}
 
-			rawUuid, err := exec.Command("blkid", "-o", "value", "-s", "UUID", r.path).Output()
-			if err != nil {
+		// changed forces the disc to be identified again, otherwise a
+		// disc is only read once while it's in the drive
+		check := func(changed bool) {
+			if !discPresent(r.path) {
 				if token != nil {
-					log.Debug().Err(err).Msg("error identifying optical media, removing token")
-					token = nil
-					iq <- readers.Scan{
-						Source: r.device,
-						Token:  nil,
-					}
-				} else {
-					continue
+					log.Debug().Msg("disc removed, removing token")
 				}
+				identified = false
+				remove()
+				return
 			}
 
-			uuid := strings.TrimSpace(string(rawUuid))
-
-			if uuid == "" && token != nil {
-				log.Debug().Msg("id is empty, removing token")
-				token = nil
-				iq <- readers.Scan{
-					Source: r.device,
-					Token:  nil,
-				}
-				continue
+			if identified && !changed {
+				return
 			}
+			identified = true
+
+			d := r.identify()
+			log.Debug().Msgf(
+				"identified disc: system=%s, serial=%s, label=%s, uuid=%s, cddb=%s",
+				d.System, d.Serial, d.Label, d.Uuid, d.CddbId,
+			)
 
-			if token != nil && token.UID == uuid {
-				continue
+			id := d.Id()
+			if id == "" {
+				log.Debug().Msg("could not identify disc")
+				remove()
+				return
 			}
 
-			if uuid == "" {
-				continue
+			if token != nil && token.UID == id {
+				return
 			}
 
 			token = &tokens.Token{
 				Type:     TokenType,
+				UID:      id,
+				Text:     r.findGame(d),
 				ScanTime: time.Now(),
-				UID:      uuid,
+				Source:   r.device,
 			}
 
 			log.Debug().Msgf("new token: %s", token.UID)
@@ -114,6 +222,21 @@ func (r *FileReader) Open(device string, iq chan<- readers.Scan) error {
 				Token:  token,
 			}
 		}
+
+		check(true)
+
+		for r.polling {
+			select {
+			case _, ok := <-changes:
+				if !ok {
+					changes = nil
+					continue
+				}
+				check(true)
+			case <-time.After(statusInterval):
+				check(false)
+			}
+		}
 	}()
 
 	return nil
@@ -121,6 +244,9 @@ func (r *FileReader) Open(device string, iq chan<- readers.Scan) error {
 
 func (r *FileReader) Close() error {
 	r.polling = false
+	if r.stopWatch != nil {
+		r.stopWatch()
+	}
 	return nil
 }
 
@@ -140,6 +266,24 @@ func (r *FileReader) Info() string {
 	return r.path
 }
 
-func (r *FileReader) Write(text string) (*tokens.Token, error) {
-	return nil, nil
+func (r *FileReader) Write(text string, _ readers.WriteOptions, _ func(readers.WriteStatus)) (*tokens.Token, error) {
+	return nil, errors.New("writing not supported on this reader")
+}
+
+func (r *FileReader) CancelWrite() {
+	// no writes to cancel
+}
+
+func (r *FileReader) Capabilities() readers.Capabilities {
+	return readers.Capabilities{
+		Removal:  true,
+		TagTypes: []string{TokenType},
+	}
+}
+
+func (r *FileReader) Health() error {
+	if !r.Connected() {
+		return readers.ErrNotConnected
+	}
+	return nil
 }
@@ -0,0 +1,80 @@
+package pn532
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/mifare"
+)
+
+// mifareCard sends MIFARE Classic commands to the active target.
+type mifareCard struct {
+	t   Transport
+	uid []byte
+}
+
+// buildMifareAuthCommand returns a command to authenticate against a block.
+// Cards with 7 byte UIDs use the last 4 bytes.
+func buildMifareAuthCommand(keyType byte, block int, key []byte, uid []byte) []byte {
+	command := append([]byte{keyType, byte(block)}, key...)
+	if len(uid) > 4 {
+		uid = uid[len(uid)-4:]
+	}
+	return append(command, uid...)
+}
+
+// Auth authenticates a block, selecting the card again if it fails because
+// a failed authentication halts the card.
+func (c mifareCard) Auth(block int, keyType byte, key []byte) error {
+	_, err := ntagTransceive(c.t)(buildMifareAuthCommand(keyType, block, key, c.uid))
+	if err == nil {
+		return nil
+	}
+
+	tgt, selErr := InListPassiveTarget(c.t)
+	if selErr != nil {
+		return fmt.Errorf("error reselecting card: %w", selErr)
+	} else if tgt == nil || !bytes.Equal(tgt.UidBytes, c.uid) {
+		return errors.New("card removed during authentication")
+	}
+
+	return err
+}
+
+func (c mifareCard) ReadBlock(block int) ([]byte, error) {
+	res, err := ntagTransceive(c.t)([]byte{mifare.ReadCommand, byte(block)})
+	if err != nil {
+		return nil, fmt.Errorf("error reading block %d: %w", block, err)
+	} else if len(res) < mifare.BlockSize {
+		return nil, fmt.Errorf("unexpected block %d length: %d", block, len(res))
+	}
+	return res[:mifare.BlockSize], nil
+}
+
+func (c mifareCard) WriteBlock(block int, data []byte) error {
+	_, err := ntagTransceive(c.t)(append([]byte{mifare.WriteCommand, byte(block)}, data...))
+	if err != nil {
+		return fmt.Errorf("error writing block %d: %w", block, err)
+	}
+	return nil
+}
+
+// mifareSectorCount returns the number of sectors on a MIFARE Classic
+// target, based on its SAK.
+func mifareSectorCount(tgt *Target) int {
+	if tgt.Sak == 0x18 {
+		return mifare.Sectors4K
+	}
+	return mifare.Sectors1K
+}
+
+// readMifare reads the NDEF data blocks of the active MIFARE Classic target.
+func readMifare(t Transport, tgt *Target, keys mifare.Keys) ([]byte, error) {
+	return mifare.Read(mifareCard{t: t, uid: tgt.UidBytes}, mifareSectorCount(tgt), keys)
+}
+
+// writeMifare writes an NDEF message to the active MIFARE Classic target.
+func writeMifare(t Transport, tgt *Target, keys mifare.Keys, payload []byte) error {
+	return mifare.Write(mifareCard{t: t, uid: tgt.UidBytes}, mifareSectorCount(tgt), keys, payload)
+}
@@ -0,0 +1,126 @@
+package pn532
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/figures"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/ndef"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/ntag"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/type4"
+	"github.com/rs/zerolog/log"
+)
+
+// ntagTransceive sends NTAG commands to the active target and strips the
+// data exchange status from the response.
+func ntagTransceive(t Transport) ntag.Transceive {
+	return func(tx []byte) ([]byte, error) {
+		res, err := InDataExchange(t, tx)
+		if err != nil {
+			return nil, err
+		} else if res[0] != 0x41 || res[1] != 0x00 {
+			return nil, fmt.Errorf("unexpected data exchange status: %x", res)
+		}
+		return res[2:], nil
+	}
+}
+
+// type4Transceive sends APDUs to the active target, the PN532 handles the
+// ISO 14443-4 block framing.
+func type4Transceive(t Transport) type4.Transceive {
+	return type4.Transceive(ntagTransceive(t))
+}
+
+// readNtag reads blocks from the capability container page onwards until
+// an empty block is found. Data read before an error is still returned.
+func readNtag(t Transport) ([]byte, error) {
+	i := 3
+	data := make([]byte, 0)
+	for {
+		// TODO: this is a random limit i picked, should detect blocks in card
+		if i >= 256 {
+			break
+		}
+
+		res, err := InDataExchange(t, []byte{ntag.ReadCommand, byte(i)})
+		if err != nil {
+			return data, fmt.Errorf("failed to run indataexchange: %w", err)
+		} else if len(res) < 2 {
+			return data, errors.New("unexpected data response length")
+		} else if res[0] != 0x41 || res[1] != 0x00 {
+			log.Warn().Msgf("unexpected data format: %x", res)
+			break
+		} else if bytes.Equal(res[2:], make([]byte, 16)) {
+			break
+		}
+
+		data = append(data, res[2:]...)
+		i += 4
+
+		time.Sleep(6 * time.Millisecond) // TODO: needs adjusting to a smaller safe value
+	}
+
+	return data, nil
+}
+
+// readFigure decodes the ID of an Amiibo or Lego Dimensions target, nil is
+// returned for any other tag.
+func readFigure(t Transport, tgt *Target) *figures.Figure {
+	tx := ntagTransceive(t)
+	f, err := figures.Read(func(page byte) ([]byte, error) {
+		return tx([]byte{ntag.ReadCommand, page})
+	}, tgt.UidBytes)
+	if err != nil {
+		log.Warn().Err(err).Msg("error reading figure")
+		return nil
+	} else if f != nil {
+		log.Info().Msgf("decoded figure: %s %s", f.Id, f.Name)
+	}
+	return f
+}
+
+// writeNtag writes a text record to the active target starting at the first
+// user page, then applies any protection options.
+func writeNtag(t Transport, text string, opts readers.WriteOptions) ([]byte, error) {
+	payload, err := ndef.BuildMessage(text)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := ntagTransceive(t)
+
+	cc, err := ntag.ReadPage(tx, ntag.CapabilityPage)
+	if err != nil {
+		return nil, fmt.Errorf("error reading capability container: %w", err)
+	}
+
+	capacity := int(cc[2]) * 8
+	if len(payload) > capacity {
+		return nil, fmt.Errorf("payload too big for card: [%d/%d] bytes used", len(payload), capacity)
+	}
+
+	err = ntag.Unlock(tx, opts.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < len(payload); i += ntag.PageSize {
+		page := make([]byte, ntag.PageSize)
+		copy(page, payload[i:])
+
+		err := ntag.WritePage(tx, ntag.FirstUserPage+byte(i/ntag.PageSize), page)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = ntag.Protect(tx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error protecting tag: %w", err)
+	}
+
+	return payload, nil
+}
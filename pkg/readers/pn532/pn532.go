@@ -1,4 +1,4 @@
-package pn532_uart
+package pn532
 
 import (
 	"bytes"
@@ -8,123 +8,39 @@ import (
 	"time"
 
 	"github.com/rs/zerolog/log"
-	"go.bug.st/serial"
 )
 
 const (
 	cmdSamConfiguration    = 0x14
+	cmdRfConfiguration     = 0x32
 	cmdGetFirmwareVersion  = 0x02
 	cmdGetGeneralStatus    = 0x04
 	cmdInListPassiveTarget = 0x4A
 	cmdInDataExchange      = 0x40
 	hostToPn532            = 0xD4
 	pn532ToHost            = 0xD5
-	pn532Ready             = 0x01
 )
 
 var (
-	ackFrame        = []byte{0x00, 0x00, 0xFF, 0x00, 0xFF, 0x00}
-	nackFrame       = []byte{0x00, 0x00, 0xFF, 0xFF, 0x00, 0x00}
+	AckFrame        = []byte{0x00, 0x00, 0xFF, 0x00, 0xFF, 0x00}
+	NackFrame       = []byte{0x00, 0x00, 0xFF, 0xFF, 0x00, 0x00}
 	ErrAckTimeout   = errors.New("timeout waiting for ACK")
 	ErrNoFrameFound = errors.New("no frame found")
 )
 
-func wakeUp(port serial.Port) error {
-	// over uart, pn532 must be (to be safe) "woken up" by sending a 0x55
-	// dummy byte and then waiting for some amount of time
-
-	n, err := port.Write([]byte{
-		0x55, 0x00, 0x00, 0x00, 0x00, 0x00,
-		0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
-		0x00, 0x00, 0x00, 0x00,
-	})
-	if err != nil {
-		return err
-	} else if n != 16 {
-		return errors.New("wakeup write error, not all bytes written")
-	}
-
-	err = port.Drain()
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func sendAck(port serial.Port) error {
+func sendAck(t Transport) error {
 	// tells the PN532 the command was received ok! (optional)
 	// can also be used to immediately cancel the current processing command
-
-	n, err := port.Write(ackFrame)
-	if err != nil {
-		return err
-	} else if n != len(ackFrame) {
-		return errors.New("ack write error, not all bytes written")
-	}
-
-	return port.Drain()
+	return t.Write(AckFrame)
 }
 
-// Block and wait to receive an ACK frame on the serial port, returning any
-// extra data that was received before the ACK frame. Data before the ACK frame
-// is not to spec, but is an odd bug happening on Windows.
-func waitAck(port serial.Port) ([]byte, error) {
-	// pn532 will send this sequence to acknowledge it received
-	// the previous command
-
-	tries := 0
-	maxTries := 64 // bytes to scan through
-
-	buf := make([]byte, 1)
-	ackBuf := make([]byte, 0)
-	preAck := make([]byte, 0)
-
-	for {
-		if tries >= maxTries {
-			return preAck, ErrAckTimeout
-		}
-
-		n, err := port.Read(buf)
-		if err != nil {
-			return preAck, err
-		} else if n == 0 {
-			tries++
-			continue
-		}
-
-		ackBuf = append(ackBuf, buf[0])
-		if len(ackBuf) < 6 {
-			continue
-		}
-
-		// log.Debug().Msgf("inspecting ack: %x", ackBuf)
-
-		if bytes.Equal(ackBuf, ackFrame) {
-			return preAck, nil
-		} else {
-			preAck = append(preAck, ackBuf[0])
-			ackBuf = ackBuf[1:]
-			tries++
-			continue
-		}
-	}
-}
-
-func sendNack(port serial.Port) error {
+func sendNack(t Transport) error {
 	// tells the PN532 there was a problem and to resend previous data
-	n, err := port.Write(nackFrame)
-	if err != nil {
-		return err
-	} else if n != len(nackFrame) {
-		return errors.New("nack write error, not all bytes written")
-	}
-
-	return port.Drain()
+	return t.Write(NackFrame)
 }
 
-func sendFrame(port serial.Port, cmd byte, args []byte) ([]byte, error) {
-	// create frame
+// BuildFrame wraps a command and its arguments in a normal information frame.
+func BuildFrame(cmd byte, args []byte) ([]byte, error) {
 	frm := []byte{0x00, 0x00, 0xFF} // preamble and start code
 
 	data := []byte{hostToPn532, cmd}
@@ -149,45 +65,41 @@ func sendFrame(port serial.Port, cmd byte, args []byte) ([]byte, error) {
 	frm = append(frm, ^checksum+1) // data checksum
 	frm = append(frm, 0x00)        // postamble
 
-	//log.Debug().Msgf("sending frame: %x", frm)
+	return frm, nil
+}
 
-	// write frame
-	err := wakeUp(port)
+func sendFrame(t Transport, cmd byte, args []byte) ([]byte, error) {
+	frm, err := BuildFrame(cmd, args)
 	if err != nil {
 		return []byte{}, err
 	}
 
-	n, err := port.Write(frm)
-	if err != nil {
-		return []byte{}, err
-	} else if n != len(frm) {
-		return []byte{}, errors.New("write error, not all bytes written")
-	}
+	//log.Debug().Msgf("sending frame: %x", frm)
 
-	err = port.Drain()
+	err = t.Write(frm)
 	if err != nil {
 		return []byte{}, err
 	}
 
-	return waitAck(port)
+	return t.WaitAck()
 }
 
-// Read a single frame from the serial port, returning the data part of the
+// Read a single frame from the transport, returning the data part of the
 // frame. Optionally accepts data to prepend to the read buffer and
 // treat as part of the potential frame.
-func receiveFrame(port serial.Port, pre []byte) ([]byte, error) {
+func receiveFrame(t Transport, pre []byte) ([]byte, error) {
 	tries := 0
 	maxTries := 3
 
 retry:
 	buf := make([]byte, 255+7)
+	start := 0
 	if tries == 0 {
 		// prepend any leftover response from a skipped ACK
-		buf = make([]byte, 255+7-len(pre))
-		buf = append(pre, buf...)
+		start = copy(buf, pre)
 	}
 
-	_, err := port.Read(buf)
+	_, err := t.Read(buf[start:])
 	if err != nil {
 		return []byte{}, err
 	}
@@ -207,11 +119,15 @@ retry:
 
 	// check frame length value and checksum (LEN)
 	off++
+	if off+1 >= len(buf) {
+		return []byte{}, ErrNoFrameFound
+	}
 	frameLen := int(buf[off])
-	if ((frameLen + int(buf[off+1])) & 0xFF) != 0 {
+	if frameLen == 0 || off+2+frameLen+1 > len(buf) ||
+		((frameLen+int(buf[off+1]))&0xFF) != 0 {
 		if tries < maxTries {
 			tries++
-			err := sendNack(port)
+			err := sendNack(t)
 			if err != nil {
 				return []byte{}, err
 			}
@@ -229,7 +145,7 @@ retry:
 	if chk != 0 {
 		if tries < maxTries {
 			tries++
-			err := sendNack(port)
+			err := sendNack(t)
 			if err != nil {
 				return []byte{}, err
 			}
@@ -244,7 +160,7 @@ retry:
 	if buf[off] != pn532ToHost {
 		if tries < maxTries {
 			tries++
-			err := sendNack(port)
+			err := sendNack(t)
 			if err != nil {
 				return []byte{}, err
 			}
@@ -267,11 +183,11 @@ retry:
 }
 
 func callCommand(
-	port serial.Port,
+	t Transport,
 	cmd byte,
 	data []byte,
 ) ([]byte, error) {
-	ackData, err := sendFrame(port, cmd, data)
+	ackData, err := sendFrame(t, cmd, data)
 	if err != nil {
 		return []byte{}, err
 	}
@@ -282,12 +198,12 @@ func callCommand(
 
 	time.Sleep(6 * time.Millisecond)
 
-	res, err := receiveFrame(port, ackData)
+	res, err := receiveFrame(t, ackData)
 	if err != nil {
 		return []byte{}, err
 	}
 
-	err = sendAck(port)
+	err = sendAck(t)
 	if err != nil {
 		return []byte{}, err
 	}
@@ -295,10 +211,10 @@ func callCommand(
 	return res, nil
 }
 
-func SamConfiguration(port serial.Port) error {
+func SamConfiguration(t Transport) error {
 	log.Debug().Msg("running sam configuration")
 	// sets pn532 to "normal" mode
-	res, err := callCommand(port, cmdSamConfiguration, []byte{0x01, 0x14, 0x01})
+	res, err := callCommand(t, cmdSamConfiguration, []byte{0x01, 0x14, 0x01})
 	if err != nil {
 		return err
 	} else if len(res) != 1 || res[0] != 0x15 {
@@ -308,6 +224,22 @@ func SamConfiguration(port serial.Port) error {
 	return nil
 }
 
+// SetPassiveActivationRetries limits how many times InListPassiveTarget
+// retries when no tag is present, so it returns instead of waiting for a tag
+// forever. Retries of 0xFF means forever.
+func SetPassiveActivationRetries(t Transport, retries byte) error {
+	log.Debug().Msg("running rfconfiguration")
+	// MxRtyATR, MxRtyPSL and MxRtyPassiveActivation
+	res, err := callCommand(t, cmdRfConfiguration, []byte{0x05, 0xFF, 0x01, retries})
+	if err != nil {
+		return err
+	} else if len(res) != 1 || res[0] != 0x33 {
+		return errors.New("unexpected rf configuration response")
+	}
+
+	return nil
+}
+
 type FirmwareVersion struct {
 	Version          string
 	SupportIso14443a bool
@@ -315,9 +247,9 @@ type FirmwareVersion struct {
 	SupportIso18092  bool
 }
 
-func GetFirmwareVersion(port serial.Port) (FirmwareVersion, error) {
+func GetFirmwareVersion(t Transport) (FirmwareVersion, error) {
 	log.Debug().Msg("running getfirmwareversion")
-	res, err := callCommand(port, cmdGetFirmwareVersion, []byte{})
+	res, err := callCommand(t, cmdGetFirmwareVersion, []byte{})
 	if err != nil {
 		return FirmwareVersion{}, err
 	} else if len(res) != 5 || res[0] != 0x03 {
@@ -343,9 +275,9 @@ type GeneralStatus struct {
 	FieldPresent bool
 }
 
-func GetGeneralStatus(port serial.Port) (GeneralStatus, error) {
+func GetGeneralStatus(t Transport) (GeneralStatus, error) {
 	log.Debug().Msg("running getgeneralstatus")
-	res, err := callCommand(port, cmdGetGeneralStatus, []byte{})
+	res, err := callCommand(t, cmdGetGeneralStatus, []byte{})
 	if err != nil {
 		return GeneralStatus{}, err
 	} else if len(res) < 4 || res[0] != 0x05 {
@@ -364,11 +296,13 @@ type Target struct {
 	Type     string
 	Uid      string
 	UidBytes []byte
+	// SEL_RES of the target, identifies the MIFARE Classic card size
+	Sak byte
 }
 
-func InListPassiveTarget(port serial.Port) (*Target, error) {
+func InListPassiveTarget(t Transport) (*Target, error) {
 	//log.Debug().Msg("running inlistpassivetarget")
-	res, err := callCommand(port, cmdInListPassiveTarget, []byte{0x01, 0x00})
+	res, err := callCommand(t, cmdInListPassiveTarget, []byte{0x01, 0x00})
 	if errors.Is(err, ErrNoFrameFound) {
 		// no tag detected
 		return nil, nil
@@ -390,22 +324,27 @@ func InListPassiveTarget(port serial.Port) (*Target, error) {
 	uidStr := fmt.Sprintf("%x", uid)
 
 	tagType := ""
-	if bytes.Equal(res[3:6], []byte{0x00, 0x04, 0x08}) {
+	if bytes.Equal(res[3:6], []byte{0x00, 0x04, 0x08}) ||
+		bytes.Equal(res[3:6], []byte{0x00, 0x02, 0x18}) {
 		tagType = tokens.TypeMifare
 	} else if bytes.Equal(res[3:6], []byte{0x00, 0x44, 0x00}) {
 		tagType = tokens.TypeNTAG
+	} else if res[5]&0x20 != 0 {
+		// ISO 14443-4 compliant, the PN532 has already sent RATS
+		tagType = tokens.TypeType4
 	}
 
 	return &Target{
 		Type:     tagType,
 		Uid:      uidStr,
 		UidBytes: uid,
+		Sak:      res[5],
 	}, nil
 }
 
-func InDataExchange(port serial.Port, data []byte) ([]byte, error) {
+func InDataExchange(t Transport, data []byte) ([]byte, error) {
 	log.Debug().Msg("running indataexchange")
-	res, err := callCommand(port, cmdInDataExchange, append([]byte{0x01}, data...))
+	res, err := callCommand(t, cmdInDataExchange, append([]byte{0x01}, data...))
 	if err != nil {
 		return []byte{}, err
 	} else if len(res) < 2 {
@@ -0,0 +1,173 @@
+package pn532
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/mifare"
+	"github.com/ZaparooProject/zaparoo-core/pkg/service/tokens"
+)
+
+// fakeTransport acknowledges every command frame and replies with queued
+// response frames in order.
+type fakeTransport struct {
+	written   [][]byte
+	responses [][]byte
+}
+
+func (t *fakeTransport) Write(frame []byte) error {
+	t.written = append(t.written, append([]byte{}, frame...))
+	return nil
+}
+
+func (t *fakeTransport) WaitAck() ([]byte, error) {
+	return nil, nil
+}
+
+func (t *fakeTransport) Read(buf []byte) (int, error) {
+	if len(t.responses) == 0 {
+		return 0, nil
+	}
+
+	res := t.responses[0]
+	t.responses = t.responses[1:]
+	return copy(buf, res), nil
+}
+
+func (t *fakeTransport) Close() error {
+	return nil
+}
+
+// responseFrame builds a PN532 to host frame with the given data.
+func responseFrame(data ...byte) []byte {
+	frm := []byte{0x00, 0x00, 0xFF}
+	body := append([]byte{pn532ToHost}, data...)
+	frm = append(frm, byte(len(body)), ^byte(len(body))+1)
+
+	chk := byte(0)
+	for _, b := range body {
+		frm = append(frm, b)
+		chk += b
+	}
+
+	return append(frm, ^chk+1, 0x00)
+}
+
+func TestBuildFrame(t *testing.T) {
+	frm, err := BuildFrame(cmdGetFirmwareVersion, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []byte{0x00, 0x00, 0xFF, 0x02, 0xFE, 0xD4, 0x02, 0x2A, 0x00}
+	if !bytes.Equal(frm, want) {
+		t.Fatalf("expected: %x, got: %x", want, frm)
+	}
+}
+
+func TestInListPassiveTarget(t *testing.T) {
+	ft := &fakeTransport{
+		responses: [][]byte{
+			responseFrame(
+				0x4B, 0x01, 0x01, 0x00, 0x44, 0x00, 0x07,
+				0x04, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66,
+			),
+		},
+	}
+
+	tgt, err := InListPassiveTarget(ft)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tgt == nil || tgt.Uid != "04112233445566" {
+		t.Fatalf("unexpected target: %+v", tgt)
+	}
+
+	// command frame, then the ACK after the response
+	if len(ft.written) != 2 || !bytes.Equal(ft.written[1], AckFrame) {
+		t.Fatalf("unexpected frames written: %x", ft.written)
+	}
+}
+
+func TestInListPassiveTargetNoTag(t *testing.T) {
+	ft := &fakeTransport{
+		responses: [][]byte{responseFrame(0x4B, 0x00)},
+	}
+
+	tgt, err := InListPassiveTarget(ft)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tgt != nil {
+		t.Fatalf("expected no target, got: %+v", tgt)
+	}
+}
+
+func TestReceiveFrameNack(t *testing.T) {
+	bad := responseFrame(0x41, 0x00)
+	bad[len(bad)-2]++
+
+	ft := &fakeTransport{
+		responses: [][]byte{bad, responseFrame(0x41, 0x00, 0xAA)},
+	}
+
+	res, err := InDataExchange(ft, []byte{0x30, 0x04})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(res, []byte{0x41, 0x00, 0xAA}) {
+		t.Fatalf("unexpected response: %x", res)
+	}
+
+	if !bytes.Equal(ft.written[1], NackFrame) {
+		t.Fatalf("expected NACK after bad checksum, got: %x", ft.written[1])
+	}
+}
+
+func TestInListPassiveTargetMifare4K(t *testing.T) {
+	ft := &fakeTransport{
+		responses: [][]byte{
+			responseFrame(0x4B, 0x01, 0x01, 0x00, 0x02, 0x18, 0x04, 0x11, 0x22, 0x33, 0x44),
+		},
+	}
+
+	tgt, err := InListPassiveTarget(ft)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tgt == nil || tgt.Type != tokens.TypeMifare || mifareSectorCount(tgt) != mifare.Sectors4K {
+		t.Fatalf("unexpected target: %+v", tgt)
+	}
+}
+
+func TestMifareAuthReselects(t *testing.T) {
+	uid := []byte{0x11, 0x22, 0x33, 0x44}
+	ft := &fakeTransport{
+		responses: [][]byte{
+			// authentication error, then the card is selected again
+			responseFrame(0x41, 0x14),
+			responseFrame(0x4B, 0x01, 0x01, 0x00, 0x04, 0x08, 0x04, 0x11, 0x22, 0x33, 0x44),
+		},
+	}
+
+	card := mifareCard{t: ft, uid: uid}
+	err := card.Auth(4, mifare.KeyTypeA, mifare.KeyFactory)
+	if err == nil {
+		t.Fatal("expected authentication to fail")
+	}
+
+	want := append([]byte{0x01, mifare.KeyTypeA, 0x04}, mifare.KeyFactory...)
+	want = append(want, uid...)
+	if !bytes.Contains(ft.written[0], want) {
+		t.Fatalf("unexpected auth command: %x", ft.written[0])
+	}
+
+	// auth command and ACK, then the select command
+	if len(ft.written) != 4 || !bytes.Contains(ft.written[2], []byte{cmdInListPassiveTarget}) {
+		t.Fatalf("expected card to be selected again: %x", ft.written)
+	}
+}
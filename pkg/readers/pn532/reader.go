@@ -0,0 +1,530 @@
+// Package pn532 implements the PN532 frame protocol and a reader driver
+// which is shared by all PN532 transports.
+package pn532
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/ZaparooProject/zaparoo-core/pkg/service/tokens"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ZaparooProject/zaparoo-core/pkg/config"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/mifare"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/ndef"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/type4"
+	"github.com/ZaparooProject/zaparoo-core/pkg/utils"
+	"github.com/rs/zerolog/log"
+)
+
+type writeRequestResult struct {
+	Token *tokens.Token
+	Err   error
+}
+
+type writeRequest struct {
+	Text    string
+	Options readers.WriteOptions
+	Status  func(readers.WriteStatus)
+	Result  chan writeRequestResult
+}
+
+// Driver describes how a reader connects to a PN532 over its transport.
+type Driver struct {
+	// Id is the reader ID used in device strings.
+	Id string
+	// Name is the human-readable name of the reader.
+	Name string
+	// Connect opens the transport to a device path. The PN532 is
+	// initialized by the reader.
+	Connect func(name string) (Transport, error)
+	// Detect returns the device string of an unconnected reader, or an
+	// empty string. Optional, readers without it must be configured.
+	Detect func(connected []string) string
+	// PollInterval is the delay between polls for a tag, defaults to
+	// defaultPollInterval.
+	PollInterval time.Duration
+}
+
+const defaultPollInterval = 250 * time.Millisecond
+
+// healthTimeout is how long a health check waits for the poll loop to
+// accept it and then for the PN532 to reply.
+const healthTimeout = 2 * time.Second
+
+type Reader struct {
+	cfg         *config.UserConfig
+	driver      Driver
+	device      string
+	name        string
+	polling     atomic.Bool
+	transport   Transport
+	lastToken   *tokens.Token
+	write       chan writeRequest
+	cancelWrite chan bool
+	health      chan chan error
+	// set while a write is waiting for or writing to a tag, the poll loop
+	// can't answer health checks until it's done
+	writing atomic.Bool
+	// error which made the reader close itself
+	errMu sync.Mutex
+	err   error
+}
+
+func NewReader(cfg *config.UserConfig, driver Driver) *Reader {
+	return &Reader{
+		cfg:         cfg,
+		driver:      driver,
+		write:       make(chan writeRequest),
+		cancelWrite: make(chan bool, 1),
+		health:      make(chan chan error),
+	}
+}
+
+func (r *Reader) Ids() []string {
+	return []string{r.driver.Id}
+}
+
+// Connect opens a transport to a device path and initializes the PN532.
+func Connect(open func(name string) (Transport, error), name string) (Transport, error) {
+	log.Debug().Msgf("connecting to %s", name)
+	t, err := open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	fv, err := Init(t)
+	if err != nil {
+		_ = t.Close()
+		return nil, err
+	}
+	log.Debug().Msgf("firmware version: %v", fv)
+
+	return t, nil
+}
+
+func (r *Reader) Open(device string, iq chan<- readers.Scan) error {
+	ps := strings.SplitN(device, ":", 2)
+	if len(ps) != 2 {
+		return errors.New("invalid device string: " + device)
+	}
+
+	if !utils.Contains(r.Ids(), ps[0]) {
+		return errors.New("invalid reader id: " + ps[0])
+	}
+
+	name := ps[1]
+
+	if runtime.GOOS != "windows" {
+		if _, err := os.Stat(name); err != nil {
+			return err
+		}
+	}
+
+	transport, err := Connect(r.driver.Connect, name)
+	if err != nil {
+		return err
+	}
+
+	r.transport = transport
+	r.device = device
+	r.name = name
+	r.setErr(nil)
+	r.polling.Store(true)
+
+	pollInterval := r.driver.PollInterval
+	if pollInterval == 0 {
+		pollInterval = defaultPollInterval
+	}
+
+	go func() {
+		errCount := 0
+		maxErrors := 5
+		zeroScans := 0
+		maxZeroScans := 3
+		var lastErr error
+
+		for r.polling.Load() {
+			if errCount >= maxErrors {
+				log.Error().Msg("too many errors, exiting")
+				r.setErr(fmt.Errorf("too many errors: %w", lastErr))
+				err := r.Close()
+				if err != nil {
+					log.Warn().Err(err).Msg("failed to close transport")
+				}
+				r.polling.Store(false)
+				break
+			}
+
+			time.Sleep(pollInterval)
+
+			select {
+			case req := <-r.write:
+				r.writeTag(req)
+			case req := <-r.health:
+				_, err := GetFirmwareVersion(r.transport)
+				req <- err
+			default:
+			}
+
+			tgt, err := InListPassiveTarget(r.transport)
+			if err != nil {
+				log.Error().Err(err).Msg("failed to read passive target")
+				lastErr = err
+				errCount++
+				continue
+			} else if tgt == nil {
+				zeroScans++
+
+				// token was removed
+				if zeroScans == maxZeroScans && r.lastToken != nil {
+					if r.lastToken != nil {
+						iq <- readers.Scan{
+							Source: r.device,
+							Token:  nil,
+						}
+						r.lastToken = nil
+					}
+				}
+
+				continue
+			}
+
+			log.Debug().Msgf("target: %s", tgt.Uid)
+
+			errCount = 0
+			zeroScans = 0
+
+			if r.lastToken != nil && r.lastToken.UID == tgt.Uid {
+				// same token
+				continue
+			}
+
+			var data []byte
+			if tgt.Type == tokens.TypeMifare {
+				data, err = readMifare(r.transport, tgt, mifare.ParseKeys(r.cfg.GetMifareKey()))
+				if err != nil {
+					log.Error().Err(err).Msg("failed to read mifare")
+					lastErr = err
+					errCount++
+				}
+			} else if tgt.Type == tokens.TypeType4 {
+				data, err = type4.ReadNdef(type4Transceive(r.transport))
+				if err != nil {
+					log.Error().Err(err).Msg("failed to read type 4 tag")
+				}
+			} else {
+				data, err = readNtag(r.transport)
+				if err != nil {
+					log.Error().Err(err).Msg("failed to read ntag")
+					lastErr = err
+					errCount++
+				}
+			}
+
+			token := r.newToken(tgt, data)
+			if tgt.Type == tokens.TypeNTAG {
+				token.Figure = readFigure(r.transport, tgt)
+			}
+
+			if !utils.TokensEqual(token, r.lastToken) {
+				iq <- readers.Scan{
+					Source: r.device,
+					Token:  token,
+				}
+			}
+
+			r.lastToken = token
+		}
+	}()
+
+	return nil
+}
+
+func (r *Reader) Close() error {
+	r.polling.Store(false)
+	if r.transport != nil {
+		err := r.transport.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Reader) Detect(connected []string) string {
+	if r.driver.Detect == nil {
+		return ""
+	}
+	return r.driver.Detect(connected)
+}
+
+func (r *Reader) Device() string {
+	return r.device
+}
+
+func (r *Reader) Connected() bool {
+	return r.polling.Load() && r.transport != nil
+}
+
+func (r *Reader) Info() string {
+	return r.driver.Name + " (" + r.name + ")"
+}
+
+func (r *Reader) Write(
+	text string,
+	opts readers.WriteOptions,
+	status func(readers.WriteStatus),
+) (*tokens.Token, error) {
+	if !r.Connected() {
+		return nil, errors.New("not connected")
+	}
+
+	// clear any cancel request left over from a previous write
+	select {
+	case <-r.cancelWrite:
+	default:
+	}
+
+	req := writeRequest{
+		Text:    text,
+		Options: opts,
+		Status:  status,
+		Result:  make(chan writeRequestResult),
+	}
+
+	r.writing.Store(true)
+	defer r.writing.Store(false)
+
+	r.write <- req
+
+	res := <-req.Result
+	if res.Err != nil {
+		log.Error().Msgf("error writing to tag: %s", res.Err)
+		return nil, res.Err
+	}
+
+	return res.Token, nil
+}
+
+func (r *Reader) CancelWrite() {
+	select {
+	case r.cancelWrite <- true:
+	default:
+	}
+}
+
+func (r *Reader) Capabilities() readers.Capabilities {
+	return readers.Capabilities{
+		Write:    true,
+		Removal:  true,
+		TagTypes: []string{tokens.TypeNTAG, tokens.TypeMifare, tokens.TypeType4},
+	}
+}
+
+// newToken builds a token from the data read from a target.
+func (r *Reader) newToken(tgt *Target, data []byte) *tokens.Token {
+	log.Debug().Msgf("record bytes: %s", hex.EncodeToString(data))
+
+	// NTAG data starts at the capability container page, MIFARE data at the
+	// TLV blocks and type 4 tags return the bare NDEF message
+	var records []ndef.Record
+	var err error
+	if tgt.Type == tokens.TypeType4 {
+		records, err = ndef.ParseMessage(data)
+	} else if tgt.Type == tokens.TypeMifare {
+		records, err = ndef.ParseRecords(data)
+	} else if len(data) > 4 {
+		records, err = ndef.ParseRecords(data[4:])
+	} else {
+		err = ndef.ErrNoMessage
+	}
+	if err != nil {
+		log.Error().Err(err).Msgf("error parsing NDEF record")
+		// TODO: there should be some distinction between a data
+		// transfer error and a legitimate empty/missing NDEF record
+	}
+
+	tagText := ndef.TokenText(records, r.cfg.GetUriStripPrefix())
+
+	if tagText == "" {
+		log.Warn().Msg("no text NDEF found")
+	} else {
+		log.Info().Msgf("decoded text NDEF: %s", tagText)
+	}
+
+	return &tokens.Token{
+		Type:     tgt.Type,
+		UID:      tgt.Uid,
+		Text:     tagText,
+		Data:     hex.EncodeToString(data),
+		ScanTime: time.Now(),
+		Source:   r.device,
+		Records:  records,
+	}
+}
+
+func (r *Reader) writeTag(req writeRequest) {
+	log.Info().Msgf("pn532 write request: %s", req.Text)
+
+	fail := func(err error) {
+		req.Status(readers.WriteStatus{
+			Device: r.device,
+			Status: readers.WriteStatusFailed,
+			Error:  err,
+		})
+		req.Result <- writeRequestResult{
+			Err: err,
+		}
+	}
+
+	req.Status(readers.WriteStatus{
+		Device: r.device,
+		Status: readers.WriteStatusWaiting,
+	})
+
+	var tgt *Target
+	tries := 4 * 30 // ~30 seconds
+
+	for tries > 0 && r.polling.Load() {
+		select {
+		case <-r.cancelWrite:
+			log.Info().Msg("write request cancelled")
+			fail(errors.New("write cancelled"))
+			return
+		default:
+		}
+
+		var err error
+		tgt, err = InListPassiveTarget(r.transport)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to read passive target")
+		} else if tgt != nil {
+			break
+		}
+
+		time.Sleep(250 * time.Millisecond)
+		tries--
+	}
+
+	if tgt == nil {
+		log.Error().Msgf("could not detect a tag")
+		fail(errors.New("could not detect a tag"))
+		return
+	}
+
+	log.Info().Msgf("found tag with UID: %s", tgt.Uid)
+
+	if tgt.Type != tokens.TypeNTAG && tgt.Type != tokens.TypeMifare {
+		fail(fmt.Errorf("unsupported tag type: %s", tgt.Type))
+		return
+	} else if tgt.Type == tokens.TypeMifare && req.Options.Protected() {
+		fail(errors.New("protection not supported on mifare tags"))
+		return
+	}
+
+	req.Status(readers.WriteStatus{
+		Device: r.device,
+		Status: readers.WriteStatusWriting,
+	})
+
+	var payload []byte
+	var data []byte
+	var err error
+	if tgt.Type == tokens.TypeMifare {
+		keys := mifare.ParseKeys(r.cfg.GetMifareKey())
+
+		payload, err = ndef.BuildMessage(req.Text)
+		if err == nil {
+			err = writeMifare(r.transport, tgt, keys, payload)
+		}
+		if err != nil {
+			log.Error().Msgf("error writing to mifare: %s", err)
+			fail(err)
+			return
+		}
+
+		data, err = readMifare(r.transport, tgt, keys)
+	} else {
+		payload, err = writeNtag(r.transport, req.Text, req.Options)
+		if err != nil {
+			log.Error().Msgf("error writing to ntag: %s", err)
+			fail(err)
+			return
+		}
+
+		data, err = readNtag(r.transport)
+	}
+	if err != nil {
+		log.Error().Msgf("error reading written tag: %s", err)
+		fail(err)
+		return
+	}
+
+	t := r.newToken(tgt, data)
+	if t.Text != req.Text {
+		log.Error().Msgf("text mismatch after write: %s != %s", t.Text, req.Text)
+		fail(errors.New("text mismatch after write"))
+		return
+	}
+
+	log.Info().Msgf("successfully wrote to card: %s", hex.EncodeToString(payload))
+	req.Status(readers.WriteStatus{
+		Device: r.device,
+		Status: readers.WriteStatusVerified,
+	})
+	req.Result <- writeRequestResult{
+		Token: t,
+	}
+}
+
+func (r *Reader) setErr(err error) {
+	r.errMu.Lock()
+	defer r.errMu.Unlock()
+	r.err = err
+}
+
+func (r *Reader) getErr() error {
+	r.errMu.Lock()
+	defer r.errMu.Unlock()
+	return r.err
+}
+
+// Health asks the PN532 for its firmware version. If the reader has closed
+// itself, the error which caused it is returned. A reader busy with a write
+// is healthy, the write fails by itself if the PN532 stops responding.
+func (r *Reader) Health() error {
+	if !r.Connected() {
+		if err := r.getErr(); err != nil {
+			return err
+		}
+		return readers.ErrNotConnected
+	}
+
+	if r.writing.Load() {
+		return nil
+	}
+
+	req := make(chan error, 1)
+	select {
+	case r.health <- req:
+	case <-time.After(healthTimeout):
+		return errors.New("timed out waiting for poll loop")
+	}
+
+	select {
+	case err := <-req:
+		if err != nil {
+			return fmt.Errorf("firmware version check failed: %w", err)
+		}
+		return nil
+	case <-time.After(healthTimeout):
+		return errors.New("timed out waiting for firmware version")
+	}
+}
@@ -0,0 +1,47 @@
+package pn532
+
+// StatusReady is the status byte sent by the PN532 over I2C and SPI when a
+// response is ready to be read.
+const StatusReady = 0x01
+
+// passiveActivationRetries is low so polling for a tag returns quickly when
+// none is present.
+const passiveActivationRetries = 0x02
+
+// Transport is the physical link to a PN532, like UART, I2C or SPI. The
+// frame protocol is the same for all of them, only how bytes are moved and
+// how the host knows a response is ready differs.
+type Transport interface {
+	// Write sends a complete frame to the PN532, waking it up first if the
+	// link requires it.
+	Write(frame []byte) error
+	// WaitAck blocks until the PN532 acknowledges the last frame written.
+	// Any data received before the ACK is returned so it can be treated as
+	// part of the response.
+	WaitAck() ([]byte, error)
+	// Read reads a response frame into buf. If no response is ready before
+	// the link's timeout, no bytes are read and no error is returned.
+	Read(buf []byte) (int, error)
+	Close() error
+}
+
+// Init configures a newly connected PN532 for reading tags and checks it
+// responds like a PN532.
+func Init(t Transport) (FirmwareVersion, error) {
+	err := SamConfiguration(t)
+	if err != nil {
+		return FirmwareVersion{}, err
+	}
+
+	fv, err := GetFirmwareVersion(t)
+	if err != nil {
+		return fv, err
+	}
+
+	err = SetPassiveActivationRetries(t, passiveActivationRetries)
+	if err != nil {
+		return fv, err
+	}
+
+	return fv, nil
+}
@@ -0,0 +1,20 @@
+// Package pn532_i2c is a native driver for PN532 boards connected to a Linux
+// I2C bus, without libnfc.
+package pn532_i2c
+
+import (
+	"github.com/ZaparooProject/zaparoo-core/pkg/config"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/pn532"
+)
+
+// I2C devices can't be detected safely, they must be set in the config,
+// e.g. pn532_i2c:/dev/i2c-1.
+var driver = pn532.Driver{
+	Id:      "pn532_i2c",
+	Name:    "PN532 I2C",
+	Connect: connect,
+}
+
+func NewReader(cfg *config.UserConfig) *pn532.Reader {
+	return pn532.NewReader(cfg, driver)
+}
@@ -0,0 +1,126 @@
+//go:build linux
+
+package pn532_i2c
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/pn532"
+)
+
+const (
+	// from linux/i2c-dev.h
+	ioctlI2cSlave = 0x0703
+	// 7-bit address of the PN532
+	pn532Address = 0x24
+	readyTimeout = 100 * time.Millisecond
+	readyPoll    = time.Millisecond
+)
+
+// i2cTransport moves PN532 frames over an I2C bus. Every read from the
+// PN532 starts with a status byte, which is set once a response is ready.
+type i2cTransport struct {
+	dev *os.File
+}
+
+func connect(name string) (pn532.Transport, error) {
+	dev, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	_, _, errno := syscall.Syscall(
+		syscall.SYS_IOCTL,
+		dev.Fd(),
+		ioctlI2cSlave,
+		pn532Address,
+	)
+	if errno != 0 {
+		_ = dev.Close()
+		return nil, fmt.Errorf("error setting i2c address: %w", errno)
+	}
+
+	return &i2cTransport{dev: dev}, nil
+}
+
+func (t *i2cTransport) Write(frame []byte) error {
+	n, err := t.dev.Write(frame)
+	if err != nil {
+		// the first transaction after power down wakes the PN532 up and
+		// may not be acknowledged
+		time.Sleep(2 * time.Millisecond)
+		n, err = t.dev.Write(frame)
+	}
+	if err != nil {
+		return err
+	} else if n != len(frame) {
+		return errors.New("write error, not all bytes written")
+	}
+
+	return nil
+}
+
+// ready polls the status byte until a response is ready or the timeout is
+// reached.
+func (t *i2cTransport) ready() (bool, error) {
+	status := make([]byte, 1)
+	deadline := time.Now().Add(readyTimeout)
+
+	for time.Now().Before(deadline) {
+		_, err := t.dev.Read(status)
+		if err != nil {
+			return false, err
+		} else if status[0]&pn532.StatusReady != 0 {
+			return true, nil
+		}
+
+		time.Sleep(readyPoll)
+	}
+
+	return false, nil
+}
+
+// read reads a response once it's ready, without the status byte.
+func (t *i2cTransport) read(buf []byte) (int, error) {
+	ok, err := t.ready()
+	if err != nil || !ok {
+		return 0, err
+	}
+
+	res := make([]byte, len(buf)+1)
+	n, err := t.dev.Read(res)
+	if err != nil {
+		return 0, err
+	} else if n == 0 {
+		return 0, nil
+	}
+
+	return copy(buf, res[1:n]), nil
+}
+
+func (t *i2cTransport) WaitAck() ([]byte, error) {
+	ack := make([]byte, len(pn532.AckFrame))
+	n, err := t.read(ack)
+	if err != nil {
+		return nil, err
+	} else if n == 0 {
+		return nil, pn532.ErrAckTimeout
+	} else if !bytes.Equal(ack[:n], pn532.AckFrame) {
+		return nil, fmt.Errorf("invalid ACK frame: %x", ack[:n])
+	}
+
+	return nil, nil
+}
+
+func (t *i2cTransport) Read(buf []byte) (int, error) {
+	return t.read(buf)
+}
+
+func (t *i2cTransport) Close() error {
+	return t.dev.Close()
+}
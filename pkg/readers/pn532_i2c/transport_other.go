@@ -0,0 +1,13 @@
+//go:build !linux
+
+package pn532_i2c
+
+import (
+	"errors"
+
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/pn532"
+)
+
+func connect(_ string) (pn532.Transport, error) {
+	return nil, errors.New("i2c is only supported on linux")
+}
@@ -0,0 +1,20 @@
+// Package pn532_spi is a native driver for PN532 boards connected to a Linux
+// spidev device, without libnfc.
+package pn532_spi
+
+import (
+	"github.com/ZaparooProject/zaparoo-core/pkg/config"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/pn532"
+)
+
+// SPI devices can't be detected safely, they must be set in the config,
+// e.g. pn532_spi:/dev/spidev0.0.
+var driver = pn532.Driver{
+	Id:      "pn532_spi",
+	Name:    "PN532 SPI",
+	Connect: connect,
+}
+
+func NewReader(cfg *config.UserConfig) *pn532.Reader {
+	return pn532.NewReader(cfg, driver)
+}
@@ -0,0 +1,182 @@
+//go:build linux
+
+package pn532_spi
+
+import (
+	"bytes"
+	"fmt"
+	"math/bits"
+	"os"
+	"runtime"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/pn532"
+)
+
+const (
+	// from linux/spi/spidev.h
+	ioctlSpiWrMode     = 0x40016B01
+	ioctlSpiWrMaxSpeed = 0x40046B04
+	ioctlSpiMessageOne = 0x40206B00
+	spiMode0           = 0x00
+	spiSpeedHz         = 1000000
+	spiBitsPerWord     = 8
+	readyTimeout       = 100 * time.Millisecond
+	readyPoll          = time.Millisecond
+	spiDataWrite       = 0x01
+	spiStatusRead      = 0x02
+	spiDataRead        = 0x03
+)
+
+// spiIocTransfer is struct spi_ioc_transfer from linux/spi/spidev.h.
+type spiIocTransfer struct {
+	txBuf          uint64
+	rxBuf          uint64
+	length         uint32
+	speedHz        uint32
+	delayUsecs     uint16
+	bitsPerWord    uint8
+	csChange       uint8
+	txNbits        uint8
+	rxNbits        uint8
+	wordDelayUsecs uint8
+	pad            uint8
+}
+
+// spiTransport moves PN532 frames over SPI. Every transfer starts with a
+// byte saying if it's a data write, status read or data read.
+type spiTransport struct {
+	dev *os.File
+}
+
+func ioctl(fd uintptr, req uintptr, arg uintptr) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, arg)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func connect(name string) (pn532.Transport, error) {
+	dev, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	mode := uint8(spiMode0)
+	err = ioctl(dev.Fd(), ioctlSpiWrMode, uintptr(unsafe.Pointer(&mode)))
+	if err != nil {
+		_ = dev.Close()
+		return nil, fmt.Errorf("error setting spi mode: %w", err)
+	}
+
+	speed := uint32(spiSpeedHz)
+	err = ioctl(dev.Fd(), ioctlSpiWrMaxSpeed, uintptr(unsafe.Pointer(&speed)))
+	if err != nil {
+		_ = dev.Close()
+		return nil, fmt.Errorf("error setting spi speed: %w", err)
+	}
+
+	return &spiTransport{dev: dev}, nil
+}
+
+// reverseBits converts between MSB and LSB first. The PN532 is LSB first,
+// which most spidev drivers don't support directly.
+func reverseBits(data []byte) []byte {
+	out := make([]byte, len(data))
+	for i, b := range data {
+		out[i] = bits.Reverse8(b)
+	}
+	return out
+}
+
+// transfer does a full duplex transfer with chip select held for its whole
+// length.
+func (t *spiTransport) transfer(tx []byte) ([]byte, error) {
+	if len(tx) == 0 {
+		return nil, nil
+	}
+
+	txBuf := reverseBits(tx)
+	rxBuf := make([]byte, len(tx))
+
+	xfer := spiIocTransfer{
+		txBuf:       uint64(uintptr(unsafe.Pointer(&txBuf[0]))),
+		rxBuf:       uint64(uintptr(unsafe.Pointer(&rxBuf[0]))),
+		length:      uint32(len(tx)),
+		speedHz:     spiSpeedHz,
+		bitsPerWord: spiBitsPerWord,
+	}
+
+	err := ioctl(t.dev.Fd(), ioctlSpiMessageOne, uintptr(unsafe.Pointer(&xfer)))
+	runtime.KeepAlive(txBuf)
+	runtime.KeepAlive(rxBuf)
+	if err != nil {
+		return nil, err
+	}
+
+	return reverseBits(rxBuf), nil
+}
+
+func (t *spiTransport) Write(frame []byte) error {
+	_, err := t.transfer(append([]byte{spiDataWrite}, frame...))
+	return err
+}
+
+// ready polls the status until a response is ready or the timeout is
+// reached.
+func (t *spiTransport) ready() (bool, error) {
+	deadline := time.Now().Add(readyTimeout)
+
+	for time.Now().Before(deadline) {
+		res, err := t.transfer([]byte{spiStatusRead, 0x00})
+		if err != nil {
+			return false, err
+		} else if res[1]&pn532.StatusReady != 0 {
+			return true, nil
+		}
+
+		time.Sleep(readyPoll)
+	}
+
+	return false, nil
+}
+
+// read reads a response once it's ready.
+func (t *spiTransport) read(buf []byte) (int, error) {
+	ok, err := t.ready()
+	if err != nil || !ok {
+		return 0, err
+	}
+
+	res, err := t.transfer(append([]byte{spiDataRead}, make([]byte, len(buf))...))
+	if err != nil {
+		return 0, err
+	}
+
+	return copy(buf, res[1:]), nil
+}
+
+func (t *spiTransport) WaitAck() ([]byte, error) {
+	ack := make([]byte, len(pn532.AckFrame))
+	n, err := t.read(ack)
+	if err != nil {
+		return nil, err
+	} else if n == 0 {
+		return nil, pn532.ErrAckTimeout
+	} else if !bytes.Equal(ack[:n], pn532.AckFrame) {
+		return nil, fmt.Errorf("invalid ACK frame: %x", ack[:n])
+	}
+
+	return nil, nil
+}
+
+func (t *spiTransport) Read(buf []byte) (int, error) {
+	return t.read(buf)
+}
+
+func (t *spiTransport) Close() error {
+	return t.dev.Close()
+}
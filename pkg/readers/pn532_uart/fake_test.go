@@ -0,0 +1,216 @@
+package pn532_uart
+
+import (
+	"bytes"
+	"sync"
+	"time"
+
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/pn532"
+	"go.bug.st/serial"
+)
+
+const (
+	fakeNtagPages = 45 // NTAG213
+	fakeCmdRead   = 0x30
+	fakeCmdWrite  = 0xA2
+)
+
+var fakeErrorFrame = []byte{0x00, 0x00, 0xFF, 0x01, 0xFF, 0x7F, 0x81, 0x00}
+
+// fakeNtag is an NTAG213 in the field of a fakePn532.
+type fakeNtag struct {
+	uid   []byte
+	pages [fakeNtagPages][4]byte
+}
+
+func newFakeNtag(uid []byte) *fakeNtag {
+	tag := &fakeNtag{uid: uid}
+	tag.pages[3] = [4]byte{0xE1, 0x10, 0x12, 0x00}
+	// CFG0 with AUTH0 past the end, password protection disabled
+	tag.pages[0x29] = [4]byte{0x04, 0x00, 0x00, 0xFF}
+	return tag
+}
+
+// fakePn532 is an in-memory serial port which behaves like a PN532 on the
+// other end, speaking the frame protocol. Commands are handled as soon as
+// their frame has been written.
+type fakePn532 struct {
+	mu      sync.Mutex
+	in      []byte
+	out     []byte
+	last    []byte
+	tag     *fakeNtag
+	errors  int
+	closed  bool
+	written int
+}
+
+var _ serial.Port = (*fakePn532)(nil)
+
+// setTag places a tag in the field, or removes it if nil.
+func (f *fakePn532) setTag(tag *fakeNtag) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.tag = tag
+}
+
+// failNext makes the next n commands reply with an error frame.
+func (f *fakePn532) failNext(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.errors = n
+}
+
+func (f *fakePn532) isClosed() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.closed
+}
+
+func (f *fakePn532) pagesWritten() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.written
+}
+
+func (f *fakePn532) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.in = append(f.in, p...)
+	f.process()
+
+	return len(p), nil
+}
+
+// process handles any complete frames in the input buffer.
+func (f *fakePn532) process() {
+	for {
+		start := bytes.Index(f.in, []byte{0x00, 0xFF})
+		if start < 0 || len(f.in) < start+4 {
+			return
+		}
+
+		frm := f.in[start+2:]
+		switch {
+		case frm[0] == 0x00 && frm[1] == 0xFF:
+			// ACK from the host
+			f.in = f.in[start+4:]
+			continue
+		case frm[0] == 0xFF && frm[1] == 0x00:
+			// NACK, resend the last response
+			f.in = f.in[start+4:]
+			f.out = append(f.out, f.last...)
+			continue
+		}
+
+		length := int(frm[0])
+		if len(frm) < 2+length+2 {
+			return
+		}
+
+		data := frm[2 : 2+length]
+		f.in = frm[2+length+2:]
+
+		f.out = append(f.out, pn532.AckFrame...)
+		if f.errors > 0 {
+			f.errors--
+			f.last = fakeErrorFrame
+		} else {
+			f.last = fakeResponseFrame(f.command(data[1], data[2:]))
+		}
+		f.out = append(f.out, f.last...)
+	}
+}
+
+func fakeResponseFrame(data []byte) []byte {
+	frm := []byte{0x00, 0x00, 0xFF}
+	body := append([]byte{0xD5}, data...)
+	frm = append(frm, byte(len(body)), ^byte(len(body))+1)
+
+	chk := byte(0)
+	for _, b := range body {
+		frm = append(frm, b)
+		chk += b
+	}
+
+	return append(frm, ^chk+1, 0x00)
+}
+
+// command returns the response data of a command, without the TFI.
+func (f *fakePn532) command(cmd byte, args []byte) []byte {
+	switch cmd {
+	case 0x02:
+		return []byte{0x03, 0x32, 0x01, 0x06, 0x07}
+	case 0x14:
+		return []byte{0x15}
+	case 0x32:
+		return []byte{0x33}
+	case 0x4A:
+		if f.tag == nil {
+			return []byte{0x4B, 0x00}
+		}
+		res := []byte{0x4B, 0x01, 0x01, 0x00, 0x44, 0x00, byte(len(f.tag.uid))}
+		return append(res, f.tag.uid...)
+	case 0x40:
+		return append([]byte{0x41}, f.exchange(args[1:])...)
+	}
+
+	return []byte{cmd + 1}
+}
+
+// exchange handles a command sent to the tag, returning the status byte
+// and response.
+func (f *fakePn532) exchange(tx []byte) []byte {
+	if f.tag == nil || len(tx) < 2 {
+		// timeout
+		return []byte{0x01}
+	}
+
+	page := int(tx[1])
+	if page >= fakeNtagPages {
+		return []byte{0x01}
+	}
+
+	switch tx[0] {
+	case fakeCmdRead:
+		res := []byte{0x00}
+		for i := 0; i < 4; i++ {
+			p := f.tag.pages[(page+i)%fakeNtagPages]
+			res = append(res, p[:]...)
+		}
+		return res
+	case fakeCmdWrite:
+		copy(f.tag.pages[page][:], tx[2:6])
+		f.written++
+		return []byte{0x00}
+	}
+
+	return []byte{0x01}
+}
+
+func (f *fakePn532) Read(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	n := copy(p, f.out)
+	f.out = f.out[n:]
+	return n, nil
+}
+
+func (f *fakePn532) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	return nil
+}
+
+func (f *fakePn532) SetMode(_ *serial.Mode) error                         { return nil }
+func (f *fakePn532) Drain() error                                         { return nil }
+func (f *fakePn532) ResetInputBuffer() error                              { return nil }
+func (f *fakePn532) ResetOutputBuffer() error                             { return nil }
+func (f *fakePn532) SetDTR(_ bool) error                                  { return nil }
+func (f *fakePn532) SetRTS(_ bool) error                                  { return nil }
+func (f *fakePn532) SetReadTimeout(_ time.Duration) error                 { return nil }
+func (f *fakePn532) Break(_ time.Duration) error                          { return nil }
+func (f *fakePn532) GetModemStatusBits() (*serial.ModemStatusBits, error) { return nil, nil }
@@ -0,0 +1,239 @@
+package pn532_uart
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ZaparooProject/zaparoo-core/pkg/config"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/ndef"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/pn532"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/readertest"
+)
+
+var testUid = []byte{0x04, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66}
+
+// openFakeReader opens a reader whose transport talks to a fake PN532,
+// polling much faster than real hardware needs.
+func openFakeReader(t *testing.T, fake *fakePn532) (*pn532.Reader, chan readers.Scan) {
+	t.Helper()
+
+	r := pn532.NewReader(&config.UserConfig{}, pn532.Driver{
+		Id:   driver.Id,
+		Name: driver.Name,
+		Connect: func(_ string) (pn532.Transport, error) {
+			return NewTransport(fake), nil
+		},
+		PollInterval: time.Millisecond,
+	})
+
+	name := readertest.DevicePath(t, "ttyUSB0")
+	return r, readertest.Open(t, r, driver.Id+":"+name)
+}
+
+// writeText stores an NDEF text record on the tag, starting at page 4.
+func writeText(t *testing.T, tag *fakeNtag, text string) {
+	t.Helper()
+
+	payload, err := ndef.BuildMessage(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < len(payload); i += 4 {
+		copy(tag.pages[4+i/4][:], payload[i:])
+	}
+}
+
+func TestReaderScanAndRemove(t *testing.T) {
+	fake := &fakePn532{}
+	_, scans := openFakeReader(t, fake)
+
+	tag := newFakeNtag(testUid)
+	writeText(t, tag, "**launch.random:snes")
+	fake.setTag(tag)
+
+	scan := readertest.WaitScan(t, scans)
+	if scan.Token == nil {
+		t.Fatal("expected token")
+	}
+
+	if scan.Token.UID != "04112233445566" || scan.Token.Text != "**launch.random:snes" {
+		t.Fatalf("unexpected token: %+v", scan.Token)
+	}
+
+	fake.setTag(nil)
+
+	scan = readertest.WaitScan(t, scans)
+	if scan.Token != nil {
+		t.Fatalf("expected removal, got: %+v", scan.Token)
+	}
+}
+
+func TestReaderSameTagNotRepeated(t *testing.T) {
+	fake := &fakePn532{}
+	_, scans := openFakeReader(t, fake)
+
+	fake.setTag(newFakeNtag(testUid))
+	readertest.WaitScan(t, scans)
+
+	// let the reader poll the same tag a few more times
+	time.Sleep(50 * time.Millisecond)
+
+	select {
+	case scan := <-scans:
+		t.Fatalf("unexpected scan: %+v", scan)
+	default:
+	}
+}
+
+func TestReaderRecoversFromErrors(t *testing.T) {
+	fake := &fakePn532{}
+	r, scans := openFakeReader(t, fake)
+
+	// fewer errors than the limit in a row
+	fake.failNext(3)
+	fake.setTag(newFakeNtag(testUid))
+
+	scan := readertest.WaitScan(t, scans)
+	if scan.Token == nil {
+		t.Fatal("expected token")
+	}
+
+	if !r.Connected() {
+		t.Fatal("expected reader to still be connected")
+	}
+}
+
+func TestReaderMaxErrors(t *testing.T) {
+	fake := &fakePn532{}
+	r, _ := openFakeReader(t, fake)
+
+	fake.failNext(1000)
+
+	readertest.WaitFor(t, func() bool {
+		return !r.Connected()
+	})
+
+	if !fake.isClosed() {
+		t.Fatal("expected serial port to be closed")
+	}
+
+	err := r.Health()
+	if err == nil || !strings.Contains(err.Error(), "too many errors") {
+		t.Errorf("health = %v, want too many errors", err)
+	}
+}
+
+func TestReaderHealth(t *testing.T) {
+	fake := &fakePn532{}
+	r, _ := openFakeReader(t, fake)
+
+	err := r.Health()
+	if err != nil {
+		t.Fatalf("unexpected health error: %s", err)
+	}
+
+	err = r.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !errors.Is(r.Health(), readers.ErrNotConnected) {
+		t.Errorf("health = %v, want %v", r.Health(), readers.ErrNotConnected)
+	}
+}
+
+func TestReaderWrite(t *testing.T) {
+	fake := &fakePn532{}
+	r, _ := openFakeReader(t, fake)
+
+	tag := newFakeNtag(testUid)
+	fake.setTag(tag)
+
+	var statuses []string
+	token, err := r.Write("**launch.random", readers.WriteOptions{}, func(s readers.WriteStatus) {
+		statuses = append(statuses, s.Status)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token.Text != "**launch.random" {
+		t.Fatalf("unexpected token: %+v", token)
+	}
+
+	if fake.pagesWritten() == 0 {
+		t.Fatal("expected pages to be written")
+	}
+
+	want := []string{
+		readers.WriteStatusWaiting,
+		readers.WriteStatusWriting,
+		readers.WriteStatusVerified,
+	}
+	if len(statuses) != len(want) {
+		t.Fatalf("unexpected statuses: %v", statuses)
+	}
+	for i := range want {
+		if statuses[i] != want[i] {
+			t.Fatalf("unexpected statuses: %v", statuses)
+		}
+	}
+}
+
+func TestReaderWriteCancel(t *testing.T) {
+	fake := &fakePn532{}
+	r, _ := openFakeReader(t, fake)
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		r.CancelWrite()
+	}()
+
+	_, err := r.Write("**launch.random", readers.WriteOptions{}, func(readers.WriteStatus) {})
+	if err == nil {
+		t.Fatal("expected cancelled write to fail")
+	}
+
+	if fake.pagesWritten() != 0 {
+		t.Fatal("expected no pages to be written")
+	}
+}
+
+func TestReaderHealthDuringWrite(t *testing.T) {
+	fake := &fakePn532{}
+	r, _ := openFakeReader(t, fake)
+
+	waiting := make(chan struct{}, 1)
+	done := make(chan error, 1)
+	go func() {
+		_, err := r.Write("**launch.random", readers.WriteOptions{}, func(s readers.WriteStatus) {
+			if s.Status == readers.WriteStatusWaiting {
+				waiting <- struct{}{}
+			}
+		})
+		done <- err
+	}()
+
+	select {
+	case <-waiting:
+	case <-time.After(readertest.Timeout):
+		t.Fatal("timed out waiting for write")
+	}
+
+	// the poll loop is busy waiting for a tag, which is still healthy
+	err := r.Health()
+	if err != nil {
+		t.Fatalf("unexpected health error during write: %s", err)
+	}
+
+	r.CancelWrite()
+	select {
+	case <-done:
+	case <-time.After(readertest.Timeout):
+		t.Fatal("timed out waiting for write to be cancelled")
+	}
+}
@@ -0,0 +1,109 @@
+package pn532_uart
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/pn532"
+	"go.bug.st/serial"
+)
+
+// uartTransport moves PN532 frames over a serial port.
+type uartTransport struct {
+	port serial.Port
+}
+
+// NewTransport wraps an open serial port as a PN532 transport.
+func NewTransport(port serial.Port) pn532.Transport {
+	return &uartTransport{port: port}
+}
+
+func (t *uartTransport) wakeUp() error {
+	// over uart, pn532 must be (to be safe) "woken up" by sending a 0x55
+	// dummy byte and then waiting for some amount of time
+
+	n, err := t.port.Write([]byte{
+		0x55, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00,
+	})
+	if err != nil {
+		return err
+	} else if n != 16 {
+		return errors.New("wakeup write error, not all bytes written")
+	}
+
+	return t.port.Drain()
+}
+
+func (t *uartTransport) Write(frame []byte) error {
+	// ACK and NACK frames are replies to the PN532, it's already awake
+	if !bytes.Equal(frame, pn532.AckFrame) && !bytes.Equal(frame, pn532.NackFrame) {
+		err := t.wakeUp()
+		if err != nil {
+			return err
+		}
+	}
+
+	n, err := t.port.Write(frame)
+	if err != nil {
+		return err
+	} else if n != len(frame) {
+		return errors.New("write error, not all bytes written")
+	}
+
+	return t.port.Drain()
+}
+
+// Block and wait to receive an ACK frame on the serial port, returning any
+// extra data that was received before the ACK frame. Data before the ACK frame
+// is not to spec, but is an odd bug happening on Windows.
+func (t *uartTransport) WaitAck() ([]byte, error) {
+	// pn532 will send this sequence to acknowledge it received
+	// the previous command
+
+	tries := 0
+	maxTries := 64 // bytes to scan through
+
+	buf := make([]byte, 1)
+	ackBuf := make([]byte, 0)
+	preAck := make([]byte, 0)
+
+	for {
+		if tries >= maxTries {
+			return preAck, pn532.ErrAckTimeout
+		}
+
+		n, err := t.port.Read(buf)
+		if err != nil {
+			return preAck, err
+		} else if n == 0 {
+			tries++
+			continue
+		}
+
+		ackBuf = append(ackBuf, buf[0])
+		if len(ackBuf) < 6 {
+			continue
+		}
+
+		// log.Debug().Msgf("inspecting ack: %x", ackBuf)
+
+		if bytes.Equal(ackBuf, pn532.AckFrame) {
+			return preAck, nil
+		} else {
+			preAck = append(preAck, ackBuf[0])
+			ackBuf = ackBuf[1:]
+			tries++
+			continue
+		}
+	}
+}
+
+func (t *uartTransport) Read(buf []byte) (int, error) {
+	return t.port.Read(buf)
+}
+
+func (t *uartTransport) Close() error {
+	return t.port.Close()
+}
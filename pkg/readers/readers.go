@@ -1,15 +1,64 @@
 package readers
 
 import (
+	"errors"
+
 	"github.com/ZaparooProject/zaparoo-core/pkg/service/tokens"
 )
 
+var ErrNotConnected = errors.New("reader not connected")
+
 type Scan struct {
 	Source string
 	Token  *tokens.Token
 	Error  error
 }
 
+const (
+	WriteStatusWaiting  = "waiting"
+	WriteStatusWriting  = "writing"
+	WriteStatusVerified = "verified"
+	WriteStatusFailed   = "failed"
+)
+
+// WriteStatus reports the progress of a write request on a reader.
+type WriteStatus struct {
+	Device string
+	Status string
+	Error  error
+}
+
+// Capabilities describes the features supported by a reader driver.
+type Capabilities struct {
+	// Write is true if the reader can write tokens.
+	Write bool
+	// Removal is true if the reader can detect when a token is removed.
+	Removal bool
+	// TagTypes lists the token types the reader is able to read.
+	TagTypes []string
+}
+
+// WriteOptions are protection settings applied to a token after it has been
+// written. Only NTAG21x tokens support protection.
+type WriteOptions struct {
+	// Password is the 4 byte NTAG21x password. If set, writes to the token
+	// require authentication with the password.
+	Password []byte
+	// Pack is the 2 byte acknowledgement returned by the token after a
+	// successful authentication.
+	Pack []byte
+	// ProtectFrom is the first page protected by the password. Zero means
+	// from the first user page.
+	ProtectFrom byte
+	// Lock permanently makes the token read-only.
+	Lock bool
+}
+
+// Protected returns true if any protection has been requested.
+func (o WriteOptions) Protected() bool {
+	return len(o.Password) > 0 || o.Lock
+}
+
 type Reader interface {
 	// TODO: type? file, libnfc, etc.
 	// Ids returns the device string prefixes supported by this reader.
@@ -31,5 +80,15 @@ type Reader interface {
 	Info() string
 	// Write sends a string to the device to be written to a token, if
 	// that device supports writing. Blocks until completion or timeout.
-	Write(string) (*tokens.Token, error)
+	// Protection options are applied once the text has been written.
+	// Progress of the write is reported to the given status function.
+	Write(string, WriteOptions, func(WriteStatus)) (*tokens.Token, error)
+	// CancelWrite stops any write currently waiting on the device.
+	CancelWrite()
+	// Capabilities returns the features supported by the reader.
+	Capabilities() Capabilities
+	// Health checks the device is still responding, if the reader is able
+	// to, and returns the reason it isn't. Readers which have closed
+	// themselves return the error which caused it.
+	Health() error
 }
@@ -0,0 +1,75 @@
+// Package readertest provides helpers for testing reader drivers against
+// fake devices.
+package readertest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers"
+)
+
+// Timeout is how long tests wait for a reader to do something before
+// failing.
+const Timeout = 5 * time.Second
+
+// DevicePath creates an empty file with the given name in a temp
+// directory. Readers check their device path exists before opening it, so
+// the file stands in for a serial port or input device.
+func DevicePath(t *testing.T, name string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	err := os.WriteFile(path, nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// Open opens a reader on a device and closes it when the test ends. The
+// returned channel is buffered so tests can check scans after the fact.
+func Open(t *testing.T, r readers.Reader, device string) chan readers.Scan {
+	t.Helper()
+
+	scans := make(chan readers.Scan, 10)
+	err := r.Open(device, scans)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = r.Close()
+	})
+
+	return scans
+}
+
+// WaitScan returns the next scan sent by a reader.
+func WaitScan(t *testing.T, scans <-chan readers.Scan) readers.Scan {
+	t.Helper()
+
+	select {
+	case scan := <-scans:
+		return scan
+	case <-time.After(Timeout):
+		t.Fatal("timed out waiting for scan")
+	}
+
+	return readers.Scan{}
+}
+
+// WaitFor waits until the condition is true.
+func WaitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(Timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,134 @@
+package readers
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var comPortRe = regexp.MustCompile(`(?i)^(\\\\\.\\)?(COM\d+)$`)
+
+// DevicePath returns the local device path in a device connection string,
+// e.g. /dev/ttyUSB0 in both pn532_uart:/dev/ttyUSB0 and
+// simple_serial:/dev/ttyUSB0:115200. An empty string is returned if the
+// device doesn't refer to a local path, like a network address.
+func DevicePath(device string) string {
+	ps := strings.Split(device, ":")
+	if len(ps) < 2 {
+		return ""
+	}
+
+	// the first part is always the reader id
+	for i := 1; i < len(ps); i++ {
+		p := ps[i]
+
+		if comPortRe.MatchString(p) {
+			return p
+		}
+
+		// windows paths with a drive letter have been split at the colon
+		if len(p) == 1 && i+1 < len(ps) &&
+			(strings.HasPrefix(ps[i+1], `\`) || strings.HasPrefix(ps[i+1], "/")) {
+			return p + ":" + ps[i+1]
+		}
+
+		if strings.HasPrefix(p, "/") {
+			return p
+		}
+	}
+
+	return ""
+}
+
+// CanonicalPath returns a device path with any symlinks resolved, such as
+// the links in /dev/serial/by-id, so the same physical device always has
+// the same path. Windows COM ports are upper case and have no \\.\ prefix.
+func CanonicalPath(path string) string {
+	if m := comPortRe.FindStringSubmatch(path); m != nil {
+		return strings.ToUpper(m[2])
+	}
+
+	if path == "" {
+		return ""
+	}
+
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		// the device may have been unplugged, the path is still the best
+		// guess at what it was
+		return filepath.Clean(path)
+	}
+
+	return resolved
+}
+
+// PathConnected returns true if any of the connected device strings refer
+// to the same physical device as the given path, whichever reader driver
+// they're using.
+func PathConnected(connected []string, path string) bool {
+	path = CanonicalPath(path)
+	if path == "" {
+		return false
+	}
+
+	for _, c := range connected {
+		if CanonicalPath(DevicePath(c)) == path {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Registry tracks which device connection string holds each physical
+// device, so the same device isn't opened twice by different drivers.
+type Registry struct {
+	paths map[string]string
+}
+
+// NewRegistry returns a registry with the given device strings already
+// holding their devices.
+func NewRegistry(connected []string) *Registry {
+	r := &Registry{
+		paths: make(map[string]string),
+	}
+	for _, device := range connected {
+		r.Claim(device)
+	}
+	return r
+}
+
+// Holder returns the device string holding the same physical device as
+// the given device string, or an empty string if it's free. Devices which
+// don't refer to a local path are never held.
+func (r *Registry) Holder(device string) string {
+	path := CanonicalPath(DevicePath(device))
+	if path == "" {
+		return ""
+	}
+
+	holder, ok := r.paths[path]
+	if !ok || holder == device {
+		return ""
+	}
+
+	return holder
+}
+
+// Claim registers a device string as holding its physical device. If the
+// device is already held by another device string, it returns false and
+// the holder.
+func (r *Registry) Claim(device string) (string, bool) {
+	path := CanonicalPath(DevicePath(device))
+	if path == "" {
+		return "", true
+	}
+
+	holder, ok := r.paths[path]
+	if ok && holder != device {
+		return holder, false
+	}
+
+	r.paths[path] = device
+	return "", true
+}
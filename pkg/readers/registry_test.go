@@ -0,0 +1,132 @@
+package readers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDevicePath(t *testing.T) {
+	tests := []struct {
+		device string
+		want   string
+	}{
+		{"pn532_uart:/dev/ttyUSB0", "/dev/ttyUSB0"},
+		{"simple_serial:/dev/ttyACM0:115200", "/dev/ttyACM0"},
+		{"simple_serial:COM3:9600", "COM3"},
+		{`pn532_uart:\\.\COM12`, `\\.\COM12`},
+		{`file:C:\tokens\token.txt`, `C:\tokens\token.txt`},
+		{"file:/tmp/token.txt", "/tmp/token.txt"},
+		{"tcp::7497", ""},
+		{"acr122_pcsc:ACS ACR122U PICC Interface 00 00", ""},
+		{"pn532_uart", ""},
+	}
+
+	for _, tt := range tests {
+		got := DevicePath(tt.device)
+		if got != tt.want {
+			t.Errorf("DevicePath(%q) = %q, want %q", tt.device, got, tt.want)
+		}
+	}
+}
+
+func TestCanonicalPathComPort(t *testing.T) {
+	for _, p := range []string{"com3", "COM3", `\\.\com3`} {
+		if got := CanonicalPath(p); got != "COM3" {
+			t.Errorf("CanonicalPath(%q) = %q, want COM3", p, got)
+		}
+	}
+}
+
+// symlinkedDevice creates a fake device and a symlink to it, like the links
+// in /dev/serial/by-id.
+func symlinkedDevice(t *testing.T) (string, string) {
+	dir := t.TempDir()
+
+	dev := filepath.Join(dir, "ttyUSB0")
+	err := os.WriteFile(dev, nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.Mkdir(filepath.Join(dir, "by-id"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	link := filepath.Join(dir, "by-id", "usb-Prolific-if00-port0")
+	err = os.Symlink("../ttyUSB0", link)
+	if err != nil {
+		t.Skipf("symlinks not supported: %s", err)
+	}
+
+	dev, err = filepath.EvalSymlinks(dev)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dev, link
+}
+
+func TestCanonicalPathSymlink(t *testing.T) {
+	dev, link := symlinkedDevice(t)
+
+	if got := CanonicalPath(link); got != dev {
+		t.Errorf("CanonicalPath(%q) = %q, want %q", link, got, dev)
+	}
+
+	missing := filepath.Join(filepath.Dir(dev), "ttyUSB1")
+	if got := CanonicalPath(missing); got != missing {
+		t.Errorf("CanonicalPath(%q) = %q, want unchanged", missing, got)
+	}
+}
+
+func TestPathConnected(t *testing.T) {
+	dev, link := symlinkedDevice(t)
+
+	connected := []string{"tcp::7497", "pn532_uart:" + dev}
+	if !PathConnected(connected, link) {
+		t.Error("expected symlink to match connected device")
+	}
+	if !PathConnected(connected, dev) {
+		t.Error("expected same path to match connected device")
+	}
+	if PathConnected(connected, filepath.Join(filepath.Dir(dev), "ttyUSB1")) {
+		t.Error("expected other device to not match")
+	}
+	if PathConnected([]string{"simple_serial:COM3:9600"}, "COM4") {
+		t.Error("expected other com port to not match")
+	}
+	if !PathConnected([]string{"simple_serial:com3:9600"}, "COM3") {
+		t.Error("expected com port to match regardless of case")
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	dev, link := symlinkedDevice(t)
+
+	r := NewRegistry([]string{"libnfc:" + link, "tcp::7497"})
+
+	if got := r.Holder("pn532_uart:" + dev); got != "libnfc:"+link {
+		t.Errorf("holder = %q, want libnfc:%s", got, link)
+	}
+	if got := r.Holder("libnfc:" + link); got != "" {
+		t.Errorf("holder = %q, want none for the holding device", got)
+	}
+	if got := r.Holder("tcp::7497"); got != "" {
+		t.Errorf("holder = %q, want none for network devices", got)
+	}
+
+	holder, ok := r.Claim("simple_serial:" + dev + ":115200")
+	if ok || holder != "libnfc:"+link {
+		t.Errorf("claim = %q, %t, want conflict with libnfc:%s", holder, ok, link)
+	}
+
+	other := filepath.Join(filepath.Dir(dev), "ttyACM0")
+	if _, ok := r.Claim("simple_serial:" + other); !ok {
+		t.Error("expected claim of free device to succeed")
+	}
+	if got := r.Holder("pn532_uart:" + other); got != "simple_serial:"+other {
+		t.Errorf("holder = %q, want simple_serial:%s", got, other)
+	}
+}
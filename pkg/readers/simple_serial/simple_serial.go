@@ -2,32 +2,53 @@ package simple_serial
 
 import (
 	"errors"
+	"fmt"
 	"github.com/ZaparooProject/zaparoo-core/pkg/service/tokens"
 	"os"
 	"runtime"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ZaparooProject/zaparoo-core/pkg/config"
 	"github.com/ZaparooProject/zaparoo-core/pkg/readers"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/lineproto"
 	"github.com/ZaparooProject/zaparoo-core/pkg/utils"
 	"github.com/rs/zerolog/log"
 
 	"go.bug.st/serial"
 )
 
+const (
+	defaultBaudRate = 115200
+	// devices without the removal capability have their tokens removed
+	// after this long without a scan, unless configured otherwise
+	defaultRemovalTimeout = 1 * time.Second
+)
+
 type SimpleSerialReader struct {
 	cfg       *config.UserConfig
+	open      func(string, *serial.Mode) (serial.Port, error)
 	device    string
 	path      string
-	polling   bool
+	polling   atomic.Bool
 	port      serial.Port
 	lastToken *tokens.Token
+	mu        sync.Mutex
+	info      lineproto.DeviceInfo
+	writer    *lineproto.Writer
+	// error which made the reader close itself, guarded by mu
+	err error
 }
 
 func NewReader(cfg *config.UserConfig) *SimpleSerialReader {
 	return &SimpleSerialReader{
-		cfg: cfg,
+		cfg:    cfg,
+		open:   serial.Open,
+		info:   lineproto.DeviceInfo{Version: 1},
+		writer: lineproto.NewWriter(),
 	}
 }
 
@@ -35,53 +56,87 @@ func (r *SimpleSerialReader) Ids() []string {
 	return []string{"simple_serial"}
 }
 
-func (r *SimpleSerialReader) parseLine(line string) (*tokens.Token, error) {
-	line = strings.TrimSpace(line)
-	line = strings.Trim(line, "\r")
+// deviceInfo returns the info from the device's last HELLO.
+func (r *SimpleSerialReader) deviceInfo() lineproto.DeviceInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.info
+}
 
-	if len(line) == 0 {
-		return nil, nil
+// parseDevicePath splits the optional baud rate from the end of a device
+// path, e.g. /dev/ttyUSB0:9600.
+func parseDevicePath(path string) (string, int, error) {
+	i := strings.LastIndex(path, ":")
+	if i < 0 {
+		return path, defaultBaudRate, nil
 	}
 
-	if !strings.HasPrefix(line, "SCAN\t") {
-		return nil, nil
+	baud, err := strconv.Atoi(path[i+1:])
+	if err != nil {
+		// not a baud rate, the colon is part of the path
+		return path, defaultBaudRate, nil
 	}
 
-	args := line[5:]
-	if len(args) == 0 {
-		return nil, nil
+	if baud <= 0 {
+		return "", 0, fmt.Errorf("invalid baud rate: %d", baud)
 	}
 
-	t := tokens.Token{
-		Data:     line,
-		ScanTime: time.Now(),
-		Source:   r.device,
+	return path[:i], baud, nil
+}
+
+func (r *SimpleSerialReader) send(line string) error {
+	_, err := r.port.Write([]byte(line))
+	return err
+}
+
+// handleLine processes a single line received from the device.
+func (r *SimpleSerialReader) handleLine(line string, iq chan<- readers.Scan) {
+	msg, args := lineproto.SplitLine(line)
+	info := r.deviceInfo()
+
+	if r.writer.HandleReply(msg, args) {
+		return
 	}
 
-	ps := strings.Split(args, "\t")
-	hasArg := false
-	for i := 0; i < len(ps); i++ {
-		ps[i] = strings.TrimSpace(ps[i])
-		if strings.HasPrefix(ps[i], "uid=") {
-			t.UID = ps[i][4:]
-			hasArg = true
-		} else if strings.HasPrefix(ps[i], "text=") {
-			t.Text = ps[i][5:]
-			hasArg = true
-		} else if strings.HasPrefix(ps[i], "removable=") {
-			// TODO: this isn't really what removable means, but it works
-			//		 for now. it will block shell commands though
-			t.Remote = ps[i][10:] == "no"
-			hasArg = true
+	switch msg {
+	case "":
+		return
+	case lineproto.MsgScan:
+		t := lineproto.ParseScan(line, args, info.Version >= 2)
+		if t == nil {
+			return
 		}
-	}
+		t.Source = r.device
 
-	// if there are no named arguments, whole args becomes text
-	if !hasArg {
-		t.Text = args
-	}
+		if !utils.TokensEqual(t, r.lastToken) {
+			iq <- readers.Scan{
+				Source: r.device,
+				Token:  t,
+			}
+		}
 
-	return &t, nil
+		r.lastToken = t
+	case lineproto.MsgRemoved:
+		if r.lastToken != nil {
+			iq <- readers.Scan{
+				Source: r.device,
+				Token:  nil,
+			}
+			r.lastToken = nil
+		}
+	case lineproto.MsgHello:
+		info = lineproto.ParseHello(args)
+		log.Info().Msgf(
+			"simple serial device %s: version=%d, name=%s, write=%t, removal=%t",
+			r.device, info.Version, info.Name, info.Write, info.Removal,
+		)
+
+		r.mu.Lock()
+		r.info = info
+		r.mu.Unlock()
+	default:
+		log.Debug().Msgf("unknown simple serial message: %s", msg)
+	}
 }
 
 func (r *SimpleSerialReader) Open(device string, iq chan<- readers.Scan) error {
@@ -94,7 +149,10 @@ func (r *SimpleSerialReader) Open(device string, iq chan<- readers.Scan) error {
 		return errors.New("invalid reader id: " + ps[0])
 	}
 
-	path := ps[1]
+	path, baud, err := parseDevicePath(ps[1])
+	if err != nil {
+		return err
+	}
 
 	if runtime.GOOS != "windows" {
 		if _, err := os.Stat(path); err != nil {
@@ -102,8 +160,8 @@ func (r *SimpleSerialReader) Open(device string, iq chan<- readers.Scan) error {
 		}
 	}
 
-	port, err := serial.Open(path, &serial.Mode{
-		BaudRate: 115200,
+	port, err := r.open(path, &serial.Mode{
+		BaudRate: baud,
 	})
 	if err != nil {
 		return err
@@ -117,16 +175,34 @@ func (r *SimpleSerialReader) Open(device string, iq chan<- readers.Scan) error {
 	r.port = port
 	r.device = device
 	r.path = path
-	r.polling = true
+	r.setErr(nil)
+	r.polling.Store(true)
+
+	r.mu.Lock()
+	r.info = lineproto.DeviceInfo{Version: 1}
+	r.mu.Unlock()
+
+	// devices which support the protocol reply with their own HELLO, they
+	// should also send one when they start up in case this one is missed
+	err = r.send(lineproto.FormatLine(
+		lineproto.MsgHello,
+		"version", strconv.Itoa(lineproto.ProtocolVersion),
+	))
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to send hello to simple serial device")
+	}
+
+	removalTimeout := r.cfg.GetReaderRemovalTimeout(device, defaultRemovalTimeout)
 
 	go func() {
 		var lineBuf []byte
 
-		for r.polling {
+		for r.polling.Load() {
 			buf := make([]byte, 1024)
 			n, err := r.port.Read(buf)
 			if err != nil {
 				log.Error().Err(err).Msg("failed to read from serial port")
+				r.setErr(err)
 				err = r.Close()
 				if err != nil {
 					log.Error().Err(err).Msg("failed to close serial port")
@@ -136,31 +212,19 @@ func (r *SimpleSerialReader) Open(device string, iq chan<- readers.Scan) error {
 
 			for i := 0; i < n; i++ {
 				if buf[i] == '\n' {
-					line := string(lineBuf)
+					r.handleLine(string(lineBuf), iq)
 					lineBuf = nil
-
-					t, err := r.parseLine(line)
-					if err != nil {
-						log.Error().Err(err).Msg("failed to parse line")
-						continue
-					}
-
-					if t != nil && !utils.TokensEqual(t, r.lastToken) {
-						iq <- readers.Scan{
-							Source: r.device,
-							Token:  t,
-						}
-					}
-
-					if t != nil {
-						r.lastToken = t
-					}
 				} else {
 					lineBuf = append(lineBuf, buf[i])
 				}
 			}
 
-			if r.lastToken != nil && time.Since(r.lastToken.ScanTime) > 1*time.Second {
+			// devices which report removals don't need the timeout
+			if r.deviceInfo().Removal || removalTimeout <= 0 {
+				continue
+			}
+
+			if r.lastToken != nil && time.Since(r.lastToken.ScanTime) > removalTimeout {
 				iq <- readers.Scan{
 					Source: r.device,
 					Token:  nil,
@@ -174,7 +238,7 @@ func (r *SimpleSerialReader) Open(device string, iq chan<- readers.Scan) error {
 }
 
 func (r *SimpleSerialReader) Close() error {
-	r.polling = false
+	r.polling.Store(false)
 	if r.port != nil {
 		err := r.port.Close()
 		if err != nil {
@@ -193,13 +257,66 @@ func (r *SimpleSerialReader) Device() string {
 }
 
 func (r *SimpleSerialReader) Connected() bool {
-	return r.polling && r.port != nil
+	return r.polling.Load() && r.port != nil
 }
 
 func (r *SimpleSerialReader) Info() string {
+	info := r.deviceInfo()
+	if info.Name != "" {
+		return info.Name + " (" + r.path + ")"
+	}
 	return r.path
 }
 
-func (r *SimpleSerialReader) Write(text string) (*tokens.Token, error) {
-	return nil, errors.New("writing not supported on this reader")
+func (r *SimpleSerialReader) Write(
+	text string,
+	opts readers.WriteOptions,
+	status func(readers.WriteStatus),
+) (*tokens.Token, error) {
+	if !r.Connected() {
+		return nil, errors.New("not connected")
+	}
+
+	if !r.deviceInfo().Write {
+		return nil, errors.New("writing not supported on this reader")
+	}
+
+	if opts.Protected() {
+		return nil, errors.New("token protection not supported on this reader")
+	}
+
+	return r.writer.Write(r.device, text, status, r.send)
+}
+
+func (r *SimpleSerialReader) CancelWrite() {
+	r.writer.Cancel()
+}
+
+func (r *SimpleSerialReader) Capabilities() readers.Capabilities {
+	return readers.Capabilities{
+		Write:   r.deviceInfo().Write,
+		Removal: true,
+	}
+}
+
+func (r *SimpleSerialReader) setErr(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.err = err
+}
+
+func (r *SimpleSerialReader) getErr() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+func (r *SimpleSerialReader) Health() error {
+	if !r.Connected() {
+		if err := r.getErr(); err != nil {
+			return err
+		}
+		return readers.ErrNotConnected
+	}
+	return nil
 }
@@ -0,0 +1,332 @@
+package simple_serial
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ZaparooProject/zaparoo-core/pkg/config"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/lineproto"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/readertest"
+	"go.bug.st/serial"
+)
+
+// fakeDevice is an in-memory serial port with a scripted device on the
+// other end. Each complete line written by the host is passed to the
+// handler and any replies are queued for reading.
+type fakeDevice struct {
+	mu      sync.Mutex
+	in      []byte
+	out     []byte
+	lines   []string
+	closed  bool
+	mode    *serial.Mode
+	handler func(line string) []string
+}
+
+var _ serial.Port = (*fakeDevice)(nil)
+
+// send queues lines from the device to the host.
+func (d *fakeDevice) send(lines ...string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, l := range lines {
+		d.out = append(d.out, l+"\n"...)
+	}
+}
+
+// received returns the lines written by the host.
+func (d *fakeDevice) received() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string{}, d.lines...)
+}
+
+func (d *fakeDevice) Write(p []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.in = append(d.in, p...)
+	for {
+		i := strings.IndexByte(string(d.in), '\n')
+		if i < 0 {
+			break
+		}
+
+		line := string(d.in[:i])
+		d.in = d.in[i+1:]
+		d.lines = append(d.lines, line)
+
+		if d.handler != nil {
+			for _, l := range d.handler(line) {
+				d.out = append(d.out, l+"\n"...)
+			}
+		}
+	}
+
+	return len(p), nil
+}
+
+func (d *fakeDevice) Read(p []byte) (int, error) {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return 0, errors.New("port closed")
+	}
+
+	n := copy(p, d.out)
+	d.out = d.out[n:]
+	d.mu.Unlock()
+
+	if n == 0 {
+		// read timeout
+		time.Sleep(time.Millisecond)
+	}
+
+	return n, nil
+}
+
+func (d *fakeDevice) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.closed = true
+	return nil
+}
+
+func (d *fakeDevice) SetMode(_ *serial.Mode) error                         { return nil }
+func (d *fakeDevice) Drain() error                                         { return nil }
+func (d *fakeDevice) ResetInputBuffer() error                              { return nil }
+func (d *fakeDevice) ResetOutputBuffer() error                             { return nil }
+func (d *fakeDevice) SetDTR(_ bool) error                                  { return nil }
+func (d *fakeDevice) SetRTS(_ bool) error                                  { return nil }
+func (d *fakeDevice) SetReadTimeout(_ time.Duration) error                 { return nil }
+func (d *fakeDevice) Break(_ time.Duration) error                          { return nil }
+func (d *fakeDevice) GetModemStatusBits() (*serial.ModemStatusBits, error) { return nil, nil }
+
+// openFakeReader opens a reader on a fake serial port, recording the mode
+// it was opened with. The suffix is added to the end of the device string.
+func openFakeReader(t *testing.T, dev *fakeDevice, suffix string) (*SimpleSerialReader, chan readers.Scan) {
+	t.Helper()
+
+	r := NewReader(&config.UserConfig{})
+	r.open = func(_ string, mode *serial.Mode) (serial.Port, error) {
+		dev.mode = mode
+		return dev, nil
+	}
+
+	name := readertest.DevicePath(t, "ttyUSB0")
+	return r, readertest.Open(t, r, "simple_serial:"+name+suffix)
+}
+
+// helloHandler replies to the host's HELLO with the given capabilities.
+func helloHandler(caps string) func(string) []string {
+	return func(line string) []string {
+		if strings.HasPrefix(line, lineproto.MsgHello) {
+			return []string{"HELLO\tversion=2\tcaps=" + caps + "\tname=Test"}
+		}
+		return nil
+	}
+}
+
+func TestReaderLegacyScan(t *testing.T) {
+	dev := &fakeDevice{}
+	r, scans := openFakeReader(t, dev, "")
+
+	if dev.mode.BaudRate != defaultBaudRate {
+		t.Fatalf("unexpected baud rate: %d", dev.mode.BaudRate)
+	}
+
+	dev.send("SCAN\tuid=abcd\ttext=**launch.random:snes")
+
+	scan := readertest.WaitScan(t, scans)
+	if scan.Token == nil || scan.Token.UID != "abcd" || scan.Token.Text != "**launch.random:snes" {
+		t.Fatalf("unexpected scan: %+v", scan)
+	}
+
+	// removal is inferred from the timeout
+	scan = readertest.WaitScan(t, scans)
+	if scan.Token != nil {
+		t.Fatalf("expected removal, got: %+v", scan.Token)
+	}
+
+	if r.Capabilities().Write {
+		t.Fatal("expected legacy device to not support writing")
+	}
+
+	_, err := r.Write("test", readers.WriteOptions{}, func(readers.WriteStatus) {})
+	if err == nil {
+		t.Fatal("expected write to fail on legacy device")
+	}
+}
+
+func TestReaderBaudRate(t *testing.T) {
+	dev := &fakeDevice{}
+	r, _ := openFakeReader(t, dev, ":9600")
+
+	if dev.mode.BaudRate != 9600 {
+		t.Fatalf("unexpected baud rate: %d", dev.mode.BaudRate)
+	}
+
+	if strings.HasSuffix(r.Info(), ":9600") {
+		t.Fatalf("unexpected info: %s", r.Info())
+	}
+}
+
+func TestReaderHelloAndRemoved(t *testing.T) {
+	dev := &fakeDevice{handler: helloHandler("removal")}
+	r, scans := openFakeReader(t, dev, "")
+
+	readertest.WaitFor(t, func() bool {
+		return r.deviceInfo().Removal
+	})
+
+	if !strings.HasPrefix(r.Info(), "Test (") {
+		t.Fatalf("unexpected info: %s", r.Info())
+	}
+
+	dev.send("SCAN\ttext=a\\tb")
+
+	scan := readertest.WaitScan(t, scans)
+	if scan.Token == nil || scan.Token.Text != "a\tb" {
+		t.Fatalf("unexpected scan: %+v", scan)
+	}
+
+	// no timeout removal when the device reports removals
+	select {
+	case scan := <-scans:
+		t.Fatalf("unexpected scan: %+v", scan)
+	case <-time.After(1500 * time.Millisecond):
+	}
+
+	dev.send(lineproto.MsgRemoved)
+
+	scan = readertest.WaitScan(t, scans)
+	if scan.Token != nil {
+		t.Fatalf("expected removal, got: %+v", scan.Token)
+	}
+}
+
+func TestReaderWrite(t *testing.T) {
+	hello := helloHandler("write,removal")
+	dev := &fakeDevice{}
+	dev.handler = func(line string) []string {
+		if strings.HasPrefix(line, lineproto.MsgWrite) {
+			return []string{lineproto.MsgWriting, "OK\tuid=04aabbcc"}
+		}
+		return hello(line)
+	}
+	r, _ := openFakeReader(t, dev, "")
+
+	readertest.WaitFor(t, func() bool {
+		return r.Capabilities().Write
+	})
+
+	var statuses []string
+	token, err := r.Write("**launch.random", readers.WriteOptions{}, func(s readers.WriteStatus) {
+		statuses = append(statuses, s.Status)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token.UID != "04aabbcc" || token.Text != "**launch.random" {
+		t.Fatalf("unexpected token: %+v", token)
+	}
+
+	lines := dev.received()
+	if lines[len(lines)-1] != "WRITE\ttext=**launch.random" {
+		t.Fatalf("unexpected lines: %q", lines)
+	}
+
+	want := []string{
+		readers.WriteStatusWaiting,
+		readers.WriteStatusWriting,
+		readers.WriteStatusVerified,
+	}
+	if strings.Join(statuses, ",") != strings.Join(want, ",") {
+		t.Fatalf("unexpected statuses: %v", statuses)
+	}
+}
+
+func TestReaderWriteError(t *testing.T) {
+	hello := helloHandler("write")
+	dev := &fakeDevice{}
+	dev.handler = func(line string) []string {
+		if strings.HasPrefix(line, lineproto.MsgWrite) {
+			return []string{"ERR\ttag too small"}
+		}
+		return hello(line)
+	}
+	r, _ := openFakeReader(t, dev, "")
+
+	readertest.WaitFor(t, func() bool {
+		return r.Capabilities().Write
+	})
+
+	var last readers.WriteStatus
+	_, err := r.Write("**launch.random", readers.WriteOptions{}, func(s readers.WriteStatus) {
+		last = s
+	})
+	if err == nil || !strings.Contains(err.Error(), "tag too small") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if last.Status != readers.WriteStatusFailed {
+		t.Fatalf("unexpected status: %+v", last)
+	}
+}
+
+func TestReaderWriteCancel(t *testing.T) {
+	dev := &fakeDevice{handler: helloHandler("write")}
+	r, _ := openFakeReader(t, dev, "")
+
+	readertest.WaitFor(t, func() bool {
+		return r.Capabilities().Write
+	})
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		r.CancelWrite()
+	}()
+
+	_, err := r.Write("**launch.random", readers.WriteOptions{}, func(readers.WriteStatus) {})
+	if err == nil {
+		t.Fatal("expected cancelled write to fail")
+	}
+
+	readertest.WaitFor(t, func() bool {
+		lines := dev.received()
+		return lines[len(lines)-1] == lineproto.MsgCancel
+	})
+}
+
+func TestParseDevicePath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+		baud int
+	}{
+		{"/dev/ttyUSB0", "/dev/ttyUSB0", defaultBaudRate},
+		{"/dev/ttyUSB0:9600", "/dev/ttyUSB0", 9600},
+		{"COM3", "COM3", defaultBaudRate},
+		{"COM3:57600", "COM3", 57600},
+		{"/dev/serial/by-id/usb-a:b", "/dev/serial/by-id/usb-a:b", defaultBaudRate},
+	}
+
+	for _, tt := range tests {
+		path, baud, err := parseDevicePath(tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if path != tt.want || baud != tt.baud {
+			t.Fatalf("%s: unexpected path %s and baud %d", tt.path, path, baud)
+		}
+	}
+
+	if _, _, err := parseDevicePath("/dev/ttyUSB0:0"); err == nil {
+		t.Fatal("expected invalid baud rate error")
+	}
+}
@@ -0,0 +1,229 @@
+// Package type4 reads NDEF messages from NFC Forum Type 4 tags using ISO
+// 7816-4 APDUs. This covers ISO 14443-4 cards like DESFire and NTAG424, and
+// phones emulating a tag with host card emulation.
+package type4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Transceive sends an APDU to a tag and returns its response, including the
+// status word.
+type Transceive func(tx []byte) ([]byte, error)
+
+const (
+	claIso        = 0x00
+	insSelect     = 0xA4
+	insReadBinary = 0xB0
+
+	selectByName = 0x04
+	selectFirst  = 0x00
+	selectNoResp = 0x0C
+
+	ccFileId   = 0xE103
+	ccMinSize  = 15
+	ndefTlvTag = 0x04
+
+	// NLEN field at the start of the NDEF file
+	nlenSize = 2
+	// fallback when the capability container reports an unusable size
+	defaultMaxLe = 0x3B
+)
+
+// NFCForum-TS-Type-4-Tag_2.0 section 5.1.3. Mapping version 1.0 tags use a
+// different application name and expect a response to SELECT.
+var (
+	ndefAppV2 = []byte{0xD2, 0x76, 0x00, 0x00, 0x85, 0x01, 0x01}
+	ndefAppV1 = []byte{0xD2, 0x76, 0x00, 0x00, 0x85, 0x01, 0x00}
+)
+
+var ErrNotNdef = errors.New("NDEF application not found")
+
+var swOk = []byte{0x90, 0x00}
+
+// CapabilityContainer is the decoded CC file of a Type 4 tag.
+type CapabilityContainer struct {
+	Version byte
+	// MaxLe is the maximum amount of data which can be read in one command.
+	MaxLe int
+	// MaxLc is the maximum amount of data which can be written in one
+	// command.
+	MaxLc      int
+	NdefFileId uint16
+	// MaxNdefSize is the size of the NDEF file, including the NLEN field.
+	MaxNdefSize int
+	ReadAccess  byte
+	WriteAccess byte
+}
+
+// command sends an APDU and checks the status word of the response, which is
+// removed from the returned data.
+func command(tx Transceive, apdu []byte) ([]byte, error) {
+	res, err := tx(apdu)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(res) < 2 {
+		return nil, fmt.Errorf("invalid response: %x", res)
+	}
+
+	sw := res[len(res)-2:]
+	if !bytes.Equal(sw, swOk) {
+		return nil, fmt.Errorf("invalid response code: %x", sw)
+	}
+
+	return res[:len(res)-2], nil
+}
+
+// SelectApp selects the NDEF application and returns the mapping version
+// it was found with.
+func SelectApp(tx Transceive) (int, error) {
+	apdu := []byte{claIso, insSelect, selectByName, selectFirst, byte(len(ndefAppV2))}
+	apdu = append(apdu, ndefAppV2...)
+	_, err := command(tx, append(apdu, 0x00))
+	if err == nil {
+		return 2, nil
+	}
+
+	apdu = []byte{claIso, insSelect, selectByName, selectFirst, byte(len(ndefAppV1))}
+	apdu = append(apdu, ndefAppV1...)
+	_, err = command(tx, append(apdu, 0x00))
+	if err == nil {
+		return 1, nil
+	}
+
+	return 0, ErrNotNdef
+}
+
+func selectFile(tx Transceive, version int, id uint16) error {
+	p2 := byte(selectNoResp)
+	if version == 1 {
+		p2 = selectFirst
+	}
+
+	_, err := command(tx, []byte{
+		claIso, insSelect, selectFirst, p2, 0x02,
+		byte(id >> 8), byte(id),
+	})
+	if err != nil {
+		return fmt.Errorf("error selecting file %04x: %w", id, err)
+	}
+
+	return nil
+}
+
+func readBinary(tx Transceive, offset int, length int) ([]byte, error) {
+	res, err := command(tx, []byte{
+		claIso, insReadBinary, byte(offset >> 8), byte(offset), byte(length),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading offset %d: %w", offset, err)
+	}
+	return res, nil
+}
+
+// ParseCapabilityContainer decodes a CC file, NFCForum-TS-Type-4-Tag_2.0
+// section 5.1.2. Only the first NDEF file control TLV is used.
+func ParseCapabilityContainer(data []byte) (CapabilityContainer, error) {
+	if len(data) < ccMinSize {
+		return CapabilityContainer{}, fmt.Errorf("capability container too short: %x", data)
+	}
+
+	if data[7] != ndefTlvTag {
+		return CapabilityContainer{}, fmt.Errorf("NDEF file control TLV not found: %x", data)
+	}
+
+	cc := CapabilityContainer{
+		Version:     data[2],
+		MaxLe:       int(binary.BigEndian.Uint16(data[3:5])),
+		MaxLc:       int(binary.BigEndian.Uint16(data[5:7])),
+		NdefFileId:  binary.BigEndian.Uint16(data[9:11]),
+		MaxNdefSize: int(binary.BigEndian.Uint16(data[11:13])),
+		ReadAccess:  data[13],
+		WriteAccess: data[14],
+	}
+
+	// short APDUs can't read more than 255 bytes at once
+	if cc.MaxLe <= 0 || cc.MaxLe > 0xFF {
+		cc.MaxLe = defaultMaxLe
+	}
+
+	return cc, nil
+}
+
+// ReadCapabilityContainer selects the NDEF application and reads its CC
+// file. The mapping version is returned for selecting other files.
+func ReadCapabilityContainer(tx Transceive) (CapabilityContainer, int, error) {
+	version, err := SelectApp(tx)
+	if err != nil {
+		return CapabilityContainer{}, 0, err
+	}
+
+	err = selectFile(tx, version, ccFileId)
+	if err != nil {
+		return CapabilityContainer{}, version, err
+	}
+
+	data, err := readBinary(tx, 0, ccMinSize)
+	if err != nil {
+		return CapabilityContainer{}, version, err
+	}
+
+	cc, err := ParseCapabilityContainer(data)
+	return cc, version, err
+}
+
+// ReadNdef returns the NDEF message stored on a Type 4 tag. The message is
+// not wrapped in a TLV block like on other tag types.
+func ReadNdef(tx Transceive) ([]byte, error) {
+	cc, version, err := ReadCapabilityContainer(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	if cc.ReadAccess != 0x00 {
+		return nil, fmt.Errorf("NDEF file is not readable: %x", cc.ReadAccess)
+	}
+
+	err = selectFile(tx, version, cc.NdefFileId)
+	if err != nil {
+		return nil, err
+	}
+
+	nlen, err := readBinary(tx, 0, nlenSize)
+	if err != nil {
+		return nil, err
+	} else if len(nlen) < nlenSize {
+		return nil, fmt.Errorf("invalid NLEN: %x", nlen)
+	}
+
+	size := int(binary.BigEndian.Uint16(nlen))
+	if size == 0 {
+		return nil, errors.New("NDEF file is empty")
+	} else if cc.MaxNdefSize > 0 && size > cc.MaxNdefSize-nlenSize {
+		return nil, fmt.Errorf("NLEN larger than NDEF file: %d", size)
+	}
+
+	msg := make([]byte, 0, size)
+	for len(msg) < size {
+		length := size - len(msg)
+		if length > cc.MaxLe {
+			length = cc.MaxLe
+		}
+
+		data, err := readBinary(tx, nlenSize+len(msg), length)
+		if err != nil {
+			return nil, err
+		} else if len(data) == 0 {
+			return nil, errors.New("empty read response")
+		}
+
+		msg = append(msg, data...)
+	}
+
+	return msg[:size], nil
+}
@@ -0,0 +1,108 @@
+package type4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// fakeTag is an in-memory Type 4 tag which handles SELECT and READ BINARY.
+type fakeTag struct {
+	app      []byte
+	files    map[uint16][]byte
+	selected []byte
+	reads    int
+}
+
+func newFakeTag(app []byte, msg []byte, maxLe uint16) *fakeTag {
+	cc := []byte{
+		0x00, 0x0F, 0x20, 0x00, 0x00, 0x00, 0xFF,
+		0x04, 0x06, 0xE1, 0x04, 0x08, 0x00, 0x00, 0xFF,
+	}
+	binary.BigEndian.PutUint16(cc[3:5], maxLe)
+
+	ndefFile := make([]byte, 2, 2+len(msg))
+	binary.BigEndian.PutUint16(ndefFile, uint16(len(msg)))
+	ndefFile = append(ndefFile, msg...)
+
+	return &fakeTag{
+		app: app,
+		files: map[uint16][]byte{
+			ccFileId: cc,
+			0xE104:   ndefFile,
+		},
+	}
+}
+
+func (t *fakeTag) transceive(tx []byte) ([]byte, error) {
+	notFound := []byte{0x6A, 0x82}
+
+	switch tx[1] {
+	case insSelect:
+		if tx[2] == selectByName {
+			if !bytes.Equal(tx[5:5+tx[4]], t.app) {
+				return notFound, nil
+			}
+			return swOk, nil
+		}
+
+		f, ok := t.files[binary.BigEndian.Uint16(tx[5:7])]
+		if !ok {
+			return notFound, nil
+		}
+		t.selected = f
+		return swOk, nil
+	case insReadBinary:
+		t.reads++
+		offset := int(binary.BigEndian.Uint16(tx[2:4]))
+		end := offset + int(tx[4])
+		if end > len(t.selected) {
+			end = len(t.selected)
+		}
+		return append(append([]byte{}, t.selected[offset:end]...), swOk...), nil
+	}
+
+	return []byte{0x6D, 0x00}, nil
+}
+
+func TestReadNdef(t *testing.T) {
+	msg := bytes.Repeat([]byte{0xAB}, 100)
+	tag := newFakeTag(ndefAppV2, msg, 0x20)
+
+	got, err := ReadNdef(tag.transceive)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, msg) {
+		t.Fatalf("expected: %x, got: %x", msg, got)
+	}
+
+	// CC, NLEN and 4 chunks of the message
+	if tag.reads != 6 {
+		t.Fatalf("unexpected number of reads: %d", tag.reads)
+	}
+}
+
+func TestReadNdefV1(t *testing.T) {
+	msg := []byte{0xD1, 0x01, 0x04, 0x54, 0x02, 0x65, 0x6E, 0x41}
+	tag := newFakeTag(ndefAppV1, msg, 0xFF)
+
+	got, err := ReadNdef(tag.transceive)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, msg) {
+		t.Fatalf("expected: %x, got: %x", msg, got)
+	}
+}
+
+func TestReadNdefNoApp(t *testing.T) {
+	tag := newFakeTag([]byte{0xA0, 0x00}, nil, 0xFF)
+
+	_, err := ReadNdef(tag.transceive)
+	if err != ErrNotNdef {
+		t.Fatalf("expected ErrNotNdef, got: %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"strings"
+	"time"
+
+	"github.com/ZaparooProject/zaparoo-core/pkg/launcher"
+	"github.com/ZaparooProject/zaparoo-core/pkg/service/tokens"
+	"github.com/ZaparooProject/zaparoo-core/pkg/utils"
+)
+
+// retapFilter ignores a token which is tapped again too soon after it was
+// last scanned, which is usually a double tap or a card bouncing on the
+// reader. It applies to every reader, whatever its own removal timing is.
+type retapFilter struct {
+	last   *tokens.Token
+	lastAt time.Time
+}
+
+// ignore records a scan and returns true if the same token was scanned less
+// than the interval before it. Every scan is recorded, so repeated taps are
+// ignored until the token is left alone for the interval.
+func (f *retapFilter) ignore(token *tokens.Token, interval time.Duration, now time.Time) bool {
+	retap := interval > 0 &&
+		f.last != nil &&
+		utils.TokensEqual(token, f.last) &&
+		now.Sub(f.lastAt) < interval
+
+	f.last = token
+	f.lastAt = now
+
+	return retap
+}
+
+// confirmCommand returns the first command in a token's commands which must
+// be confirmed by tapping the token again, or an empty string.
+func confirmCommand(confirmCmds []string, cmds []string) string {
+	for _, cmd := range cmds {
+		name := launcher.CommandName(cmd)
+		if name == "" {
+			continue
+		}
+
+		for _, c := range confirmCmds {
+			if strings.EqualFold(strings.TrimSpace(c), name) {
+				return name
+			}
+		}
+	}
+
+	return ""
+}
+
+// isConfirmation returns true if a token is the second tap of the token
+// waiting to be confirmed, before the confirmation timed out.
+func isConfirmation(pending *tokens.Token, token tokens.Token, timeout time.Duration, now time.Time) bool {
+	if pending == nil || !utils.TokensEqual(pending, &token) {
+		return false
+	}
+
+	return now.Sub(pending.ScanTime) <= timeout
+}
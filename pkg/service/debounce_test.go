@@ -0,0 +1,84 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ZaparooProject/zaparoo-core/pkg/service/tokens"
+)
+
+func TestRetapFilter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	a := &tokens.Token{UID: "04aabbccdd2280", Text: "_Console/SNES"}
+	b := &tokens.Token{UID: "04aabbccdd2281", Text: "_Console/NES"}
+
+	var f retapFilter
+	interval := 2 * time.Second
+
+	if f.ignore(a, interval, now) {
+		t.Error("expected first scan to not be ignored")
+	}
+	if !f.ignore(a, interval, now.Add(500*time.Millisecond)) {
+		t.Error("expected double tap to be ignored")
+	}
+	// repeated taps keep extending the interval
+	if !f.ignore(a, interval, now.Add(2*time.Second)) {
+		t.Error("expected repeated tap to be ignored")
+	}
+	if f.ignore(a, interval, now.Add(5*time.Second)) {
+		t.Error("expected tap after the interval to not be ignored")
+	}
+	if f.ignore(b, interval, now.Add(5500*time.Millisecond)) {
+		t.Error("expected different token to not be ignored")
+	}
+	if f.ignore(a, 0, now.Add(5600*time.Millisecond)) {
+		t.Error("expected nothing to be ignored with no interval")
+	}
+}
+
+func TestConfirmCommand(t *testing.T) {
+	confirm := []string{"shell", " Mister.INI "}
+
+	tests := []struct {
+		cmds []string
+		want string
+	}{
+		{[]string{"**shell:reboot"}, "shell"},
+		{[]string{"_Console/SNES", "**mister.ini:2"}, "mister.ini"},
+		{[]string{"**input.coinp1:1"}, ""},
+		{[]string{"_Console/SNES"}, ""},
+		{[]string{"**shell"}, ""},
+	}
+
+	for _, tt := range tests {
+		got := confirmCommand(confirm, tt.cmds)
+		if got != tt.want {
+			t.Errorf("confirmCommand(%q) = %q, want %q", tt.cmds, got, tt.want)
+		}
+	}
+
+	if got := confirmCommand(nil, []string{"**shell:reboot"}); got != "" {
+		t.Errorf("confirmCommand with no commands = %q, want none", got)
+	}
+}
+
+func TestIsConfirmation(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	pending := &tokens.Token{UID: "04aabbccdd2280", Text: "**shell:reboot", ScanTime: now}
+	again := tokens.Token{UID: "04aabbccdd2280", Text: "**shell:reboot", ScanTime: now.Add(time.Second)}
+	other := tokens.Token{UID: "04aabbccdd2281", Text: "**shell:reboot", ScanTime: now.Add(time.Second)}
+	timeout := 5 * time.Second
+
+	if !isConfirmation(pending, again, timeout, now.Add(time.Second)) {
+		t.Error("expected second tap to confirm")
+	}
+	if isConfirmation(pending, again, timeout, now.Add(6*time.Second)) {
+		t.Error("expected second tap after the timeout to not confirm")
+	}
+	if isConfirmation(pending, other, timeout, now.Add(time.Second)) {
+		t.Error("expected different token to not confirm")
+	}
+	if isConfirmation(nil, again, timeout, now.Add(time.Second)) {
+		t.Error("expected no pending token to not confirm")
+	}
+}
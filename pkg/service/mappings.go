@@ -87,6 +87,42 @@ func checkMappingData(m database.Mapping, t tokens.Token) bool {
 	return false
 }
 
+// checkMappingFigure matches against both the ID and name of a figure, so
+// mappings can use names from the lookup tables instead of raw IDs.
+func checkMappingFigure(m database.Mapping, t tokens.Token) bool {
+	if t.Figure == nil {
+		return false
+	}
+
+	for _, v := range []string{t.Figure.Id, t.Figure.Name} {
+		if v == "" {
+			continue
+		}
+
+		switch {
+		case m.Match == database.MatchTypeExact:
+			if strings.EqualFold(v, m.Pattern) {
+				return true
+			}
+		case m.Match == database.MatchTypePartial:
+			if strings.Contains(strings.ToLower(v), strings.ToLower(m.Pattern)) {
+				return true
+			}
+		case m.Match == database.MatchTypeRegex:
+			re, err := regexp.Compile(m.Pattern)
+			if err != nil {
+				log.Error().Err(err).Msgf("error compiling regex")
+				return false
+			}
+			if re.MatchString(v) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
 func getMapping(db *database.Database, pl platforms.Platform, token tokens.Token) (string, bool) {
 	// check db mappings
 	ms, err := db.GetEnabledMappings()
@@ -111,6 +147,11 @@ func getMapping(db *database.Database, pl platforms.Platform, token tokens.Token
 				log.Info().Msg("launching with db data match override")
 				return m.Override, true
 			}
+		case m.Type == database.MappingTypeFigure:
+			if checkMappingFigure(m, token) {
+				log.Info().Msg("launching with db figure match override")
+				return m.Override, true
+			}
 		}
 	}
 
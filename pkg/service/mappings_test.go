@@ -0,0 +1,49 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/ZaparooProject/zaparoo-core/pkg/database"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/figures"
+	"github.com/ZaparooProject/zaparoo-core/pkg/service/tokens"
+)
+
+func TestCheckMappingFigure(t *testing.T) {
+	token := tokens.Token{
+		Figure: &figures.Figure{
+			Type: figures.TypeAmiibo,
+			Id:   "0000000000000002",
+			Name: "Mario",
+		},
+	}
+
+	tests := []struct {
+		match   string
+		pattern string
+		want    bool
+	}{
+		{database.MatchTypeExact, "0000000000000002", true},
+		{database.MatchTypeExact, "mario", true},
+		{database.MatchTypeExact, "Luigi", false},
+		{database.MatchTypePartial, "00000002", true},
+		{database.MatchTypePartial, "Mar", true},
+		{database.MatchTypeRegex, "^Mario$", true},
+		{database.MatchTypeRegex, "^Luigi$", false},
+	}
+
+	for _, tt := range tests {
+		m := database.Mapping{
+			Type:    database.MappingTypeFigure,
+			Match:   tt.match,
+			Pattern: tt.pattern,
+		}
+		if got := checkMappingFigure(m, token); got != tt.want {
+			t.Errorf("%s %q: got %t, want %t", tt.match, tt.pattern, got, tt.want)
+		}
+	}
+
+	m := database.Mapping{Match: database.MatchTypeExact, Pattern: "Mario"}
+	if checkMappingFigure(m, tokens.Token{}) {
+		t.Error("expected token without figure to not match")
+	}
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"errors"
+	"github.com/ZaparooProject/zaparoo-core/pkg/api/models"
 	"github.com/ZaparooProject/zaparoo-core/pkg/service/tokens"
 	"strings"
 	"time"
@@ -9,6 +10,7 @@ import (
 	"github.com/ZaparooProject/zaparoo-core/pkg/config"
 	"github.com/ZaparooProject/zaparoo-core/pkg/platforms"
 	"github.com/ZaparooProject/zaparoo-core/pkg/readers"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/hotplug"
 	"github.com/ZaparooProject/zaparoo-core/pkg/service/state"
 	"github.com/ZaparooProject/zaparoo-core/pkg/utils"
 	"github.com/rs/zerolog/log"
@@ -18,8 +20,9 @@ func shouldExit(
 	cfg *config.UserConfig,
 	pl platforms.Platform,
 	st *state.State,
+	source string,
 ) bool {
-	if !cfg.GetExitGame() {
+	if !cfg.GetReaderExitGame(source) {
 		return false
 	}
 
@@ -39,18 +42,25 @@ func shouldExit(
 	return true
 }
 
+// reportsRemoval returns true if the reader of a device sends a removal
+// between scans. Readers which can't detect removal never do, so the same
+// token scanned twice in a row means it was scanned again.
+func reportsRemoval(st *state.State, device string) bool {
+	r, ok := st.GetReader(device)
+	return !ok || r == nil || r.Capabilities().Removal
+}
+
 func connectReaders(
 	pl platforms.Platform,
 	cfg *config.UserConfig,
 	st *state.State,
 	iq chan<- readers.Scan,
+	sv *readerSupervisor,
+	autoDetect bool,
 ) error {
 	rs := st.ListReaders()
 	var toConnect []string
 
-	// TODO: this needs to gather the final list of reader paths, resolve any
-	// symlinks, remove duplicates, and then connect to them
-
 	userDevice := cfg.GetConnectionString()
 	if userDevice != "" && !utils.Contains(rs, userDevice) {
 		log.Debug().Msgf("user device not connected, adding: %s", userDevice)
@@ -64,6 +74,44 @@ func connectReaders(
 		}
 	}
 
+	for _, device := range st.ListExtraReaders() {
+		if !utils.Contains(rs, device) && !utils.Contains(toConnect, device) {
+			log.Debug().Msgf("requested device not connected, adding: %s", device)
+			toConnect = append(toConnect, device)
+		}
+	}
+
+	disabled := st.ListDisabledReaders()
+	for _, device := range disabled {
+		if utils.Contains(toConnect, device) {
+			log.Debug().Msgf("device disconnected by request, skipping: %s", device)
+			toConnect = utils.Remove(toConnect, device)
+		}
+	}
+
+	// devices are compared by their resolved path so the same physical
+	// device is never opened twice, e.g. through a by-id symlink or by both
+	// libnfc and a native driver
+	registry := readers.NewRegistry(rs)
+	prevConflicts := st.ListReaderConflicts()
+	var conflicts []state.ReaderConflict
+
+	addConflict := func(device string, heldBy string) {
+		c := state.ReaderConflict{
+			Device: device,
+			Path:   readers.CanonicalPath(readers.DevicePath(device)),
+			HeldBy: heldBy,
+		}
+		conflicts = append(conflicts, c)
+
+		for _, pc := range prevConflicts {
+			if pc == c {
+				return
+			}
+		}
+		log.Warn().Msgf("device %s is already in use by %s, skipping", device, heldBy)
+	}
+
 	// user defined readers
 	for _, device := range toConnect {
 		if _, ok := st.GetReader(device); !ok {
@@ -72,8 +120,19 @@ func connectReaders(
 				return errors.New("invalid device string")
 			}
 
+			if holder := registry.Holder(device); holder != "" {
+				addConflict(device, holder)
+				continue
+			}
+
+			// wait before retrying devices which recently failed
+			if !sv.ready(device) {
+				continue
+			}
+
 			rt := ps[0]
 
+			var openErr error
 			for _, r := range pl.SupportedReaders(cfg) {
 				ids := r.Ids()
 				if utils.Contains(ids, rt) {
@@ -81,33 +140,56 @@ func connectReaders(
 					err := r.Open(device, iq)
 					if err != nil {
 						log.Error().Msgf("error opening reader: %s", err)
+						openErr = err
 					} else {
+						registry.Claim(device)
 						st.SetReader(device, r)
 						log.Info().Msgf("opened reader: %s", device)
+						openErr = nil
 						break
 					}
 				}
 			}
+
+			if openErr != nil {
+				sv.failed(device, openErr)
+			}
 		}
 	}
 
-	// auto-detect readers
-	for _, r := range pl.SupportedReaders(cfg) {
-		detect := r.Detect(st.ListReaders())
-		if detect != "" {
-			err := r.Open(detect, iq)
-			if err != nil {
-				log.Error().Msgf("error opening detected reader %s: %s", detect, err)
+	// auto-detect readers, which probes devices and can be disruptive, so
+	// it's only done when devices may have changed
+	if autoDetect {
+		for _, r := range pl.SupportedReaders(cfg) {
+			// disabled devices are passed as connected so they're not detected
+			detect := r.Detect(append(st.ListReaders(), disabled...))
+			if holder := registry.Holder(detect); detect != "" && holder != "" {
+				log.Debug().Msgf("detected device %s is already in use by %s", detect, holder)
+				detect = ""
+			} else if detect != "" && !sv.ready(detect) {
+				log.Debug().Msgf("detected device %s recently failed, waiting to retry", detect)
+				detect = ""
 			}
-		}
 
-		if r.Connected() {
-			st.SetReader(detect, r)
-		} else {
-			_ = r.Close()
+			if detect != "" {
+				err := r.Open(detect, iq)
+				if err != nil {
+					log.Error().Msgf("error opening detected reader %s: %s", detect, err)
+					sv.failed(detect, err)
+				}
+			}
+
+			if r.Connected() {
+				registry.Claim(detect)
+				st.SetReader(detect, r)
+			} else {
+				_ = r.Close()
+			}
 		}
 	}
 
+	st.SetReaderConflicts(conflicts)
+
 	ids := st.ListReaders()
 	rsm := make(map[string]*readers.Reader)
 	for _, id := range ids {
@@ -130,18 +212,31 @@ func readerManager(
 	cfg *config.UserConfig,
 	st *state.State,
 	itq chan<- tokens.Token,
-	lsq chan *tokens.Token,
+	lsq chan *launchedSoftware,
 ) {
 	scanQueue := make(chan readers.Scan)
 
-	var err error
 	var lastError time.Time
 
 	var prevToken *tokens.Token
+	var retap retapFilter
 	var exitTimer *time.Timer
+	var removedAt time.Time
+
+	var sessionTimer *time.Timer
+	var warningTimer *time.Timer
 
 	readerTicker := time.NewTicker(1 * time.Second)
 	stopService := make(chan bool)
+	// closed on shutdown, when nothing reads the launched software queue
+	stopped := make(chan struct{})
+
+	softwareExited := func() {
+		select {
+		case lsq <- nil:
+		case <-stopped:
+		}
+	}
 
 	playFail := func() {
 		if time.Since(lastError) > 1*time.Second {
@@ -157,8 +252,8 @@ func readerManager(
 			}
 		}
 
-		timerLen := time.Second * time.Duration(cfg.GetExitGameDelay())
-		log.Debug().Msgf("exit timer set to: %s seconds", timerLen)
+		timerLen := exitGameDelay(cfg, pl)
+		log.Debug().Msgf("exit timer set to: %s", timerLen)
 		exitTimer = time.NewTimer(timerLen)
 
 		go func() {
@@ -175,52 +270,150 @@ func readerManager(
 				log.Warn().Msgf("error killing launcher: %s", err)
 			}
 
-			lsq <- nil
+			softwareExited()
 		}()
 	}
 
-	// manage reader connections
+	stopSession := func() {
+		if warningTimer != nil {
+			warningTimer.Stop()
+		}
+
+		if sessionTimer != nil {
+			stopped := sessionTimer.Stop()
+			if stopped {
+				log.Info().Msg("cancelling session timer")
+			}
+		}
+	}
+
+	startSession := func(token *tokens.Token, limit time.Duration) {
+		stopSession()
+
+		if limit <= 0 {
+			return
+		}
+
+		log.Info().Msgf("session timer set to: %s", limit)
+
+		warning := time.Duration(cfg.GetSessionWarning()) * time.Second
+		if warning > 0 && warning < limit {
+			warningTimer = time.AfterFunc(limit-warning, func() {
+				if !utils.TokensEqual(token, st.GetSoftwareToken()) {
+					return
+				}
+
+				log.Info().Msgf("session ending in: %s", warning)
+				st.Notifications <- models.Notification{
+					Method: models.SessionWarning,
+					Params: models.SessionWarningParams{
+						Remaining: int(warning.Seconds()),
+					},
+				}
+			})
+		}
+
+		sessionTimer = time.AfterFunc(limit, func() {
+			if pl.GetActiveLauncher() == "" || !utils.TokensEqual(token, st.GetSoftwareToken()) {
+				log.Debug().Msg("session software no longer active, not exiting")
+				return
+			}
+
+			log.Info().Msg("session time limit reached, exiting software")
+			err := pl.KillLauncher()
+			if err != nil {
+				log.Warn().Msgf("error killing launcher: %s", err)
+			}
+
+			softwareExited()
+		})
+	}
+
+	// manage reader connections. Configured readers are reconnected on
+	// every tick, but readers are only auto-detected when a device has been
+	// added or removed, unless hotplug events aren't available. Readers
+	// which fail are retried with a backoff by the supervisor
+	sv := newReaderSupervisor(st)
 	go func() {
+		hotplugEvents, stopHotplug, err := hotplug.Watch()
+		if err != nil {
+			log.Info().Err(err).Msg("hotplug events not available, polling for readers")
+			stopHotplug = func() {}
+		}
+		polling := err != nil
+
+		// always detect on the first check
+		detect := true
+		probe := cfg.GetProbeDevice()
+		var settle <-chan time.Time
+
 		for {
 			select {
 			case <-stopService:
+				stopHotplug()
 				return
-			case <-readerTicker.C:
-				rs := st.ListReaders()
-				for _, device := range rs {
-					r, ok := st.GetReader(device)
-					if ok && r != nil && !r.Connected() {
-						log.Debug().Msgf("pruning disconnected reader: %s", device)
-						st.RemoveReader(device)
-					}
+			case _, ok := <-hotplugEvents:
+				if !ok {
+					log.Warn().Msg("hotplug watcher stopped, polling for readers")
+					hotplugEvents = nil
+					polling = true
+				} else if settle == nil {
+					settle = time.After(hotplug.SettleDelay)
 				}
+				continue
+			case <-settle:
+				log.Debug().Msg("devices changed, detecting readers")
+				settle = nil
+				detect = true
+				sv.devicesChanged()
+			case <-readerTicker.C:
+			}
 
-				err := connectReaders(pl, cfg, st, scanQueue)
-				if err != nil {
-					log.Error().Msgf("error connecting rs: %s", err)
-				}
+			// detection may have been enabled in the settings
+			if p := cfg.GetProbeDevice(); p != probe {
+				probe = p
+				detect = true
+			}
+
+			if sv.check() {
+				detect = true
+			}
+
+			err := connectReaders(pl, cfg, st, scanQueue, sv, detect || polling)
+			if err != nil {
+				log.Error().Msgf("error connecting rs: %s", err)
 			}
+			detect = false
 		}
 	}()
 
 	// token pre-processing loop
 	for !st.ShouldStopService() {
 		var scan *tokens.Token
+		var source string
 
 		select {
 		case t := <-scanQueue:
 			// a reader has sent a token for pre-processing
 			log.Debug().Msgf("pre-processing token: %v", t)
+			if t.Token != nil || t.Error != nil {
+				st.RecordReaderScan(t.Source, t.Error)
+			}
 			if t.Error != nil {
-				log.Error().Msgf("error reading card: %s", err)
+				log.Error().Msgf("error reading card: %s", t.Error)
 				playFail()
 				lastError = time.Now()
 				continue
 			}
 			scan = t.Token
-		case stoken := <-lsq:
+			source = t.Source
+		case ls := <-lsq:
 			// a token has been launched that starts software
-			log.Debug().Msgf("new software token: %v", st)
+			var stoken *tokens.Token
+			if ls != nil {
+				stoken = ls.Token
+			}
+			log.Debug().Msgf("new software token: %v", stoken)
 
 			if exitTimer != nil && !utils.TokensEqual(stoken, st.GetSoftwareToken()) {
 				if stopped := exitTimer.Stop(); stopped {
@@ -229,10 +422,15 @@ func readerManager(
 			}
 
 			st.SetSoftwareToken(stoken)
+			if stoken == nil {
+				stopSession()
+			} else {
+				startSession(stoken, ls.SessionTime)
+			}
 			continue
 		}
 
-		if utils.TokensEqual(scan, prevToken) {
+		if utils.TokensEqual(scan, prevToken) && reportsRemoval(st, source) {
 			log.Debug().Msg("ignoring duplicate scan")
 			continue
 		}
@@ -242,6 +440,16 @@ func readerManager(
 		if scan != nil {
 			log.Info().Msgf("new token scanned: %v", scan)
 			st.SetActiveCard(*scan)
+
+			// a token waiting to be confirmed is always let through
+			retapped := retap.ignore(scan, cfg.GetRetapInterval(), time.Now()) &&
+				!utils.TokensEqual(scan, st.GetConfirmToken())
+
+			if cfg.GetReaderRole(source) == config.ReaderRoleWrite {
+				log.Info().Msgf("token scanned on write station, not launching: %s", source)
+				continue
+			}
+
 			if !st.IsLauncherDisabled() {
 				if exitTimer != nil {
 					stopped := exitTimer.Stop()
@@ -254,6 +462,11 @@ func readerManager(
 					}
 				}
 
+				if reinsertedInGrace(cfg, scan, st.GetSoftwareToken(), removedAt, time.Now()) {
+					log.Info().Msg("same token reinserted within grace period, not relaunching")
+					continue
+				}
+
 				wt := st.GetWroteToken()
 				if wt != nil && utils.TokensEqual(scan, wt) {
 					log.Info().Msg("skipping launching just written token")
@@ -263,21 +476,34 @@ func readerManager(
 					st.SetWroteToken(nil)
 				}
 
+				if retapped {
+					log.Info().Msg("same token tapped again within retap interval, ignoring")
+					continue
+				}
+
+				if cfg.GetDisableRelaunch() && utils.TokensEqual(scan, st.GetSoftwareToken()) {
+					log.Info().Msg("token of running software tapped again, not relaunching")
+					continue
+				}
+
 				log.Info().Msgf("sending token: %v", scan)
 				pl.PlaySuccessSound(cfg)
 				itq <- *scan
 			}
 		} else {
 			log.Info().Msg("token was removed")
+			removedAt = time.Now()
 			st.SetActiveCard(tokens.Token{})
 			//stopMPlayer()
-			if shouldExit(cfg, pl, st) {
+			if shouldExit(cfg, pl, st, source) {
 				startTimedExit()
 			}
 		}
 	}
 
 	// daemon shutdown
+	stopSession()
+	close(stopped)
 	stopService <- true
 	rs := st.ListReaders()
 	for _, device := range rs {
@@ -0,0 +1,18 @@
+package service
+
+import (
+	"testing"
+)
+
+func TestReportsRemoval(t *testing.T) {
+	st := newTestState(t)
+
+	if !reportsRemoval(st, "test:1") {
+		t.Error("expected unknown device to report removal")
+	}
+
+	st.SetReader("test:1", &detectReader{device: "test:1"})
+	if reportsRemoval(st, "test:1") {
+		t.Error("expected reader without removal to not report it")
+	}
+}
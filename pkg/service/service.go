@@ -24,6 +24,9 @@ package service
 import (
 	"fmt"
 	"github.com/ZaparooProject/zaparoo-core/pkg/api"
+	"github.com/ZaparooProject/zaparoo-core/pkg/api/models"
+	"github.com/ZaparooProject/zaparoo-core/pkg/api/webhooks"
+	"github.com/ZaparooProject/zaparoo-core/pkg/mqtt"
 	"github.com/ZaparooProject/zaparoo-core/pkg/service/playlists"
 	"github.com/ZaparooProject/zaparoo-core/pkg/service/tokens"
 	"strings"
@@ -50,9 +53,10 @@ func inExitGameBlocklist(platform platforms.Platform, cfg *config.UserConfig) bo
 func launchToken(
 	platform platforms.Platform,
 	cfg *config.UserConfig,
+	st *state.State,
 	token tokens.Token,
 	db *database.Database,
-	lsq chan<- *tokens.Token,
+	lsq chan<- *launchedSoftware,
 	plsc playlists.PlaylistController,
 ) error {
 	text := token.Text
@@ -69,6 +73,32 @@ func launchToken(
 
 	log.Info().Msgf("launching with text: %s", text)
 	cmds := strings.Split(text, "||")
+	session := sessionTime(cfg, cmds)
+
+	// commands set to be confirmed only run when their token is tapped
+	// again, remote launches are already deliberate
+	if !token.Remote && token.Source != tokens.SourcePlaylist {
+		cmd := confirmCommand(cfg.GetConfirmCommands(), cmds)
+		if cmd != "" && !isConfirmation(st.GetConfirmToken(), token, cfg.GetConfirmTimeout(), time.Now()) {
+			log.Info().Msgf("token runs %s command, waiting for it to be tapped again", cmd)
+			st.SetConfirmToken(&token)
+			st.Notifications <- models.Notification{
+				Method: models.TokensConfirm,
+				Params: models.TokenResponse{
+					Type:     token.Type,
+					UID:      token.UID,
+					Text:     token.Text,
+					Data:     token.Data,
+					ScanTime: token.ScanTime,
+					Figure:   token.Figure,
+				},
+			}
+			return nil
+		} else if cmd != "" {
+			log.Info().Msgf("token tapped again, running %s command", cmd)
+			st.SetConfirmToken(nil)
+		}
+	}
 
 	for i, cmd := range cmds {
 		err, softwareSwap := launcher.LaunchToken(
@@ -87,7 +117,10 @@ func launchToken(
 
 		if softwareSwap && !token.Remote {
 			log.Info().Msgf("current software launched set to: %s", token.UID)
-			lsq <- &token
+			lsq <- &launchedSoftware{
+				Token:       &token,
+				SessionTime: session,
+			}
 		}
 	}
 
@@ -100,7 +133,7 @@ func processTokenQueue(
 	st *state.State,
 	itq <-chan tokens.Token,
 	db *database.Database,
-	lsq chan<- *tokens.Token,
+	lsq chan<- *launchedSoftware,
 	plq chan *playlists.Playlist,
 ) {
 	var activePlaylist *playlists.Playlist
@@ -131,7 +164,7 @@ func processTokenQueue(
 						Active: activePlaylist,
 						Queue:  plq,
 					}
-					err := launchToken(platform, cfg, t, db, lsq, plsc)
+					err := launchToken(platform, cfg, st, t, db, lsq, plsc)
 					if err != nil {
 						log.Error().Err(err).Msgf("error launching token")
 					}
@@ -155,7 +188,7 @@ func processTokenQueue(
 						Active: activePlaylist,
 						Queue:  plq,
 					}
-					err := launchToken(platform, cfg, t, db, lsq, plsc)
+					err := launchToken(platform, cfg, st, t, db, lsq, plsc)
 					if err != nil {
 						log.Error().Err(err).Msgf("error launching token")
 					}
@@ -177,11 +210,12 @@ func processTokenQueue(
 			}
 
 			he := database.HistoryEntry{
-				Time: t.ScanTime,
-				Type: t.Type,
-				UID:  t.UID,
-				Text: t.Text,
-				Data: t.Data,
+				Time:   t.ScanTime,
+				Type:   t.Type,
+				UID:    t.UID,
+				Text:   t.Text,
+				Data:   t.Data,
+				Figure: t.Figure,
 			}
 
 			if st.IsLauncherDisabled() {
@@ -199,7 +233,7 @@ func processTokenQueue(
 					Queue:  plq,
 				}
 
-				err = launchToken(platform, cfg, t, db, lsq, plsc)
+				err = launchToken(platform, cfg, st, t, db, lsq, plsc)
 				if err != nil {
 					log.Error().Err(err).Msgf("error launching token")
 				}
@@ -218,6 +252,32 @@ func processTokenQueue(
 	}
 }
 
+// broadcastNotifications copies notifications from the state to the API and
+// any other consumers. The API receives every notification, other consumers
+// are skipped if their buffer is full so they can't block the service.
+func broadcastNotifications(
+	st *state.State,
+	ns <-chan models.Notification,
+	apiNs chan<- models.Notification,
+	others ...chan<- models.Notification,
+) {
+	for !st.ShouldStopService() {
+		select {
+		case n := <-ns:
+			apiNs <- n
+			for _, o := range others {
+				select {
+				case o <- n:
+				default:
+					log.Warn().Msgf("dropped notification: %s", n.Method)
+				}
+			}
+		case <-time.After(500 * time.Millisecond):
+			continue
+		}
+	}
+}
+
 func Start(
 	platform platforms.Platform,
 	cfg *config.UserConfig,
@@ -226,7 +286,7 @@ func Start(
 	st, ns := state.NewState(platform)
 	// TODO: convert this to a *token channel
 	itq := make(chan tokens.Token)
-	lsq := make(chan *tokens.Token)
+	lsq := make(chan *launchedSoftware)
 	plq := make(chan *playlists.Playlist)
 
 	log.Info().Msgf("Zaparoo v%s", config.Version)
@@ -238,6 +298,9 @@ func Start(
 	log.Info().Msgf("probe_device = %t", cfg.GetProbeDevice())
 	log.Info().Msgf("exit_game = %t", cfg.GetExitGame())
 	log.Info().Msgf("exit_game_blocklist = %s", cfg.GetExitGameBlocklist())
+	log.Info().Msgf("exit_game_delay_override = %s", cfg.GetExitGameDelayOverride())
+	log.Info().Msgf("exit_game_grace = %d", cfg.GetExitGameGrace())
+	log.Info().Msgf("session_time = %d", cfg.GetSessionTime())
 	log.Info().Msgf("debug = %t", cfg.GetDebug())
 
 	log.Debug().Msg("opening database")
@@ -247,8 +310,29 @@ func Start(
 		return nil, err
 	}
 
+	log.Debug().Msg("starting webhooks")
+	wns := make(chan models.Notification, 100)
+	go webhooks.Start(st, db, wns)
+	others := []chan<- models.Notification{wns}
+
+	stopMqtt := func() {}
+	if cfg.GetMqttBroker() != "" {
+		log.Debug().Msg("starting MQTT client")
+		mns := make(chan models.Notification, 100)
+		stop, err := mqtt.Start(cfg, st, itq, mns)
+		if err != nil {
+			log.Error().Err(err).Msg("error starting MQTT client")
+		} else {
+			others = append(others, mns)
+			stopMqtt = stop
+		}
+	}
+
+	apiNs := make(chan models.Notification)
+	go broadcastNotifications(st, ns, apiNs, others...)
+
 	log.Debug().Msg("starting API service")
-	go api.Start(platform, cfg, st, itq, db, ns)
+	go api.Start(platform, cfg, st, itq, db, apiNs)
 
 	log.Debug().Msg("running platform setup")
 	err = platform.Setup(cfg, st.Notifications)
@@ -268,6 +352,7 @@ func Start(
 	go processTokenQueue(platform, cfg, st, itq, db, lsq, plq)
 
 	return func() error {
+		stopMqtt()
 		err = platform.Stop()
 		if err != nil {
 			log.Warn().Msgf("error stopping platform: %s", err)
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ZaparooProject/zaparoo-core/pkg/config"
+	"github.com/ZaparooProject/zaparoo-core/pkg/launcher"
+	"github.com/ZaparooProject/zaparoo-core/pkg/platforms"
+	"github.com/ZaparooProject/zaparoo-core/pkg/service/tokens"
+	"github.com/ZaparooProject/zaparoo-core/pkg/utils"
+	"github.com/rs/zerolog/log"
+)
+
+// Named argument which can be added to any launch command to set a maximum
+// play time, in seconds, for the token.
+const sessionArg = "session"
+
+// launchedSoftware is sent to the reader manager when a token has started
+// new software. A nil value means the software has been exited.
+type launchedSoftware struct {
+	Token *tokens.Token
+	// Maximum time the software is allowed to run before it's exited, zero
+	// means there is no limit.
+	SessionTime time.Duration
+}
+
+// Return the session time for a list of token commands. The session named
+// argument on any command takes precedence over the configured default.
+func sessionTime(cfg *config.UserConfig, cmds []string) time.Duration {
+	seconds := cfg.GetSessionTime()
+
+	for _, cmd := range cmds {
+		_, namedArgs := launcher.SplitNamedArgs(cmd)
+		arg, ok := namedArgs[sessionArg]
+		if !ok {
+			continue
+		}
+
+		v, err := strconv.Atoi(arg)
+		if err != nil || v < 0 {
+			log.Warn().Msgf("invalid session time: %s", arg)
+			continue
+		}
+
+		seconds = v
+	}
+
+	return time.Duration(seconds) * time.Second
+}
+
+// Return the exit game delay for the active software, checking the per-system
+// overrides against both the active system and launcher.
+func exitGameDelay(cfg *config.UserConfig, pl platforms.Platform) time.Duration {
+	delay := cfg.GetExitGameDelay()
+
+	active := []string{
+		strings.ToLower(pl.ActiveSystem()),
+		strings.ToLower(pl.GetActiveLauncher()),
+	}
+
+	for _, v := range cfg.GetExitGameDelayOverride() {
+		ps := strings.SplitN(v, ":", 2)
+		if len(ps) != 2 {
+			log.Warn().Msgf("invalid exit game delay override: %s", v)
+			continue
+		}
+
+		id := strings.ToLower(strings.TrimSpace(ps[0]))
+		if id == "" || (id != active[0] && id != active[1]) {
+			continue
+		}
+
+		seconds, err := strconv.Atoi(strings.TrimSpace(ps[1]))
+		if err != nil || seconds < 0 {
+			log.Warn().Msgf("invalid exit game delay override: %s", v)
+			continue
+		}
+
+		log.Debug().Msgf("using exit game delay override for %s: %d", id, seconds)
+		delay = seconds
+		break
+	}
+
+	return time.Duration(delay) * time.Second
+}
+
+// Return true if the token of the running software was put back on a reader
+// within the exit game grace period after it was removed.
+func reinsertedInGrace(
+	cfg *config.UserConfig,
+	scan *tokens.Token,
+	software *tokens.Token,
+	removedAt time.Time,
+	now time.Time,
+) bool {
+	grace := time.Duration(cfg.GetExitGameGrace()) * time.Second
+	return grace > 0 &&
+		now.Sub(removedAt) <= grace &&
+		utils.TokensEqual(scan, software)
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ZaparooProject/zaparoo-core/pkg/config"
+	"github.com/ZaparooProject/zaparoo-core/pkg/service/tokens"
+)
+
+func TestSessionTime(t *testing.T) {
+	tests := []struct {
+		name     string
+		fallback int
+		cmds     []string
+		want     time.Duration
+	}{
+		{"default", 60, []string{"**launch.system:snes"}, 60 * time.Second},
+		{"no limit", 0, []string{"**launch.system:snes"}, 0},
+		{"named arg", 60, []string{"**launch.system:snes?session=30"}, 30 * time.Second},
+		{"disabled by arg", 60, []string{"**launch.system:snes?session=0"}, 0},
+		{"last arg wins", 0, []string{"**launch.system:snes?session=30", "**delay:100?session=90"}, 90 * time.Second},
+		{"invalid arg", 60, []string{"**launch.system:snes?session=abc"}, 60 * time.Second},
+		{"negative arg", 60, []string{"**launch.system:snes?session=-5"}, 60 * time.Second},
+	}
+
+	for _, tt := range tests {
+		cfg := &config.UserConfig{}
+		cfg.SetSessionTime(tt.fallback)
+
+		if got := sessionTime(cfg, tt.cmds); got != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestExitGameDelay(t *testing.T) {
+	tests := []struct {
+		name      string
+		overrides []string
+		want      time.Duration
+	}{
+		{"no overrides", nil, 5 * time.Second},
+		{"system", []string{"snes:10"}, 10 * time.Second},
+		{"launcher", []string{"retroarch:20"}, 20 * time.Second},
+		{"case and spaces", []string{" SNES : 10 "}, 10 * time.Second},
+		{"first match wins", []string{"snes:10", "retroarch:20"}, 10 * time.Second},
+		{"other system", []string{"genesis:10"}, 5 * time.Second},
+		{"zero", []string{"snes:0"}, 0},
+		{"missing seconds", []string{"snes"}, 5 * time.Second},
+		{"invalid seconds", []string{"snes:abc", "retroarch:20"}, 20 * time.Second},
+		{"negative seconds", []string{"snes:-1"}, 5 * time.Second},
+		{"empty id", []string{":10"}, 5 * time.Second},
+	}
+
+	pl := &testPlatform{system: "SNES", launcher: "RetroArch"}
+
+	for _, tt := range tests {
+		cfg := &config.UserConfig{}
+		cfg.SetExitGameDelay(5)
+		cfg.SetExitGameDelayOverride(tt.overrides)
+
+		if got := exitGameDelay(cfg, pl); got != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestReinsertedInGrace(t *testing.T) {
+	software := &tokens.Token{UID: "abcd", Text: "**launch.system:snes"}
+	other := &tokens.Token{UID: "ef01", Text: "**launch.system:genesis"}
+	removedAt := time.Now()
+
+	tests := []struct {
+		name    string
+		grace   int
+		scan    *tokens.Token
+		elapsed time.Duration
+		want    bool
+	}{
+		{"same token", 5, software, 2 * time.Second, true},
+		{"at grace limit", 5, software, 5 * time.Second, true},
+		{"after grace", 5, software, 6 * time.Second, false},
+		{"other token", 5, other, 2 * time.Second, false},
+		{"grace disabled", 0, software, 0, false},
+	}
+
+	for _, tt := range tests {
+		cfg := &config.UserConfig{}
+		cfg.SetExitGameGrace(tt.grace)
+
+		got := reinsertedInGrace(cfg, tt.scan, software, removedAt, removedAt.Add(tt.elapsed))
+		if got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+
+	cfg := &config.UserConfig{}
+	cfg.SetExitGameGrace(5)
+	if reinsertedInGrace(cfg, software, nil, removedAt, removedAt) {
+		t.Error("expected no grace without running software")
+	}
+}
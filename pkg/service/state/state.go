@@ -4,6 +4,7 @@ import (
 	"github.com/ZaparooProject/zaparoo-core/pkg/api/models"
 	"github.com/ZaparooProject/zaparoo-core/pkg/service/tokens"
 	"sync"
+	"time"
 
 	"github.com/ZaparooProject/zaparoo-core/pkg/platforms"
 	"github.com/ZaparooProject/zaparoo-core/pkg/readers"
@@ -11,6 +12,23 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
+// ReaderStats tracks activity of a connected reader since it was opened.
+type ReaderStats struct {
+	ConnectedAt   time.Time
+	Scans         int
+	Errors        int
+	LastError     string
+	LastErrorTime time.Time
+}
+
+// ReaderConflict is a device which wasn't opened because the same physical
+// device is already held by another reader.
+type ReaderConflict struct {
+	Device string
+	Path   string
+	HeldBy string
+}
+
 type State struct {
 	mu              sync.RWMutex
 	activeCard      tokens.Token // TODO: rename activeToken
@@ -19,8 +37,13 @@ type State struct {
 	disableLauncher bool
 	platform        platforms.Platform
 	readers         map[string]readers.Reader
+	readerStats     map[string]*ReaderStats
+	extraReaders    []string // connected at runtime via the API
+	disabledReaders []string // disconnected at runtime via the API
+	readerConflicts []ReaderConflict
 	softwareToken   *tokens.Token
 	wroteToken      *tokens.Token
+	confirmToken    *tokens.Token // waiting to be tapped again to run
 	Notifications   chan<- models.Notification
 }
 
@@ -29,6 +52,7 @@ func NewState(platform platforms.Platform) (*State, <-chan models.Notification)
 	return &State{
 		platform:      platform,
 		readers:       make(map[string]readers.Reader),
+		readerStats:   make(map[string]*ReaderStats),
 		Notifications: ns,
 	}, ns
 }
@@ -55,6 +79,7 @@ func (s *State) SetActiveCard(card tokens.Token) {
 			Text:     card.Text,
 			Data:     card.Data,
 			ScanTime: card.ScanTime,
+			Figure:   card.Figure,
 		},
 	}
 	s.mu.Unlock()
@@ -135,6 +160,7 @@ func (s *State) SetReader(device string, reader readers.Reader) {
 	}
 
 	s.readers[device] = reader
+	s.readerStats[device] = &ReaderStats{ConnectedAt: time.Now()}
 	s.Notifications <- models.Notification{
 		Method: models.ReadersConnected,
 		Params: device,
@@ -152,6 +178,7 @@ func (s *State) RemoveReader(device string) {
 		}
 	}
 	delete(s.readers, device)
+	delete(s.readerStats, device)
 	s.Notifications <- models.Notification{
 		Method: models.ReadersDisconnected,
 		Params: device,
@@ -171,6 +198,91 @@ func (s *State) ListReaders() []string {
 	return rs
 }
 
+// RecordReaderScan updates the stats of a reader after it has sent a scan
+// result. A nil error counts as a successful scan.
+func (s *State) RecordReaderScan(device string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats, ok := s.readerStats[device]
+	if !ok {
+		return
+	}
+
+	if err != nil {
+		stats.Errors++
+		stats.LastError = err.Error()
+		stats.LastErrorTime = time.Now()
+	} else {
+		stats.Scans++
+	}
+}
+
+func (s *State) GetReaderStats(device string) (ReaderStats, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	stats, ok := s.readerStats[device]
+	if !ok {
+		return ReaderStats{}, false
+	}
+	return *stats, true
+}
+
+// SetReaderConflicts replaces the list of devices which couldn't be opened
+// because their physical device is in use by another reader.
+func (s *State) SetReaderConflicts(conflicts []ReaderConflict) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.readerConflicts = conflicts
+}
+
+func (s *State) ListReaderConflicts() []ReaderConflict {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	cs := make([]ReaderConflict, len(s.readerConflicts))
+	copy(cs, s.readerConflicts)
+	return cs
+}
+
+// ConnectReader requests a connection to a device which isn't in the user
+// config. It will be opened by the reader manager on its next check.
+func (s *State) ConnectReader(device string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.disabledReaders = utils.Remove(s.disabledReaders, device)
+	if !utils.Contains(s.extraReaders, device) {
+		s.extraReaders = append(s.extraReaders, device)
+	}
+}
+
+// DisconnectReader closes a connected device and stops it from being
+// reconnected or auto-detected until it's requested again.
+func (s *State) DisconnectReader(device string) {
+	s.mu.Lock()
+	s.extraReaders = utils.Remove(s.extraReaders, device)
+	if !utils.Contains(s.disabledReaders, device) {
+		s.disabledReaders = append(s.disabledReaders, device)
+	}
+	s.mu.Unlock()
+
+	if _, ok := s.GetReader(device); ok {
+		s.RemoveReader(device)
+	}
+}
+
+func (s *State) ListExtraReaders() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]string(nil), s.extraReaders...)
+}
+
+func (s *State) ListDisabledReaders() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]string(nil), s.disabledReaders...)
+}
+
 func (s *State) SetSoftwareToken(token *tokens.Token) {
 	s.mu.Lock()
 	s.softwareToken = token
@@ -194,3 +306,17 @@ func (s *State) GetWroteToken() *tokens.Token {
 	defer s.mu.RUnlock()
 	return s.wroteToken
 }
+
+// SetConfirmToken sets the token which has been tapped once and needs to be
+// tapped again to run its commands, or clears it if nil.
+func (s *State) SetConfirmToken(token *tokens.Token) {
+	s.mu.Lock()
+	s.confirmToken = token
+	s.mu.Unlock()
+}
+
+func (s *State) GetConfirmToken() *tokens.Token {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.confirmToken
+}
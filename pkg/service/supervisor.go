@@ -0,0 +1,153 @@
+package service
+
+import (
+	"time"
+
+	"github.com/ZaparooProject/zaparoo-core/pkg/api/models"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers"
+	"github.com/ZaparooProject/zaparoo-core/pkg/service/state"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// readers which fail are retried after this long, doubling each time
+	// they fail again
+	readerRetryMin = 1 * time.Second
+	readerRetryMax = 1 * time.Minute
+	// how often connected readers are asked if they're still working
+	readerHealthInterval = 30 * time.Second
+)
+
+// readerSupervisor tracks readers which failed to open or stopped working,
+// so they're retried with a backoff and reported to clients instead of
+// being reconnected blindly on every check.
+type readerSupervisor struct {
+	st              *state.State
+	backoff         *readers.Backoff
+	lastHealthCheck time.Time
+	lastRetryCheck  time.Time
+}
+
+func newReaderSupervisor(st *state.State) *readerSupervisor {
+	return &readerSupervisor{
+		st:              st,
+		backoff:         readers.NewBackoff(readerRetryMin, readerRetryMax),
+		lastHealthCheck: time.Now(),
+		lastRetryCheck:  time.Now(),
+	}
+}
+
+// ready returns true if a device can be opened, it either hasn't failed or
+// its retry wait has passed.
+func (sv *readerSupervisor) ready(device string) bool {
+	return sv.backoff.Ready(device)
+}
+
+// failed records a device failing and sends a notification with the
+// reason.
+func (sv *readerSupervisor) failed(device string, err error) {
+	if err == nil {
+		err = readers.ErrNotConnected
+	}
+
+	wait := sv.backoff.Fail(device)
+	failures := sv.backoff.Failures(device)
+	log.Warn().Err(err).Msgf("reader %s failed %d times, retrying in %s", device, failures, wait)
+
+	sv.st.Notifications <- models.Notification{
+		Method: models.ReadersError,
+		Params: models.ReaderErrorParams{
+			Device:   device,
+			Error:    err.Error(),
+			Failures: failures,
+			Retry:    int(wait.Seconds()),
+		},
+	}
+}
+
+// devicesChanged lets all failed devices be retried immediately, because
+// a device which was missing may have been plugged in.
+func (sv *readerSupervisor) devicesChanged() {
+	sv.backoff.Clear()
+}
+
+// prune removes readers which have closed themselves, reporting why. It
+// returns true if any were removed.
+func (sv *readerSupervisor) prune() bool {
+	pruned := false
+
+	for _, device := range sv.st.ListReaders() {
+		r, ok := sv.st.GetReader(device)
+		if ok && r != nil && !r.Connected() {
+			log.Debug().Msgf("pruning disconnected reader: %s", device)
+			sv.failed(device, r.Health())
+			sv.st.RemoveReader(device)
+			pruned = true
+		}
+	}
+
+	return pruned
+}
+
+// checkHealth runs the health check of every connected reader, if it's
+// due, and removes readers which fail so they're reopened. Readers which
+// pass have their failures forgotten. It returns true if any readers were
+// removed.
+func (sv *readerSupervisor) checkHealth() bool {
+	if time.Since(sv.lastHealthCheck) < readerHealthInterval {
+		return false
+	}
+	sv.lastHealthCheck = time.Now()
+
+	removed := false
+
+	for _, device := range sv.st.ListReaders() {
+		r, ok := sv.st.GetReader(device)
+		if !ok || r == nil {
+			continue
+		}
+
+		err := r.Health()
+		if err != nil {
+			sv.failed(device, err)
+			sv.st.RemoveReader(device)
+			removed = true
+			continue
+		}
+
+		sv.backoff.Reset(device)
+	}
+
+	return removed
+}
+
+// retryDue returns true if the retry wait of a failed device has ended since
+// the last check. Devices which are only found by auto-detection need it to
+// run again to be retried.
+func (sv *readerSupervisor) retryDue() bool {
+	now := time.Now()
+	due := sv.backoff.Expired(sv.lastRetryCheck, now)
+	sv.lastRetryCheck = now
+	return due
+}
+
+// check removes readers which stopped working and returns true if readers
+// should be auto-detected, because one was removed or a failed device can
+// be retried.
+func (sv *readerSupervisor) check() bool {
+	detect := false
+
+	// the device of a removed reader may have been unplugged without an
+	// event, or be ready to be detected again
+	if sv.prune() {
+		detect = true
+	}
+	if sv.checkHealth() {
+		detect = true
+	}
+	if sv.retryDue() {
+		detect = true
+	}
+
+	return detect
+}
@@ -0,0 +1,216 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ZaparooProject/zaparoo-core/pkg/config"
+	"github.com/ZaparooProject/zaparoo-core/pkg/platforms"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers"
+	"github.com/ZaparooProject/zaparoo-core/pkg/service/state"
+	"github.com/ZaparooProject/zaparoo-core/pkg/service/tokens"
+)
+
+// testPlatform implements the parts of a platform used by the service, any
+// other method panics.
+type testPlatform struct {
+	platforms.Platform
+	readers  []readers.Reader
+	system   string
+	launcher string
+}
+
+func (p *testPlatform) ActiveSystem() string      { return p.system }
+func (p *testPlatform) GetActiveLauncher() string { return p.launcher }
+
+func (p *testPlatform) SupportedReaders(*config.UserConfig) []readers.Reader {
+	return p.readers
+}
+
+func (p *testPlatform) ReadersUpdateHook(map[string]*readers.Reader) error {
+	return nil
+}
+
+// detectReader is an auto-detected reader whose device fails to open a
+// number of times before it works.
+type detectReader struct {
+	mu        sync.Mutex
+	device    string
+	openFails int
+	opened    bool
+}
+
+func (r *detectReader) Ids() []string { return []string{"test"} }
+
+func (r *detectReader) Open(device string, _ chan<- readers.Scan) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.openFails > 0 {
+		r.openFails--
+		return errors.New("device not ready")
+	}
+
+	r.opened = true
+	return nil
+}
+
+func (r *detectReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.opened = false
+	return nil
+}
+
+func (r *detectReader) Detect(connected []string) string {
+	for _, c := range connected {
+		if c == r.device {
+			return ""
+		}
+	}
+	return r.device
+}
+
+func (r *detectReader) Device() string { return r.device }
+
+func (r *detectReader) Connected() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.opened
+}
+
+func (r *detectReader) Info() string  { return "test" }
+func (r *detectReader) Health() error { return nil }
+func (r *detectReader) CancelWrite()  {}
+
+func (r *detectReader) Write(string, readers.WriteOptions, func(readers.WriteStatus)) (*tokens.Token, error) {
+	return nil, errors.New("writing not supported on this reader")
+}
+
+func (r *detectReader) Capabilities() readers.Capabilities {
+	return readers.Capabilities{}
+}
+
+// newTestState returns a state whose notifications are discarded.
+func newTestState(t *testing.T) *state.State {
+	t.Helper()
+
+	st, ns := state.NewState(nil)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ns:
+			case <-done:
+				return
+			}
+		}
+	}()
+	t.Cleanup(func() {
+		st.StopService()
+		close(done)
+	})
+
+	return st
+}
+
+func newTestSupervisor(st *state.State) *readerSupervisor {
+	return &readerSupervisor{
+		st:              st,
+		backoff:         readers.NewBackoff(50*time.Millisecond, time.Second),
+		lastHealthCheck: time.Now(),
+		lastRetryCheck:  time.Now(),
+	}
+}
+
+// waitCheck runs supervisor checks until one asks for detection.
+func waitCheck(t *testing.T, sv *readerSupervisor) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !sv.check() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for detection to be retried")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestDetectRetriedAfterOpenFails(t *testing.T) {
+	st := newTestState(t)
+	sv := newTestSupervisor(st)
+	r := &detectReader{device: "test:1", openFails: 1}
+	pl := &testPlatform{readers: []readers.Reader{r}}
+	cfg := &config.UserConfig{}
+
+	err := connectReaders(pl, cfg, st, nil, sv, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := st.GetReader("test:1"); ok {
+		t.Fatal("expected failed reader to not be connected")
+	}
+
+	if sv.check() {
+		t.Fatal("expected no detection while the device is waiting to retry")
+	}
+
+	waitCheck(t, sv)
+
+	err = connectReaders(pl, cfg, st, nil, sv, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := st.GetReader("test:1"); !ok {
+		t.Fatal("expected reader to be connected after retry")
+	}
+}
+
+func TestDetectRetriedAfterPrune(t *testing.T) {
+	st := newTestState(t)
+	sv := newTestSupervisor(st)
+	r := &detectReader{device: "test:1"}
+	pl := &testPlatform{readers: []readers.Reader{r}}
+	cfg := &config.UserConfig{}
+
+	err := connectReaders(pl, cfg, st, nil, sv, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := st.GetReader("test:1"); !ok {
+		t.Fatal("expected reader to be connected")
+	}
+
+	// reader glitches and closes itself
+	_ = r.Close()
+
+	if !sv.check() {
+		t.Fatal("expected detection after pruning a reader")
+	}
+
+	// the pruned device is waiting to retry, so it's skipped
+	err = connectReaders(pl, cfg, st, nil, sv, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := st.GetReader("test:1"); ok {
+		t.Fatal("expected pruned reader to wait before reconnecting")
+	}
+
+	waitCheck(t, sv)
+
+	err = connectReaders(pl, cfg, st, nil, sv, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := st.GetReader("test:1"); !ok {
+		t.Fatal("expected reader to be reconnected after retry")
+	}
+}
@@ -2,6 +2,9 @@ package tokens
 
 import (
 	"time"
+
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/figures"
+	"github.com/ZaparooProject/zaparoo-core/pkg/readers/ndef"
 )
 
 const (
@@ -9,6 +12,7 @@ const (
 	TypeMifare         = "MIFARE"
 	TypeAmiibo         = "Amiibo"
 	TypeLegoDimensions = "LegoDimensions"
+	TypeType4          = "Type4"
 	SourcePlaylist     = "Playlist"
 )
 
@@ -20,4 +24,8 @@ type Token struct {
 	ScanTime time.Time
 	Remote   bool
 	Source   string
+	// Records contains all NDEF records found on the token.
+	Records []ndef.Record
+	// Figure is the decoded character of an Amiibo or Lego Dimensions token.
+	Figure *figures.Figure
 }
@@ -88,6 +88,17 @@ func Contains[T comparable](xs []T, x T) bool {
 	return false
 }
 
+// Remove returns a copy of slice with all instances of value removed.
+func Remove[T comparable](xs []T, x T) []T {
+	var res []T
+	for _, v := range xs {
+		if v != x {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
 // MapKeys returns a list of all keys in a map.
 func MapKeys[K comparable, V any](m map[K]V) []K {
 	keys := make([]K, len(m))
@@ -169,6 +180,13 @@ func RandomElem[T any](xs []T) (T, error) {
 	}
 }
 
+// Shuffle randomises the order of a slice in place.
+func Shuffle[T any](xs []T) {
+	r.Shuffle(len(xs), func(i, j int) {
+		xs[i], xs[j] = xs[j], xs[i]
+	})
+}
+
 func CopyFile(sourcePath, destPath string) error {
 	inputFile, err := os.Open(sourcePath)
 	if err != nil {